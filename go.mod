@@ -6,6 +6,7 @@ require (
 	cloud.google.com/go v0.62.0 // indirect
 	cloud.google.com/go/pubsub v1.6.1
 	cloud.google.com/go/storage v1.10.0
+	github.com/aws/aws-sdk-go v1.31.12
 	github.com/blang/semver/v4 v4.0.0
 	github.com/davecgh/go-spew v1.1.1
 	github.com/go-git/go-git-fixtures/v4 v4.0.1
@@ -20,6 +20,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"knative.dev/test-infra/kntest/pkg/cluster/gke"
+	"knative.dev/test-infra/kntest/pkg/cluster/kind"
 )
 
 func AddCommands(topLevel *cobra.Command) {
@@ -29,6 +30,7 @@ func AddCommands(topLevel *cobra.Command) {
 	}
 
 	gke.AddCommands(clusterCmd)
+	kind.AddCommands(clusterCmd)
 
 	topLevel.AddCommand(clusterCmd)
 }
@@ -17,7 +17,11 @@ limitations under the License.
 package gke
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 
@@ -38,11 +42,15 @@ func AddCommands(clusterCmd *cobra.Command) {
 	addCommonOptions(gkeCmd, rw)
 	addCreate(gkeCmd, rw)
 	addDelete(gkeCmd, rw)
+	addHeartbeat(gkeCmd, rw)
 	addGet(gkeCmd, rw)
+	addUpgrade(gkeCmd, rw)
+	addResize(gkeCmd, rw)
 	clusterCmd.AddCommand(gkeCmd)
 }
 
 func addCreate(cc *cobra.Command, rw *clm.RequestWrapper) {
+	co := &createOptions{}
 	var createCmd = &cobra.Command{
 		Use:   "create",
 		Short: "Create a GKE cluster.",
@@ -55,12 +63,18 @@ func addCreate(cc *cobra.Command, rw *clm.RequestWrapper) {
 			if len(regions) > 1 {
 				rw.Request.BackupRegions = regions[1:]
 			}
-			if _, err := clm.Create(rw); err != nil {
+			gkeOps, err := clm.Create(rw)
+			if err != nil {
 				log.Fatalf("Error creating the cluster: %v", err)
 			}
+			if co.heartbeat && gkeOps.IsBoskos() {
+				if err := startHeartbeat(rw, gkeOps); err != nil {
+					log.Fatalf("Error keeping the lease of the project alive: %v", err)
+				}
+			}
 		},
 	}
-	addCreateOptions(createCmd, rw)
+	addCreateOptions(createCmd, rw, co)
 	cc.AddCommand(createCmd)
 }
 
@@ -77,6 +91,28 @@ func addDelete(clusterCmd *cobra.Command, rw *clm.RequestWrapper) {
 	clusterCmd.AddCommand(deleteCmd)
 }
 
+func addHeartbeat(clusterCmd *cobra.Command, rw *clm.RequestWrapper) {
+	var heartbeatCmd = &cobra.Command{
+		Use:   "heartbeat",
+		Short: "Keep the lease of the Boskos project of the current GKE cluster alive until it's deleted.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+			go func() {
+				<-sigs
+				cancel()
+			}()
+			if err := clm.Heartbeat(ctx, rw); err != nil {
+				log.Fatalf("Error keeping the lease of the project alive: %v", err)
+			}
+		},
+	}
+	clusterCmd.AddCommand(heartbeatCmd)
+}
+
 func addGet(clusterCmd *cobra.Command, rw *clm.RequestWrapper) {
 	var getCmd = &cobra.Command{
 		Use:   "get",
@@ -89,3 +125,42 @@ func addGet(clusterCmd *cobra.Command, rw *clm.RequestWrapper) {
 	}
 	clusterCmd.AddCommand(getCmd)
 }
+
+func addUpgrade(clusterCmd *cobra.Command, rw *clm.RequestWrapper) {
+	uo := &upgradeOptions{}
+	var upgradeCmd = &cobra.Command{
+		Use:   "upgrade",
+		Short: "Upgrade the master of the current GKE cluster, then its node pools.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			// nil upgrades all the node pools
+			var nodePools []string
+			if uo.skipNodes {
+				nodePools = []string{}
+			} else if len(uo.nodePools) != 0 {
+				nodePools = uo.nodePools
+			}
+			if _, err := clm.Upgrade(rw, uo.version, nodePools); err != nil {
+				log.Fatalf("Error upgrading the cluster: %v", err)
+			}
+		},
+	}
+	addUpgradeOptions(upgradeCmd, uo)
+	clusterCmd.AddCommand(upgradeCmd)
+}
+
+func addResize(clusterCmd *cobra.Command, rw *clm.RequestWrapper) {
+	req := &gke.ResizeRequest{}
+	var resizeCmd = &cobra.Command{
+		Use:   "resize",
+		Short: "Resize a node pool of the current GKE cluster.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if _, err := clm.Resize(rw, *req); err != nil {
+				log.Fatalf("Error resizing the cluster: %v", err)
+			}
+		},
+	}
+	addResizeOptions(resizeCmd, req)
+	clusterCmd.AddCommand(resizeCmd)
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gke
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	clm "knative.dev/test-infra/pkg/clustermanager/e2e-tests"
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/gke"
+)
+
+// startHeartbeat starts `kntest cluster gke heartbeat` detached, so that the
+// lease of the Boskos project of the cluster is kept alive once create exits,
+// until delete releases the project
+func startHeartbeat(rw *clm.RequestWrapper, gkeOps *gke.GKECluster) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed getting the kntest executable: %w", err)
+	}
+	req := rw.Request
+	// The heartbeat finds the cluster from its kubeconfig, and the project
+	// from the cluster, like delete does.
+	args := []string{"cluster", "gke", "heartbeat", "--kubeconfig", gkeOps.Kubeconfig}
+	for _, flag := range []struct{ name, value string }{
+		{"--gcp-credential-file", req.GCPCredentialFile},
+		{"--boskos-url", req.BoskosURL},
+		{"--protection-policy", req.ProtectionPolicy},
+	} {
+		if flag.value != "" {
+			args = append(args, flag.name, flag.value)
+		}
+	}
+
+	logPath := filepath.Join(os.TempDir(), "kntest", fmt.Sprintf("heartbeat-%s.log", gkeOps.Project))
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return fmt.Errorf("failed creating the directory of the heartbeat log: %w", err)
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed opening the heartbeat log: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed starting the heartbeat: %w", err)
+	}
+	log.Printf("Keeping the lease of Boskos project %q alive in process %d until the cluster is deleted, logging to %q",
+		gkeOps.Project, cmd.Process.Pid, logPath)
+	// The heartbeat isn't waited for, it outlives create.
+	return cmd.Process.Release()
+}
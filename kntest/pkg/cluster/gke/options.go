@@ -20,8 +20,19 @@ import (
 	"github.com/spf13/cobra"
 
 	clm "knative.dev/test-infra/pkg/clustermanager/e2e-tests"
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/gke"
 )
 
+type createOptions struct {
+	heartbeat bool
+}
+
+type upgradeOptions struct {
+	version   string
+	nodePools []string
+	skipNodes bool
+}
+
 func addCommonOptions(clusterCmd *cobra.Command, rw *clm.RequestWrapper) {
 	pf := clusterCmd.PersistentFlags()
 	req := &rw.Request
@@ -33,10 +44,18 @@ func addCommonOptions(clusterCmd *cobra.Command, rw *clm.RequestWrapper) {
 	pf.StringVar(&req.ClusterName, "name", "", "cluster name")
 	pf.StringSliceVar(&rw.Regions, "region", []string{}, "GCP regions, separated by comma or multiple args")
 	pf.StringVar(&req.ResourceType, "resource-type", "", "Boskos Resource Type")
+	pf.StringVar(&req.BoskosReleaseState, "boskos-release-state", "", "state the Boskos project is released to on delete, \"dirty\" if empty, "+
+		"e.g. \"free\" if it doesn't need to be cleaned up")
+	pf.StringVar(&req.BoskosURL, "boskos-url", "", "URL of the Boskos server to acquire the GCP project from if no project is given, e.g. a local Boskos server, "+
+		"the URL in BOSKOS_URL or the Boskos of the Prow cluster if empty")
 	pf.BoolVar(&req.SaveMetaData, "save-meta-data", false, "save meta data for the created cluster into a file")
+	pf.StringVar(&req.ProtectionPolicy, "protection-policy", "", "protection policy file the operations are checked against, "+
+		"the default protection policy if empty, see config/protection/policy.yaml")
+	pf.StringVar(&req.Kubeconfig, "kubeconfig", "", "dedicated kubeconfig file to look up the cluster from and write its credentials to, "+
+		"a default file per cluster under the temporary directory if empty, recorded in the meta data for the following commands")
 }
 
-func addCreateOptions(clusterCmd *cobra.Command, rw *clm.RequestWrapper) {
+func addCreateOptions(clusterCmd *cobra.Command, rw *clm.RequestWrapper, co *createOptions) {
 	pf := clusterCmd.Flags()
 	req := &rw.Request
 	// The default values set here are not used in the final operations,
@@ -45,7 +64,31 @@ func addCreateOptions(clusterCmd *cobra.Command, rw *clm.RequestWrapper) {
 	pf.Int64Var(&req.MinNodes, "min-nodes", 0, "minimal number of nodes")
 	pf.Int64Var(&req.MaxNodes, "max-nodes", 0, "maximal number of nodes")
 	pf.StringVar(&req.NodeType, "node-type", "", "node type")
+	pf.StringSliceVar(&req.BackupNodeTypes, "backup-node-types", []string{}, "node types to try in the same region if the node type is out of stock, separated by comma")
+	pf.StringVar(&req.FailureClasses, "failure-classes", "", "failure classes file the cluster creation failures are classified and retried with, "+
+		"the default failure classes if empty, see config/failure/classes.yaml")
 	pf.StringVar(&req.ReleaseChannel, "release-channel", "", "GKE release channel")
 	pf.StringVar(&req.GKEVersion, "version", "", "GKE version")
 	pf.StringSliceVar(&req.Addons, "addons", []string{}, "addons to be added, separated by comma")
+	pf.DurationVar(&req.TTL, "ttl", 0, "how long the cluster lives before it can be reaped, 24h if 0, never expires if negative")
+	pf.StringSliceVar(&req.BackupResourceTypes, "backup-resource-types", []string{}, "Boskos resource types to acquire the GCP project from, in order, "+
+		"if there is no free project of the resource type, separated by comma")
+	pf.StringVar(&req.BoskosProject, "boskos-project", "", "name of the Boskos project to acquire instead of any free project of the resource types")
+	pf.BoolVar(&co.heartbeat, "heartbeat", true, "keep the lease of the Boskos project alive in a detached heartbeat process once create exits, "+
+		"until delete releases the project")
+}
+
+func addUpgradeOptions(clusterCmd *cobra.Command, uo *upgradeOptions) {
+	pf := clusterCmd.Flags()
+	pf.StringVar(&uo.version, "version", "latest", "GKE version to upgrade the master to, e.g. 1.17, 1.17.9-gke.1504 or latest")
+	pf.StringSliceVar(&uo.nodePools, "node-pools", []string{}, "node pools to upgrade to the master version after the master, all the node pools if empty")
+	pf.BoolVar(&uo.skipNodes, "skip-nodes", false, "only upgrade the master")
+}
+
+func addResizeOptions(clusterCmd *cobra.Command, req *gke.ResizeRequest) {
+	pf := clusterCmd.Flags()
+	pf.StringVar(&req.NodePool, "node-pool", "default-pool", "node pool to resize")
+	pf.Int64Var(&req.NumNodes, "num-nodes", -1, "number of nodes to resize the node pool to, not resized if negative")
+	pf.Int64Var(&req.MinNodes, "min-nodes", 0, "minimal number of nodes for autoscaling")
+	pf.Int64Var(&req.MaxNodes, "max-nodes", 0, "maximal number of nodes for autoscaling, autoscaling isn't changed if 0")
 }
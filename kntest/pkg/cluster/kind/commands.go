@@ -0,0 +1,84 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kind
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+
+	clm "knative.dev/test-infra/pkg/clustermanager/e2e-tests"
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/kind"
+)
+
+// AddCommands adds kind subcommands.
+func AddCommands(clusterCmd *cobra.Command) {
+	var kindCmd = &cobra.Command{
+		Use:   "kind",
+		Short: "kind (Kubernetes in Docker) related commands.",
+	}
+
+	req := &kind.KindRequest{}
+	addCommonOptions(kindCmd, req)
+	addCreate(kindCmd, req)
+	addDelete(kindCmd, req)
+	addGet(kindCmd, req)
+	clusterCmd.AddCommand(kindCmd)
+}
+
+func addCreate(cc *cobra.Command, req *kind.KindRequest) {
+	var createCmd = &cobra.Command{
+		Use:   "create",
+		Short: "Create a kind cluster, or reuse the existing one with the same name.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if _, err := clm.CreateKind(*req); err != nil {
+				log.Fatalf("Error creating the cluster: %v", err)
+			}
+		},
+	}
+	addCreateOptions(createCmd, req)
+	cc.AddCommand(createCmd)
+}
+
+func addDelete(clusterCmd *cobra.Command, req *kind.KindRequest) {
+	var deleteCmd = &cobra.Command{
+		Use:   "delete",
+		Short: "Delete the kind cluster.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := clm.DeleteKind(*req); err != nil {
+				log.Fatalf("Error deleting the cluster: %v", err)
+			}
+		},
+	}
+	clusterCmd.AddCommand(deleteCmd)
+}
+
+func addGet(clusterCmd *cobra.Command, req *kind.KindRequest) {
+	var getCmd = &cobra.Command{
+		Use:   "get",
+		Short: "Get the existing kind cluster and export its kubeconfig.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if _, err := clm.GetKind(*req); err != nil {
+				log.Fatalf("Error getting the cluster: %v", err)
+			}
+		},
+	}
+	clusterCmd.AddCommand(getCmd)
+}
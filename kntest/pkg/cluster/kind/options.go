@@ -0,0 +1,43 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kind
+
+import (
+	"github.com/spf13/cobra"
+
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/kind"
+)
+
+func addCommonOptions(clusterCmd *cobra.Command, req *kind.KindRequest) {
+	pf := clusterCmd.PersistentFlags()
+	// The default values set here are not used in the final operations,
+	// they will further be defaulted in kind.KindClient.Setup
+	pf.StringVar(&req.ClusterName, "name", "", "cluster name")
+	pf.StringVar(&req.Kubeconfig, "kubeconfig", "", "kubeconfig file to export the cluster to, default to the kubeconfig of kubectl")
+	pf.BoolVar(&req.SaveMetaData, "save-meta-data", false, "save meta data for the cluster into a file")
+}
+
+func addCreateOptions(clusterCmd *cobra.Command, req *kind.KindRequest) {
+	pf := clusterCmd.Flags()
+	pf.IntVar(&req.ControlPlaneNodes, "control-plane-nodes", 0, "number of control plane nodes")
+	pf.IntVar(&req.WorkerNodes, "worker-nodes", 0, "number of worker nodes")
+	pf.StringVar(&req.NodeImage, "image", "", "node image, e.g. kindest/node:v1.18.8")
+	pf.StringVar(&req.WaitTimeout, "wait", "", "how long to wait for the control plane to be ready")
+	pf.BoolVar(&req.Registry, "registry", false, "run a local registry the nodes can pull images from")
+	pf.StringVar(&req.RegistryName, "registry-name", "", "name of the container of the local registry")
+	pf.IntVar(&req.RegistryPort, "registry-port", 0, "port of the local registry on localhost")
+}
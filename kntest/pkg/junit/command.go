@@ -17,14 +17,22 @@ limitations under the License.
 package junit
 
 import (
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"os"
+	"regexp"
+	"strings"
 
 	"github.com/spf13/cobra"
 
 	"knative.dev/test-infra/pkg/junit"
 )
 
+// stdio is the file name used to read from stdin or write to stdout.
+const stdio = "-"
+
 type option struct {
 	suite  string
 	name   string
@@ -45,13 +53,14 @@ func AddCommands(topLevel *cobra.Command) {
 	var junitCmd = &cobra.Command{
 		Use:   "junit",
 		Short: "Commands for manipulating junit formatted xml files.",
+		Long: "Commands for manipulating junit formatted xml files.\n" +
+			"Without a subcommand, it creates a junit xml file with a single testcase.",
 		Run: func(cmd *cobra.Command, args []string) {
 			suites := junit.TestSuites{}
 			suite := junit.TestSuite{Name: opt.suite}
 			tc := junit.TestCase{Name: opt.name}
 			if opt.errMsg != "" {
-				// errMsg := html.EscapeString(errMsg)
-				tc.Failure = &opt.errMsg
+				tc.Failure = &junit.Result{Value: opt.errMsg}
 			}
 			suite.AddTestCase(tc)
 			// Ignore the error as it only happens if the test suite name already exists.
@@ -67,5 +76,186 @@ func AddCommands(topLevel *cobra.Command) {
 	}
 
 	addOptions(junitCmd, opt)
+	addConvertCommand(junitCmd)
+	addMergeCommand(junitCmd)
+	addFilterCommand(junitCmd)
+	addSummaryCommand(junitCmd)
 	topLevel.AddCommand(junitCmd)
 }
+
+func addConvertCommand(junitCmd *cobra.Command) {
+	var from, input, dest, suite string
+	var convertCmd = &cobra.Command{
+		Use:   "convert",
+		Short: "Convert `go test -json` or TAP output to junit xml.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			r, err := openInput(input)
+			if err != nil {
+				log.Fatalf("Error opening %q: %v", input, err)
+			}
+			defer r.Close()
+
+			var suites *junit.TestSuites
+			switch from {
+			case "go-test-json":
+				suites, err = junit.ParseGoTestJSON(r)
+			case "tap":
+				suites, err = junit.ParseTAP(r, suite)
+			default:
+				log.Fatalf("Unsupported input format %q, must be one of go-test-json, tap", from)
+			}
+			if err != nil {
+				log.Fatalf("Error converting %q: %v", input, err)
+			}
+			writeSuites(suites, dest)
+		},
+	}
+	pf := convertCmd.Flags()
+	pf.StringVar(&from, "from", "go-test-json", "Format of the input, one of go-test-json, tap")
+	pf.StringVar(&input, "input", stdio, "File to read from, - means stdin")
+	pf.StringVar(&dest, "dest", stdio, "Where junit xml writes to, - means stdout")
+	pf.StringVar(&suite, "suite", "tap", "Name of suite, only used for TAP input")
+	junitCmd.AddCommand(convertCmd)
+}
+
+func addMergeCommand(junitCmd *cobra.Command) {
+	var dest string
+	var mergeCmd = &cobra.Command{
+		Use:   "merge [files...]",
+		Short: "Merge junit xml files into one, keeping only the last run of rerun tests.",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			writeSuites(mergeFiles(args), dest)
+		},
+	}
+	mergeCmd.Flags().StringVar(&dest, "dest", stdio, "Where junit xml writes to, - means stdout")
+	junitCmd.AddCommand(mergeCmd)
+}
+
+func addFilterCommand(junitCmd *cobra.Command) {
+	var keep, drop, dest string
+	var statuses []string
+	var filterCmd = &cobra.Command{
+		Use:   "filter [files...]",
+		Short: "Keep or drop junit testcases by name or status.",
+		Long: "Keep or drop junit testcases by name or status.\n" +
+			"Names are matched as <suite>.<test>. The files are merged first if there are more than one.",
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			keepFunc, err := newFilter(keep, drop, statuses)
+			if err != nil {
+				log.Fatal(err)
+			}
+			writeSuites(mergeFiles(args).Filter(keepFunc), dest)
+		},
+	}
+	pf := filterCmd.Flags()
+	pf.StringVar(&keep, "keep", "", "Regex of testcases to keep, empty means all")
+	pf.StringVar(&drop, "drop", "", "Regex of testcases to drop, applied after --keep")
+	pf.StringSliceVar(&statuses, "status", []string{}, "Statuses of testcases to keep, any of passed, failed, errored, skipped")
+	pf.StringVar(&dest, "dest", stdio, "Where junit xml writes to, - means stdout")
+	junitCmd.AddCommand(filterCmd)
+}
+
+func addSummaryCommand(junitCmd *cobra.Command) {
+	var slowest int
+	var summaryCmd = &cobra.Command{
+		Use:   "summary [files...]",
+		Short: "Print the test counts and slowest tests, exit with 1 if any test failed.",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			s := mergeFiles(args).Summarize(slowest)
+			printSummary(os.Stdout, s)
+			if s.Failed+s.Errored > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+	summaryCmd.Flags().IntVar(&slowest, "slowest", 10, "Number of slowest tests to print")
+	junitCmd.AddCommand(summaryCmd)
+}
+
+// newFilter creates the function used to select testcases from the flags of
+// the filter command.
+func newFilter(keep, drop string, statuses []string) (func(*junit.TestSuite, *junit.TestCase) bool, error) {
+	var keepRe, dropRe *regexp.Regexp
+	var err error
+	if keep != "" {
+		if keepRe, err = regexp.Compile(keep); err != nil {
+			return nil, fmt.Errorf("invalid --keep regex %q: %w", keep, err)
+		}
+	}
+	if drop != "" {
+		if dropRe, err = regexp.Compile(drop); err != nil {
+			return nil, fmt.Errorf("invalid --drop regex %q: %w", drop, err)
+		}
+	}
+	wanted := make(map[junit.TestStatusEnum]bool, len(statuses))
+	for _, s := range statuses {
+		status := junit.TestStatusEnum(strings.ToLower(s))
+		switch status {
+		case junit.Passed, junit.Failed, junit.Errored, junit.Skipped:
+			wanted[status] = true
+		default:
+			return nil, fmt.Errorf("invalid --status %q", s)
+		}
+	}
+
+	return func(suite *junit.TestSuite, tc *junit.TestCase) bool {
+		name := suite.Name + "." + tc.Name
+		if keepRe != nil && !keepRe.MatchString(name) {
+			return false
+		}
+		if dropRe != nil && dropRe.MatchString(name) {
+			return false
+		}
+		return len(wanted) == 0 || wanted[tc.GetTestStatus()]
+	}, nil
+}
+
+func printSummary(w io.Writer, s *junit.Summary) {
+	fmt.Fprintf(w, "%d tests, %d passed, %d failed, %d errored, %d skipped in %.3fs\n",
+		s.Tests, s.Passed, s.Failed, s.Errored, s.Skipped, s.Time)
+	if len(s.Failures) != 0 {
+		fmt.Fprintln(w, "\nFailed tests:")
+		for _, r := range s.Failures {
+			fmt.Fprintf(w, "  %s (%s)\n", r.FullName(), r.GetTestStatus())
+		}
+	}
+	if len(s.Slowest) != 0 {
+		fmt.Fprintf(w, "\nSlowest %d tests:\n", len(s.Slowest))
+		for _, r := range s.Slowest {
+			fmt.Fprintf(w, "  %8.3fs %s\n", r.Seconds(), r.FullName())
+		}
+	}
+}
+
+func mergeFiles(paths []string) *junit.TestSuites {
+	suites, err := junit.MergeFiles(paths...)
+	if err != nil {
+		log.Fatalf("Error reading junit files: %v", err)
+	}
+	return suites
+}
+
+func openInput(path string) (io.ReadCloser, error) {
+	if path == stdio {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+func writeSuites(suites *junit.TestSuites, dest string) {
+	contents, err := suites.ToBytes("", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if dest == stdio {
+		os.Stdout.Write(append(contents, '\n'))
+		return
+	}
+	if err := ioutil.WriteFile(dest, contents, 0644); err != nil {
+		log.Fatalf("Error writing to file %q: %v", dest, err)
+	}
+}
@@ -28,11 +28,17 @@ func addOptions(gkeCmd *cobra.Command, cfg *kubetest2.GKEClusterConfig) {
 	f.StringVar(&cfg.Environment, "environment", "prod", "The GKE environment, must be one of prod, staging, staging2 and test.")
 	f.StringVar(&cfg.CommandGroup, "command-group", "beta", "The gcloud command group, must be alpha, beta or empty.")
 	f.StringVar(&cfg.GCPProjectID, "gcp-project-id", "", "GCP project ID for creating the cluster")
+	f.StringSliceVar(&cfg.BoskosResourceTypes, "boskos-resource-types", []string{}, "The Boskos resource types to acquire the GCP project from in CI, in order, "+
+		"if --gcp-project-id is empty, gke-project if empty.")
+	f.StringVar(&cfg.BoskosProject, "boskos-project", "", "The name of the Boskos project to acquire in CI if --gcp-project-id is empty, "+
+		"instead of any free project of the resource types.")
+	f.StringVar(&cfg.BoskosReleaseState, "boskos-release-state", "", "The state the Boskos project is released to, dirty if empty.")
 
 	f.StringVar(&cfg.Name, "name", "", "The GKE cluster name.")
 	f.StringVar(&cfg.Region, "region", "us-central1", "The region to create the GKE cluster.")
 	f.StringSliceVar(&cfg.BackupRegions, "backup-regions", []string{"us-west1", "us-east1"}, "The backup regions if the cluster creation runs into stockout issue in the primary region.")
 	f.StringVar(&cfg.Machine, "machine", "e2-standard-4", "The machine type for the GKE cluster.")
+	f.StringSliceVar(&cfg.BackupMachines, "backup-machines", []string{}, "The backup machine types if the cluster creation runs into stockout issue of the machine type in a region.")
 	f.IntVar(&cfg.MinNodes, "min-nodes", 1, "The minimum number of nodes.")
 	f.IntVar(&cfg.MaxNodes, "max-nodes", 3, "The maximum number of nodes.")
 	f.StringVar(&cfg.Network, "network", "e2e-network", "The network name for the GKE cluster.")
@@ -43,8 +49,11 @@ func addOptions(gkeCmd *cobra.Command, cfg *kubetest2.GKEClusterConfig) {
 	f.StringVar(&cfg.Addons, "addons", "", "Addons for the GKE cluster, should be comma-separated.")
 	f.BoolVar(&cfg.EnableWorkloadIdentity, "enable-workload-identity", false, "Whether to enable workload identity for this cluster or not.")
 	f.StringVar(&cfg.PrivateClusterAccessLevel, "private-cluster-access-level", "", "Private cluster access level, if not empty, must be one of 'no', 'limited' or 'unrestricted'")
-	f.StringVar(&cfg.PrivateClusterMasterIPSubnetRange, "private-cluster-master-ip-subnet-range", "172.16.0", "The master IP subnet range for the private cluster. The last digit must be left empty to allow retrying cluster creation in the backup regions.")
+	f.StringVar(&cfg.PrivateClusterMasterIPSubnetRange, "private-cluster-master-ip-subnet-range", "172.16.0", "The master IP subnet range for the private cluster. The last digit must be left empty to allow retrying cluster creation, it's the number of the attempt.")
 	f.StringVar(&cfg.PrivateClusterMasterIPSubnetMask, "private-cluster-master-ip-subnet-mask", "28", "The master IP subnet mask for the private cluster.")
 
+	f.DurationVar(&cfg.TTL, "ttl", 0, "How long the cluster lives before it can be reaped, 24h if 0, never expires if negative.")
 	f.StringVar(&cfg.ExtraGcloudFlags, "extra-gcloud-flags", "", "The extra gcloud flags that will be used for cluster creation.")
+	f.StringVar(&cfg.FailureClasses, "failure-classes", "", "The failure classes file the cluster creation failures are classified and retried with, "+
+		"the default failure classes in config/failure/classes.yaml if empty.")
 }
@@ -24,6 +24,16 @@ import (
 
 func addOptions(kubetest2Cmd *cobra.Command, opts *kubetest2.Options) {
 	pf := kubetest2Cmd.PersistentFlags()
-	pf.StringVar(&opts.TestCommand, "test-command", "", "test command for running the tests")
+	pf.StringVar(&opts.TestCommand, "test-command", "", "test command for running the tests with the exec tester, its arguments can be quoted")
 	pf.BoolVar(&opts.SaveMetaData, "save-meta-data", true, "whether or not to save cluster info into metadata.json")
+	pf.StringVar((*string)(&opts.Tester), "tester", "", "tester for running the tests, exec or ginkgo, exec if empty and --test-command is set")
+	pf.BoolVar(&opts.Down, "down", false, "whether or not to tear down the cluster after the tests, even if the cluster creation or the tests fail")
+	pf.StringVar(&opts.ArtifactsDir, "artifacts", "", "directory for the kubetest2 artifacts and the JUnit results of the up, test and down phases, the Prow artifacts directory if empty")
+
+	pf.StringVar(&opts.Ginkgo.FocusRegex, "ginkgo-focus-regex", "", "regex of the tests to run with the ginkgo tester")
+	pf.StringVar(&opts.Ginkgo.SkipRegex, "ginkgo-skip-regex", "", "regex of the tests to skip with the ginkgo tester")
+	pf.IntVar(&opts.Ginkgo.Parallel, "ginkgo-parallel", 0, "number of tests run in parallel by the ginkgo tester")
+	pf.IntVar(&opts.Ginkgo.FlakeAttempts, "ginkgo-flake-attempts", 0, "number of attempts of a failed test with the ginkgo tester")
+	pf.StringVar(&opts.Ginkgo.TestPackageVersion, "ginkgo-test-package-version", "", "version of the Kubernetes test package used by the ginkgo tester")
+	pf.StringVar(&opts.Ginkgo.TestArgs, "ginkgo-test-args", "", "extra arguments passed to the e2e.test binary by the ginkgo tester")
 }
@@ -18,9 +18,17 @@ package boskos
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
 	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/common"
 
 	boskosclient "sigs.k8s.io/boskos/client"
@@ -30,26 +38,114 @@ import (
 const (
 	// GKEProjectResource is resource type defined for GKE projects
 	GKEProjectResource = "gke-project"
+	// URLEnv is the environment variable overriding the Boskos URL, e.g. to use
+	// a local Boskos server outside of the Prow cluster
+	URLEnv = "BOSKOS_URL"
 )
 
 var (
+	// boskosURI is the URL of Boskos in the Prow cluster, used by default
 	boskosURI = "http://boskos.test-pods.svc.cluster.local."
-	// Keep Boskos for 2 hours, which will be used to release Boskos resource
-	// only when a job forgot or failed to release Boskos, which shouldn't
-	// happen that often. Using this can avoid keeping "heartbeat" which is
-	// almost not doable for Go
+	// Keep waiting for a free project for 2 hours at most
 	defaultWaitDuration = 2 * time.Hour
+	// Update the acquired projects every 5 minutes, so that the Boskos reaper
+	// doesn't reclaim them while tests are still running
+	defaultHeartbeatInterval = 5 * time.Minute
+	// Interval between the attempts to acquire a project of multiple types
+	acquirePollInterval = 10 * time.Second
 )
 
+// ErrLeaseLost is returned when Boskos doesn't know the project or it isn't
+// owned by the client anymore, e.g. it was released or reclaimed by the
+// Boskos reaper. The other errors updating a project, e.g. Boskos being
+// unavailable, are transient.
+var ErrLeaseLost = errors.New("lease of the GKE project lost")
+
 // Operation defines actions for handling GKE resources
 type Operation interface {
-	AcquireGKEProject(string) (*boskoscommon.Resource, error)
-	ReleaseGKEProject(string) error
+	// AcquireGKEProject acquires a free project of the resource type, and
+	// keeps its lease alive until it's released
+	AcquireGKEProject(resType string) (*boskoscommon.Resource, error)
+	// AcquireGKEProjectFromTypes acquires a free project of the first resource
+	// type having one, in order, and keeps its lease alive until it's released
+	AcquireGKEProjectFromTypes(ctx context.Context, resTypes []string) (*boskoscommon.Resource, error)
+	// AcquireGKEProjectByName acquires the project with the name once it's
+	// free, and keeps its lease alive until it's released
+	AcquireGKEProjectByName(ctx context.Context, name string) (*boskoscommon.Resource, error)
+	// ResumeGKEProject takes over the lease of a project the owner of the
+	// client acquired before, e.g. before a restart, and keeps it alive
+	ResumeGKEProject(name string) error
+	// HeartbeatGKEProject keeps the lease of a project the owner of the
+	// client acquired alive in the foreground, until ctx is done or the
+	// project is released
+	HeartbeatGKEProject(ctx context.Context, name string) error
+	// ReleaseGKEProject releases the project to the release state of the
+	// client, "dirty" by default, and stops keeping its lease alive
+	ReleaseGKEProject(name string) error
+	// ReleaseGKEProjectToState releases the project to the state, and stops
+	// keeping its lease alive
+	ReleaseGKEProjectToState(name, state string) error
 }
 
+var _ Operation = (*Client)(nil)
+
 // Client a wrapper around k8s boskos client that implements Operation
 type Client struct {
 	*boskosclient.Client
+
+	// url is the URL of the Boskos server
+	url string
+	// ctx stops all the heartbeats once done
+	ctx               context.Context
+	releaseState      string
+	heartbeatInterval time.Duration
+	waitDuration      time.Duration
+	// heartbeats stop the heartbeat of each acquired project
+	heartbeats map[string]context.CancelFunc
+	mutex      sync.Mutex
+}
+
+// ClientOption configures a Client
+type ClientOption func(*Client)
+
+// WithURL sets the URL of the Boskos server, e.g. http://localhost:8080 for a
+// local Boskos server. The URL in the BOSKOS_URL environment variable is used
+// if it's empty, then the URL of Boskos in the Prow cluster.
+func WithURL(url string) ClientOption {
+	return func(c *Client) {
+		c.url = url
+	}
+}
+
+// WithReleaseState sets the state the projects are released to, e.g.
+// boskoscommon.Free if they don't need to be cleaned up
+func WithReleaseState(state string) ClientOption {
+	return func(c *Client) {
+		c.releaseState = state
+	}
+}
+
+// WithHeartbeatInterval sets the interval between the updates keeping the
+// leases alive, heartbeats are disabled if interval isn't positive
+func WithHeartbeatInterval(interval time.Duration) ClientOption {
+	return func(c *Client) {
+		c.heartbeatInterval = interval
+	}
+}
+
+// WithContext sets the context of the heartbeats, all the heartbeats stop
+// once it's done
+func WithContext(ctx context.Context) ClientOption {
+	return func(c *Client) {
+		c.ctx = ctx
+	}
+}
+
+// WithWaitDuration sets how long AcquireGKEProject waits for a free project
+func WithWaitDuration(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.waitDuration = d
+	}
 }
 
 // NewClient creates a boskos Client with GKE operation. The owner of any resources acquired
@@ -57,25 +153,50 @@ type Client struct {
 // authentication for boskos client where pass is a password file. `user` and `pass` fields
 // are passed directly to k8s boskos client. Refer to
 // [k8s boskos](https://github.com/kubernetes/test-infra/tree/master/boskos) for more details.
-// If host is "", it looks up JOB_NAME environment variable and set it to be the host name.
-func NewClient(host string, user string, pass string) (*Client, error) {
+// If host is "", it looks up JOB_NAME environment variable and set it to be the host name,
+// or the name of the machine if it's not set either.
+// The Boskos server is the one in the Prow cluster unless set with WithURL or BOSKOS_URL.
+func NewClient(host string, user string, pass string, opts ...ClientOption) (*Client, error) {
 	if host == "" {
 		host = common.GetOSEnv("JOB_NAME")
 	}
+	if host == "" {
+		// Outside of Prow, e.g. with a local Boskos server, which requires
+		// an owner as well
+		host, _ = os.Hostname()
+	}
 
-	c, err := boskosclient.NewClient(host, boskosURI, user, pass)
+	client := &Client{
+		ctx:               context.Background(),
+		releaseState:      boskoscommon.Dirty,
+		heartbeatInterval: defaultHeartbeatInterval,
+		waitDuration:      defaultWaitDuration,
+		heartbeats:        make(map[string]context.CancelFunc),
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	if client.url == "" {
+		client.url = common.GetOSEnv(URLEnv)
+	}
+	if client.url == "" {
+		client.url = boskosURI
+	}
+
+	c, err := boskosclient.NewClient(host, client.url, user, pass)
 	if err != nil {
 		return nil, err
 	}
-
-	return &Client{c}, nil
+	client.Client = c
+	return client, nil
 }
 
 // AcquireGKEProject acquires GKE Boskos Project with "free" state, and not
 // owned by anyone, sets its state to "busy" and assign it an owner of *host,
-// which by default is env var `JOB_NAME`.
+// which by default is env var `JOB_NAME`. Its lease is kept alive until it's
+// released.
 func (c *Client) AcquireGKEProject(resType string) (*boskoscommon.Resource, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultWaitDuration)
+	ctx, cancel := context.WithTimeout(context.Background(), c.waitDuration)
 	defer cancel()
 	p, err := c.AcquireWait(ctx, resType, boskoscommon.Free, boskoscommon.Busy)
 	if err != nil {
@@ -84,17 +205,185 @@ func (c *Client) AcquireGKEProject(resType string) (*boskoscommon.Resource, erro
 	if p == nil {
 		return nil, fmt.Errorf("boskos does not have a free %s at the moment", resType)
 	}
+	c.startHeartbeat(p.Name)
 	return p, nil
 }
 
+// AcquireGKEProjectFromTypes acquires a free project of the first resource
+// type having one, in order, e.g. a project of a dedicated type then a project
+// of the shared type. It keeps trying until ctx is done.
+func (c *Client) AcquireGKEProjectFromTypes(ctx context.Context, resTypes []string) (*boskoscommon.Resource, error) {
+	if len(resTypes) == 0 {
+		return nil, errors.New("no resource type to acquire a GKE project from")
+	}
+	for {
+		for _, resType := range resTypes {
+			p, err := c.Acquire(resType, boskoscommon.Free, boskoscommon.Busy)
+			if err == nil && p != nil {
+				c.startHeartbeat(p.Name)
+				return p, nil
+			}
+			// Try the next type if there is no free project of this type.
+			if err != nil && err != boskosclient.ErrNotFound && err != boskosclient.ErrAlreadyInUse {
+				return nil, fmt.Errorf("boskos failed to acquire GKE project of type %q: %w", resType, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("boskos does not have a free project of types %v: %w", resTypes, ctx.Err())
+		case <-time.After(acquirePollInterval):
+		}
+	}
+}
+
+// AcquireGKEProjectByName waits until the project with the name is free and
+// acquires it, or ctx is done.
+func (c *Client) AcquireGKEProjectByName(ctx context.Context, name string) (*boskoscommon.Resource, error) {
+	ps, err := c.AcquireByStateWait(ctx, boskoscommon.Free, boskoscommon.Busy, []string{name})
+	if err != nil {
+		return nil, fmt.Errorf("boskos failed to acquire GKE project %q: %w", name, err)
+	}
+	if len(ps) != 1 {
+		return nil, fmt.Errorf("boskos returned %d projects acquiring GKE project %q", len(ps), name)
+	}
+	c.startHeartbeat(name)
+	return &ps[0], nil
+}
+
+// ResumeGKEProject checks that the project is still busy and owned by the
+// host of the client, e.g. when it was acquired by the same host before a
+// restart, and keeps its lease alive until it's released. It returns an error
+// if the lease was lost, e.g. reclaimed by the Boskos reaper.
+func (c *Client) ResumeGKEProject(name string) error {
+	if err := c.updateLease(name); err != nil {
+		return fmt.Errorf("boskos failed to resume GKE project %q: %w", name, err)
+	}
+	c.startHeartbeat(name)
+	return nil
+}
+
+// HeartbeatGKEProject keeps the lease of the project acquired by the owner of
+// the client alive in the foreground, until ctx is done or the project is
+// released, e.g. by another process deleting the cluster. Unlike the heartbeat
+// of the acquiring client, it outlives the process acquiring the project, so it
+// runs in a process of its own for the whole tests. It returns an error
+// wrapping ErrLeaseLost if the project isn't owned by the client to begin with,
+// the transient errors are only logged.
+func (c *Client) HeartbeatGKEProject(ctx context.Context, name string) error {
+	if err := c.updateLease(name); err != nil {
+		return fmt.Errorf("boskos failed to update GKE project %q: %w", name, err)
+	}
+	interval := c.heartbeatInterval
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := c.updateLease(name); errors.Is(err, ErrLeaseLost) {
+				log.Printf("Stopping the heartbeat of Boskos project %q, it was released", name)
+				return nil
+			} else if err != nil {
+				log.Printf("Failed updating the lease of Boskos project %q: '%v'", name, err)
+			}
+		}
+	}
+}
+
 // ReleaseGKEProject releases project, the host must match with the host name that acquired
 // the project, which by default is env var `JOB_NAME`. The state is set to
-// "dirty" for Janitor picking up.
+// the release state of the client, "dirty" by default for Janitor picking up.
 // This function is very powerful, it can release Boskos resource acquired by
 // other processes, regardless of where the other process is running.
 func (c *Client) ReleaseGKEProject(name string) error {
-	if err := c.Release(name, boskoscommon.Dirty); err != nil {
+	return c.ReleaseGKEProjectToState(name, c.releaseState)
+}
+
+// ReleaseGKEProjectToState releases project like ReleaseGKEProject, and sets
+// its state to state.
+func (c *Client) ReleaseGKEProjectToState(name, state string) error {
+	c.stopHeartbeat(name)
+	if err := c.Release(name, state); err != nil {
 		return fmt.Errorf("boskos failed to release GKE project %q: %w", name, err)
 	}
 	return nil
 }
+
+// startHeartbeat updates the project in the background until it's released
+// or the context of the client is done, so that its lease doesn't expire
+func (c *Client) startHeartbeat(name string) {
+	if c.heartbeatInterval <= 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.heartbeats[name]; ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.heartbeats[name] = cancel
+	go func() {
+		ticker := time.NewTicker(c.heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.updateLease(name); errors.Is(err, ErrLeaseLost) {
+					log.Printf("Stopping the heartbeat of Boskos project %q: '%v'", name, err)
+					c.stopHeartbeat(name)
+					return
+				} else if err != nil {
+					log.Printf("Failed updating the lease of Boskos project %q: '%v'", name, err)
+				}
+			}
+		}
+	}()
+}
+
+// updateLease updates the project to keep its lease alive. The error wraps
+// ErrLeaseLost if Boskos doesn't know the project or it isn't owned by the
+// client.
+func (c *Client) updateLease(name string) error {
+	// Update doesn't require the project in the local storage of the client,
+	// unlike UpdateOne, as resumed projects aren't
+	err := c.Update(name, boskoscommon.Busy, nil)
+	if err != nil && isLeaseLost(err) {
+		return fmt.Errorf("%w: %v", ErrLeaseLost, err)
+	}
+	return err
+}
+
+// isLeaseLost tells whether Boskos rejected the update as it doesn't know the
+// project or the owner doesn't match. The Boskos client only reports the
+// status code in the messages of the aggregated errors of its attempts.
+func isLeaseLost(err error) bool {
+	var agg utilerrors.Aggregate
+	if !errors.As(err, &agg) {
+		return false
+	}
+	for _, e := range agg.Errors() {
+		msg := e.Error()
+		for _, code := range []int{http.StatusUnauthorized, http.StatusNotFound} {
+			if strings.Contains(msg, fmt.Sprintf("status code %d ", code)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stopHeartbeat stops the heartbeat of the project if any
+func (c *Client) stopHeartbeat(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if cancel, ok := c.heartbeats[name]; ok {
+		cancel()
+		delete(c.heartbeats, name)
+	}
+}
@@ -17,12 +17,20 @@ limitations under the License.
 package boskos
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	boskosclient "sigs.k8s.io/boskos/client"
+	boskoscommon "sigs.k8s.io/boskos/common"
+
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/boskos/server"
 	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/common"
 )
 
@@ -157,3 +165,360 @@ func TestReleaseGKEProject(t *testing.T) {
 		})
 	}
 }
+
+func TestReleaseGKEProjectToState(t *testing.T) {
+	var requests []string
+	ts := fakeServer(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.RequestURI)
+	})
+	defer ts.Close()
+	oldBoskosURI := boskosURI
+	defer func() {
+		boskosURI = oldBoskosURI
+	}()
+	boskosURI = ts.URL
+
+	client, err := NewClient(fakeHost, "", "", WithReleaseState(boskoscommon.Free))
+	if err != nil {
+		t.Fatalf("Failed to create test client %v", err)
+	}
+	if err := client.ReleaseGKEProject("a"); err != nil {
+		t.Fatalf("Unexpected error when releasing GKE project, '%v'", err)
+	}
+	if err := client.ReleaseGKEProjectToState("b", boskoscommon.Cleaning); err != nil {
+		t.Fatalf("Unexpected error when releasing GKE project, '%v'", err)
+	}
+	want := []string{"/release?dest=free&name=a&owner=fakehost", "/release?dest=cleaning&name=b&owner=fakehost"}
+	if strings.Join(requests, ",") != strings.Join(want, ",") {
+		t.Fatalf("Request URIs don't match: want: %v, got: %v", want, requests)
+	}
+}
+
+func TestAcquireGKEProjectFromTypes(t *testing.T) {
+	var requests []string
+	ts := fakeServer(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Query().Get("type"))
+		if r.URL.Query().Get("type") == "t" {
+			fmt.Fprint(w, fakeRes)
+			return
+		}
+		http.Error(w, "Not Found", http.StatusNotFound)
+	})
+	defer ts.Close()
+	oldBoskosURI := boskosURI
+	defer func() {
+		boskosURI = oldBoskosURI
+	}()
+	boskosURI = ts.URL
+
+	client, err := NewClient(fakeHost, "", "", WithHeartbeatInterval(0))
+	if err != nil {
+		t.Fatalf("Failed to create test client %v", err)
+	}
+	p, err := client.AcquireGKEProjectFromTypes(context.Background(), []string{"dedicated", "t"})
+	if err != nil {
+		t.Fatalf("Unexpected error when acquiring GKE project, '%v'", err)
+	}
+	if p.Name != "res" || strings.Join(requests, ",") != "dedicated,t" {
+		t.Fatalf("Expected project 'res' after trying types [dedicated t], but got %q after trying %v", p.Name, requests)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.AcquireGKEProjectFromTypes(ctx, []string{"dedicated"}); err == nil {
+		t.Fatal("No expected error when acquiring GKE project of a type without free project.")
+	}
+}
+
+func TestAcquireGKEProjectByName(t *testing.T) {
+	ts := fakeServer(func(w http.ResponseWriter, r *http.Request) {
+		for _, s := range []string{"/acquirebystate?", "names=res", "state=free", "dest=busy"} {
+			if !strings.Contains(r.RequestURI, s) {
+				t.Errorf("Request URI = %q, want: %q", r.RequestURI, s)
+			}
+		}
+		fmt.Fprint(w, "["+fakeRes+"]")
+	})
+	defer ts.Close()
+	oldBoskosURI := boskosURI
+	defer func() {
+		boskosURI = oldBoskosURI
+	}()
+	boskosURI = ts.URL
+
+	client, err := NewClient(fakeHost, "", "", WithHeartbeatInterval(0))
+	if err != nil {
+		t.Fatalf("Failed to create test client %v", err)
+	}
+	p, err := client.AcquireGKEProjectByName(context.Background(), "res")
+	if err != nil {
+		t.Fatalf("Unexpected error when acquiring GKE project, '%v'", err)
+	}
+	if p.Name != "res" {
+		t.Fatalf("Expected project 'res', but got %q", p.Name)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	var mutex sync.Mutex
+	updates := 0
+	ts := fakeServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/acquire":
+			fmt.Fprint(w, fakeRes)
+		case "/update":
+			if !strings.Contains(r.RequestURI, "name=res") || !strings.Contains(r.RequestURI, "state=busy") {
+				t.Errorf("Request URI = %q, want an update of 'res' to busy", r.RequestURI)
+			}
+			mutex.Lock()
+			updates++
+			mutex.Unlock()
+		}
+	})
+	defer ts.Close()
+	oldBoskosURI := boskosURI
+	defer func() {
+		boskosURI = oldBoskosURI
+	}()
+	boskosURI = ts.URL
+	getUpdates := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return updates
+	}
+
+	client, err := NewClient(fakeHost, "", "", WithHeartbeatInterval(5*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create test client %v", err)
+	}
+	if _, err := client.AcquireGKEProject("t"); err != nil {
+		t.Fatalf("Unexpected error when acquiring GKE project, '%v'", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if getUpdates() == 0 {
+		t.Fatal("Expected the lease of the project to be updated, but it wasn't")
+	}
+	// The heartbeat stops on release.
+	if err := client.ReleaseGKEProject("res"); err != nil {
+		t.Fatalf("Unexpected error when releasing GKE project, '%v'", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	released := getUpdates()
+	time.Sleep(50 * time.Millisecond)
+	if got := getUpdates(); got != released {
+		t.Fatalf("Expected no update after releasing the project, but got %d", got-released)
+	}
+}
+
+func TestResumeGKEProject(t *testing.T) {
+	var mutex sync.Mutex
+	updates := 0
+	ts := fakeServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/release" {
+			return
+		}
+		if r.URL.Path != "/update" || r.URL.Query().Get("owner") != fakeHost || r.URL.Query().Get("state") != "busy" {
+			t.Errorf("Request URI = %q, want an update to busy by %q", r.RequestURI, fakeHost)
+		}
+		// Only "res" is still owned by the host
+		switch r.URL.Query().Get("name") {
+		case "res":
+		case "unavailable":
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		default:
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mutex.Lock()
+		updates++
+		mutex.Unlock()
+	})
+	defer ts.Close()
+	oldBoskosURI := boskosURI
+	defer func() {
+		boskosURI = oldBoskosURI
+	}()
+	boskosURI = ts.URL
+	// Don't wait between the retries of the failed updates
+	oldSleepFunc := boskosclient.SleepFunc
+	defer func() {
+		boskosclient.SleepFunc = oldSleepFunc
+	}()
+	boskosclient.SleepFunc = func(time.Duration) {}
+	getUpdates := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return updates
+	}
+
+	client, err := NewClient(fakeHost, "", "", WithHeartbeatInterval(5*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create test client %v", err)
+	}
+	if err := client.ResumeGKEProject("reclaimed"); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("Expected the lease to be lost resuming GKE project not owned anymore, but got '%v'", err)
+	}
+	// Boskos being unavailable doesn't mean the lease is lost.
+	if err := client.ResumeGKEProject("unavailable"); err == nil || errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("Expected a transient error resuming GKE project, but got '%v'", err)
+	}
+	if err := client.ResumeGKEProject("res"); err != nil {
+		t.Fatalf("Unexpected error when resuming GKE project, '%v'", err)
+	}
+	// The lease of the resumed project is kept alive, although it wasn't
+	// acquired by the client.
+	time.Sleep(50 * time.Millisecond)
+	if got := getUpdates(); got < 2 {
+		t.Fatalf("Expected the lease of the project to be updated, but got %d updates", got)
+	}
+	if err := client.ReleaseGKEProject("res"); err != nil {
+		t.Fatalf("Unexpected error when releasing GKE project, '%v'", err)
+	}
+}
+
+func TestHeartbeatGKEProject(t *testing.T) {
+	var mutex sync.Mutex
+	updates := 0
+	ts := fakeServer(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch r.URL.Query().Get("name") {
+		case "res":
+			updates++
+			// The project is released after a few updates, and its owner
+			// doesn't match anymore. The updates failing in between are
+			// transient.
+			if updates == 2 {
+				http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			} else if updates > 3 {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			}
+		default:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		}
+	})
+	defer ts.Close()
+	oldBoskosURI := boskosURI
+	defer func() {
+		boskosURI = oldBoskosURI
+	}()
+	boskosURI = ts.URL
+	oldSleepFunc := boskosclient.SleepFunc
+	defer func() {
+		boskosclient.SleepFunc = oldSleepFunc
+	}()
+	boskosclient.SleepFunc = func(time.Duration) {}
+
+	client, err := NewClient(fakeHost, "", "", WithHeartbeatInterval(time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create test client %v", err)
+	}
+	if err := client.HeartbeatGKEProject(context.Background(), "unknown"); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("Expected the lease to be lost for an unknown GKE project, but got '%v'", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- client.HeartbeatGKEProject(context.Background(), "res")
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Unexpected error keeping the lease of GKE project alive, '%v'", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the heartbeat to stop once the project is released")
+	}
+
+	// The heartbeat stops once the context is done too.
+	mutex.Lock()
+	updates = 0
+	mutex.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		done <- client.HeartbeatGKEProject(ctx, "res")
+	}()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Unexpected error keeping the lease of GKE project alive, '%v'", err)
+	}
+}
+
+func TestURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []ClientOption
+		env    string
+		expURL string
+	}{
+		{"Test default URL", nil, "", boskosURI},
+		{"Test URL from env", nil, "http://localhost:8080", "http://localhost:8080"},
+		{"Test URL from option", []ClientOption{WithURL("http://localhost:9090")}, "http://localhost:8080", "http://localhost:9090"},
+	}
+	oldGetOSEnv := common.GetOSEnv
+	defer func() {
+		common.GetOSEnv = oldGetOSEnv
+	}()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			common.GetOSEnv = func(s string) string {
+				if s == URLEnv {
+					return tt.env
+				}
+				return oldGetOSEnv(s)
+			}
+			client, err := NewClient(fakeHost, "", "", tt.opts...)
+			if err != nil {
+				t.Fatalf("Failed to create test client %v", err)
+			}
+			if client.url != tt.expURL {
+				t.Fatalf("Expected URL %q, but got %q", tt.expURL, client.url)
+			}
+		})
+	}
+}
+
+func TestLocalServer(t *testing.T) {
+	s, err := server.NewServer(&boskoscommon.BoskosConfig{Resources: []boskoscommon.ResourceEntry{
+		{Type: GKEProjectResource, State: boskoscommon.Free, Names: []string{"project-a", "project-b"}},
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error when creating the local server, '%v'", err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	client, err := NewClient(fakeHost, "", "", WithURL(ts.URL), WithHeartbeatInterval(5*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create test client %v", err)
+	}
+	p, err := client.AcquireGKEProject(GKEProjectResource)
+	if err != nil {
+		t.Fatalf("Unexpected error when acquiring GKE project, '%v'", err)
+	}
+	acquired := s.Resources()[0]
+	if p.Name != "project-a" || acquired.State != boskoscommon.Busy || acquired.Owner != fakeHost {
+		t.Fatalf("Expected project-a busy and owned by %q, but got %+v", fakeHost, acquired)
+	}
+
+	// The heartbeat keeps the lease alive.
+	time.Sleep(50 * time.Millisecond)
+	if updated := s.Resources()[0]; !updated.LastUpdate.After(acquired.LastUpdate) {
+		t.Fatalf("Expected the lease of the project to be updated after %v, but got %v", acquired.LastUpdate, updated.LastUpdate)
+	}
+	metric, err := client.Metric(GKEProjectResource)
+	if err != nil {
+		t.Fatalf("Unexpected error when getting the metric, '%v'", err)
+	}
+	if metric.Current[boskoscommon.Busy] != 1 || metric.Current[boskoscommon.Free] != 1 {
+		t.Fatalf("Expected 1 busy and 1 free project, but got %v", metric.Current)
+	}
+
+	if err := client.ReleaseGKEProject(p.Name); err != nil {
+		t.Fatalf("Unexpected error when releasing GKE project, '%v'", err)
+	}
+	if released := s.Resources()[0]; released.State != boskoscommon.Dirty || released.Owner != "" {
+		t.Fatalf("Expected project-a dirty and not owned, but got %+v", released)
+	}
+}
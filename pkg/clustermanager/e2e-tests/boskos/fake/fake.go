@@ -17,7 +17,10 @@ limitations under the License.
 package fake
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	boskoscommon "sigs.k8s.io/boskos/common"
 
@@ -28,9 +31,18 @@ const (
 	fakeOwner = "fake-owner"
 )
 
+var _ boskos.Operation = (*FakeBoskosClient)(nil)
+
 // FakeBoskosClient implements boskos.Operation
 type FakeBoskosClient struct {
+	// ReleaseState is the state ReleaseGKEProject releases the projects to,
+	// "free" if empty so that tests can acquire them again
+	ReleaseState string
+
 	resources []*boskoscommon.Resource
+	// heartbeats are the projects whose lease is kept alive
+	heartbeats map[string]bool
+	mutex      sync.Mutex
 }
 
 func (c *FakeBoskosClient) getOwner(host *string) string {
@@ -41,30 +53,119 @@ func (c *FakeBoskosClient) getOwner(host *string) string {
 }
 
 func (c *FakeBoskosClient) GetResources() []*boskoscommon.Resource {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	return c.resources
 }
 
-// AcquireGKEProject fakes to be no op
+// Heartbeating checks if the lease of the project is kept alive, i.e. it's
+// acquired and not released yet
+func (c *FakeBoskosClient) Heartbeating(name string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.heartbeats[name]
+}
+
+// AcquireGKEProject acquires a free project of the resource type
 func (c *FakeBoskosClient) AcquireGKEProject(resType string) (*boskoscommon.Resource, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	for _, res := range c.resources {
-		if res.State == boskoscommon.Free {
-			res.State = boskoscommon.Busy
-			res.Owner = c.getOwner(nil)
-			res.Type = resType
-			return res, nil
+		if res.Type == resType && res.State == boskoscommon.Free {
+			return c.acquire(res), nil
 		}
 	}
 	return nil, fmt.Errorf("no GKE project available")
 }
 
-// ReleaseGKEProject fakes to be no op
+// AcquireGKEProjectFromTypes acquires a free project of the first resource
+// type having one. Unlike Boskos, it doesn't wait for a project to be free.
+func (c *FakeBoskosClient) AcquireGKEProjectFromTypes(ctx context.Context, resTypes []string) (*boskoscommon.Resource, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, resType := range resTypes {
+		for _, res := range c.resources {
+			if res.Type == resType && res.State == boskoscommon.Free {
+				return c.acquire(res), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no GKE project of types %v available", resTypes)
+}
+
+// AcquireGKEProjectByName acquires the project if it's free. Unlike Boskos,
+// it doesn't wait for the project to be free.
+func (c *FakeBoskosClient) AcquireGKEProjectByName(ctx context.Context, name string) (*boskoscommon.Resource, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, res := range c.resources {
+		if res.Name == name {
+			if res.State != boskoscommon.Free {
+				return nil, fmt.Errorf("GKE project %q is %s", name, res.State)
+			}
+			return c.acquire(res), nil
+		}
+	}
+	return nil, fmt.Errorf("resource doesn't exist yet: '%s'", name)
+}
+
+// ResumeGKEProject keeps the lease of the project alive if it's still owned
+func (c *FakeBoskosClient) ResumeGKEProject(name string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.checkOwned(name); err != nil {
+		return err
+	}
+	if c.heartbeats == nil {
+		c.heartbeats = make(map[string]bool)
+	}
+	c.heartbeats[name] = true
+	return nil
+}
+
+// HeartbeatGKEProject waits until the project is released or ctx is done, if
+// it's owned
+func (c *FakeBoskosClient) HeartbeatGKEProject(ctx context.Context, name string) error {
+	owned := func() error {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		return c.checkOwned(name)
+	}
+	if err := owned(); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Millisecond):
+			if owned() != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// ReleaseGKEProject releases the project to ReleaseState
 func (c *FakeBoskosClient) ReleaseGKEProject(name string) error {
+	state := c.ReleaseState
+	if state == "" {
+		state = boskoscommon.Free
+	}
+	return c.ReleaseGKEProjectToState(name, state)
+}
+
+// ReleaseGKEProjectToState releases the project to the state
+func (c *FakeBoskosClient) ReleaseGKEProjectToState(name, state string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	owner := c.getOwner(nil)
 	for _, res := range c.resources {
 		if res.Name == name {
 			if res.Owner == owner {
 				res.Owner = ""
-				res.State = boskoscommon.Free
+				res.State = state
+				delete(c.heartbeats, name)
 				return nil
 			} else {
 				return fmt.Errorf("Got owner: '%s', expect owner: '%s'", res.Owner, owner)
@@ -76,9 +177,42 @@ func (c *FakeBoskosClient) ReleaseGKEProject(name string) error {
 
 // NewGKEProject adds Boskos resources for testing purpose
 func (c *FakeBoskosClient) NewGKEProject(name string) {
+	c.NewResource(name, boskos.GKEProjectResource)
+}
+
+// NewResource adds a free Boskos resource of the type for testing purpose
+func (c *FakeBoskosClient) NewResource(name, resType string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	c.resources = append(c.resources, &boskoscommon.Resource{
-		Type:  boskos.GKEProjectResource,
+		Type:  resType,
 		Name:  name,
 		State: boskoscommon.Free,
 	})
 }
+
+// checkOwned returns an error wrapping boskos.ErrLeaseLost unless the project
+// is busy and owned by the owner of the client, the caller must hold the mutex
+func (c *FakeBoskosClient) checkOwned(name string) error {
+	owner := c.getOwner(nil)
+	for _, res := range c.resources {
+		if res.Name == name {
+			if res.State != boskoscommon.Busy || res.Owner != owner {
+				return fmt.Errorf("%w: GKE project %q is %s and owned by '%s'", boskos.ErrLeaseLost, name, res.State, res.Owner)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: resource doesn't exist yet: '%s'", boskos.ErrLeaseLost, name)
+}
+
+// acquire marks the resource as acquired, the caller must hold the mutex
+func (c *FakeBoskosClient) acquire(res *boskoscommon.Resource) *boskoscommon.Resource {
+	res.State = boskoscommon.Busy
+	res.Owner = c.getOwner(nil)
+	if c.heartbeats == nil {
+		c.heartbeats = make(map[string]bool)
+	}
+	c.heartbeats[res.Name] = true
+	return res
+}
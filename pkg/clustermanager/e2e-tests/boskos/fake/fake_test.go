@@ -0,0 +1,81 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	boskoscommon "sigs.k8s.io/boskos/common"
+
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/boskos"
+)
+
+func TestFakeBoskosClient(t *testing.T) {
+	ctx := context.Background()
+	c := &FakeBoskosClient{}
+	c.NewGKEProject("shared-0")
+	c.NewResource("dedicated-0", "dedicated")
+
+	p, err := c.AcquireGKEProjectFromTypes(ctx, []string{"dedicated", "gke-project"})
+	if err != nil || p.Name != "dedicated-0" || !c.Heartbeating(p.Name) {
+		t.Fatalf("Expected to acquire 'dedicated-0' and keep its lease alive, but got %+v, '%v'", p, err)
+	}
+	p, err = c.AcquireGKEProjectFromTypes(ctx, []string{"dedicated", "gke-project"})
+	if err != nil || p.Name != "shared-0" {
+		t.Fatalf("Expected to fall back to 'shared-0', but got %+v, '%v'", p, err)
+	}
+	if _, err := c.AcquireGKEProject("gke-project"); err == nil {
+		t.Fatal("Expected an error acquiring a project while none is free, but got nil")
+	}
+
+	if err := c.ReleaseGKEProjectToState("dedicated-0", boskoscommon.Dirty); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if c.Heartbeating("dedicated-0") {
+		t.Fatal("Expected the lease of 'dedicated-0' not to be kept alive after its release")
+	}
+	if _, err := c.AcquireGKEProjectByName(ctx, "dedicated-0"); err == nil {
+		t.Fatal("Expected an error acquiring a dirty project, but got nil")
+	}
+	if err := c.ResumeGKEProject("dedicated-0"); !errors.Is(err, boskos.ErrLeaseLost) {
+		t.Fatalf("Expected the lease to be lost resuming a released project, but got '%v'", err)
+	}
+	if err := c.HeartbeatGKEProject(ctx, "dedicated-0"); !errors.Is(err, boskos.ErrLeaseLost) {
+		t.Fatalf("Expected the lease to be lost keeping a released project alive, but got '%v'", err)
+	}
+	if err := c.ResumeGKEProject("shared-0"); err != nil || !c.Heartbeating("shared-0") {
+		t.Fatalf("Expected to resume the lease of 'shared-0', but got '%v'", err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- c.HeartbeatGKEProject(ctx, "shared-0")
+	}()
+	// Release the project once the heartbeat is running.
+	time.Sleep(10 * time.Millisecond)
+	if err := c.ReleaseGKEProject("shared-0"); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Expected the heartbeat to stop once 'shared-0' is released, but got '%v'", err)
+	}
+	if p, err := c.AcquireGKEProjectByName(ctx, "shared-0"); err != nil || p.State != boskoscommon.Busy {
+		t.Fatalf("Expected to acquire 'shared-0' again, but got %+v, '%v'", p, err)
+	}
+}
@@ -0,0 +1,393 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package server is a Boskos-compatible HTTP server keeping the resources in
+// memory, so that the acquire, heartbeat and release cycle of the Boskos
+// clients can be run and tested outside of the Prow cluster.
+//
+// It serves the endpoints the Boskos clients use: /acquire, /acquirebystate,
+// /release, /update, /reset and /metric. Unlike Boskos, it doesn't persist
+// the resources, doesn't support dynamic resources, and doesn't queue the
+// acquire requests by request ID.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	boskoscommon "sigs.k8s.io/boskos/common"
+)
+
+// Errors of the operations, mapped to the status codes Boskos returns
+var (
+	// ErrNotFound is returned when no resource matches, like Boskos it's also
+	// returned when the resource type doesn't exist
+	ErrNotFound = errors.New("resource not found")
+	// ErrOwnerMismatch is returned when the resource is owned by someone else
+	ErrOwnerMismatch = errors.New("owner mismatch")
+	// ErrStateMismatch is returned when the resource isn't in the given state
+	ErrStateMismatch = errors.New("state mismatch")
+)
+
+// Server is a Boskos-compatible server
+type Server struct {
+	// Now is the source of time of the server, time.Now if nil
+	Now func() time.Time
+
+	resources map[string]*boskoscommon.Resource
+	mutex     sync.Mutex
+	mux       *http.ServeMux
+}
+
+// LoadConfig reads the resources from a Boskos config file, e.g.
+// config/prod/build-cluster/boskos/boskos_resources.yaml
+func LoadConfig(path string) (*boskoscommon.BoskosConfig, error) {
+	config, err := boskoscommon.ParseConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading the Boskos config %q: %w", path, err)
+	}
+	return config, nil
+}
+
+// NewServer creates a server with the resources of the config
+func NewServer(config *boskoscommon.BoskosConfig) (*Server, error) {
+	if err := boskoscommon.ValidateConfig(config); err != nil {
+		return nil, fmt.Errorf("invalid Boskos config: %w", err)
+	}
+	s := &Server{resources: make(map[string]*boskoscommon.Resource)}
+	for _, e := range config.Resources {
+		if e.IsDRLC() {
+			return nil, fmt.Errorf("dynamic resources of type %q are not supported", e.Type)
+		}
+		for _, res := range boskoscommon.NewResourcesFromConfig(e) {
+			res := res
+			s.resources[res.Name] = &res
+		}
+	}
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("/acquire", s.handle(http.MethodPost, s.handleAcquire))
+	s.mux.HandleFunc("/acquirebystate", s.handle(http.MethodPost, s.handleAcquireByState))
+	s.mux.HandleFunc("/release", s.handle(http.MethodPost, s.handleRelease))
+	s.mux.HandleFunc("/update", s.handle(http.MethodPost, s.handleUpdate))
+	s.mux.HandleFunc("/reset", s.handle(http.MethodPost, s.handleReset))
+	s.mux.HandleFunc("/metric", s.handle(http.MethodGet, s.handleMetric))
+	return s, nil
+}
+
+// ServeHTTP serves the Boskos endpoints
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Resources returns a copy of all the resources, sorted by name
+func (s *Server) Resources() []boskoscommon.Resource {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	resources := make([]boskoscommon.Resource, 0, len(s.resources))
+	for _, res := range s.resources {
+		resources = append(resources, *res)
+	}
+	sort.Sort(boskoscommon.ResourceByName(resources))
+	return resources
+}
+
+// Types returns the resource types, sorted
+func (s *Server) Types() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	seen := make(map[string]bool)
+	var types []string
+	for _, res := range s.resources {
+		if !seen[res.Type] {
+			seen[res.Type] = true
+			types = append(types, res.Type)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Acquire acquires a resource of the type in the state that isn't owned by
+// anyone, and moves it to the dest state
+func (s *Server) Acquire(rtype, state, dest, owner string) (*boskoscommon.Resource, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// Acquire the least recently updated resource, like Boskos does.
+	var found *boskoscommon.Resource
+	for _, res := range s.resources {
+		if res.Type != rtype || res.State != state || res.Owner != "" {
+			continue
+		}
+		if found == nil || res.LastUpdate.Before(found.LastUpdate) ||
+			(res.LastUpdate.Equal(found.LastUpdate) && res.Name < found.Name) {
+			found = res
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	s.lease(found, dest, owner)
+	res := *found
+	return &res, nil
+}
+
+// AcquireByState acquires all the named resources in the state, and moves
+// them to the dest state. Nothing is acquired if any of them isn't available.
+func (s *Server) AcquireByState(state, dest, owner string, names []string) ([]boskoscommon.Resource, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, name := range names {
+		res, ok := s.resources[name]
+		if !ok || res.State != state {
+			return nil, fmt.Errorf("%w: %q in state %q", ErrNotFound, name, state)
+		}
+		if res.Owner != "" {
+			return nil, fmt.Errorf("%w: %q is owned by %q", ErrOwnerMismatch, name, res.Owner)
+		}
+	}
+	resources := make([]boskoscommon.Resource, 0, len(names))
+	for _, name := range names {
+		s.lease(s.resources[name], dest, owner)
+		resources = append(resources, *s.resources[name])
+	}
+	return resources, nil
+}
+
+// Release releases the resource owned by owner to the dest state
+func (s *Server) Release(name, dest, owner string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	res, err := s.owned(name, owner)
+	if err != nil {
+		return err
+	}
+	s.lease(res, dest, "")
+	return nil
+}
+
+// Update keeps the lease of the resource owned by owner alive, and merges
+// the user data into the user data of the resource
+func (s *Server) Update(name, state, owner string, userData *boskoscommon.UserData) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	res, err := s.owned(name, owner)
+	if err != nil {
+		return err
+	}
+	if res.State != state {
+		return fmt.Errorf("%w: %q is in state %q, not %q", ErrStateMismatch, name, res.State, state)
+	}
+	if userData != nil {
+		if res.UserData == nil {
+			res.UserData = &boskoscommon.UserData{}
+		}
+		res.UserData.Update(userData)
+	}
+	res.LastUpdate = s.now()
+	return nil
+}
+
+// Reset moves the resources of the type in the state whose lease wasn't kept
+// alive for expire to the dest state, and frees them. All the types match if
+// rtype is empty. It returns the previous owner of each resource reset.
+func (s *Server) Reset(rtype, state string, expire time.Duration, dest string) map[string]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := s.now()
+	owners := make(map[string]string)
+	for _, res := range s.resources {
+		if (rtype != "" && res.Type != rtype) || res.State != state || now.Sub(res.LastUpdate) < expire {
+			continue
+		}
+		owners[res.Name] = res.Owner
+		s.lease(res, dest, "")
+	}
+	return owners
+}
+
+// Metric returns the number of resources of the type in each state and owned
+// by each owner
+func (s *Server) Metric(rtype string) (boskoscommon.Metric, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	metric := boskoscommon.NewMetric(rtype)
+	found := false
+	for _, res := range s.resources {
+		if res.Type != rtype {
+			continue
+		}
+		found = true
+		metric.Current[res.State]++
+		metric.Owners[res.Owner]++
+	}
+	if !found {
+		return metric, ErrNotFound
+	}
+	return metric, nil
+}
+
+// owned returns the resource if it's owned by owner. The caller must hold the
+// mutex.
+func (s *Server) owned(name, owner string) (*boskoscommon.Resource, error) {
+	res, ok := s.resources[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, name)
+	}
+	if res.Owner != owner {
+		return nil, fmt.Errorf("%w: %q is owned by %q, not %q", ErrOwnerMismatch, name, res.Owner, owner)
+	}
+	return res, nil
+}
+
+// lease moves the resource to the state and sets its owner. The caller must
+// hold the mutex.
+func (s *Server) lease(res *boskoscommon.Resource, state, owner string) {
+	res.State = state
+	res.Owner = owner
+	res.LastUpdate = s.now()
+}
+
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// handle checks the method of the requests, and writes the response of the
+// handler as JSON, or its error with the status code Boskos returns for it
+func (s *Server) handle(method string, h func(*http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			http.Error(w, fmt.Sprintf("method %s is not allowed, use %s", r.Method, method), http.StatusMethodNotAllowed)
+			return
+		}
+		resp, err := h(r)
+		if err != nil {
+			log.Printf("%s %s: %v", r.Method, r.URL, err)
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+		if resp == nil {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("Failed writing the response of %s %s: %v", r.Method, r.URL, err)
+		}
+	}
+}
+
+func (s *Server) handleAcquire(r *http.Request) (interface{}, error) {
+	params, err := requiredParams(r, "type", "state", "dest", "owner")
+	if err != nil {
+		return nil, err
+	}
+	return s.Acquire(params["type"], params["state"], params["dest"], params["owner"])
+}
+
+func (s *Server) handleAcquireByState(r *http.Request) (interface{}, error) {
+	params, err := requiredParams(r, "state", "dest", "owner", "names")
+	if err != nil {
+		return nil, err
+	}
+	return s.AcquireByState(params["state"], params["dest"], params["owner"], strings.Split(params["names"], ","))
+}
+
+func (s *Server) handleRelease(r *http.Request) (interface{}, error) {
+	params, err := requiredParams(r, "name", "dest", "owner")
+	if err != nil {
+		return nil, err
+	}
+	return nil, s.Release(params["name"], params["dest"], params["owner"])
+}
+
+func (s *Server) handleUpdate(r *http.Request) (interface{}, error) {
+	params, err := requiredParams(r, "name", "state", "owner")
+	if err != nil {
+		return nil, err
+	}
+	var userData *boskoscommon.UserData
+	if r.ContentLength != 0 {
+		userData = &boskoscommon.UserData{}
+		if err := json.NewDecoder(r.Body).Decode(userData); err != nil {
+			return nil, badRequest{fmt.Errorf("invalid user data: %w", err)}
+		}
+	}
+	return nil, s.Update(params["name"], params["state"], params["owner"], userData)
+}
+
+func (s *Server) handleReset(r *http.Request) (interface{}, error) {
+	params, err := requiredParams(r, "type", "state", "expire", "dest")
+	if err != nil {
+		return nil, err
+	}
+	expire, err := time.ParseDuration(params["expire"])
+	if err != nil {
+		return nil, badRequest{fmt.Errorf("invalid expire %q: %w", params["expire"], err)}
+	}
+	return s.Reset(params["type"], params["state"], expire, params["dest"]), nil
+}
+
+func (s *Server) handleMetric(r *http.Request) (interface{}, error) {
+	params, err := requiredParams(r, "type")
+	if err != nil {
+		return nil, err
+	}
+	return s.Metric(params["type"])
+}
+
+// badRequest is an error of the request itself
+type badRequest struct {
+	error
+}
+
+// requiredParams returns the query parameters, all required
+func requiredParams(r *http.Request, names ...string) (map[string]string, error) {
+	params := make(map[string]string, len(names))
+	for _, name := range names {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			return nil, badRequest{fmt.Errorf("parameter %q is required", name)}
+		}
+		params[name] = v
+	}
+	return params, nil
+}
+
+// statusCode returns the status code Boskos returns for the error
+func statusCode(err error) int {
+	var br badRequest
+	switch {
+	case errors.As(err, &br):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrOwnerMismatch):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrStateMismatch):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
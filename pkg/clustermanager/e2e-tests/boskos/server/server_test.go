@@ -0,0 +1,211 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	boskoscommon "sigs.k8s.io/boskos/common"
+)
+
+func newTestServer(t *testing.T) (*Server, *time.Time) {
+	config, err := LoadConfig("testdata/boskos_resources.yaml")
+	if err != nil {
+		t.Fatalf("Expected no error loading the config, but got '%v'", err)
+	}
+	s, err := NewServer(config)
+	if err != nil {
+		t.Fatalf("Expected no error creating the server, but got '%v'", err)
+	}
+	now := time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC)
+	s.Now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestNewServer(t *testing.T) {
+	s, _ := newTestServer(t)
+	var names []string
+	for _, res := range s.Resources() {
+		names = append(names, res.Name+"/"+res.Type+"/"+res.State)
+	}
+	want := []string{"project-a/gke-project/free", "project-b/gke-project/free", "project-c/gke-project-dedicated/dirty"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("Expected resources %v, but got %v", want, names)
+	}
+	if got := s.Types(); !reflect.DeepEqual(got, []string{"gke-project", "gke-project-dedicated"}) {
+		t.Fatalf("Expected types [gke-project gke-project-dedicated], but got %v", got)
+	}
+
+	for _, config := range []*boskoscommon.BoskosConfig{
+		{},
+		{Resources: []boskoscommon.ResourceEntry{{Type: "gke-project", MaxCount: 2}}},
+	} {
+		if _, err := NewServer(config); err == nil {
+			t.Fatalf("Expected an error creating a server with %+v, but got none", config)
+		}
+	}
+	if _, err := LoadConfig("testdata/non-existent.yaml"); err == nil {
+		t.Fatal("Expected an error loading a non-existent config, but got none")
+	}
+}
+
+func TestLease(t *testing.T) {
+	s, now := newTestServer(t)
+
+	// The least recently updated resource is acquired first.
+	res, err := s.Acquire("gke-project", boskoscommon.Free, boskoscommon.Busy, "job-1")
+	if err != nil || res.Name != "project-a" || res.Owner != "job-1" || res.State != boskoscommon.Busy {
+		t.Fatalf("Expected project-a busy and owned by job-1, but got %+v and '%v'", res, err)
+	}
+	*now = now.Add(time.Minute)
+	if err := s.Release("project-a", boskoscommon.Free, "job-1"); err != nil {
+		t.Fatalf("Expected no error releasing project-a, but got '%v'", err)
+	}
+	if res, _ := s.Acquire("gke-project", boskoscommon.Free, boskoscommon.Busy, "job-2"); res == nil || res.Name != "project-b" {
+		t.Fatalf("Expected project-b, but got %+v", res)
+	}
+	if _, err := s.Acquire("gke-project", boskoscommon.Free, boskoscommon.Busy, "job-3"); err != nil {
+		t.Fatalf("Expected no error acquiring project-a again, but got '%v'", err)
+	}
+	if _, err := s.Acquire("gke-project", boskoscommon.Free, boskoscommon.Busy, "job-4"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected error '%v', but got '%v'", ErrNotFound, err)
+	}
+
+	// Only the owner can update and release the resource.
+	if err := s.Release("project-b", boskoscommon.Dirty, "job-1"); !errors.Is(err, ErrOwnerMismatch) {
+		t.Fatalf("Expected error '%v', but got '%v'", ErrOwnerMismatch, err)
+	}
+	if err := s.Update("project-b", boskoscommon.Busy, "job-1", nil); !errors.Is(err, ErrOwnerMismatch) {
+		t.Fatalf("Expected error '%v', but got '%v'", ErrOwnerMismatch, err)
+	}
+	if err := s.Update("project-b", boskoscommon.Free, "job-2", nil); !errors.Is(err, ErrStateMismatch) {
+		t.Fatalf("Expected error '%v', but got '%v'", ErrStateMismatch, err)
+	}
+	if err := s.Update("project-z", boskoscommon.Busy, "job-2", nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected error '%v', but got '%v'", ErrNotFound, err)
+	}
+
+	// Updates keep the lease alive, the other leases expire.
+	*now = now.Add(time.Hour)
+	userData := boskoscommon.UserDataFromMap(boskoscommon.UserDataMap{"cluster": "e2e"})
+	if err := s.Update("project-b", boskoscommon.Busy, "job-2", userData); err != nil {
+		t.Fatalf("Expected no error updating project-b, but got '%v'", err)
+	}
+	*now = now.Add(time.Minute)
+	owners := s.Reset("gke-project", boskoscommon.Busy, 30*time.Minute, boskoscommon.Dirty)
+	if want := map[string]string{"project-a": "job-3"}; !reflect.DeepEqual(owners, want) {
+		t.Fatalf("Expected reset %v, but got %v", want, owners)
+	}
+	b := s.Resources()[1]
+	if cluster := b.UserData.ToMap()["cluster"]; b.State != boskoscommon.Busy || cluster != "e2e" {
+		t.Fatalf("Expected project-b busy with its user data, but got %+v", b)
+	}
+
+	metric, err := s.Metric("gke-project")
+	if err != nil {
+		t.Fatalf("Expected no error getting the metric, but got '%v'", err)
+	}
+	want := boskoscommon.Metric{
+		Type:    "gke-project",
+		Current: map[string]int{boskoscommon.Busy: 1, boskoscommon.Dirty: 1},
+		Owners:  map[string]int{"job-2": 1, "": 1},
+	}
+	if !reflect.DeepEqual(metric, want) {
+		t.Fatalf("Expected metric %+v, but got %+v", want, metric)
+	}
+	if _, err := s.Metric("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected error '%v', but got '%v'", ErrNotFound, err)
+	}
+}
+
+func TestAcquireByState(t *testing.T) {
+	s, _ := newTestServer(t)
+	if _, err := s.AcquireByState(boskoscommon.Free, boskoscommon.Busy, "job-1", []string{"project-a", "project-c"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected error '%v', but got '%v'", ErrNotFound, err)
+	}
+	// Nothing is acquired if any resource isn't available.
+	if res := s.Resources()[0]; res.Owner != "" {
+		t.Fatalf("Expected project-a not to be acquired, but got %+v", res)
+	}
+	resources, err := s.AcquireByState(boskoscommon.Free, boskoscommon.Busy, "job-1", []string{"project-b", "project-a"})
+	if err != nil {
+		t.Fatalf("Expected no error acquiring the projects, but got '%v'", err)
+	}
+	if len(resources) != 2 || resources[0].Name != "project-b" || resources[1].Owner != "job-1" {
+		t.Fatalf("Expected project-b and project-a owned by job-1, but got %+v", resources)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	s, _ := newTestServer(t)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	// The requests run in order, on the same resources.
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"acquire", http.MethodPost, "/acquire?type=gke-project&state=free&dest=busy&owner=job", "", http.StatusOK, `"name":"project-a"`},
+		{"acquire none free", http.MethodPost, "/acquire?type=gke-project-dedicated&state=free&dest=busy&owner=job", "", http.StatusNotFound, ""},
+		{"acquire missing owner", http.MethodPost, "/acquire?type=gke-project&state=free&dest=busy", "", http.StatusBadRequest, `"owner" is required`},
+		{"acquire with GET", http.MethodGet, "/acquire?type=gke-project&state=free&dest=busy&owner=job", "", http.StatusMethodNotAllowed, ""},
+		{"update", http.MethodPost, "/update?name=project-a&state=busy&owner=job", `{"cluster":"e2e"}`, http.StatusOK, ""},
+		{"update heartbeat", http.MethodPost, "/update?name=project-a&state=busy&owner=job", "", http.StatusOK, ""},
+		{"update invalid user data", http.MethodPost, "/update?name=project-a&state=busy&owner=job", "{", http.StatusBadRequest, ""},
+		{"update wrong state", http.MethodPost, "/update?name=project-a&state=free&owner=job", "", http.StatusConflict, ""},
+		{"release wrong owner", http.MethodPost, "/release?name=project-a&dest=dirty&owner=other", "", http.StatusUnauthorized, ""},
+		{"release", http.MethodPost, "/release?name=project-a&dest=dirty&owner=job", "", http.StatusOK, ""},
+		{"acquire by state", http.MethodPost, "/acquirebystate?names=project-a&state=dirty&dest=cleaning&owner=janitor", "", http.StatusOK, `"state":"cleaning"`},
+		{"reset", http.MethodPost, "/reset?type=gke-project&state=cleaning&expire=0s&dest=dirty", "", http.StatusOK, `{"project-a":"janitor"}`},
+		{"reset invalid expire", http.MethodPost, "/reset?type=gke-project&state=cleaning&expire=1&dest=dirty", "", http.StatusBadRequest, ""},
+		{"metric", http.MethodGet, "/metric?type=gke-project", "", http.StatusOK, `"current":{"dirty":1,"free":1}`},
+		{"metric unknown type", http.MethodGet, "/metric?type=unknown", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("%s: expected no error creating the request, but got '%v'", tt.name, err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: expected no error, but got '%v'", tt.name, err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: expected no error reading the response, but got '%v'", tt.name, err)
+		}
+		if resp.StatusCode != tt.wantStatus {
+			t.Fatalf("%s: expected status %d, but got %d: %s", tt.name, tt.wantStatus, resp.StatusCode, body)
+		}
+		if !strings.Contains(string(body), tt.wantBody) {
+			t.Fatalf("%s: expected body containing %q, but got %q", tt.name, tt.wantBody, body)
+		}
+	}
+}
@@ -24,7 +24,6 @@ import (
 	container "google.golang.org/api/container/v1beta1"
 
 	clm "knative.dev/test-infra/pkg/clustermanager/e2e-tests/gke"
-	"knative.dev/test-infra/pkg/cmd"
 	"knative.dev/test-infra/pkg/gke"
 	"knative.dev/test-infra/pkg/metautil"
 )
@@ -33,36 +32,38 @@ const (
 	// Keys to be written into metadata.json
 	e2eRegionKey      = "E2E:Region"
 	e2eZoneKey        = "E2E:Zone"
-	clusterNameKey    = "E2E:Machine"
+	clusterNameKey    = "E2E:ClusterName"
 	clusterVersionKey = "E2E:Version"
 	minNodesKey       = "E2E:MinNodes"
 	maxNodesKey       = "E2E:MaxNodes"
 	projectKey        = "E2E:Project"
+	providerKey       = "E2E:Provider"
+	kubeconfigKey     = "E2E:Kubeconfig"
+	// legacyClusterNameKey is where the name of GKE clusters has always been
+	// written, kept for the existing readers
+	legacyClusterNameKey = "E2E:Machine"
 )
 
-// Create creates a GKE cluster and configures gcloud after successful GKE create request
+// Create creates a GKE cluster and writes its credentials to a dedicated
+// kubeconfig file after successful GKE create request, the path of the file is
+// in the Kubeconfig of the returned cluster
 func Create(rw *RequestWrapper) (*clm.GKECluster, error) {
 	gkeOps, err := rw.acquire()
 	if err != nil {
 		return nil, err
 	}
 
+	// Write a kubeconfig pointing to the cluster, instead of changing the
+	// global gcloud and kubectl configs
+	if err := gkeOps.WriteKubeconfig(); err != nil {
+		return nil, fmt.Errorf("failed writing the kubeconfig of the cluster: %w", err)
+	}
+
 	if rw.Request.SaveMetaData {
 		// At this point we should have a cluster ready to run test. Need to save
 		// metadata so that following flow can understand the context of cluster, as
 		// well as for Prow usage later
-		writeMetaData(gkeOps.Cluster, gkeOps.Project)
-	}
-
-	// set up kube config points to cluster
-	clusterAuthCmd := fmt.Sprintf(
-		"gcloud beta container clusters get-credentials %s --region %s --project %s",
-		gkeOps.Cluster.Name, gkeOps.Cluster.Location, gkeOps.Project)
-	if out, err := cmd.RunCommand(clusterAuthCmd); err != nil {
-		return nil, fmt.Errorf("failed connecting to cluster: %q, %w", out, err)
-	}
-	if out, err := cmd.RunCommand("gcloud config set project " + gkeOps.Project); err != nil {
-		return nil, fmt.Errorf("failed setting project: %q, %w", out, err)
+		writeMetaData(gkeOps.Cluster, gkeOps.Project, gkeOps.Kubeconfig)
 	}
 
 	return gkeOps, nil
@@ -70,7 +71,7 @@ func Create(rw *RequestWrapper) (*clm.GKECluster, error) {
 
 // writeMetadata writes the cluster information to a metadata file defined in the request
 // after the cluster operation is finished
-func writeMetaData(cluster *container.Cluster, project string) {
+func writeMetaData(cluster *container.Cluster, project, kubeconfig string) {
 	// Set up metadata client for saving metadata
 	c, err := metautil.NewClient("")
 	if err != nil {
@@ -97,13 +98,16 @@ func writeMetaData(cluster *container.Cluster, project string) {
 
 	e2eRegion, e2eZone := gke.RegionZoneFromLoc(cluster.Location)
 	for key, val := range map[string]string{
-		e2eRegionKey:      e2eRegion,
-		e2eZoneKey:        e2eZone,
-		clusterNameKey:    cluster.Name,
-		clusterVersionKey: cluster.InitialClusterVersion,
-		minNodesKey:       minNodes,
-		maxNodesKey:       maxNodes,
-		projectKey:        project,
+		e2eRegionKey:         e2eRegion,
+		e2eZoneKey:           e2eZone,
+		clusterNameKey:       cluster.Name,
+		legacyClusterNameKey: cluster.Name,
+		clusterVersionKey:    cluster.InitialClusterVersion,
+		minNodesKey:          minNodes,
+		maxNodesKey:          maxNodes,
+		projectKey:           project,
+		providerKey:          "gke",
+		kubeconfigKey:        kubeconfig,
 	} {
 		if err = c.Set(key, val); err != nil {
 			log.Fatalf("Failed saving metadata %q:%q: '%v'", key, val, err)
@@ -111,3 +115,19 @@ func writeMetaData(cluster *container.Cluster, project string) {
 	}
 	log.Println("Done writing metadata")
 }
+
+// readKubeconfigFromMetaData returns the kubeconfig file of the cluster
+// written to the metadata file by writeMetaData, empty if there is none
+func readKubeconfigFromMetaData() string {
+	c, err := metautil.NewClient("")
+	if err != nil {
+		log.Printf("Failed reading metadata: '%v'", err)
+		return ""
+	}
+	kubeconfig, err := c.Get(kubeconfigKey)
+	if err != nil {
+		return ""
+	}
+	log.Printf("Using the kubeconfig %q from metadata %q", kubeconfig, c.Path)
+	return kubeconfig
+}
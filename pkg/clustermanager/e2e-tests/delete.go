@@ -19,8 +19,6 @@ package e2e_tests
 import (
 	"fmt"
 	"log"
-
-	"knative.dev/test-infra/pkg/cmd"
 )
 
 // Delete deletes a GKE cluster
@@ -35,12 +33,9 @@ func Delete(rw *RequestWrapper) error {
 	if err = gkeOps.Delete(); err != nil {
 		return fmt.Errorf("failed deleting cluster: %w", err)
 	}
-	// Unset context with best effort.
-	// The commands will try to unset the current context and delete it from kubeconfig.
-	cc, _ := cmd.RunCommand("kubectl config current-context")
-	if _, err := cmd.RunCommand("kubectl config unset current-context"); err != nil {
-		cmd.RunCommand("kubectl config unset contexts." + cc)
+	// The dedicated kubeconfig is useless without the cluster.
+	if err := gkeOps.RemoveKubeconfig(); err != nil {
+		log.Printf("Failed removing the kubeconfig of the cluster: '%v'", err)
 	}
-
 	return nil
 }
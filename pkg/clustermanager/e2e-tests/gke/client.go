@@ -16,14 +16,27 @@ limitations under the License.
 
 package gke
 
+import (
+	"fmt"
+
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/provider"
+)
+
 // Client is the entrypoint
 type Client interface {
 	Setup(...interface{}) (ClusterOperations, error)
 }
 
 // ClusterOperations contains all provider specific logics
-type ClusterOperations interface {
-	Provider() string
-	Acquire() error
-	Delete() error
+type ClusterOperations = provider.ClusterOperations
+
+func init() {
+	provider.Register(providerName, provider.SetupFunc(func(request interface{}) (provider.ClusterOperations, error) {
+		r, ok := request.(GKERequest)
+		if !ok {
+			return nil, fmt.Errorf("expected a GKERequest for provider %q, but got %T", providerName, request)
+		}
+		gs := &GKEClient{}
+		return gs.Setup(r), nil
+	}))
 }
@@ -17,12 +17,15 @@ limitations under the License.
 package gke
 
 import (
-	"regexp"
+	"time"
 
 	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/boskos"
 )
 
 const (
+	// providerName is the name GKE is registered with in the provider registry
+	providerName = "gke"
+
 	defaultGKEMinNodes  = 1
 	defaultGKEMaxNodes  = 3
 	defaultGKENodeType  = "e2-standard-4"
@@ -31,23 +34,17 @@ const (
 	regionEnv           = "E2E_CLUSTER_REGION"
 	backupRegionEnv     = "E2E_CLUSTER_BACKUP_REGIONS"
 	defaultResourceType = boskos.GKEProjectResource
+	defaultNodePool     = "default-pool"
+	// masterNodeVersion is the node version meaning the version of the master
+	masterNodeVersion = "-"
 
 	clusterRunning = "RUNNING"
+
+	// boskosWaitDuration is how long to wait for a free project of the
+	// resource types, or for the project with the name
+	boskosWaitDuration = 2 * time.Hour
 )
 
 var (
-	protectedProjects       = []string{"knative-tests"}
-	protectedClusters       = []string{"knative-prow"}
 	defaultGKEBackupRegions = []string{"us-west1", "us-east1"}
-
-	// If one of the error patterns below is matched, it would be recommended to
-	// retry creating the cluster in a different region/zone.
-	// - stockout (https://github.com/knative/test-infra/issues/592)
-	// - latest GKE not available in this region/zone yet (https://github.com/knative/test-infra/issues/694)
-	retryableCreationErrors = []*regexp.Regexp{
-		regexp.MustCompile(`.*Master version "[0-9a-z\-.]+" is unsupported.*`),
-		regexp.MustCompile(`.*No valid versions with the prefix "[0-9.]+" found.*`),
-		regexp.MustCompile(`.*does not have enough resources available to fulfill.*`),
-		regexp.MustCompile(`.*only \d+ nodes out of \d+ have registered; this is likely due to Nodes failing to start correctly.*`),
-	}
 )
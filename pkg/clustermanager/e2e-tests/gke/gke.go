@@ -17,6 +17,7 @@ limitations under the License.
 package gke
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -25,20 +26,25 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	container "google.golang.org/api/container/v1beta1"
 	"google.golang.org/api/option"
+	boskoscommon "sigs.k8s.io/boskos/common"
 
 	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/common"
+	"knative.dev/test-infra/pkg/clustermanager/ownership"
+	"knative.dev/test-infra/pkg/failure"
 	"knative.dev/test-infra/pkg/gke"
+	"knative.dev/test-infra/pkg/protection"
 )
 
 // Provider returns gke
 func (gc *GKECluster) Provider() string {
-	return "gke"
+	return providerName
 }
 
 // Acquire gets existing cluster or create a new one, the creation logic
-// contains retries in BackupRegions. Default creating cluster
+// contains retries in BackupRegions and with BackupNodeTypes, depending on the
+// class of the failure. Default creating cluster
 // in us-central1, and default BackupRegions are us-west1 and us-east1. If
-// Region or Zone is provided then there is no retries
+// Region or Zone is provided then there is no retries in other regions
 func (gc *GKECluster) Acquire() error {
 	if gc.Request.SkipCreation {
 		if err := gc.checkEnvironment(); err != nil {
@@ -47,15 +53,14 @@ func (gc *GKECluster) Acquire() error {
 		// If gc.Cluster is discovered above, then the cluster exists and it's
 		// project and name matches with requested, use it
 		if gc.Cluster != nil {
-			gc.ensureProtected()
-			return nil
+			return gc.ensureProtected(protection.ActionUse)
 		}
 		return errors.New("failing acquiring an existing cluster")
 	}
 
 	// If running on Prow and project name is not provided, get project name from boskos.
 	if gc.Request.Project == "" && gc.isBoskos {
-		project, err := gc.boskosOps.AcquireGKEProject(gc.Request.ResourceType)
+		project, err := gc.acquireBoskosProject()
 		if err != nil {
 			return fmt.Errorf("failed acquiring boskos project: '%w'", err)
 		}
@@ -64,7 +69,9 @@ func (gc *GKECluster) Acquire() error {
 	if gc.Project == "" {
 		return errors.New("GCP project must be set")
 	}
-	gc.ensureProtected()
+	if err := gc.ensureProtected(protection.ActionCreate); err != nil {
+		return err
+	}
 	log.Printf("Identified project %s for cluster creation", gc.Project)
 
 	client, err := gc.newGKEClient(gc.Project, gc.Request.GCPCredentialFile)
@@ -75,6 +82,9 @@ func (gc *GKECluster) Acquire() error {
 	request := gc.Request.DeepCopy()
 	// We are going to use request for creating cluster, set its Project
 	request.Project = gc.Project
+	// Stamp the cluster with who creates it and when it expires, so that it
+	// can be reaped if it's left behind
+	request.ResourceLabels = ownership.New(gc.Request.TTL).AddLabels(request.ResourceLabels)
 	// Set the cluster name if it doesn't exist
 	if request.ClusterName == "" {
 		var err error
@@ -92,57 +102,139 @@ func (gc *GKECluster) Acquire() error {
 			regions = append(regions, br)
 		}
 	}
-	var cluster *container.Cluster
-	rb, err := gke.NewCreateClusterRequest(request)
-	if err != nil {
-		return fmt.Errorf("failed building the CreateClusterRequest: '%w'", err)
+	// Combine NodeType with BackupNodeTypes, these will be the node types
+	// tried in each region
+	nodeTypes := []string{request.NodeType}
+	for _, bt := range gc.Request.BackupNodeTypes {
+		if bt != request.NodeType {
+			nodeTypes = append(nodeTypes, bt)
+		}
 	}
-	for i, region := range regions {
-		// Restore innocence
-		err = nil
+	ctx := context.Background()
+	retrier := failure.NewRetrier(gc.classifier, regions, nodeTypes)
+	defer gc.reportCreation(retrier)
+	for {
+		attempt := retrier.Attempt()
+		region := attempt.Region
+		request.NodeType = attempt.MachineType
+		rb, err := gke.NewCreateClusterRequest(request)
+		if err != nil {
+			return fmt.Errorf("failed building the CreateClusterRequest: '%w'", err)
+		}
 
 		clusterName := request.ClusterName
 		// Use cluster if it already exists and running
-		existingCluster, _ := client.GetCluster(gc.Project, region, request.Zone, clusterName)
+		existingCluster, _ := client.GetCluster(ctx, gc.Project, region, request.Zone, clusterName)
 		if existingCluster != nil && existingCluster.Status == clusterRunning {
 			gc.Cluster = existingCluster
 			return nil
 		}
 		// Creating cluster
 		log.Printf("Creating cluster %q in region %q zone %q with:\n%+v", clusterName, region, request.Zone, spew.Sdump(rb))
-		err = client.CreateCluster(gc.Project, region, request.Zone, rb)
+		err = client.CreateCluster(ctx, gc.Project, region, request.Zone, rb, gke.WithProgress(logProgress()))
+		var cluster *container.Cluster
 		if err == nil {
-			cluster, err = client.GetCluster(gc.Project, region, request.Zone, rb.Cluster.Name)
+			cluster, err = client.GetCluster(ctx, gc.Project, region, request.Zone, rb.Cluster.Name)
 		}
-		if err != nil {
-			errMsg := fmt.Sprintf("Error during cluster creation: '%v'. ", err)
-			if !common.IsProw() { // Delete half created cluster if it's user created
-				errMsg = fmt.Sprintf("%sDeleting cluster %q in region %q zone %q in background...\n", errMsg, clusterName, region, request.Zone)
-				client.DeleteClusterAsync(gc.Project, region, request.Zone, clusterName)
-			}
-			// Retry another region if cluster creation failed.
-			if i != len(regions)-1 && needsRetryCreation(err.Error()) {
-				errMsg = fmt.Sprintf("%sRetry another region %q for cluster creation", errMsg, regions[i+1])
-			}
-			log.Print(errMsg)
-		} else {
+		if err == nil {
 			log.Print("Cluster creation completed")
 			gc.Cluster = cluster
-			break
 		}
+		retry := retrier.Next(err)
+		if err == nil {
+			return nil
+		}
+
+		errMsg := fmt.Sprintf("Error during cluster creation: '%v'. ", err)
+		results := retrier.Results()
+		last, next := results[len(results)-1], retrier.Attempt()
+		if retry && next.Region == region {
+			// The cluster is created again with the same name in the same
+			// region, so the half created cluster must be gone first.
+			errMsg = fmt.Sprintf("%sDeleting cluster %q in region %q zone %q before retrying...\n", errMsg, clusterName, region, request.Zone)
+			if derr := client.DeleteCluster(ctx, gc.Project, region, request.Zone, clusterName); derr != nil {
+				log.Printf("Failed deleting cluster %q: '%v'", clusterName, derr)
+			}
+		} else if !common.IsProw() { // Delete half created cluster if it's user created
+			errMsg = fmt.Sprintf("%sDeleting cluster %q in region %q zone %q in background...\n", errMsg, clusterName, region, request.Zone)
+			client.DeleteClusterAsync(ctx, gc.Project, region, request.Zone, clusterName)
+		}
+		if !retry {
+			log.Printf("%sThe %s failure is not retried", errMsg, last.Class)
+			return err
+		}
+		log.Printf("%sThe %s failure is retried (%s) in region %q with node type %q", errMsg, last.Class, last.Action, next.Region, next.MachineType)
 	}
+}
 
-	return err
+// reportCreation records the results of the cluster creation attempts in the
+// metadata and the JUnit results, if the metadata is saved
+func (gc *GKECluster) reportCreation(retrier *failure.Retrier) {
+	results := retrier.Results()
+	if !gc.Request.SaveMetaData || len(results) == 0 {
+		return
+	}
+	if err := failure.Report("", results); err != nil {
+		log.Printf("Failed reporting the cluster creation attempts: '%v'", err)
+	}
 }
 
-// needsRetryCreation determines if cluster creation needs to be retried based on the error message.
-func needsRetryCreation(errMsg string) bool {
-	for _, regx := range retryableCreationErrors {
-		if regx.MatchString(errMsg) {
-			return true
+// logProgress returns a function logging the progress of an operation when
+// its status message or progress changes
+func logProgress() func(gke.Progress) {
+	var last string
+	return func(p gke.Progress) {
+		msg := fmt.Sprintf("Operation %s is %s", p.Operation.Name, p.Operation.Status)
+		if p.Percent >= 0 {
+			msg = fmt.Sprintf("%s (%d%%)", msg, p.Percent)
+		}
+		if p.Operation.StatusMessage != "" {
+			msg = fmt.Sprintf("%s: %s", msg, p.Operation.StatusMessage)
 		}
+		if msg != last {
+			log.Print(msg)
+			last = msg
+		}
+	}
+}
+
+// acquireBoskosProject acquires the boskos project with the name if it's set,
+// or a free project of the resource type then of the backup resource types
+func (gc *GKECluster) acquireBoskosProject() (*boskoscommon.Resource, error) {
+	if gc.Request.BoskosProject == "" && len(gc.Request.BackupResourceTypes) == 0 {
+		return gc.boskosOps.AcquireGKEProject(gc.Request.ResourceType)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), boskosWaitDuration)
+	defer cancel()
+	if gc.Request.BoskosProject != "" {
+		return gc.boskosOps.AcquireGKEProjectByName(ctx, gc.Request.BoskosProject)
 	}
-	return false
+	resTypes := append([]string{gc.Request.ResourceType}, gc.Request.BackupResourceTypes...)
+	return gc.boskosOps.AcquireGKEProjectFromTypes(ctx, resTypes)
+}
+
+// Heartbeat keeps the lease of the boskos project of the cluster alive until
+// ctx is done or the project is released, e.g. by Delete in another process.
+// The lease is only kept alive by Acquire while its process runs, so Heartbeat
+// runs in a process of its own when the cluster is created and deleted by
+// separate processes.
+func (gc *GKECluster) Heartbeat(ctx context.Context) error {
+	if !gc.isBoskos {
+		return errors.New("the project isn't acquired from boskos, there is no lease to keep alive")
+	}
+	if gc.Project == "" {
+		return errors.New("GCP project must be set")
+	}
+	log.Printf("Keeping the lease of boskos project %q alive", gc.Project)
+	if err := gc.boskosOps.HeartbeatGKEProject(ctx, gc.Project); err != nil {
+		return fmt.Errorf("failed keeping the lease of boskos project alive: '%w'", err)
+	}
+	return nil
+}
+
+// IsBoskos tells whether the project of the cluster is acquired from boskos
+func (gc *GKECluster) IsBoskos() bool {
+	return gc.isBoskos
 }
 
 // Delete takes care of GKE cluster resource cleanup.
@@ -152,7 +244,9 @@ func (gc *GKECluster) Delete() error {
 	if err = gc.checkEnvironment(); err != nil {
 		return fmt.Errorf("failed checking project/cluster from environment: '%w'", err)
 	}
-	gc.ensureProtected()
+	if err := gc.ensureProtected(protection.ActionDelete); err != nil {
+		return err
+	}
 
 	// Should only get here if running locally and cluster created by this
 	// client, so at this moment cluster should have been set
@@ -167,9 +261,9 @@ func (gc *GKECluster) Delete() error {
 	}
 	region, zone := gke.RegionZoneFromLoc(gc.Cluster.Location)
 	if gc.asyncCleanup {
-		_, err = client.DeleteClusterAsync(gc.Project, region, zone, gc.Cluster.Name)
+		_, err = client.DeleteClusterAsync(context.Background(), gc.Project, region, zone, gc.Cluster.Name)
 	} else {
-		err = client.DeleteCluster(gc.Project, region, zone, gc.Cluster.Name)
+		err = client.DeleteCluster(context.Background(), gc.Project, region, zone, gc.Cluster.Name, gke.WithProgress(logProgress()))
 	}
 	if err != nil {
 		return fmt.Errorf("failed deleting cluster: '%w'", err)
@@ -186,28 +280,26 @@ func (gc *GKECluster) Delete() error {
 	return nil
 }
 
-// ensureProtected ensures not operating on protected project/cluster
-func (gc *GKECluster) ensureProtected() {
+// ensureProtected ensures the protection policy allows the action on the
+// project and the cluster
+func (gc *GKECluster) ensureProtected(action protection.Action) error {
 	if gc.Project != "" {
-		for _, pp := range protectedProjects {
-			if gc.Project == pp {
-				log.Fatalf("project %q is protected", gc.Project)
-			}
+		if err := gc.policy.Check(action, protection.Project(gc.Project)); err != nil {
+			return err
 		}
 	}
 	if gc.Cluster != nil {
-		for _, pc := range protectedClusters {
-			if gc.Cluster.Name == pc {
-				log.Fatalf("cluster %q is protected", gc.Cluster.Name)
-			}
-		}
+		return gc.policy.Check(action, protection.Cluster(gc.Cluster.Name, gc.Cluster.ResourceLabels))
 	}
+	return nil
 }
 
 // checkEnvironment checks environment set for kubeconfig and gcloud, and try to
 // identify existing project/cluster if they are not set
 //
-// checks for existing cluster by looking at kubeconfig, if kubeconfig is set:
+// checks for existing cluster by looking at the current context of the
+// dedicated kubeconfig if there is one, see kubeconfigPath, the global
+// kubeconfig is never used:
 // 	- If it exists in GKE:
 //		- If Request doesn't contain project/clustername:
 //			- Use it
@@ -216,7 +308,11 @@ func (gc *GKECluster) ensureProtected() {
 //				- Use it
 // If cluster isn't discovered above, try to get project from gcloud
 func (gc *GKECluster) checkEnvironment() error {
-	output, err := common.StandardExec("kubectl", "config", "current-context")
+	var output []byte
+	err := errors.New("no dedicated kubeconfig")
+	if path := gc.kubeconfigPath(); path != "" {
+		output, err = common.StandardExec("kubectl", "config", "current-context", "--kubeconfig", path)
+	}
 	// if kubeconfig is configured, try to use it
 	if err == nil {
 		currentContext := strings.TrimSpace(string(output))
@@ -236,7 +332,7 @@ func (gc *GKECluster) checkEnvironment() error {
 					if err != nil {
 						return fmt.Errorf("failed creating the GKE client: '%v'", err)
 					}
-					cluster, err := client.GetCluster(project, region, zone, clusterName)
+					cluster, err := client.GetCluster(context.Background(), project, region, zone, clusterName)
 					if err != nil {
 						return fmt.Errorf("couldn't find cluster %s in %s in %s, does it exist? %w", clusterName, project, location, err)
 					}
@@ -17,6 +17,7 @@ limitations under the License.
 package gke
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
@@ -30,10 +31,12 @@ import (
 
 	boskosFake "knative.dev/test-infra/pkg/clustermanager/e2e-tests/boskos/fake"
 	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/common"
+	"knative.dev/test-infra/pkg/clustermanager/ownership"
 
 	"knative.dev/test-infra/pkg/gke"
 
 	gkeFake "knative.dev/test-infra/pkg/gke/fake"
+	"knative.dev/test-infra/pkg/protection"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -116,7 +119,7 @@ func TestGKECheckEnvironment(t *testing.T) {
 		fgc := setupFakeGKECluster()
 		if data.clusterExist {
 			parts := strings.Split(data.kubectlOut, "_")
-			fgc.operations.CreateClusterAsync(parts[1], parts[2], "", &container.CreateClusterRequest{
+			fgc.operations.CreateClusterAsync(context.Background(), parts[1], parts[2], "", &container.CreateClusterRequest{
 				Cluster: &container.Cluster{
 					Name: parts[3],
 				},
@@ -125,6 +128,7 @@ func TestGKECheckEnvironment(t *testing.T) {
 		}
 		fgc.Request.ClusterName = data.requestClusterName
 		fgc.Request.Project = data.requestProject
+		fgc.Request.Kubeconfig = "/path/to/kubeconfig"
 		// mock for testing
 		common.StandardExec = func(name string, args ...string) ([]byte, error) {
 			var out []byte
@@ -204,10 +208,11 @@ func TestAcquire(t *testing.T) {
 				isProw:  true, project: fakeProj, nextOpStatus: []string{}, boskosProjs: []string{fakeBoskosProj},
 				skipCreation: false},
 			want: wantResult{expCluster: &container.Cluster{
-				Name:         predefinedClusterName,
-				Location:     "us-central1",
-				Status:       "RUNNING",
-				AddonsConfig: &container.AddonsConfig{},
+				Name:                  predefinedClusterName,
+				Location:              "us-central1",
+				Status:                "RUNNING",
+				InitialClusterVersion: "latest",
+				AddonsConfig:          &container.AddonsConfig{},
 				NodePools: []*container.NodePool{
 					{
 						Name:             "default-pool",
@@ -234,10 +239,11 @@ func TestAcquire(t *testing.T) {
 				isProw:  true, nextOpStatus: []string{}, boskosProjs: []string{fakeBoskosProj}, skipCreation: false},
 			want: wantResult{
 				&container.Cluster{
-					Name:         predefinedClusterName,
-					Location:     "us-central1",
-					Status:       "RUNNING",
-					AddonsConfig: &container.AddonsConfig{},
+					Name:                  predefinedClusterName,
+					Location:              "us-central1",
+					Status:                "RUNNING",
+					InitialClusterVersion: "latest",
+					AddonsConfig:          &container.AddonsConfig{},
 					NodePools: []*container.NodePool{
 						{
 							Name:             "default-pool",
@@ -261,10 +267,11 @@ func TestAcquire(t *testing.T) {
 				isProw:  true, nextOpStatus: []string{}, boskosProjs: []string{fakeBoskosProj}, skipCreation: false},
 			want: wantResult{
 				&container.Cluster{
-					Name:         "ktest-infra-e2e-cls-1234",
-					Location:     "us-central1",
-					Status:       "RUNNING",
-					AddonsConfig: &container.AddonsConfig{},
+					Name:                  "ktest-infra-e2e-cls-1234",
+					Location:              "us-central1",
+					Status:                "RUNNING",
+					InitialClusterVersion: "latest",
+					AddonsConfig:          &container.AddonsConfig{},
 					NodePools: []*container.NodePool{
 						{
 							Name:             "default-pool",
@@ -302,10 +309,11 @@ func TestAcquire(t *testing.T) {
 				nextOpStatus: []string{}, boskosProjs: []string{fakeBoskosProj}, skipCreation: false},
 			want: wantResult{
 				&container.Cluster{
-					Name:         "customcluster",
-					Location:     "us-central1",
-					Status:       "RUNNING",
-					AddonsConfig: &container.AddonsConfig{},
+					Name:                  "customcluster",
+					Location:              "us-central1",
+					Status:                "RUNNING",
+					InitialClusterVersion: "latest",
+					AddonsConfig:          &container.AddonsConfig{},
 					NodePools: []*container.NodePool{
 						{
 							Name:             "default-pool",
@@ -328,10 +336,11 @@ func TestAcquire(t *testing.T) {
 				nextOpStatus: []string{}, boskosProjs: []string{fakeBoskosProj}, skipCreation: false},
 			want: wantResult{
 				&container.Cluster{
-					Name:         "customcluster",
-					Location:     "us-central1",
-					Status:       "RUNNING",
-					AddonsConfig: &container.AddonsConfig{},
+					Name:                  "customcluster",
+					Location:              "us-central1",
+					Status:                "RUNNING",
+					InitialClusterVersion: "latest",
+					AddonsConfig:          &container.AddonsConfig{},
 					NodePools: []*container.NodePool{
 						{
 							Name:             "default-pool",
@@ -356,10 +365,11 @@ func TestAcquire(t *testing.T) {
 				nextOpStatus: []string{}, boskosProjs: []string{fakeBoskosProj}, skipCreation: false},
 			want: wantResult{
 				&container.Cluster{
-					Name:         "customcluster",
-					Location:     "us-central1",
-					Status:       "RUNNING",
-					AddonsConfig: &container.AddonsConfig{},
+					Name:                  "customcluster",
+					Location:              "us-central1",
+					Status:                "RUNNING",
+					InitialClusterVersion: "latest",
+					AddonsConfig:          &container.AddonsConfig{},
 					NodePools: []*container.NodePool{
 						{
 							Name:             "default-pool",
@@ -383,10 +393,11 @@ func TestAcquire(t *testing.T) {
 				nextOpStatus: []string{}, boskosProjs: []string{fakeBoskosProj}, skipCreation: false},
 			want: wantResult{
 				&container.Cluster{
-					Name:         "customcluster",
-					Location:     "us-central1",
-					Status:       "RUNNING",
-					AddonsConfig: &container.AddonsConfig{},
+					Name:                  "customcluster",
+					Location:              "us-central1",
+					Status:                "RUNNING",
+					InitialClusterVersion: "latest",
+					AddonsConfig:          &container.AddonsConfig{},
 					NodePools: []*container.NodePool{
 						{
 							Name:             "default-pool",
@@ -422,10 +433,11 @@ func TestAcquire(t *testing.T) {
 				boskosProjs: []string{fakeBoskosProj}, skipCreation: false},
 			want: wantResult{
 				&container.Cluster{
-					Name:         predefinedClusterName,
-					Location:     "us-central1",
-					Status:       "RUNNING",
-					AddonsConfig: &container.AddonsConfig{},
+					Name:                  predefinedClusterName,
+					Location:              "us-central1",
+					Status:                "RUNNING",
+					InitialClusterVersion: "latest",
+					AddonsConfig:          &container.AddonsConfig{},
 					NodePools: []*container.NodePool{
 						{
 							Name:             "default-pool",
@@ -448,9 +460,10 @@ func TestAcquire(t *testing.T) {
 				boskosProjs: []string{fakeBoskosProj}, skipCreation: false},
 			want: wantResult{
 				&container.Cluster{
-					Name:     predefinedClusterName,
-					Location: "us-central1",
-					Status:   "RUNNING",
+					Name:                  predefinedClusterName,
+					Location:              "us-central1",
+					Status:                "RUNNING",
+					InitialClusterVersion: "latest",
 					AddonsConfig: &container.AddonsConfig{
 						IstioConfig: &container.IstioConfig{Disabled: false},
 					},
@@ -476,10 +489,11 @@ func TestAcquire(t *testing.T) {
 				boskosProjs: []string{fakeBoskosProj}, skipCreation: false},
 			want: wantResult{
 				&container.Cluster{
-					Name:         predefinedClusterName,
-					Location:     "us-central1",
-					Status:       "RUNNING",
-					AddonsConfig: &container.AddonsConfig{},
+					Name:                  predefinedClusterName,
+					Location:              "us-central1",
+					Status:                "RUNNING",
+					InitialClusterVersion: "latest",
+					AddonsConfig:          &container.AddonsConfig{},
 					NodePools: []*container.NodePool{
 						{
 							Name:             "default-pool",
@@ -501,10 +515,11 @@ func TestAcquire(t *testing.T) {
 				boskosProjs: []string{fakeBoskosProj}, skipCreation: false},
 			want: wantResult{
 				&container.Cluster{
-					Name:         predefinedClusterName,
-					Location:     "us-west1",
-					Status:       "RUNNING",
-					AddonsConfig: &container.AddonsConfig{},
+					Name:                  predefinedClusterName,
+					Location:              "us-west1",
+					Status:                "RUNNING",
+					InitialClusterVersion: "latest",
+					AddonsConfig:          &container.AddonsConfig{},
 					NodePools: []*container.NodePool{
 						{
 							Name:             "default-pool",
@@ -524,7 +539,7 @@ func TestAcquire(t *testing.T) {
 				request: request{clusterName: predefinedClusterName, addons: []string{}},
 				isProw:  true, project: fakeProj, nextOpStatus: []string{"PENDING", "PENDING", "PENDING"},
 				boskosProjs: []string{fakeBoskosProj}, skipCreation: false},
-			want: wantResult{nil, fmt.Errorf("timed out waiting"), false},
+			want: wantResult{nil, &gke.OperationError{Name: "2", Type: "CREATE_CLUSTER", Status: "PENDING", Progress: -1, Err: gke.ErrTimeout}, false},
 		}, {
 			name: "cluster creation went bad state",
 			td: testdata{
@@ -622,8 +637,8 @@ func TestAcquire(t *testing.T) {
 				opCount++
 				fgc.Request.ClusterName = data.existCluster.Name
 				rb, _ := gke.NewCreateClusterRequest(&fgc.Request.Request)
-				fgc.operations.CreateClusterAsync(data.project, data.existCluster.Location, "", rb)
-				fgc.Cluster, _ = fgc.operations.GetCluster(data.project, data.existCluster.Location, "", data.existCluster.Name)
+				fgc.operations.CreateClusterAsync(context.Background(), data.project, data.existCluster.Location, "", rb)
+				fgc.Cluster, _ = fgc.operations.GetCluster(context.Background(), data.project, data.existCluster.Location, "", data.existCluster.Name)
 			}
 
 			fgc.Project = data.project
@@ -647,6 +662,14 @@ func TestAcquire(t *testing.T) {
 			if !reflect.DeepEqual(err, tt.want.expErr) {
 				t.Errorf("%s\nerror got: '%v'\nerror want: '%v'", errMsg, err, tt.want.expErr)
 			}
+			if tt.want.expCluster != nil && fgc.Cluster != nil && data.existCluster == nil {
+				// The clusters created are stamped with their owner, which
+				// depends on the environment and the time of the test
+				if _, ok := ownership.FromLabels(fgc.Cluster.ResourceLabels); !ok {
+					t.Errorf("%s\ncluster created without owner labels: '%v'", errMsg, fgc.Cluster.ResourceLabels)
+				}
+				tt.want.expCluster.ResourceLabels = fgc.Cluster.ResourceLabels
+			}
 			if dif := cmp.Diff(tt.want.expCluster, fgc.Cluster); dif != "" {
 				t.Errorf("%s\nCluster got(+) is different from wanted(-)\n%v", errMsg, dif)
 			}
@@ -654,6 +677,241 @@ func TestAcquire(t *testing.T) {
 	}
 }
 
+func TestAcquireRetries(t *testing.T) {
+	const clusterName = "e2e-cluster"
+	tests := []struct {
+		name string
+		// setup sets up the failures of the fake client
+		setup func(fgsc *gkeFake.GKESDKClient)
+		// backupNodeTypes are the node types tried after a stockout
+		backupNodeTypes []string
+		wantErr         error
+		wantRegion      string
+		// wantCreations are the regions the cluster is created in, in order
+		wantCreations []string
+		// wantNodeType is the node type of the cluster created, the default
+		// one if empty
+		wantNodeType string
+	}{{
+		name:          "stockout in the primary region",
+		setup:         func(fgsc *gkeFake.GKESDKClient) { fgsc.SetCapacity("us-central1", 0) },
+		wantRegion:    "us-west1",
+		wantCreations: []string{"us-central1", "us-west1"},
+	}, {
+		name: "version not available in the first regions yet",
+		setup: func(fgsc *gkeFake.GKESDKClient) {
+			for _, region := range []string{"us-central1", "us-west1"} {
+				fgsc.InjectFault(gkeFake.Fault{
+					Method:  gkeFake.MethodCreateCluster,
+					Region:  region,
+					Message: `Master version "1.99.0-gke.1" is unsupported.`,
+					Sync:    true,
+				})
+			}
+		},
+		wantRegion:    "us-east1",
+		wantCreations: []string{"us-central1", "us-west1", "us-east1"},
+	}, {
+		name: "stockout in all regions",
+		setup: func(fgsc *gkeFake.GKESDKClient) {
+			fgsc.InjectFault(gkeFake.Fault{Method: gkeFake.MethodCreateCluster, Code: gkeFake.CodeStockout, Message: "stockout"})
+		},
+		wantErr:       gke.ErrStockout,
+		wantCreations: []string{"us-central1", "us-west1", "us-east1"},
+	}, {
+		name: "stockout of the node type in the primary region",
+		setup: func(fgsc *gkeFake.GKESDKClient) {
+			fgsc.InjectFault(gkeFake.Fault{
+				Method:  gkeFake.MethodCreateCluster,
+				Code:    gkeFake.CodeStockout,
+				Message: "Google Compute Engine does not have enough resources available to fulfill request: us-central1-a.",
+				Times:   1,
+			})
+		},
+		backupNodeTypes: []string{"e2-standard-8"},
+		wantRegion:      "us-central1",
+		wantCreations:   []string{"us-central1", "us-central1"},
+		wantNodeType:    "e2-standard-8",
+	}, {
+		name:          "quota exceeded fails fast",
+		setup:         func(fgsc *gkeFake.GKESDKClient) { fgsc.SetQuota(fakeProj, "us-central1", 0) },
+		wantErr:       gke.ErrQuotaExceeded,
+		wantCreations: []string{"us-central1"},
+	}}
+
+	oldEnvFunc := common.GetOSEnv
+	defer func() {
+		common.GetOSEnv = oldEnvFunc
+	}()
+	// Not running in Prow, so that the clusters failed to create are deleted.
+	common.GetOSEnv = func(key string) string {
+		if key == "PROW_JOB_ID" {
+			return ""
+		}
+		return oldEnvFunc(key)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fgc := setupFakeGKECluster()
+			fgsc := fgc.operations.(*gkeFake.GKESDKClient)
+			clock := gkeFake.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+			// Operations take minutes, each poll moves the clock forward.
+			fgsc.SetLifecycle(gkeFake.Lifecycle{
+				Clock:           clock,
+				PendingDuration: time.Minute,
+				RunningDuration: 5 * time.Minute,
+				PollAdvance:     4 * time.Minute,
+			})
+			tt.setup(fgsc)
+			fgc.Project = fakeProj
+			fgc.Request = &GKERequest{
+				Request: gke.Request{
+					ClusterName: clusterName,
+					MinNodes:    defaultGKEMinNodes,
+					MaxNodes:    defaultGKEMaxNodes,
+					NodeType:    defaultGKENodeType,
+					Region:      defaultGKERegion,
+				},
+				BackupRegions:   defaultGKEBackupRegions,
+				BackupNodeTypes: tt.backupNodeTypes,
+				ResourceType:    defaultResourceType,
+			}
+			fgc.asyncCleanup = false
+
+			err := fgc.Acquire()
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Expected no error, but got '%v'", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected error '%v', but got '%v'", tt.wantErr, err)
+			}
+			if tt.wantRegion != "" && (fgc.Cluster == nil || fgc.Cluster.Location != tt.wantRegion || fgc.Cluster.Status != "RUNNING") {
+				t.Fatalf("Expected a RUNNING cluster in %q, but got %+v", tt.wantRegion, fgc.Cluster)
+			}
+			if tt.wantNodeType == "" {
+				tt.wantNodeType = defaultGKENodeType
+			}
+			if fgc.Cluster != nil && fgc.Cluster.NodePools[0].Config.MachineType != tt.wantNodeType {
+				t.Fatalf("Expected node type %q, but got %q", tt.wantNodeType, fgc.Cluster.NodePools[0].Config.MachineType)
+			}
+
+			var creations []string
+			for _, call := range fgsc.Calls() {
+				if call.Method == gkeFake.MethodCreateCluster {
+					creations = append(creations, call.Location)
+				}
+			}
+			if !reflect.DeepEqual(creations, tt.wantCreations) {
+				t.Fatalf("Expected the cluster to be created in %v, but got %v", tt.wantCreations, creations)
+			}
+			// The clusters failed to create are deleted in the background.
+			clock.Advance(time.Hour)
+			wantClusters := map[string][]string{}
+			if tt.wantRegion != "" {
+				wantClusters[fmt.Sprintf("projects/%s/locations/%s", fakeProj, tt.wantRegion)] = []string{clusterName}
+			}
+			if clusters := fgsc.Clusters(); !reflect.DeepEqual(clusters, wantClusters) {
+				t.Fatalf("Expected clusters %v, but got %v", wantClusters, clusters)
+			}
+		})
+	}
+}
+
+func TestAcquireBoskosProject(t *testing.T) {
+	tests := []struct {
+		name                string
+		resourceType        string
+		backupResourceTypes []string
+		boskosProject       string
+		wantProject         string
+		wantErr             bool
+	}{{
+		name:        "project of the resource type",
+		wantProject: "shared-0",
+	}, {
+		name:                "project of a backup resource type",
+		resourceType:        "missing",
+		backupResourceTypes: []string{"missing-too", "dedicated"},
+		wantProject:         "dedicated-0",
+	}, {
+		name:          "project with the name",
+		boskosProject: "dedicated-1",
+		wantProject:   "dedicated-1",
+	}, {
+		name:          "busy project with the name",
+		boskosProject: "busy-0",
+		wantErr:       true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fgc := setupFakeGKECluster()
+			fbc := fgc.boskosOps.(*boskosFake.FakeBoskosClient)
+			fbc.NewResource("busy-0", defaultResourceType)
+			if _, err := fbc.AcquireGKEProject(defaultResourceType); err != nil {
+				t.Fatalf("Failed acquiring the busy project: '%v'", err)
+			}
+			fbc.NewResource("dedicated-0", "dedicated")
+			fbc.NewResource("dedicated-1", "dedicated")
+			fbc.NewResource("shared-0", defaultResourceType)
+			if tt.resourceType == "" {
+				tt.resourceType = defaultResourceType
+			}
+			fgc.Request = &GKERequest{
+				ResourceType:        tt.resourceType,
+				BackupResourceTypes: tt.backupResourceTypes,
+				BoskosProject:       tt.boskosProject,
+			}
+
+			p, err := fgc.acquireBoskosProject()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Expected an error, but acquired %q", p.Name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, but got '%v'", err)
+			}
+			if p.Name != tt.wantProject {
+				t.Fatalf("Expected project %q, but got %q", tt.wantProject, p.Name)
+			}
+		})
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	fgc := setupFakeGKECluster()
+	if err := fgc.Heartbeat(context.Background()); err == nil {
+		t.Fatal("Expected an error keeping the lease of a project not acquired from boskos alive, but got nil")
+	}
+
+	fbc := fgc.boskosOps.(*boskosFake.FakeBoskosClient)
+	fbc.NewGKEProject(fakeProj)
+	if _, err := fbc.AcquireGKEProject(defaultResourceType); err != nil {
+		t.Fatalf("Failed acquiring the project: '%v'", err)
+	}
+	fgc.isBoskos = true
+	fgc.Project = fakeProj
+	done := make(chan error)
+	go func() {
+		done <- fgc.Heartbeat(context.Background())
+	}()
+	// The heartbeat stops once the project is released, e.g. by delete.
+	time.Sleep(10 * time.Millisecond)
+	if err := fbc.ReleaseGKEProject(fakeProj); err != nil {
+		t.Fatalf("Failed releasing the project: '%v'", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Expected no error, but got '%v'", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the heartbeat to stop once the project is released")
+	}
+}
+
 func TestDelete(t *testing.T) {
 	type testdata struct {
 		isProw      bool
@@ -780,8 +1038,8 @@ func TestDelete(t *testing.T) {
 			if data.cluster != nil {
 				fgc.Request.ClusterName = data.cluster.Name
 				rb, _ := gke.NewCreateClusterRequest(&fgc.Request.Request)
-				fgc.operations.CreateClusterAsync(fakeProj, data.cluster.Location, "", rb)
-				fgc.Cluster, _ = fgc.operations.GetCluster(fakeProj, data.cluster.Location, "", data.cluster.Name)
+				fgc.operations.CreateClusterAsync(context.Background(), fakeProj, data.cluster.Location, "", rb)
+				fgc.Cluster, _ = fgc.operations.GetCluster(context.Background(), fakeProj, data.cluster.Location, "", data.cluster.Name)
 			}
 			// Set up fake boskos
 			for _, bos := range data.boskosState {
@@ -793,7 +1051,7 @@ func TestDelete(t *testing.T) {
 			err := fgc.Delete()
 			var gotCluster *container.Cluster
 			if data.cluster != nil {
-				gotCluster, _ = fgc.operations.GetCluster(fakeProj, data.cluster.Location, "", data.cluster.Name)
+				gotCluster, _ = fgc.operations.GetCluster(context.Background(), fakeProj, data.cluster.Location, "", data.cluster.Name)
 			}
 			gotBoskos := fgc.boskosOps.(*boskosFake.FakeBoskosClient).GetResources()
 			errMsg := fmt.Sprintf("testing deleting cluster, with:\n\tIs Prow: '%v'\n\tIs Boskos: '%v'\n\t"+
@@ -811,3 +1069,61 @@ func TestDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteProtected(t *testing.T) {
+	policy, err := protection.Parse([]byte(`
+rules:
+- kind: cluster
+  names: [knative-prow]
+  deny: ["*"]
+- kind: cluster
+  selector: env=prod
+  deny: [delete]
+`))
+	if err != nil {
+		t.Fatalf("Expected no error parsing the policy, but got '%v'", err)
+	}
+	tests := []struct {
+		name    string
+		cluster string
+		labels  map[string]string
+		wantErr error
+	}{
+		{"protected by name", "knative-prow", nil, protection.ErrProtected},
+		{"protected by labels", "customcluster", map[string]string{"env": "prod"}, protection.ErrProtected},
+		{"not protected", "customcluster", map[string]string{"env": "test"}, nil},
+	}
+
+	oldExecFunc := common.StandardExec
+	defer func() {
+		common.StandardExec = oldExecFunc
+	}()
+	common.StandardExec = func(name string, args ...string) ([]byte, error) {
+		if name == "kubectl" {
+			return nil, errors.New("kubectl not set")
+		}
+		return []byte(""), nil
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fgc := setupFakeGKECluster()
+			fgc.Project = fakeProj
+			fgc.policy = policy
+			fgc.Request.Request = gke.Request{ClusterName: tt.cluster, MinNodes: 1, MaxNodes: 1, NodeType: defaultGKENodeType}
+			rb, _ := gke.NewCreateClusterRequest(&fgc.Request.Request)
+			fgc.operations.CreateClusterAsync(context.Background(), fakeProj, defaultGKERegion, "", rb)
+			fgc.Cluster, _ = fgc.operations.GetCluster(context.Background(), fakeProj, defaultGKERegion, "", tt.cluster)
+			fgc.Cluster.ResourceLabels = tt.labels
+
+			err := fgc.Delete()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected error '%v', but got '%v'", tt.wantErr, err)
+			}
+			cluster, _ := fgc.operations.GetCluster(context.Background(), fakeProj, defaultGKERegion, "", tt.cluster)
+			if deleted := cluster == nil; deleted != (tt.wantErr == nil) {
+				t.Fatalf("Expected the cluster to be deleted only if it's not protected, but deleted is %v", deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gke
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	container "google.golang.org/api/container/v1beta1"
+	"gopkg.in/yaml.v2"
+
+	"knative.dev/test-infra/pkg/gke"
+)
+
+// kubeconfigDir is the directory of the default kubeconfig files of the
+// clusters, used if Request.Kubeconfig is empty
+var kubeconfigDir = filepath.Join(os.TempDir(), "kntest")
+
+// kubeconfig is the subset of the kubeconfig format written for a cluster
+type kubeconfig struct {
+	APIVersion     string         `yaml:"apiVersion"`
+	Kind           string         `yaml:"kind"`
+	Clusters       []namedCluster `yaml:"clusters"`
+	Contexts       []namedContext `yaml:"contexts"`
+	Users          []namedUser    `yaml:"users"`
+	CurrentContext string         `yaml:"current-context"`
+}
+
+type namedCluster struct {
+	Name    string `yaml:"name"`
+	Cluster struct {
+		Server                   string `yaml:"server"`
+		CertificateAuthorityData string `yaml:"certificate-authority-data"`
+	} `yaml:"cluster"`
+}
+
+type namedContext struct {
+	Name    string `yaml:"name"`
+	Context struct {
+		Cluster string `yaml:"cluster"`
+		User    string `yaml:"user"`
+	} `yaml:"context"`
+}
+
+type namedUser struct {
+	Name string `yaml:"name"`
+	User struct {
+		AuthProvider struct {
+			Name string `yaml:"name"`
+		} `yaml:"auth-provider"`
+	} `yaml:"user"`
+}
+
+// contextName returns the name of the kubeconfig context of the cluster, in
+// the form of gke_PROJECT_LOCATION_CLUSTER like gcloud names it
+func contextName(project string, cluster *container.Cluster) string {
+	return fmt.Sprintf("gke_%s_%s_%s", project, cluster.Location, cluster.Name)
+}
+
+// defaultKubeconfig returns the default kubeconfig file of the cluster. There
+// is one per cluster, so that the runs in parallel on the same machine don't
+// overwrite each other's kubeconfig.
+func defaultKubeconfig(project string, cluster *container.Cluster) string {
+	return filepath.Join(kubeconfigDir, contextName(project, cluster)+".kubeconfig")
+}
+
+// newKubeconfig returns a kubeconfig with a single context for the cluster.
+// The user authenticates with the gcp auth provider, i.e. with the application
+// default credentials, so that the global gcloud config isn't needed.
+func newKubeconfig(project string, cluster *container.Cluster) (*kubeconfig, error) {
+	if cluster.Endpoint == "" || cluster.MasterAuth == nil || cluster.MasterAuth.ClusterCaCertificate == "" {
+		return nil, fmt.Errorf("cluster %q doesn't have an endpoint and a CA certificate yet", cluster.Name)
+	}
+	name := contextName(project, cluster)
+	kc := &kubeconfig{
+		APIVersion:     "v1",
+		Kind:           "Config",
+		Clusters:       []namedCluster{{Name: name}},
+		Contexts:       []namedContext{{Name: name}},
+		Users:          []namedUser{{Name: name}},
+		CurrentContext: name,
+	}
+	kc.Clusters[0].Cluster.Server = "https://" + cluster.Endpoint
+	kc.Clusters[0].Cluster.CertificateAuthorityData = cluster.MasterAuth.ClusterCaCertificate
+	kc.Contexts[0].Context.Cluster = name
+	kc.Contexts[0].Context.User = name
+	kc.Users[0].User.AuthProvider.Name = "gcp"
+	return kc, nil
+}
+
+// kubeconfigPath returns the dedicated kubeconfig file of the cluster:
+// Request.Kubeconfig if it's set, e.g. to the kubeconfig recorded in the
+// metadata by create, or the default kubeconfig file of the cluster if it's
+// known or requested. It's empty otherwise, the global kubeconfig is never
+// used.
+func (gc *GKECluster) kubeconfigPath() string {
+	switch {
+	case gc.Request.Kubeconfig != "":
+		return gc.Request.Kubeconfig
+	case gc.Cluster != nil:
+		return defaultKubeconfig(gc.Project, gc.Cluster)
+	case gc.Request.Project != "" && gc.Request.ClusterName != "":
+		return defaultKubeconfig(gc.Request.Project, &container.Cluster{
+			Name:     gc.Request.ClusterName,
+			Location: gke.GetClusterLocation(gc.Request.Region, gc.Request.Zone),
+		})
+	}
+	return ""
+}
+
+// WriteKubeconfig writes the credentials of the cluster to a dedicated
+// kubeconfig file instead of the global kubeconfig, so that tests running in
+// parallel on the same machine don't change each other's current context.
+// The file is Request.Kubeconfig, or the default kubeconfig file of the
+// cluster if it's empty, its path is saved in Kubeconfig.
+func (gc *GKECluster) WriteKubeconfig() error {
+	if gc.Cluster == nil {
+		return errors.New("cluster doesn't exist")
+	}
+	kc, err := newKubeconfig(gc.Project, gc.Cluster)
+	if err != nil {
+		return err
+	}
+	content, err := yaml.Marshal(kc)
+	if err != nil {
+		return fmt.Errorf("failed marshaling the kubeconfig: %w", err)
+	}
+
+	path := gc.kubeconfigPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed creating the directory of the kubeconfig file: %w", err)
+	}
+	// The kubeconfig gives access to the cluster, only the user can read it.
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		return fmt.Errorf("failed writing the kubeconfig file %q: %w", path, err)
+	}
+	gc.Kubeconfig = path
+	log.Printf("Wrote the kubeconfig of cluster %q to %q, use it with: export KUBECONFIG=%s", gc.Cluster.Name, path, path)
+	return nil
+}
+
+// RemoveKubeconfig removes the dedicated kubeconfig file of the cluster once
+// it's deleted. The file is only removed if it was written by WriteKubeconfig
+// for this cluster, so that a kubeconfig shared with other clusters, e.g. the
+// global one given with Request.Kubeconfig, is never changed.
+func (gc *GKECluster) RemoveKubeconfig() error {
+	if gc.Cluster == nil {
+		return errors.New("cluster doesn't exist")
+	}
+	path := gc.kubeconfigPath()
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed reading the kubeconfig file %q: %w", path, err)
+	}
+	var kc kubeconfig
+	if err := yaml.Unmarshal(content, &kc); err != nil || len(kc.Contexts) != 1 ||
+		kc.Contexts[0].Name != contextName(gc.Project, gc.Cluster) {
+		log.Printf("Not removing kubeconfig %q, it isn't dedicated to cluster %q", path, gc.Cluster.Name)
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed removing the kubeconfig file %q: %w", path, err)
+	}
+	return nil
+}
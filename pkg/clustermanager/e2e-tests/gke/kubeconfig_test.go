@@ -0,0 +1,281 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gke
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	container "google.golang.org/api/container/v1beta1"
+	"gopkg.in/yaml.v2"
+
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/common"
+	"knative.dev/test-infra/pkg/gke"
+)
+
+func TestWriteKubeconfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatalf("Failed creating temp dir: '%v'", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fgc := setupFakeGKECluster()
+	fgc.Project = fakeProj
+	fgc.Request.Kubeconfig = filepath.Join(dir, "nested", "kubeconfig")
+	fgc.Cluster = &container.Cluster{
+		Name:       "customcluster",
+		Location:   "us-central1",
+		Endpoint:   "10.0.0.1",
+		MasterAuth: &container.MasterAuth{ClusterCaCertificate: "Q0EgZGF0YQ=="},
+	}
+	if err := fgc.WriteKubeconfig(); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if fgc.Kubeconfig != fgc.Request.Kubeconfig {
+		t.Fatalf("Expected kubeconfig %q, but got %q", fgc.Request.Kubeconfig, fgc.Kubeconfig)
+	}
+	info, err := os.Stat(fgc.Kubeconfig)
+	if err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected kubeconfig mode 0600, but got %v", info.Mode().Perm())
+	}
+	content, _ := ioutil.ReadFile(fgc.Kubeconfig)
+	var kc kubeconfig
+	if err := yaml.Unmarshal(content, &kc); err != nil {
+		t.Fatalf("Expected a valid kubeconfig, but got '%v'", err)
+	}
+	wantContext := "gke_b_us-central1_customcluster"
+	if kc.CurrentContext != wantContext || len(kc.Clusters) != 1 || kc.Clusters[0].Cluster.Server != "https://10.0.0.1" ||
+		kc.Clusters[0].Cluster.CertificateAuthorityData != "Q0EgZGF0YQ==" || kc.Users[0].User.AuthProvider.Name != "gcp" {
+		t.Errorf("Expected a kubeconfig for context %q, but got:\n%s", wantContext, content)
+	}
+
+	// The default file of the cluster is used if the kubeconfig isn't
+	// requested, another cluster gets its own file.
+	oldDir := kubeconfigDir
+	defer func() {
+		kubeconfigDir = oldDir
+	}()
+	kubeconfigDir = filepath.Join(dir, "default")
+	fgc.Request.Kubeconfig = ""
+	if err := fgc.WriteKubeconfig(); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	wantKubeconfig := filepath.Join(dir, "default", "gke_b_us-central1_customcluster.kubeconfig")
+	if fgc.Kubeconfig != wantKubeconfig {
+		t.Errorf("Expected the default kubeconfig %q, but got %q", wantKubeconfig, fgc.Kubeconfig)
+	}
+	other := setupFakeGKECluster()
+	other.Project = fakeProj
+	other.Cluster = &container.Cluster{
+		Name:       "othercluster",
+		Location:   "us-central1",
+		Endpoint:   "10.0.0.2",
+		MasterAuth: &container.MasterAuth{ClusterCaCertificate: "Q0EgZGF0YQ=="},
+	}
+	if err := other.WriteKubeconfig(); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if other.Kubeconfig == fgc.Kubeconfig {
+		t.Errorf("Expected another default kubeconfig for another cluster, but got %q for both", fgc.Kubeconfig)
+	}
+	if _, err := os.Stat(fgc.Kubeconfig); err != nil {
+		t.Errorf("Expected the kubeconfig of the first cluster to be kept, but got '%v'", err)
+	}
+
+	// The cluster must be reachable.
+	fgc.Cluster.Endpoint = ""
+	if err := fgc.WriteKubeconfig(); err == nil {
+		t.Error("Expected an error writing the kubeconfig of a cluster without endpoint, but got nil")
+	}
+}
+
+func TestCheckEnvironmentKubeconfig(t *testing.T) {
+	const path = "/path/to/kubeconfig"
+	oldExecFunc := common.StandardExec
+	defer func() {
+		common.StandardExec = oldExecFunc
+	}()
+	// Only the requested kubeconfig points to the cluster.
+	common.StandardExec = func(name string, args ...string) ([]byte, error) {
+		if name == "kubectl" && strings.HasSuffix(strings.Join(args, " "), "--kubeconfig "+path) {
+			return []byte("gke_b_us-central1_customcluster"), nil
+		}
+		if name == "kubectl" {
+			return []byte("gke_b_us-central1_othercluster"), nil
+		}
+		return nil, fmt.Errorf("unexpected command %s %v", name, args)
+	}
+
+	fgc := setupFakeGKECluster()
+	fgc.operations.CreateClusterAsync(context.Background(), fakeProj, "us-central1", "", &container.CreateClusterRequest{
+		Cluster:   &container.Cluster{Name: "customcluster"},
+		ProjectId: fakeProj,
+	})
+	fgc.Request.Kubeconfig = path
+	if err := fgc.checkEnvironment(); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if fgc.Cluster == nil || fgc.Cluster.Name != "customcluster" || fgc.Project != fakeProj {
+		t.Fatalf("Expected cluster 'customcluster' in project %q, but got %+v in project %q", fakeProj, fgc.Cluster, fgc.Project)
+	}
+
+	// Without a kubeconfig requested, nor a cluster to derive the default one
+	// from, no kubeconfig is looked up.
+	common.StandardExec = func(name string, args ...string) ([]byte, error) {
+		if name == "kubectl" {
+			t.Errorf("Unexpected command %s %v", name, args)
+		}
+		return nil, nil
+	}
+	fgc = setupFakeGKECluster()
+	if err := fgc.checkEnvironment(); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if fgc.Cluster != nil {
+		t.Errorf("Expected no cluster, but got %+v", fgc.Cluster)
+	}
+}
+
+// TestKubeconfigLifecycle creates, gets and deletes a cluster without
+// requesting a kubeconfig, the way kntest runs them in sequence, the later
+// commands getting the kubeconfig written by create from the metadata
+func TestKubeconfigLifecycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatalf("Failed creating temp dir: '%v'", err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldDir, oldExecFunc, oldEnvFunc := kubeconfigDir, common.StandardExec, common.GetOSEnv
+	defer func() {
+		kubeconfigDir, common.StandardExec, common.GetOSEnv = oldDir, oldExecFunc, oldEnvFunc
+	}()
+	kubeconfigDir = dir
+	common.GetOSEnv = func(key string) string {
+		if key == "PROW_JOB_ID" {
+			return ""
+		}
+		return oldEnvFunc(key)
+	}
+	// kubectl reads the current context of the given kubeconfig, the global
+	// kubeconfig must never be used.
+	common.StandardExec = func(name string, args ...string) ([]byte, error) {
+		cmd := strings.Join(append([]string{name}, args...), " ")
+		if !strings.HasPrefix(cmd, "kubectl config current-context --kubeconfig ") {
+			t.Errorf("Unexpected command %q", cmd)
+			return nil, fmt.Errorf("unexpected command %q", cmd)
+		}
+		content, err := ioutil.ReadFile(args[len(args)-1])
+		if err != nil {
+			return nil, err
+		}
+		var kc kubeconfig
+		if err := yaml.Unmarshal(content, &kc); err != nil {
+			return nil, err
+		}
+		return []byte(kc.CurrentContext), nil
+	}
+
+	// Create
+	fgc := setupFakeGKECluster()
+	fgc.Project = fakeProj
+	fgc.Request = &GKERequest{
+		Request: gke.Request{
+			ClusterName: "e2e-cluster",
+			MinNodes:    defaultGKEMinNodes,
+			MaxNodes:    defaultGKEMaxNodes,
+			NodeType:    defaultGKENodeType,
+			Region:      defaultGKERegion,
+		},
+		ResourceType: defaultResourceType,
+	}
+	if err := fgc.Acquire(); err != nil {
+		t.Fatalf("Expected no error creating the cluster, but got '%v'", err)
+	}
+	fgc.Cluster.Endpoint = "10.0.0.1"
+	fgc.Cluster.MasterAuth = &container.MasterAuth{ClusterCaCertificate: "Q0EgZGF0YQ=="}
+	if err := fgc.WriteKubeconfig(); err != nil {
+		t.Fatalf("Expected no error writing the kubeconfig, but got '%v'", err)
+	}
+
+	// Get
+	get := setupFakeGKECluster()
+	get.operations = fgc.operations
+	get.Request.SkipCreation = true
+	get.Request.Kubeconfig = fgc.Kubeconfig
+	if err := get.Acquire(); err != nil {
+		t.Fatalf("Expected no error getting the cluster, but got '%v'", err)
+	}
+	if get.Cluster == nil || get.Cluster.Name != "e2e-cluster" || get.Project != fakeProj {
+		t.Fatalf("Expected cluster 'e2e-cluster' in project %q, but got %+v in project %q", fakeProj, get.Cluster, get.Project)
+	}
+
+	// Delete
+	del := setupFakeGKECluster()
+	del.operations = fgc.operations
+	del.Request.Kubeconfig = fgc.Kubeconfig
+	if err := del.Delete(); err != nil {
+		t.Fatalf("Expected no error deleting the cluster, but got '%v'", err)
+	}
+	if _, err := fgc.operations.GetCluster(context.Background(), fakeProj, defaultGKERegion, "", "e2e-cluster"); err == nil {
+		t.Error("Expected the cluster to be deleted")
+	}
+	if err := del.RemoveKubeconfig(); err != nil {
+		t.Fatalf("Expected no error removing the kubeconfig, but got '%v'", err)
+	}
+	if _, err := os.Stat(fgc.Kubeconfig); !os.IsNotExist(err) {
+		t.Errorf("Expected the kubeconfig to be removed, but got '%v'", err)
+	}
+}
+
+func TestRemoveKubeconfigOfOtherCluster(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatalf("Failed creating temp dir: '%v'", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fgc := setupFakeGKECluster()
+	fgc.Project = fakeProj
+	fgc.Request.Kubeconfig = filepath.Join(dir, "config")
+	fgc.Cluster = &container.Cluster{
+		Name:       "othercluster",
+		Location:   "us-central1",
+		Endpoint:   "10.0.0.1",
+		MasterAuth: &container.MasterAuth{ClusterCaCertificate: "Q0EgZGF0YQ=="},
+	}
+	if err := fgc.WriteKubeconfig(); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	// A kubeconfig not written for the cluster is kept.
+	fgc.Cluster.Name = "customcluster"
+	if err := fgc.RemoveKubeconfig(); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if _, err := os.Stat(fgc.Request.Kubeconfig); err != nil {
+		t.Errorf("Expected the kubeconfig of another cluster to be kept, but got '%v'", err)
+	}
+}
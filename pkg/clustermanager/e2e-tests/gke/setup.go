@@ -19,12 +19,15 @@ package gke
 import (
 	"log"
 	"strings"
+	"time"
 
 	container "google.golang.org/api/container/v1beta1"
 
 	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/boskos"
 	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/common"
+	"knative.dev/test-infra/pkg/failure"
 	"knative.dev/test-infra/pkg/gke"
+	"knative.dev/test-infra/pkg/protection"
 )
 
 // GKEClient implements Client
@@ -40,14 +43,53 @@ type GKERequest struct {
 	// failure due to regional issue(s)
 	BackupRegions []string
 
+	// BackupNodeTypes: fall back node types to try out in the same region in
+	// case of cluster creation failure due to a stockout of the node type
+	BackupNodeTypes []string
+
 	// SkipCreation: skips cluster creation
 	SkipCreation bool
 
 	// ResourceType: the boskos resource type to acquire to hold the cluster in create
 	ResourceType string
 
+	// BackupResourceTypes: fall back boskos resource types to acquire a
+	// project of, in order, if there is no free project of ResourceType
+	BackupResourceTypes []string
+
+	// BoskosProject: the name of the boskos project to acquire, instead of any
+	// free project of the resource types
+	BoskosProject string
+
+	// BoskosReleaseState: the state the boskos project is released to on
+	// delete, "dirty" if it's empty
+	BoskosReleaseState string
+
+	// BoskosURL: the URL of the Boskos server to acquire the project from,
+	// e.g. a local Boskos server. The project is acquired from Boskos outside
+	// of Prow too if it's set, the URL in BOSKOS_URL is used if it's empty.
+	BoskosURL string
+
 	// SaveMetaData: save the meta data for the created cluster into a file
 	SaveMetaData bool
+
+	// ProtectionPolicy: the protection policy file the operations are checked
+	// against, the default protection policy is used if it's empty
+	ProtectionPolicy string
+
+	// TTL: how long the cluster lives before it can be reaped, it's stamped
+	// on the cluster with the ownership labels. ownership.DefaultTTL is used
+	// if it's 0, the cluster never expires if it's negative.
+	TTL time.Duration
+
+	// FailureClasses: the failure classes file the cluster creation failures
+	// are classified with, the default failure classes are used if it's empty
+	FailureClasses string
+
+	// Kubeconfig: the dedicated kubeconfig file the cluster is looked up from,
+	// and its credentials are written to. A default file is used if it's
+	// empty, the global kubeconfig is never used.
+	Kubeconfig string
 }
 
 // GKECluster implements ClusterOperations
@@ -56,6 +98,8 @@ type GKECluster struct {
 	// Project might be GKE specific, so put it here
 	Project string
 	Cluster *container.Cluster
+	// Kubeconfig is the path of the kubeconfig file written by WriteKubeconfig
+	Kubeconfig string
 
 	// isBoskos is true if the GCP project used is managed by boskos
 	isBoskos bool
@@ -64,6 +108,11 @@ type GKECluster struct {
 	asyncCleanup bool
 	operations   gke.SDKOperations
 	boskosOps    boskos.Operation
+	// policy is the protection policy, the default one if nil
+	policy *protection.Policy
+	// classifier classifies the cluster creation failures, the default one if
+	// nil
+	classifier *failure.Classifier
 }
 
 // Setup sets up a GKECluster client, takes GEKRequest as parameter and applies
@@ -76,6 +125,10 @@ func (gs *GKEClient) Setup(r GKERequest) ClusterOperations {
 	} else if common.IsProw() { // if no project is provided and is on Prow, use boskos
 		gc.isBoskos = true
 		gc.asyncCleanup = true
+	} else if r.BoskosURL != "" || common.GetOSEnv(boskos.URLEnv) != "" {
+		// if no project is provided and a Boskos server is set, e.g. a local
+		// one, use it but delete the cluster synchronously as on local
+		gc.isBoskos = true
 	}
 
 	if r.MinNodes == 0 {
@@ -121,11 +174,28 @@ func (gs *GKEClient) Setup(r GKERequest) ClusterOperations {
 		r.ResourceType = defaultResourceType
 	}
 
+	policy, err := protection.Load(r.ProtectionPolicy)
+	if err != nil {
+		log.Fatalf("Failed loading the protection policy: '%v'", err)
+	}
+	gc.policy = policy
+
+	classifier, err := failure.Load(r.FailureClasses)
+	if err != nil {
+		log.Fatalf("Failed loading the failure classes: '%v'", err)
+	}
+	gc.classifier = classifier
+
 	gc.Request = &r
 
+	opts := []boskos.ClientOption{boskos.WithURL(r.BoskosURL)}
+	if r.BoskosReleaseState != "" {
+		opts = append(opts, boskos.WithReleaseState(r.BoskosReleaseState))
+	}
 	client, err := boskos.NewClient("", /* boskos owner */
 		"", /* boskos user */
-		"" /* boskos password file */)
+		"", /* boskos password file */
+		opts...)
 	if err != nil {
 		log.Fatalf("Failed to create boskos client: '%v'", err)
 	}
@@ -0,0 +1,136 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	container "google.golang.org/api/container/v1beta1"
+
+	"knative.dev/test-infra/pkg/gke"
+	"knative.dev/test-infra/pkg/protection"
+)
+
+// ResizeRequest contains the settings to resize a node pool of the cluster
+type ResizeRequest struct {
+	// NodePool: name of the node pool, default to be "default-pool"
+	NodePool string
+
+	// NumNodes: the number of nodes to resize the node pool to, not resized if negative
+	NumNodes int64
+
+	// MinNodes, MaxNodes: the autoscaling range of the node pool, autoscaling
+	// isn't changed if MaxNodes is 0
+	MinNodes int64
+	MaxNodes int64
+}
+
+// Upgrade upgrades the master of the cluster to the given version, then the
+// given node pools to the version of the master, all the node pools if
+// nodePools is nil. Pass an empty nodePools to only upgrade the master.
+func (gc *GKECluster) Upgrade(version string, nodePools []string) error {
+	client, err := gc.updatableCluster()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	region, zone := gke.RegionZoneFromLoc(gc.Cluster.Location)
+	log.Printf("Upgrading the master of cluster %q in %q to %q", gc.Cluster.Name, gc.Cluster.Location, version)
+	if err := client.UpgradeMaster(ctx, gc.Project, region, zone, gc.Cluster.Name, version, gke.WithProgress(logProgress())); err != nil {
+		return fmt.Errorf("failed upgrading the master: '%w'", err)
+	}
+	if nodePools == nil {
+		for _, np := range gc.Cluster.NodePools {
+			nodePools = append(nodePools, np.Name)
+		}
+	}
+	for _, np := range nodePools {
+		log.Printf("Upgrading node pool %q of cluster %q to the master version", np, gc.Cluster.Name)
+		if err := client.UpgradeNodePool(ctx, gc.Project, region, zone, gc.Cluster.Name, np, masterNodeVersion, gke.WithProgress(logProgress())); err != nil {
+			return fmt.Errorf("failed upgrading node pool %q: '%w'", np, err)
+		}
+	}
+	return gc.refreshCluster(client)
+}
+
+// Resize resizes a node pool of the cluster, its autoscaling range is set
+// before its number of nodes.
+func (gc *GKECluster) Resize(req ResizeRequest) error {
+	if req.NumNodes < 0 && req.MaxNodes == 0 {
+		return errors.New("either the number of nodes or the autoscaling range must be set")
+	}
+	if req.MaxNodes != 0 && (req.MinNodes < 0 || req.MinNodes > req.MaxNodes) {
+		return fmt.Errorf("invalid autoscaling range %d-%d", req.MinNodes, req.MaxNodes)
+	}
+	client, err := gc.updatableCluster()
+	if err != nil {
+		return err
+	}
+	if req.NodePool == "" {
+		req.NodePool = defaultNodePool
+	}
+	ctx := context.Background()
+	region, zone := gke.RegionZoneFromLoc(gc.Cluster.Location)
+	if req.MaxNodes != 0 {
+		log.Printf("Setting the autoscaling of node pool %q of cluster %q to %d-%d", req.NodePool, gc.Cluster.Name, req.MinNodes, req.MaxNodes)
+		autoscaling := &container.NodePoolAutoscaling{Enabled: true, MinNodeCount: req.MinNodes, MaxNodeCount: req.MaxNodes}
+		if err := client.SetNodePoolAutoscaling(ctx, gc.Project, region, zone, gc.Cluster.Name, req.NodePool, autoscaling,
+			gke.WithProgress(logProgress())); err != nil {
+			return fmt.Errorf("failed setting the autoscaling of node pool %q: '%w'", req.NodePool, err)
+		}
+	}
+	if req.NumNodes >= 0 {
+		log.Printf("Resizing node pool %q of cluster %q to %d nodes", req.NodePool, gc.Cluster.Name, req.NumNodes)
+		if err := client.ResizeNodePool(ctx, gc.Project, region, zone, gc.Cluster.Name, req.NodePool, req.NumNodes,
+			gke.WithProgress(logProgress())); err != nil {
+			return fmt.Errorf("failed resizing node pool %q: '%w'", req.NodePool, err)
+		}
+	}
+	return gc.refreshCluster(client)
+}
+
+// updatableCluster checks the cluster can be updated, and returns the GKE client to update it
+func (gc *GKECluster) updatableCluster() (gke.SDKOperations, error) {
+	if err := gc.checkEnvironment(); err != nil {
+		return nil, fmt.Errorf("failed checking project/cluster from environment: '%w'", err)
+	}
+	if err := gc.ensureProtected(protection.ActionUpdate); err != nil {
+		return nil, err
+	}
+	if gc.Cluster == nil {
+		return nil, errors.New("cluster doesn't exist")
+	}
+	client, err := gc.newGKEClient(gc.Project, gc.Request.GCPCredentialFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating the GKE client: '%w'", err)
+	}
+	return client, nil
+}
+
+// refreshCluster gets the latest state of the cluster after an update
+func (gc *GKECluster) refreshCluster(client gke.SDKOperations) error {
+	region, zone := gke.RegionZoneFromLoc(gc.Cluster.Location)
+	cluster, err := client.GetCluster(context.Background(), gc.Project, region, zone, gc.Cluster.Name)
+	if err != nil {
+		return fmt.Errorf("failed getting the updated cluster: '%w'", err)
+	}
+	gc.Cluster = cluster
+	return nil
+}
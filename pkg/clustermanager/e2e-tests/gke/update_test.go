@@ -0,0 +1,166 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gke
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	container "google.golang.org/api/container/v1beta1"
+
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/common"
+	"knative.dev/test-infra/pkg/gke"
+)
+
+// setupUpdatableCluster returns a fake cluster with the given node pools,
+// and mocks the commands so that checkEnvironment doesn't change it
+func setupUpdatableCluster(t *testing.T, nodePools ...gke.NodePool) *GKECluster {
+	oldExecFunc := common.StandardExec
+	t.Cleanup(func() { common.StandardExec = oldExecFunc })
+	common.StandardExec = func(name string, args ...string) ([]byte, error) {
+		if name == "kubectl" {
+			return []byte(""), fmt.Errorf("kubectl not set")
+		}
+		return []byte(""), nil
+	}
+
+	fgc := setupFakeGKECluster()
+	fgc.Project = fakeProj
+	fgc.Request = &GKERequest{
+		Request: gke.Request{
+			ClusterName: "customcluster",
+			MinNodes:    defaultGKEMinNodes,
+			MaxNodes:    defaultGKEMaxNodes,
+			NodeType:    defaultGKENodeType,
+			Region:      defaultGKERegion,
+			NodePools:   nodePools,
+		},
+	}
+	rb, err := gke.NewCreateClusterRequest(&fgc.Request.Request)
+	if err != nil {
+		t.Fatalf("Failed building the CreateClusterRequest: '%v'", err)
+	}
+	ctx := context.Background()
+	if err := fgc.operations.CreateCluster(ctx, fakeProj, defaultGKERegion, "", rb); err != nil {
+		t.Fatalf("Failed creating the cluster: '%v'", err)
+	}
+	fgc.Cluster, _ = fgc.operations.GetCluster(ctx, fakeProj, defaultGKERegion, "", "customcluster")
+	return &fgc
+}
+
+func TestUpgrade(t *testing.T) {
+	pools := []gke.NodePool{
+		{Name: "pool-a", MinNodes: 1, MaxNodes: 1, NodeType: defaultGKENodeType},
+		{Name: "pool-b", MinNodes: 1, MaxNodes: 1, NodeType: defaultGKENodeType},
+	}
+	datas := []struct {
+		name      string
+		nodePools []string
+		// wantVersions are the versions of pool-a and pool-b after the upgrade
+		wantVersions []string
+	}{
+		{"all node pools", nil, []string{"1.17.9-gke.1504", "1.17.9-gke.1504"}},
+		{"some node pools", []string{"pool-b"}, []string{"", "1.17.9-gke.1504"}},
+		{"master only", []string{}, []string{"", ""}},
+	}
+	for _, data := range datas {
+		t.Run(data.name, func(t *testing.T) {
+			fgc := setupUpdatableCluster(t, pools...)
+			if err := fgc.Upgrade("1.17.9-gke.1504", data.nodePools); err != nil {
+				t.Fatalf("Expected no error, but got '%v'", err)
+			}
+			if fgc.Cluster.CurrentMasterVersion != "1.17.9-gke.1504" {
+				t.Errorf("Expected master version '1.17.9-gke.1504', but got %q", fgc.Cluster.CurrentMasterVersion)
+			}
+			for i, np := range fgc.Cluster.NodePools {
+				if np.Version != data.wantVersions[i] {
+					t.Errorf("Expected version %q for node pool %q, but got %q", data.wantVersions[i], np.Name, np.Version)
+				}
+			}
+		})
+	}
+
+	// The master cannot be downgraded.
+	fgc := setupUpdatableCluster(t)
+	if err := fgc.Upgrade("1.17.9-gke.1504", nil); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if err := fgc.Upgrade("1.16.13-gke.401", nil); err == nil {
+		t.Error("Expected an error downgrading the master, but got nil")
+	}
+}
+
+func TestResize(t *testing.T) {
+	datas := []struct {
+		name            string
+		req             ResizeRequest
+		wantErr         bool
+		wantNodes       int64
+		wantAutoscaling *container.NodePoolAutoscaling
+	}{{
+		name:            "resize",
+		req:             ResizeRequest{NumNodes: 3},
+		wantNodes:       3,
+		wantAutoscaling: &container.NodePoolAutoscaling{Enabled: true, MinNodeCount: 1, MaxNodeCount: 3},
+	}, {
+		name:            "autoscaling and resize",
+		req:             ResizeRequest{NodePool: "default-pool", NumNodes: 5, MinNodes: 2, MaxNodes: 10},
+		wantNodes:       5,
+		wantAutoscaling: &container.NodePoolAutoscaling{Enabled: true, MinNodeCount: 2, MaxNodeCount: 10},
+	}, {
+		name:            "autoscaling only",
+		req:             ResizeRequest{NumNodes: -1, MinNodes: 0, MaxNodes: 4},
+		wantNodes:       1,
+		wantAutoscaling: &container.NodePoolAutoscaling{Enabled: true, MinNodeCount: 0, MaxNodeCount: 4},
+	}, {
+		name:    "nothing to do",
+		req:     ResizeRequest{NumNodes: -1},
+		wantErr: true,
+	}, {
+		name:    "invalid autoscaling",
+		req:     ResizeRequest{NumNodes: 1, MinNodes: 5, MaxNodes: 4},
+		wantErr: true,
+	}, {
+		name:    "unknown node pool",
+		req:     ResizeRequest{NodePool: "unknown", NumNodes: 1},
+		wantErr: true,
+	}}
+	for _, data := range datas {
+		t.Run(data.name, func(t *testing.T) {
+			fgc := setupUpdatableCluster(t)
+			err := fgc.Resize(data.req)
+			if data.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error, but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, but got '%v'", err)
+			}
+			np := fgc.Cluster.NodePools[0]
+			if np.InitialNodeCount != data.wantNodes {
+				t.Errorf("Expected %d nodes, but got %d", data.wantNodes, np.InitialNodeCount)
+			}
+			if !reflect.DeepEqual(np.Autoscaling, data.wantAutoscaling) {
+				t.Errorf("Expected autoscaling %+v, but got %+v", data.wantAutoscaling, np.Autoscaling)
+			}
+		})
+	}
+}
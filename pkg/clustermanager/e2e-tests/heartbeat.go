@@ -0,0 +1,35 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_tests
+
+import (
+	"context"
+	"fmt"
+)
+
+// Heartbeat keeps the lease of the Boskos project of the current GKE cluster
+// alive until ctx is done or the project is released by Delete, so that the
+// cluster created by Create outlives its process
+func Heartbeat(ctx context.Context, rw *RequestWrapper) error {
+	rw.Request.SkipCreation = true
+
+	gkeOps, err := rw.acquire()
+	if err != nil {
+		return fmt.Errorf("error identifying cluster to keep the lease of its project alive: %w", err)
+	}
+	return gkeOps.Heartbeat(ctx)
+}
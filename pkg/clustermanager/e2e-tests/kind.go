@@ -0,0 +1,93 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_tests
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/kind"
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/provider"
+	"knative.dev/test-infra/pkg/metautil"
+)
+
+// CreateKind creates a kind cluster, or reuses the existing one with the same
+// name, and points the kubeconfig to it
+func CreateKind(req kind.KindRequest) (*kind.KindCluster, error) {
+	kindOps, err := acquireKind(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.SaveMetaData {
+		writeKindMetaData(kindOps)
+	}
+	return kindOps, nil
+}
+
+// GetKind gets an existing kind cluster and points the kubeconfig to it
+func GetKind(req kind.KindRequest) (*kind.KindCluster, error) {
+	req.SkipCreation = true
+	return CreateKind(req)
+}
+
+// DeleteKind deletes a kind cluster
+func DeleteKind(req kind.KindRequest) error {
+	clusterOps, err := provider.Setup("kind", req)
+	if err != nil {
+		return err
+	}
+	if err := clusterOps.Delete(); err != nil {
+		return fmt.Errorf("failed deleting cluster: %w", err)
+	}
+	return nil
+}
+
+func acquireKind(req kind.KindRequest) (*kind.KindCluster, error) {
+	clusterOps, err := provider.Setup("kind", req)
+	if err != nil {
+		return nil, err
+	}
+	kindOps := clusterOps.(*kind.KindCluster)
+	if err := kindOps.Acquire(); err != nil {
+		return nil, fmt.Errorf("failed acquiring kind cluster: %w", err)
+	}
+	return kindOps, nil
+}
+
+// writeKindMetaData writes the kind cluster information to the metadata file
+func writeKindMetaData(kc *kind.KindCluster) {
+	c, err := metautil.NewClient("")
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Writing metadata to: %q", c.Path)
+	nodes := strconv.Itoa(kc.Request.ControlPlaneNodes + kc.Request.WorkerNodes)
+	for key, val := range map[string]string{
+		providerKey:       kc.Provider(),
+		clusterNameKey:    kc.Name,
+		clusterVersionKey: kc.Request.NodeImage,
+		minNodesKey:       nodes,
+		maxNodesKey:       nodes,
+		kubeconfigKey:     kc.Request.Kubeconfig,
+	} {
+		if err = c.Set(key, val); err != nil {
+			log.Fatalf("Failed saving metadata %q:%q: '%v'", key, val, err)
+		}
+	}
+	log.Println("Done writing metadata")
+}
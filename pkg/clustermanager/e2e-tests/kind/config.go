@@ -0,0 +1,31 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kind
+
+const (
+	// providerName is the name kind is registered with in the provider registry
+	providerName = "kind"
+
+	defaultClusterName       = "kind"
+	defaultControlPlaneNodes = 1
+	defaultWaitTimeout       = "5m"
+	defaultRegistryName      = "kind-registry"
+	defaultRegistryPort      = 5000
+	registryImage            = "registry:2"
+	// kindNetwork is the docker network kind creates the nodes in
+	kindNetwork = "kind"
+)
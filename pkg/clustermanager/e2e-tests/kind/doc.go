@@ -14,19 +14,9 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package kubetest2
-
-import (
-	"bytes"
-	"io"
-	"os"
-	"os/exec"
-)
-
-func runWithOutput(command *exec.Cmd) (string, error) {
-	var buf bytes.Buffer
-	command.Stdout = io.MultiWriter(&buf, os.Stdout)
-	command.Stderr = io.MultiWriter(&buf, os.Stderr)
-	err := command.Run()
-	return buf.String(), err
-}
+/*
+Package kind provides support for managing kind (Kubernetes in Docker) clusters
+for e2e tests, so that e2e tests can run locally without a GCP project. All the
+commands run through common.StandardExec, so that they can be mocked in tests.
+*/
+package kind
@@ -0,0 +1,244 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kind
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/common"
+)
+
+// Provider returns kind
+func (kc *KindCluster) Provider() string {
+	return providerName
+}
+
+// Acquire gets the existing kind cluster or creates a new one, then exports
+// its kubeconfig. The local registry is set up if requested.
+func (kc *KindCluster) Acquire() error {
+	name := kc.Request.ClusterName
+	exists, err := clusterExists(name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if kc.Request.SkipCreation {
+			return fmt.Errorf("kind cluster %q doesn't exist", name)
+		}
+		if err := kc.create(); err != nil {
+			return err
+		}
+	} else {
+		log.Printf("Using existing kind cluster %q", name)
+		if err := kc.exportKubeconfig(); err != nil {
+			return err
+		}
+	}
+	if kc.Request.Registry && !kc.Request.SkipCreation {
+		if err := kc.setupRegistry(); err != nil {
+			return err
+		}
+	}
+	kc.Name = name
+	kc.Context = "kind-" + name
+	return nil
+}
+
+// Delete deletes the kind cluster, the local registry is kept since other
+// clusters might use it
+func (kc *KindCluster) Delete() error {
+	name := kc.Request.ClusterName
+	if kc.Name != "" {
+		name = kc.Name
+	}
+	exists, err := clusterExists(name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("kind cluster %q doesn't exist", name)
+	}
+	log.Printf("Deleting kind cluster %q", name)
+	if _, err := run("kind", kc.withKubeconfig("delete", "cluster", "--name", name)...); err != nil {
+		return fmt.Errorf("failed deleting kind cluster %q: %w", name, err)
+	}
+	kc.Name, kc.Context = "", ""
+	return nil
+}
+
+// create creates the kind cluster with the config of the request
+func (kc *KindCluster) create() error {
+	name := kc.Request.ClusterName
+	config, err := ioutil.TempFile("", "kind-config-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed creating the kind config file: %w", err)
+	}
+	defer os.Remove(config.Name())
+	content := kc.config()
+	if _, err := config.WriteString(content); err != nil {
+		config.Close()
+		return fmt.Errorf("failed writing the kind config file: %w", err)
+	}
+	if err := config.Close(); err != nil {
+		return fmt.Errorf("failed writing the kind config file: %w", err)
+	}
+
+	args := []string{"create", "cluster", "--name", name, "--config", config.Name(), "--wait", kc.Request.WaitTimeout}
+	if kc.Request.NodeImage != "" {
+		args = append(args, "--image", kc.Request.NodeImage)
+	}
+	log.Printf("Creating kind cluster %q with:\n%s", name, content)
+	if _, err := run("kind", kc.withKubeconfig(args...)...); err != nil {
+		return fmt.Errorf("failed creating kind cluster %q: %w", name, err)
+	}
+	log.Print("Cluster creation completed")
+	return nil
+}
+
+// config returns the kind config of the cluster, see
+// https://kind.sigs.k8s.io/docs/user/configuration/
+func (kc *KindCluster) config() string {
+	var sb strings.Builder
+	sb.WriteString("kind: Cluster\napiVersion: kind.x-k8s.io/v1alpha4\nnodes:\n")
+	for i := 0; i < kc.Request.ControlPlaneNodes; i++ {
+		sb.WriteString("- role: control-plane\n")
+	}
+	for i := 0; i < kc.Request.WorkerNodes; i++ {
+		sb.WriteString("- role: worker\n")
+	}
+	if kc.Request.Registry {
+		// Make the nodes pull localhost:PORT images from the registry, see
+		// https://kind.sigs.k8s.io/docs/user/local-registry/
+		fmt.Fprintf(&sb, "containerdConfigPatches:\n- |-\n"+
+			"  [plugins.\"io.containerd.grpc.v1.cri\".registry.mirrors.\"localhost:%d\"]\n"+
+			"    endpoint = [\"http://%s:5000\"]\n", kc.Request.RegistryPort, kc.Request.RegistryName)
+	}
+	return sb.String()
+}
+
+// setupRegistry runs the local registry if it's not running yet, connects it
+// to the network of the nodes and documents it in the cluster, see
+// https://github.com/kubernetes/enhancements/tree/master/keps/sig-cluster-lifecycle/generic/1755-communicating-a-local-registry
+func (kc *KindCluster) setupRegistry() error {
+	registry := kc.Request.RegistryName
+	running, err := run("docker", "inspect", "-f", "{{.State.Running}}", registry)
+	switch {
+	case err != nil:
+		log.Printf("Starting local registry %q on localhost:%d", registry, kc.Request.RegistryPort)
+		if _, err := run("docker", "run", "-d", "--restart=always",
+			"-p", fmt.Sprintf("127.0.0.1:%d:5000", kc.Request.RegistryPort),
+			"--name", registry, registryImage); err != nil {
+			return fmt.Errorf("failed running local registry %q: %w", registry, err)
+		}
+	case running != "true":
+		if _, err := run("docker", "start", registry); err != nil {
+			return fmt.Errorf("failed starting local registry %q: %w", registry, err)
+		}
+	}
+
+	network, err := run("docker", "inspect", "-f", "{{json .NetworkSettings.Networks."+kindNetwork+"}}", registry)
+	if err != nil {
+		return fmt.Errorf("failed inspecting local registry %q: %w", registry, err)
+	}
+	if network == "null" {
+		if _, err := run("docker", "network", "connect", kindNetwork, registry); err != nil {
+			return fmt.Errorf("failed connecting local registry %q to the kind network: %w", registry, err)
+		}
+	}
+
+	cm, err := ioutil.TempFile("", "local-registry-hosting-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed creating the local registry ConfigMap file: %w", err)
+	}
+	defer os.Remove(cm.Name())
+	if _, err := fmt.Fprintf(cm, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: local-registry-hosting
+  namespace: kube-public
+data:
+  localRegistryHosting.v1: |
+    host: "localhost:%d"
+    help: "https://kind.sigs.k8s.io/docs/user/local-registry/"
+`, kc.Request.RegistryPort); err != nil {
+		cm.Close()
+		return fmt.Errorf("failed writing the local registry ConfigMap file: %w", err)
+	}
+	if err := cm.Close(); err != nil {
+		return fmt.Errorf("failed writing the local registry ConfigMap file: %w", err)
+	}
+	args := []string{"apply", "-f", cm.Name(), "--context", "kind-" + kc.Request.ClusterName}
+	if kc.Request.Kubeconfig != "" {
+		args = append(args, "--kubeconfig", kc.Request.Kubeconfig)
+	}
+	if _, err := run("kubectl", args...); err != nil {
+		return fmt.Errorf("failed documenting the local registry in the cluster: %w", err)
+	}
+	return nil
+}
+
+// exportKubeconfig exports the kubeconfig of the cluster and makes it the
+// current context
+func (kc *KindCluster) exportKubeconfig() error {
+	name := kc.Request.ClusterName
+	if _, err := run("kind", kc.withKubeconfig("export", "kubeconfig", "--name", name)...); err != nil {
+		return fmt.Errorf("failed exporting the kubeconfig of kind cluster %q: %w", name, err)
+	}
+	return nil
+}
+
+// withKubeconfig appends the kubeconfig flag of the request to the args of kind
+func (kc *KindCluster) withKubeconfig(args ...string) []string {
+	if kc.Request.Kubeconfig != "" {
+		args = append(args, "--kubeconfig", kc.Request.Kubeconfig)
+	}
+	return args
+}
+
+// clusterExists checks if the kind cluster exists
+func clusterExists(name string) (bool, error) {
+	out, err := run("kind", "get", "clusters")
+	if err != nil {
+		return false, fmt.Errorf("failed listing kind clusters: %w", err)
+	}
+	for _, cluster := range strings.Split(out, "\n") {
+		if strings.TrimSpace(cluster) == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// run runs the command and returns its trimmed output, the error includes the
+// stderr of the command if it failed
+func run(name string, args ...string) (string, error) {
+	out, err := common.StandardExec(name, args...)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) != 0 {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("'%s %s' failed: %w", name, strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kind
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/common"
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/provider"
+)
+
+// fakeExec mocks common.StandardExec, it records the commands run and returns
+// the output of the first response whose prefix matches the command
+type fakeExec struct {
+	responses []response
+	commands  []string
+	// config is the content of the kind config file when creating the cluster
+	config string
+}
+
+type response struct {
+	prefix string
+	out    string
+	err    error
+}
+
+func (f *fakeExec) exec(name string, args ...string) ([]byte, error) {
+	command := strings.Join(append([]string{name}, args...), " ")
+	f.commands = append(f.commands, command)
+	for i, arg := range args {
+		if arg == "--config" {
+			content, _ := ioutil.ReadFile(args[i+1])
+			f.config = string(content)
+		}
+	}
+	for _, r := range f.responses {
+		if strings.HasPrefix(command, r.prefix) {
+			return []byte(r.out), r.err
+		}
+	}
+	return nil, nil
+}
+
+func setupFakeExec(t *testing.T, responses ...response) *fakeExec {
+	f := &fakeExec{responses: responses}
+	oldExecFunc := common.StandardExec
+	common.StandardExec = f.exec
+	t.Cleanup(func() {
+		common.StandardExec = oldExecFunc
+	})
+	return f
+}
+
+// withoutTempFiles replaces the paths of the temporary files in the commands
+func withoutTempFiles(commands []string) []string {
+	var res []string
+	for _, c := range commands {
+		fields := strings.Fields(c)
+		for i := range fields {
+			if strings.HasPrefix(fields[i], os.TempDir()) {
+				fields[i] = "FILE"
+			}
+		}
+		res = append(res, strings.Join(fields, " "))
+	}
+	return res
+}
+
+func TestSetup(t *testing.T) {
+	ops, err := provider.Setup("kind", KindRequest{Registry: true})
+	if err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	kc := ops.(*KindCluster)
+	want := KindRequest{
+		ClusterName:       defaultClusterName,
+		ControlPlaneNodes: defaultControlPlaneNodes,
+		Registry:          true,
+		RegistryName:      defaultRegistryName,
+		RegistryPort:      defaultRegistryPort,
+		WaitTimeout:       defaultWaitTimeout,
+	}
+	if !reflect.DeepEqual(*kc.Request, want) {
+		t.Fatalf("Expected request %+v, but got %+v", want, *kc.Request)
+	}
+	if _, err := provider.Setup("kind", &KindRequest{}); err == nil {
+		t.Fatal("Expected an error setting up kind with a request of the wrong type, but got nil")
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	errExec := errors.New("exit status 1")
+	tests := []struct {
+		name         string
+		req          KindRequest
+		responses    []response
+		wantErr      bool
+		wantCommands []string
+		wantConfig   string
+	}{{
+		name: "create a multi-node cluster with a local registry",
+		req: KindRequest{
+			ClusterName:       "e2e",
+			WorkerNodes:       2,
+			NodeImage:         "kindest/node:v1.18.8",
+			Registry:          true,
+			Kubeconfig:        "/home/user/.kube/e2e",
+			ControlPlaneNodes: 1,
+		},
+		responses: []response{
+			{prefix: "kind get clusters", out: "other\n"},
+			{prefix: "docker inspect -f {{.State.Running}}", err: errExec},
+			{prefix: "docker inspect -f {{json", out: "null"},
+		},
+		wantCommands: []string{
+			"kind get clusters",
+			"kind create cluster --name e2e --config FILE --wait 5m --image kindest/node:v1.18.8 --kubeconfig /home/user/.kube/e2e",
+			"docker inspect -f {{.State.Running}} kind-registry",
+			"docker run -d --restart=always -p 127.0.0.1:5000:5000 --name kind-registry registry:2",
+			"docker inspect -f {{json .NetworkSettings.Networks.kind}} kind-registry",
+			"docker network connect kind kind-registry",
+			"kubectl apply -f FILE --context kind-e2e --kubeconfig /home/user/.kube/e2e",
+		},
+		wantConfig: `kind: Cluster
+apiVersion: kind.x-k8s.io/v1alpha4
+nodes:
+- role: control-plane
+- role: worker
+- role: worker
+containerdConfigPatches:
+- |-
+  [plugins."io.containerd.grpc.v1.cri".registry.mirrors."localhost:5000"]
+    endpoint = ["http://kind-registry:5000"]
+`,
+	}, {
+		name: "reuse the existing cluster and the running registry",
+		req:  KindRequest{Registry: true},
+		responses: []response{
+			{prefix: "kind get clusters", out: "kind\n"},
+			{prefix: "docker inspect -f {{.State.Running}}", out: "true"},
+			{prefix: "docker inspect -f {{json", out: `{"NetworkID":"abc"}`},
+		},
+		wantCommands: []string{
+			"kind get clusters",
+			"kind export kubeconfig --name kind",
+			"docker inspect -f {{.State.Running}} kind-registry",
+			"docker inspect -f {{json .NetworkSettings.Networks.kind}} kind-registry",
+			"kubectl apply -f FILE --context kind-kind",
+		},
+	}, {
+		name:         "get a cluster that doesn't exist",
+		req:          KindRequest{SkipCreation: true},
+		responses:    []response{{prefix: "kind get clusters", out: "No kind clusters found."}},
+		wantErr:      true,
+		wantCommands: []string{"kind get clusters"},
+	}, {
+		name: "creation failed",
+		req:  KindRequest{},
+		responses: []response{
+			{prefix: "kind get clusters"},
+			{prefix: "kind create cluster", err: errExec},
+		},
+		wantErr: true,
+		wantCommands: []string{
+			"kind get clusters",
+			"kind create cluster --name kind --config FILE --wait 5m",
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := setupFakeExec(t, tt.responses...)
+			kc := (&KindClient{}).Setup(tt.req).(*KindCluster)
+			err := kc.Acquire()
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("Expected error %v, but got '%v'", tt.wantErr, err)
+			}
+			if got := withoutTempFiles(f.commands); !reflect.DeepEqual(got, tt.wantCommands) {
+				t.Fatalf("Expected commands:\n%s\nbut got:\n%s", strings.Join(tt.wantCommands, "\n"), strings.Join(got, "\n"))
+			}
+			if tt.wantConfig != "" && f.config != tt.wantConfig {
+				t.Fatalf("Expected kind config:\n%s\nbut got:\n%s", tt.wantConfig, f.config)
+			}
+			if !tt.wantErr && (kc.Name != kc.Request.ClusterName || kc.Context != "kind-"+kc.Request.ClusterName) {
+				t.Fatalf("Expected cluster %q, but got %q with context %q", kc.Request.ClusterName, kc.Name, kc.Context)
+			}
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	f := setupFakeExec(t, response{prefix: "kind get clusters", out: "e2e"})
+	kc := (&KindClient{}).Setup(KindRequest{ClusterName: "e2e"}).(*KindCluster)
+	if err := kc.Delete(); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	want := []string{"kind get clusters", "kind delete cluster --name e2e"}
+	if !reflect.DeepEqual(f.commands, want) {
+		t.Fatalf("Expected commands %v, but got %v", want, f.commands)
+	}
+
+	kc = (&KindClient{}).Setup(KindRequest{ClusterName: "other"}).(*KindCluster)
+	if err := kc.Delete(); err == nil {
+		t.Fatal("Expected an error deleting a cluster that doesn't exist, but got nil")
+	}
+}
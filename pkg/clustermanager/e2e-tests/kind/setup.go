@@ -0,0 +1,105 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kind
+
+import (
+	"fmt"
+
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/provider"
+)
+
+// KindClient implements Client
+type KindClient struct {
+}
+
+// KindRequest contains all requests collected for kind cluster creation
+type KindRequest struct {
+	// ClusterName is the name of the kind cluster, default "kind"
+	ClusterName string
+
+	// ControlPlaneNodes and WorkerNodes are the number of nodes of each role,
+	// the control plane also runs the workloads if there is no worker
+	ControlPlaneNodes int
+	WorkerNodes       int
+
+	// NodeImage is the kindest/node image of the nodes, which determines the
+	// Kubernetes version, e.g. kindest/node:v1.18.8. The default image of kind
+	// is used if empty.
+	NodeImage string
+
+	// Registry runs a local registry the nodes can pull images from with
+	// localhost:RegistryPort, so that images can be pushed to it with ko
+	Registry     bool
+	RegistryName string
+	RegistryPort int
+
+	// Kubeconfig is the kubeconfig file the cluster is exported to, the
+	// default of kubectl if empty
+	Kubeconfig string
+
+	// WaitTimeout is how long to wait for the control plane to be ready, e.g. 5m
+	WaitTimeout string
+
+	// SkipCreation: skips cluster creation
+	SkipCreation bool
+
+	// SaveMetaData: save the meta data for the created cluster into a file
+	SaveMetaData bool
+}
+
+// KindCluster implements ClusterOperations
+type KindCluster struct {
+	Request *KindRequest
+	// Name is the name of the cluster once acquired
+	Name string
+	// Context is the kubeconfig context of the cluster once acquired
+	Context string
+}
+
+func init() {
+	provider.Register(providerName, provider.SetupFunc(func(request interface{}) (provider.ClusterOperations, error) {
+		r, ok := request.(KindRequest)
+		if !ok {
+			return nil, fmt.Errorf("expected a KindRequest for provider %q, but got %T", providerName, request)
+		}
+		kc := &KindClient{}
+		return kc.Setup(r), nil
+	}))
+}
+
+// Setup sets up a KindCluster client, takes KindRequest as parameter and
+// applies all defaults if not defined.
+func (kc *KindClient) Setup(r KindRequest) provider.ClusterOperations {
+	if r.ClusterName == "" {
+		r.ClusterName = defaultClusterName
+	}
+	if r.ControlPlaneNodes == 0 {
+		r.ControlPlaneNodes = defaultControlPlaneNodes
+	}
+	if r.WaitTimeout == "" {
+		r.WaitTimeout = defaultWaitTimeout
+	}
+	if r.Registry {
+		if r.RegistryName == "" {
+			r.RegistryName = defaultRegistryName
+		}
+		if r.RegistryPort == 0 {
+			r.RegistryPort = defaultRegistryPort
+		}
+	}
+	return &KindCluster{Request: &r}
+}
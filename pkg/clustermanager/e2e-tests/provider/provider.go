@@ -0,0 +1,104 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package provider is the registry of the cluster providers of clustermanager,
+// e.g. GKE or kind. Providers register themselves when their package is
+// imported, like database/sql drivers.
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ClusterOperations contains all provider specific logics
+type ClusterOperations interface {
+	Provider() string
+	Acquire() error
+	Delete() error
+}
+
+// Provider sets up the operations on the clusters of a provider
+type Provider interface {
+	// Setup applies the defaults to the request and returns the operations on
+	// the cluster it describes. request is the request type of the provider,
+	// e.g. gke.GKERequest.
+	Setup(request interface{}) (ClusterOperations, error)
+}
+
+// SetupFunc is a function implementing Provider
+type SetupFunc func(request interface{}) (ClusterOperations, error)
+
+// Setup calls f(request)
+func (f SetupFunc) Setup(request interface{}) (ClusterOperations, error) {
+	return f(request)
+}
+
+var (
+	providers = make(map[string]Provider)
+	mutex     sync.RWMutex
+)
+
+// Register makes a provider available by name. It panics if the provider is
+// nil or registered twice.
+func Register(name string, p Provider) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if p == nil {
+		panic("provider: Register provider is nil")
+	}
+	if _, ok := providers[name]; ok {
+		panic(fmt.Sprintf("provider: Register called twice for provider %q", name))
+	}
+	providers[name] = p
+}
+
+// Get returns the provider registered with the name
+func Get(name string) (Provider, error) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown cluster provider %q, the known providers are %v", name, names())
+	}
+	return p, nil
+}
+
+// Setup sets up the operations on the cluster of the named provider
+func Setup(name string, request interface{}) (ClusterOperations, error) {
+	p, err := Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.Setup(request)
+}
+
+// Names returns the names of the registered providers, sorted
+func Names() []string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return names()
+}
+
+func names() []string {
+	list := make([]string, 0, len(providers))
+	for name := range providers {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type fakeCluster struct {
+	name string
+}
+
+func (c *fakeCluster) Provider() string { return "fake" }
+func (c *fakeCluster) Acquire() error   { return nil }
+func (c *fakeCluster) Delete() error    { return nil }
+
+func TestRegistry(t *testing.T) {
+	errBadRequest := errors.New("bad request")
+	Register("fake", SetupFunc(func(request interface{}) (ClusterOperations, error) {
+		name, ok := request.(string)
+		if !ok {
+			return nil, errBadRequest
+		}
+		return &fakeCluster{name: name}, nil
+	}))
+	defer func() {
+		mutex.Lock()
+		delete(providers, "fake")
+		mutex.Unlock()
+	}()
+
+	ops, err := Setup("fake", "cluster-a")
+	if err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if c, ok := ops.(*fakeCluster); !ok || c.name != "cluster-a" {
+		t.Fatalf("Expected fake cluster 'cluster-a', but got %+v", ops)
+	}
+	if _, err := Setup("fake", 42); err != errBadRequest {
+		t.Fatalf("Expected error '%v', but got '%v'", errBadRequest, err)
+	}
+	if _, err := Setup("unknown", "cluster-a"); err == nil {
+		t.Fatal("Expected an error for an unknown provider, but got nil")
+	}
+	if names := Names(); !reflect.DeepEqual(names, []string{"fake"}) {
+		t.Fatalf("Expected providers [fake], but got %v", names)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("Expected a panic registering a provider twice, but got nil")
+		}
+	}()
+	Register("fake", SetupFunc(nil))
+}
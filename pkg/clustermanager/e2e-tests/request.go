@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	clm "knative.dev/test-infra/pkg/clustermanager/e2e-tests/gke"
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/provider"
 )
 
 // RequestWrapper is a wrapper of the GKERequest.
@@ -29,8 +30,15 @@ type RequestWrapper struct {
 }
 
 func (rw *RequestWrapper) acquire() (*clm.GKECluster, error) {
-	gkeClient := clm.GKEClient{}
-	clusterOps := gkeClient.Setup(rw.Request)
+	// The existing cluster is looked up from the kubeconfig written by Create,
+	// recorded in the metadata, unless another one is requested
+	if rw.Request.SkipCreation && rw.Request.Kubeconfig == "" {
+		rw.Request.Kubeconfig = readKubeconfigFromMetaData()
+	}
+	clusterOps, err := provider.Setup("gke", rw.Request)
+	if err != nil {
+		return nil, err
+	}
 	gkeOps := clusterOps.(*clm.GKECluster)
 	if err := gkeOps.Acquire(); err != nil || gkeOps.Cluster == nil {
 		return nil, fmt.Errorf("failed acquiring GKE cluster: %w", err)
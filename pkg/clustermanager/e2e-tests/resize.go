@@ -0,0 +1,38 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_tests
+
+import (
+	"fmt"
+	"log"
+
+	clm "knative.dev/test-infra/pkg/clustermanager/e2e-tests/gke"
+)
+
+// Resize resizes a node pool of a GKE cluster
+func Resize(rw *RequestWrapper, req clm.ResizeRequest) (*clm.GKECluster, error) {
+	rw.Request.SkipCreation = true
+	gkeOps, err := rw.acquire()
+	if err != nil {
+		return nil, fmt.Errorf("error identifying cluster for resize: %w", err)
+	}
+	log.Printf("Identified project %q and cluster %q for resize", gkeOps.Project, gkeOps.Cluster.Name)
+	if err = gkeOps.Resize(req); err != nil {
+		return nil, fmt.Errorf("failed resizing cluster: %w", err)
+	}
+	return gkeOps, nil
+}
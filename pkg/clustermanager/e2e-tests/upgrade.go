@@ -0,0 +1,39 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e_tests
+
+import (
+	"fmt"
+	"log"
+
+	clm "knative.dev/test-infra/pkg/clustermanager/e2e-tests/gke"
+)
+
+// Upgrade upgrades the master of a GKE cluster to the given version, then the
+// given node pools, all the node pools if nodePools is nil
+func Upgrade(rw *RequestWrapper, version string, nodePools []string) (*clm.GKECluster, error) {
+	rw.Request.SkipCreation = true
+	gkeOps, err := rw.acquire()
+	if err != nil {
+		return nil, fmt.Errorf("error identifying cluster for upgrade: %w", err)
+	}
+	log.Printf("Identified project %q and cluster %q for upgrade", gkeOps.Project, gkeOps.Cluster.Name)
+	if err = gkeOps.Upgrade(version, nodePools); err != nil {
+		return nil, fmt.Errorf("failed upgrading cluster: %w", err)
+	}
+	return gkeOps, nil
+}
@@ -17,38 +17,46 @@ limitations under the License.
 package kubetest2
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
-	"os/exec"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
+	shell "github.com/kballard/go-shellquote"
+	boskoscommon "sigs.k8s.io/boskos/common"
+
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/boskos"
+	"knative.dev/test-infra/pkg/clustermanager/ownership"
 	"knative.dev/test-infra/pkg/cmd"
+	"knative.dev/test-infra/pkg/failure"
 	"knative.dev/test-infra/pkg/helpers"
 	"knative.dev/test-infra/pkg/metautil"
 	"knative.dev/test-infra/pkg/prow"
 )
 
 const (
-	createCommandTmpl = "%s container clusters create --quiet --enable-autoscaling --min-nodes=%d --max-nodes=%d " +
-		"--scopes=%s"
 	clusterNamePrefix                  = "e2e-cls"
 	boskosAcquireDefaultTimeoutSeconds = 1200
 )
 
-var (
-	baseKubetest2Flags = []string{"gke", "--ignore-gcp-ssh-key=true", "--up", "-v=1"}
+var baseKubetest2Flags = []string{"gke", "--ignore-gcp-ssh-key=true", "-v=1"}
 
-	// If one of the error patterns below is matched, it would be recommended to
-	// retry creating the cluster in a different region.
-	// - stockout (https://github.com/knative/test-infra/issues/592)
-	retryableCreationErrors = []*regexp.Regexp{
-		regexp.MustCompile(`.*does not have enough resources available to fulfill.*`),
-		regexp.MustCompile(`.*only \d+ nodes out of \d+ have registered; this is likely due to Nodes failing to start correctly.*`),
+// newBoskosClient is defined for easy mocking in unit tests.
+var newBoskosClient = func(waitDuration time.Duration, releaseState string) (boskos.Operation, error) {
+	opts := []boskos.ClientOption{boskos.WithWaitDuration(waitDuration)}
+	if releaseState != "" {
+		opts = append(opts, boskos.WithReleaseState(releaseState))
 	}
-)
+	return boskos.NewClient("", /* boskos owner */
+		"", /* boskos user */
+		"", /* boskos password file */
+		opts...)
+}
 
 // GKEClusterConfig are the supported configurations for creating a GKE cluster.
 type GKEClusterConfig struct {
@@ -56,6 +64,15 @@ type GKEClusterConfig struct {
 	GCPProjectID      string
 
 	BoskosAcquireTimeoutSeconds int
+	// BoskosResourceTypes are the Boskos resource types to acquire the GCP
+	// project from, in order, boskos.GKEProjectResource if it's empty
+	BoskosResourceTypes []string
+	// BoskosProject is the name of the Boskos project to acquire, instead of
+	// any free project of the resource types
+	BoskosProject string
+	// BoskosReleaseState is the state the Boskos project is released to,
+	// "dirty" if it's empty
+	BoskosReleaseState string
 
 	Environment  string
 	CommandGroup string
@@ -64,6 +81,7 @@ type GKEClusterConfig struct {
 	Region                            string
 	BackupRegions                     []string
 	Machine                           string
+	BackupMachines                    []string
 	MinNodes                          int
 	MaxNodes                          int
 	Network                           string
@@ -77,109 +95,235 @@ type GKEClusterConfig struct {
 	PrivateClusterMasterIPSubnetMask  string
 
 	ExtraGcloudFlags string
+
+	// TTL is how long the cluster lives before it can be reaped, it's stamped
+	// on the cluster with the ownership labels. ownership.DefaultTTL is used
+	// if it's 0, the cluster never expires if it's negative.
+	TTL time.Duration
+
+	// FailureClasses is the failure classes file the cluster creation failures
+	// are classified with, the default failure classes are used if it's empty
+	FailureClasses string
 }
 
 // Run will run the `kubetest2 gke` command with the provided parameters,
 // it will also handle the logic that is only used for Knative integration testing, like retrying cluster creation.
-func Run(opts *Options, cc *GKEClusterConfig) error {
-	kubetest2Flags := baseKubetest2Flags
-
-	createCommand := fmt.Sprintf(createCommandTmpl, cc.CommandGroup, cc.MinNodes, cc.MaxNodes, cc.Scopes)
-	if cc.ReleaseChannel != "" {
-		createCommand += " --release-channel=" + cc.ReleaseChannel
-	}
-	kubetest2Flags = append(kubetest2Flags, "--version="+cc.Version)
-	if cc.Addons != "" {
-		createCommand += " --addons=" + cc.Addons
+// The cluster is created, tested and torn down with one kubetest2 command per
+// phase, so that the cluster is torn down with opts.Down even if its creation
+// or the tests fail.
+func Run(opts *Options, cc *GKEClusterConfig) (err error) {
+	testFlags, err := opts.testFlags()
+	if err != nil {
+		return err
 	}
-	if cc.ExtraGcloudFlags != "" {
-		createCommand += " " + cc.ExtraGcloudFlags
+	createCommand, err := cc.createCommand()
+	if err != nil {
+		return err
 	}
-	kubetest2Flags = append(kubetest2Flags, "--create-command="+createCommand)
-
 	// If cluster name is not provided, generate a random name.
 	if cc.Name == "" {
 		cc.Name = helpers.AppendRandomString(clusterNamePrefix)
 	}
-	kubetest2Flags = append(kubetest2Flags, "--cluster-name="+cc.Name, "--environment="+cc.Environment,
-		"--num-nodes="+strconv.Itoa(cc.MinNodes), "--machine-type="+cc.Machine, "--network="+cc.Network)
-	if cc.GCPServiceAccount != "" {
-		kubetest2Flags = append(kubetest2Flags, "--gcp-service-account="+cc.GCPServiceAccount)
-	}
-	if cc.EnableWorkloadIdentity {
-		kubetest2Flags = append(kubetest2Flags, "--enable-workload-identity")
+	artifactsDir := opts.ArtifactsDir
+	if artifactsDir == "" {
+		artifactsDir = prow.GetLocalArtifactsDir()
 	}
 
-	if prow.IsCI() && cc.GCPProjectID == "" {
+	project := cc.GCPProjectID
+	if project == "" {
+		if !prow.IsCI() {
+			return errors.New("GCP project must be provided in non-CI environment")
+		}
 		log.Println("Will use boskos to provision the GCP project")
 		timeout := cc.BoskosAcquireTimeoutSeconds
 		if timeout == 0 {
 			timeout = boskosAcquireDefaultTimeoutSeconds
 		}
-		kubetest2Flags = append(kubetest2Flags, "--boskos-acquire-timeout-seconds="+strconv.Itoa(timeout))
-	} else {
-		if cc.GCPProjectID == "" {
-			return errors.New("GCP project must be provided in non-CI environment")
+		client, err := newBoskosClient(time.Duration(timeout)*time.Second, cc.BoskosReleaseState)
+		if err != nil {
+			return fmt.Errorf("failed creating the boskos client: %w", err)
 		}
-		log.Printf("Will use the GCP project %q for creating the cluster", cc.GCPProjectID)
-		kubetest2Flags = append(kubetest2Flags, "--project="+cc.GCPProjectID)
+		resource, err := cc.acquireBoskosProject(client, time.Duration(timeout)*time.Second)
+		if err != nil {
+			return err
+		}
+		project = resource.Name
+		// The project is released as dirty by default, so the cluster left
+		// in it is deleted by the janitor if it's not torn down.
+		defer func() {
+			if err := client.ReleaseGKEProject(project); err != nil {
+				log.Printf("error releasing the boskos project %q: %v", project, err)
+			}
+		}()
+	}
+	log.Printf("Will use the GCP project %q for creating the cluster", project)
+
+	flags := append([]string{}, baseKubetest2Flags...)
+	flags = append(flags, "--artifacts="+artifactsDir, "--project="+project, "--version="+cc.Version,
+		"--create-command="+strings.Join(createCommand, " "), "--cluster-name="+cc.Name,
+		"--environment="+cc.Environment, "--num-nodes="+strconv.Itoa(cc.MinNodes), "--network="+cc.Network)
+	if cc.GCPServiceAccount != "" {
+		flags = append(flags, "--gcp-service-account="+cc.GCPServiceAccount)
+	}
+	if cc.EnableWorkloadIdentity {
+		flags = append(flags, "--enable-workload-identity")
+	}
+
+	r := &runner{artifactsDir: artifactsDir}
+	defer func() {
+		if err := r.writeJUnit(); err != nil {
+			log.Printf("error writing the JUnit results of kubetest2: %v", err)
+		}
+	}()
+	flags, err = createGKEClusterWithRetries(r, flags, opts, cc)
+	if err != nil {
+		return err
+	}
+	if opts.Down {
+		defer func() {
+			if _, derr := r.run(phaseDown, append(flags, "--down")); derr != nil {
+				err = helpers.CombineErrors([]error{err, derr})
+			}
+		}()
+	}
+	if testFlags != nil {
+		_, err = r.run(phaseTest, append(flags, testFlags...))
 	}
+	return err
+}
 
-	return createGKEClusterWithRetries(kubetest2Flags, opts, cc)
+// acquireBoskosProject acquires the Boskos project with the name if it's set,
+// or a free project of the resource types, waiting for timeout at most
+func (cc *GKEClusterConfig) acquireBoskosProject(client boskos.Operation, timeout time.Duration) (*boskoscommon.Resource, error) {
+	if cc.BoskosProject == "" && len(cc.BoskosResourceTypes) == 0 {
+		return client.AcquireGKEProject(boskos.GKEProjectResource)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if cc.BoskosProject != "" {
+		return client.AcquireGKEProjectByName(ctx, cc.BoskosProject)
+	}
+	return client.AcquireGKEProjectFromTypes(ctx, cc.BoskosResourceTypes)
+}
+
+// createCommand returns the arguments of the gcloud command creating the
+// cluster. kubetest2 splits the create command on whitespace, so none of the
+// arguments can contain any.
+func (cc *GKEClusterConfig) createCommand() ([]string, error) {
+	var args []string
+	if cc.CommandGroup != "" {
+		args = append(args, cc.CommandGroup)
+	}
+	args = append(args, "container", "clusters", "create", "--quiet", "--enable-autoscaling",
+		"--min-nodes="+strconv.Itoa(cc.MinNodes), "--max-nodes="+strconv.Itoa(cc.MaxNodes), "--scopes="+cc.Scopes)
+	if cc.ReleaseChannel != "" {
+		args = append(args, "--release-channel="+cc.ReleaseChannel)
+	}
+	if cc.Addons != "" {
+		args = append(args, "--addons="+cc.Addons)
+	}
+	// Stamp the cluster with who creates it and when it expires, so that it
+	// can be reaped if it's left behind.
+	args = append(args, "--labels="+formatLabels(ownership.New(cc.TTL).Labels()))
+	if cc.ExtraGcloudFlags != "" {
+		extra, err := shell.Split(cc.ExtraGcloudFlags)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing the extra gcloud flags %q: %w", cc.ExtraGcloudFlags, err)
+		}
+		args = append(args, extra...)
+	}
+	for _, arg := range args {
+		if strings.IndexFunc(arg, unicode.IsSpace) != -1 {
+			return nil, fmt.Errorf("the cluster creation argument %q must not contain whitespace", arg)
+		}
+	}
+	return args, nil
 }
 
-func createGKEClusterWithRetries(kubetest2Flags []string, opts *Options, cc *GKEClusterConfig) error {
-	var err error
+// createGKEClusterWithRetries creates the cluster, retrying in the next
+// regions and with the next machine types depending on the class of the
+// failure. It returns the flags the cluster is created with.
+func createGKEClusterWithRetries(r *runner, kubetest2Flags []string, opts *Options, cc *GKEClusterConfig) ([]string, error) {
+	classifier, err := failure.Load(cc.FailureClasses)
+	if err != nil {
+		return nil, err
+	}
 	regions := append([]string{cc.Region}, cc.BackupRegions...)
-	for i, region := range regions {
-		flags := append(kubetest2Flags, "--region="+region)
+	machines := append([]string{cc.Machine}, cc.BackupMachines...)
+	retrier := failure.NewRetrier(classifier, regions, machines)
+	// Only save the metadata if it's in CI environment and meta data is asked to be saved.
+	if prow.IsCI() && opts.SaveMetaData {
+		defer func() {
+			if err := failure.Report(r.artifactsDir, retrier.Results()); err != nil {
+				log.Printf("error reporting the cluster creation attempts: %v", err)
+			}
+		}()
+	}
+	for {
+		attempt := retrier.Attempt()
+		flags := append(append([]string{}, kubetest2Flags...),
+			"--region="+attempt.Region, "--machine-type="+attempt.MachineType)
 		if cc.PrivateClusterAccessLevel != "" {
 			flags = append(flags, "--private-cluster-access-level="+cc.PrivateClusterAccessLevel)
-			masterIPRange := fmt.Sprintf("%s.%d/%s", cc.PrivateClusterMasterIPSubnetRange, i, cc.PrivateClusterMasterIPSubnetMask)
+			masterIPRange := fmt.Sprintf("%s.%d/%s", cc.PrivateClusterMasterIPSubnetRange, attempt.Number, cc.PrivateClusterMasterIPSubnetMask)
 			flags = append(flags, "--private-cluster-master-ip-range="+masterIPRange)
 		}
 
-		if opts.TestCommand != "" {
-			flags = append(flags, "--test=exec", "--")
-			flags = append(flags, strings.Split(opts.TestCommand, " ")...)
-		}
-
-		log.Printf("Running kubetest2 with flags: %q", flags)
-		command := exec.Command("kubetest2", flags...)
-		var out string
-		out, err = runWithOutput(command)
-		if err != nil {
-			if isRetryableCreationError(out) {
-				log.Print("Cluster creation fails due to unpredictable reasons, will retry creating with different args")
-				continue
-			} else {
-				return err
-			}
-		} else {
-			// Only save the metadata if it's in CI environment and meta data is asked to be saved.
+		out, err := r.run(phaseUp, append(flags, "--up"))
+		if err == nil {
+			retrier.Next(nil)
 			if prow.IsCI() && opts.SaveMetaData {
-				saveMetaData(cc, region)
+				saveMetaData(r.artifactsDir, cc, attempt.Region, attempt.MachineType)
+			}
+			return flags, nil
+		}
+		// Tear down what's left of the failed attempt with best effort, the
+		// cluster can be partially created.
+		if opts.Down {
+			if _, derr := r.run(phaseDown, append(flags, "--down")); derr != nil {
+				log.Printf("error tearing down the cluster of the failed attempt: %v", derr)
 			}
-			break
 		}
+		cerr := &creationError{err: err, class: classifier.ClassifyMessage(out)}
+		if !retrier.Next(cerr) {
+			log.Printf("Cluster creation failed with a %s failure, which is not retried", cerr.class)
+			return nil, err
+		}
+		next := retrier.Attempt()
+		log.Printf("Cluster creation failed with a %s failure, will retry creating in region %q with machine type %q", cerr.class, next.Region, next.MachineType)
 	}
+}
 
-	return err
+// creationError is the error of a kubetest2 run failed to create the cluster,
+// classified from its output
+type creationError struct {
+	err   error
+	class failure.Class
 }
 
-// isRetryableCreationError determines if cluster creation should be retried based on the error message.
-func isRetryableCreationError(errMsg string) bool {
-	for _, regx := range retryableCreationErrors {
-		if regx.MatchString(errMsg) {
-			return true
-		}
+func (e *creationError) Error() string {
+	return fmt.Sprintf("%v: %s failure", e.err, e.class)
+}
+
+// FailureClass returns the class of failure found in the output
+func (e *creationError) FailureClass() failure.Class {
+	return e.class
+}
+
+// formatLabels formats the labels as the value of the gcloud --labels flag,
+// sorted by key
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
 	}
-	return false
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
 }
 
 // saveMetaData will save the metadata with best effort.
-func saveMetaData(cc *GKEClusterConfig, region string) {
-	cli, err := metautil.NewClient("")
+func saveMetaData(dir string, cc *GKEClusterConfig, region, machine string) {
+	cli, err := metautil.NewClient(dir)
 	if err != nil {
 		log.Printf("error creating the metautil client: %v", err)
 		return
@@ -193,7 +337,7 @@ func saveMetaData(cc *GKEClusterConfig, region string) {
 	// Set the metadata with best effort.
 	cli.Set("E2E:Provider", "gke")
 	cli.Set("E2E:Region", region)
-	cli.Set("E2E:Machine", cc.Machine)
+	cli.Set("E2E:Machine", machine)
 	cli.Set("E2E:Version", cv)
 	cli.Set("E2E:MinNodes", strconv.Itoa(cc.MinNodes))
 	cli.Set("E2E:MaxNodes", strconv.Itoa(cc.MaxNodes))
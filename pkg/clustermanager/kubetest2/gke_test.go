@@ -0,0 +1,416 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubetest2
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	shell "github.com/kballard/go-shellquote"
+	boskoscommon "sigs.k8s.io/boskos/common"
+
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/boskos"
+	boskosFake "knative.dev/test-infra/pkg/clustermanager/e2e-tests/boskos/fake"
+	"knative.dev/test-infra/pkg/cmd"
+	"knative.dev/test-infra/pkg/junit"
+)
+
+const stockoutOutput = "ERROR: (gcloud.beta.container.clusters.create) ResponseError: code=503, message=" +
+	"The zone does not have enough resources available to fulfill the request."
+
+// call is a faked kubetest2 command, identified by its phase and region
+type call struct {
+	phase  string
+	region string
+}
+
+// fakeKubetest2 fakes the kubetest2 commands with fail, which returns the
+// output of the command and whether it fails, and records their arguments
+func fakeKubetest2(t *testing.T, fail func(c call) (string, bool)) *[][]string {
+	var commands [][]string
+	oldRunCommandContext := cmd.RunCommandContext
+	cmd.RunCommandContext = func(ctx context.Context, cmdLine string, options ...cmd.RunOption) (*cmd.Result, error) {
+		args, err := shell.Split(cmdLine)
+		if err != nil {
+			t.Fatalf("Unexpected error when splitting %q, '%v'", cmdLine, err)
+		}
+		commands = append(commands, args)
+		res := &cmd.Result{Command: cmdLine, Duration: time.Second}
+		if out, failed := fail(toCall(args)); failed {
+			res.Stderr = out
+			res.ExitCode = 1
+			return res, &cmd.CommandLineError{Command: cmdLine, ErrorCode: 1, ErrorOutput: []byte(out)}
+		}
+		return res, nil
+	}
+	t.Cleanup(func() { cmd.RunCommandContext = oldRunCommandContext })
+	return &commands
+}
+
+func toCall(args []string) call {
+	var c call
+	for _, arg := range args {
+		switch {
+		case arg == "--up":
+			c.phase = phaseUp
+		case arg == "--down":
+			c.phase = phaseDown
+		case strings.HasPrefix(arg, "--test="):
+			c.phase = phaseTest
+		case strings.HasPrefix(arg, "--region="):
+			c.region = strings.TrimPrefix(arg, "--region=")
+		}
+	}
+	return c
+}
+
+func setEnv(t *testing.T, key, val string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, val)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      Options
+		fail      func(c call) (string, bool)
+		wantCalls []call
+		wantArgs  []string
+		wantErr   bool
+	}{{
+		name:      "only create the cluster",
+		opts:      Options{},
+		wantCalls: []call{{phaseUp, "us-central1"}},
+	}, {
+		name: "run the quoted test command and tear down",
+		opts: Options{TestCommand: `go test -run 'TestA|TestB' "./test/e2e"`, Down: true},
+		wantCalls: []call{
+			{phaseUp, "us-central1"},
+			{phaseTest, "us-central1"},
+			{phaseDown, "us-central1"},
+		},
+		wantArgs: []string{"--test=exec", "--", "go", "test", "-run", "TestA|TestB", "./test/e2e"},
+	}, {
+		name: "run the ginkgo tester",
+		opts: Options{Tester: TesterGinkgo, Ginkgo: GinkgoOptions{FocusRegex: `\[Conformance\]`, Parallel: 4}},
+		wantCalls: []call{
+			{phaseUp, "us-central1"},
+			{phaseTest, "us-central1"},
+		},
+		wantArgs: []string{"--test=ginkgo", "--", `--focus-regex=\[Conformance\]`, "--parallel=4"},
+	}, {
+		name: "tear down when the tests fail",
+		opts: Options{TestCommand: "./test.sh", Down: true},
+		fail: func(c call) (string, bool) {
+			return "FAIL", c.phase == phaseTest
+		},
+		wantCalls: []call{
+			{phaseUp, "us-central1"},
+			{phaseTest, "us-central1"},
+			{phaseDown, "us-central1"},
+		},
+		wantErr: true,
+	}, {
+		name: "tear down the failed attempts and retry in the backup region",
+		opts: Options{TestCommand: "./test.sh", Down: true},
+		fail: func(c call) (string, bool) {
+			return stockoutOutput, c.phase == phaseUp && c.region == "us-central1"
+		},
+		wantCalls: []call{
+			{phaseUp, "us-central1"},
+			{phaseDown, "us-central1"},
+			{phaseUp, "us-west1"},
+			{phaseTest, "us-west1"},
+			{phaseDown, "us-west1"},
+		},
+	}, {
+		name: "no tests are run when the cluster creation fails",
+		opts: Options{TestCommand: "./test.sh"},
+		fail: func(c call) (string, bool) {
+			return stockoutOutput, c.phase == phaseUp
+		},
+		wantCalls: []call{
+			{phaseUp, "us-central1"},
+			{phaseUp, "us-west1"},
+		},
+		wantErr: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, "CI", "false")
+			fail := tt.fail
+			if fail == nil {
+				fail = func(call) (string, bool) { return "", false }
+			}
+			commands := fakeKubetest2(t, fail)
+			dir, err := ioutil.TempDir("", "kubetest2")
+			if err != nil {
+				t.Fatalf("Unexpected error when creating the artifacts directory, '%v'", err)
+			}
+			defer os.RemoveAll(dir)
+
+			opts := tt.opts
+			opts.ArtifactsDir = dir
+			cc := &GKEClusterConfig{
+				GCPProjectID:  "test-project",
+				Name:          "test-cluster",
+				Region:        "us-central1",
+				BackupRegions: []string{"us-west1"},
+				Machine:       "e2e-standard-4",
+				MinNodes:      1,
+				MaxNodes:      3,
+			}
+			err = Run(&opts, cc)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, but got '%v'", tt.wantErr, err)
+			}
+
+			var gotCalls []call
+			for _, args := range *commands {
+				gotCalls = append(gotCalls, toCall(args))
+				for _, flag := range []string{"--project=test-project", "--cluster-name=test-cluster", "--artifacts=" + dir} {
+					if !contains(args, flag) {
+						t.Errorf("Expected %q in the kubetest2 flags, but got %q", flag, args)
+					}
+				}
+			}
+			if diff := cmp.Diff(tt.wantCalls, gotCalls, cmp.AllowUnexported(call{})); diff != "" {
+				t.Errorf("got(+) is different from wanted(-)\n%v", diff)
+			}
+			if tt.wantArgs != nil {
+				args := testArgs(*commands)
+				if diff := cmp.Diff(tt.wantArgs, args); diff != "" {
+					t.Errorf("got(+) is different from wanted(-)\n%v", diff)
+				}
+			}
+
+			data, err := ioutil.ReadFile(path.Join(dir, junitFile))
+			if err != nil {
+				t.Fatalf("Unexpected error when reading the JUnit results, '%v'", err)
+			}
+			suites, err := junit.UnMarshal(data)
+			if err != nil {
+				t.Fatalf("Unexpected error when parsing the JUnit results, '%v'", err)
+			}
+			var gotCases []call
+			for _, tc := range suites.Suites[0].TestCases {
+				gotCases = append(gotCases, call{phase: tc.Name})
+			}
+			var wantCases []call
+			for _, c := range tt.wantCalls {
+				wantCases = append(wantCases, call{phase: c.phase})
+			}
+			if diff := cmp.Diff(wantCases, gotCases, cmp.AllowUnexported(call{})); diff != "" {
+				t.Errorf("got(+) is different from wanted(-)\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestRunWithBoskos(t *testing.T) {
+	tests := []struct {
+		name        string
+		cc          GKEClusterConfig
+		wantProject string
+		wantState   string
+	}{{
+		name:        "default resource type",
+		wantProject: "boskos-project",
+		wantState:   boskoscommon.Dirty,
+	}, {
+		name:        "resource types",
+		cc:          GKEClusterConfig{BoskosResourceTypes: []string{"missing", "dedicated"}},
+		wantProject: "dedicated-project",
+		wantState:   boskoscommon.Dirty,
+	}, {
+		name:        "project with the name and release state",
+		cc:          GKEClusterConfig{BoskosProject: "other-project", BoskosReleaseState: boskoscommon.Free},
+		wantProject: "other-project",
+		wantState:   boskoscommon.Free,
+	}}
+
+	setEnv(t, "CI", "true")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands := fakeKubetest2(t, func(call) (string, bool) { return "", false })
+			client := &boskosFake.FakeBoskosClient{}
+			client.NewGKEProject("boskos-project")
+			client.NewGKEProject("other-project")
+			client.NewResource("dedicated-project", "dedicated")
+			oldNewBoskosClient := newBoskosClient
+			newBoskosClient = func(_ time.Duration, releaseState string) (boskos.Operation, error) {
+				client.ReleaseState = releaseState
+				if releaseState == "" {
+					client.ReleaseState = boskoscommon.Dirty
+				}
+				return client, nil
+			}
+			defer func() { newBoskosClient = oldNewBoskosClient }()
+			dir, err := ioutil.TempDir("", "kubetest2")
+			if err != nil {
+				t.Fatalf("Unexpected error when creating the artifacts directory, '%v'", err)
+			}
+			defer os.RemoveAll(dir)
+
+			cc := tt.cc
+			cc.Region = "us-central1"
+			if err := Run(&Options{ArtifactsDir: dir, Down: true}, &cc); err != nil {
+				t.Fatalf("Unexpected error when running kubetest2, '%v'", err)
+			}
+			for _, args := range *commands {
+				if !contains(args, "--project="+tt.wantProject) {
+					t.Errorf("Expected the boskos project %q in the kubetest2 flags, but got %q", tt.wantProject, args)
+				}
+			}
+			for _, res := range client.GetResources() {
+				if res.Owner != "" {
+					t.Errorf("Expected the project %q to be released, but got owner %q", res.Name, res.Owner)
+				}
+				if res.Name == tt.wantProject && res.State != tt.wantState {
+					t.Errorf("Expected the project %q to be released to %q, but got %q", res.Name, tt.wantState, res.State)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		cc      GKEClusterConfig
+		want    []string
+		wantErr bool
+	}{{
+		name: "default",
+		cc:   GKEClusterConfig{CommandGroup: "beta", MinNodes: 1, MaxNodes: 3, Scopes: "cloud-platform"},
+		want: []string{"beta", "container", "clusters", "create", "--quiet", "--enable-autoscaling",
+			"--min-nodes=1", "--max-nodes=3", "--scopes=cloud-platform"},
+	}, {
+		name: "quoted extra gcloud flags",
+		cc:   GKEClusterConfig{MinNodes: 1, MaxNodes: 1, ExtraGcloudFlags: `--image-type='cos' --tags="a,b"`},
+		want: []string{"container", "clusters", "create", "--quiet", "--enable-autoscaling",
+			"--min-nodes=1", "--max-nodes=1", "--scopes=", "--image-type=cos", "--tags=a,b"},
+	}, {
+		name:    "extra gcloud flag with whitespace",
+		cc:      GKEClusterConfig{ExtraGcloudFlags: `--description="a cluster"`},
+		wantErr: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cc.createCommand()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, but got '%v'", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			// Skip the ownership labels, they depend on the environment.
+			var args []string
+			for _, arg := range got {
+				if !strings.HasPrefix(arg, "--labels=") {
+					args = append(args, arg)
+				}
+			}
+			if diff := cmp.Diff(tt.want, args); diff != "" {
+				t.Errorf("got(+) is different from wanted(-)\n%v", diff)
+			}
+		})
+	}
+}
+
+func TestTestFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		want    []string
+		wantErr bool
+	}{{
+		name: "no tests",
+	}, {
+		name: "exec tester with quoted arguments",
+		opts: Options{TestCommand: `./test.sh --run "a b"`},
+		want: []string{"--test=exec", "--", "./test.sh", "--run", "a b"},
+	}, {
+		name:    "exec tester without test command",
+		opts:    Options{Tester: TesterExec},
+		wantErr: true,
+	}, {
+		name:    "unbalanced quotes",
+		opts:    Options{TestCommand: `./test.sh "a`},
+		wantErr: true,
+	}, {
+		name: "ginkgo tester",
+		opts: Options{Tester: TesterGinkgo, Ginkgo: GinkgoOptions{SkipRegex: "Serial", FlakeAttempts: 2, TestArgs: "--num-nodes=3 --minStartupPods=8"}},
+		want: []string{"--test=ginkgo", "--", "--skip-regex=Serial", "--flake-attempts=2", "--test-args=--num-nodes=3 --minStartupPods=8"},
+	}, {
+		name:    "ginkgo tester with test command",
+		opts:    Options{Tester: TesterGinkgo, TestCommand: "./test.sh"},
+		wantErr: true,
+	}, {
+		name:    "unsupported tester",
+		opts:    Options{Tester: "node"},
+		wantErr: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.opts.testFlags()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, but got '%v'", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("got(+) is different from wanted(-)\n%v", diff)
+			}
+		})
+	}
+}
+
+func contains(args []string, arg string) bool {
+	for _, a := range args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
+
+// testArgs returns the tester arguments of the test command
+func testArgs(commands [][]string) []string {
+	for _, args := range commands {
+		for i, arg := range args {
+			if strings.HasPrefix(arg, "--test=") {
+				return args[i:]
+			}
+		}
+	}
+	return nil
+}
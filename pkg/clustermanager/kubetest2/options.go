@@ -16,8 +16,112 @@ limitations under the License.
 
 package kubetest2
 
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	shell "github.com/kballard/go-shellquote"
+)
+
+// Tester is the kubetest2 tester the tests are run with.
+type Tester string
+
+const (
+	// TesterExec runs the test command as is.
+	TesterExec Tester = "exec"
+	// TesterGinkgo runs the Kubernetes e2e tests with ginkgo.
+	TesterGinkgo Tester = "ginkgo"
+)
+
 // Options are the common options for running kubetest2 command.
 type Options struct {
-	TestCommand  string
+	// TestCommand is the command run by the exec tester, its arguments are
+	// split the way a shell would, so they can be quoted.
+	TestCommand string
+	// SaveMetaData saves the cluster info into metadata.json in CI.
 	SaveMetaData bool
+
+	// Tester is the tester the tests are run with, it's the exec tester if
+	// it's empty and TestCommand is set, no tests are run otherwise.
+	Tester Tester
+	// Ginkgo are the options of the ginkgo tester.
+	Ginkgo GinkgoOptions
+
+	// Down tears the cluster down once the tests are done, even if the
+	// cluster creation or the tests fail.
+	Down bool
+	// ArtifactsDir is the directory the kubetest2 artifacts and the JUnit
+	// results of the phases are written to, the Prow artifacts directory is
+	// used if it's empty.
+	ArtifactsDir string
+}
+
+// GinkgoOptions are the options of the ginkgo tester.
+type GinkgoOptions struct {
+	FocusRegex         string
+	SkipRegex          string
+	Parallel           int
+	FlakeAttempts      int
+	TestPackageVersion string
+	// TestArgs are the extra arguments passed to the e2e.test binary.
+	TestArgs string
+}
+
+// tester returns the tester the tests are run with, or empty if no tests
+// are run.
+func (o *Options) tester() Tester {
+	if o.Tester == "" && o.TestCommand != "" {
+		return TesterExec
+	}
+	return o.Tester
+}
+
+// testFlags returns the kubetest2 flags for running the tests with the
+// tester, or nil if no tests are run.
+func (o *Options) testFlags() ([]string, error) {
+	switch o.tester() {
+	case "":
+		return nil, nil
+	case TesterExec:
+		if o.TestCommand == "" {
+			return nil, errors.New("the test command must be provided for the exec tester")
+		}
+		args, err := shell.Split(o.TestCommand)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing the test command %q: %w", o.TestCommand, err)
+		}
+		return append([]string{"--test=" + string(TesterExec), "--"}, args...), nil
+	case TesterGinkgo:
+		if o.TestCommand != "" {
+			return nil, errors.New("the test command is only supported by the exec tester")
+		}
+		return append([]string{"--test=" + string(TesterGinkgo), "--"}, o.Ginkgo.flags()...), nil
+	default:
+		return nil, fmt.Errorf("unsupported tester %q, must be one of %q and %q", o.Tester, TesterExec, TesterGinkgo)
+	}
+}
+
+// flags returns the flags of the ginkgo tester that are set.
+func (g GinkgoOptions) flags() []string {
+	var flags []string
+	if g.FocusRegex != "" {
+		flags = append(flags, "--focus-regex="+g.FocusRegex)
+	}
+	if g.SkipRegex != "" {
+		flags = append(flags, "--skip-regex="+g.SkipRegex)
+	}
+	if g.Parallel > 0 {
+		flags = append(flags, "--parallel="+strconv.Itoa(g.Parallel))
+	}
+	if g.FlakeAttempts > 0 {
+		flags = append(flags, "--flake-attempts="+strconv.Itoa(g.FlakeAttempts))
+	}
+	if g.TestPackageVersion != "" {
+		flags = append(flags, "--test-package-version="+g.TestPackageVersion)
+	}
+	if g.TestArgs != "" {
+		flags = append(flags, "--test-args="+g.TestArgs)
+	}
+	return flags
 }
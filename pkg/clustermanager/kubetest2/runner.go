@@ -0,0 +1,119 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubetest2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	shell "github.com/kballard/go-shellquote"
+
+	"knative.dev/test-infra/pkg/cmd"
+	"knative.dev/test-infra/pkg/helpers"
+	"knative.dev/test-infra/pkg/junit"
+)
+
+// The kubetest2 phases
+const (
+	phaseUp   = "Up"
+	phaseTest = "Test"
+	phaseDown = "Down"
+)
+
+const (
+	junitSuite = "kubetest2"
+	junitFile  = "junit_kubetest2.xml"
+)
+
+// phaseResult is the result of running a kubetest2 phase
+type phaseResult struct {
+	name     string
+	duration time.Duration
+	err      error
+}
+
+// runner runs the kubetest2 phases one command each, and records their
+// results
+type runner struct {
+	artifactsDir string
+	results      []phaseResult
+}
+
+// run runs kubetest2 with the flags as the phase named name, and returns the
+// output of the command
+func (r *runner) run(name string, flags []string) (string, error) {
+	cmdLine := shell.Join(append([]string{"kubetest2"}, flags...)...)
+	log.Printf("Running kubetest2 %s: %s", name, cmdLine)
+	res, err := cmd.RunCommandContext(context.Background(), cmdLine,
+		cmd.WithStdoutWriter(os.Stdout), cmd.WithStderrWriter(os.Stderr))
+	if err != nil {
+		err = phaseError(name, res, err)
+	}
+	r.results = append(r.results, phaseResult{name: name, duration: res.Duration, err: err})
+	return res.Stdout + res.Stderr, err
+}
+
+// phaseError returns the error of a failed phase, without the output of the
+// command since it's already streamed
+func phaseError(name string, res *cmd.Result, err error) error {
+	var cle *cmd.CommandLineError
+	if errors.As(err, &cle) && cle.Cause != nil {
+		return fmt.Errorf("kubetest2 %s failed: %w", name, cle.Cause)
+	}
+	return fmt.Errorf("kubetest2 %s failed with exit code %d", name, res.ExitCode)
+}
+
+// junit returns the results as a JUnit suite with one test case per phase run
+func (r *runner) junit() *junit.TestSuites {
+	suite := junit.TestSuite{Name: junitSuite}
+	var total float64
+	for _, res := range r.results {
+		tc := junit.TestCase{
+			Name:      res.name,
+			ClassName: junitSuite,
+			Time:      fmt.Sprintf("%.3f", res.duration.Seconds()),
+		}
+		total += res.duration.Seconds()
+		if res.err != nil {
+			tc.Failure = &junit.Result{Message: res.err.Error(), Value: res.err.Error()}
+		}
+		suite.AddTestCase(tc)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total)
+	suites := &junit.TestSuites{}
+	suites.AddTestSuite(&suite)
+	return suites
+}
+
+// writeJUnit writes the results of the phases to the JUnit file in the
+// artifacts directory
+func (r *runner) writeJUnit() error {
+	data, err := r.junit().ToBytes("", "  ")
+	if err != nil {
+		return fmt.Errorf("failed marshaling the JUnit results: %w", err)
+	}
+	if err := helpers.CreateDir(r.artifactsDir); err != nil {
+		return fmt.Errorf("failed creating the artifacts directory: %w", err)
+	}
+	return ioutil.WriteFile(path.Join(r.artifactsDir, junitFile), data, 0644)
+}
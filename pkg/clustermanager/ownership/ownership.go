@@ -0,0 +1,153 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ownership stamps the clusters created for the tests with labels
+// telling who created them and when they expire, so that the clusters left
+// behind, e.g. when a Prow pod is killed, can be reaped.
+package ownership
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The GCP labels of the clusters
+const (
+	// CreatorLabel is the user who created the cluster, prow in Prow
+	CreatorLabel = "knative-creator"
+	// ProwJobIDLabel is the ID of the Prow job that created the cluster
+	ProwJobIDLabel = "knative-prow-job-id"
+	// ProwJobLabel is the name of the Prow job that created the cluster
+	ProwJobLabel = "knative-prow-job"
+	// BuildIDLabel is the build ID of the Prow job that created the cluster
+	BuildIDLabel = "knative-build-id"
+	// ExpiresAtLabel is when the cluster expires, in seconds since the epoch
+	ExpiresAtLabel = "knative-expires-at"
+)
+
+// DefaultTTL is how long the clusters live by default, much longer than the
+// timeout of any Prow job
+const DefaultTTL = 24 * time.Hour
+
+// prowCreator is the creator of the clusters created in Prow
+const prowCreator = "prow"
+
+// defined here so that they can be mocked for unit testing
+var (
+	getenv = os.Getenv
+	now    = time.Now
+)
+
+// Owner is who created a cluster and when it expires
+type Owner struct {
+	Creator   string
+	ProwJobID string
+	ProwJob   string
+	BuildID   string
+	// ExpiresAt is zero if the cluster never expires
+	ExpiresAt time.Time
+}
+
+// New returns the owner of a cluster created now by the current Prow job, or
+// by the current user outside of Prow, which expires after ttl. DefaultTTL is
+// used if ttl is 0, the cluster never expires if it's negative.
+func New(ttl time.Duration) Owner {
+	var o Owner
+	if getenv("CI") == "true" {
+		o.Creator = prowCreator
+		o.ProwJobID = getenv("PROW_JOB_ID")
+		o.ProwJob = getenv("JOB_NAME")
+		o.BuildID = getenv("BUILD_ID")
+	} else {
+		o.Creator = getenv("USER")
+	}
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	if ttl > 0 {
+		o.ExpiresAt = now().Add(ttl).Truncate(time.Second)
+	}
+	return o
+}
+
+// Labels returns the labels of the owner, the empty values are omitted
+func (o Owner) Labels() map[string]string {
+	labels := make(map[string]string)
+	for key, val := range map[string]string{
+		CreatorLabel:   o.Creator,
+		ProwJobIDLabel: o.ProwJobID,
+		ProwJobLabel:   o.ProwJob,
+		BuildIDLabel:   o.BuildID,
+	} {
+		if val = SanitizeValue(val); val != "" {
+			labels[key] = val
+		}
+	}
+	if !o.ExpiresAt.IsZero() {
+		labels[ExpiresAtLabel] = strconv.FormatInt(o.ExpiresAt.Unix(), 10)
+	}
+	return labels
+}
+
+// AddLabels adds the labels of the owner to labels, and returns them. The
+// labels already set are kept.
+func (o Owner) AddLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	for key, val := range o.Labels() {
+		if _, ok := labels[key]; !ok {
+			labels[key] = val
+		}
+	}
+	return labels
+}
+
+// FromLabels returns the owner of a cluster from its labels, false if the
+// cluster has none of the labels
+func FromLabels(labels map[string]string) (Owner, bool) {
+	o := Owner{
+		Creator:   labels[CreatorLabel],
+		ProwJobID: labels[ProwJobIDLabel],
+		ProwJob:   labels[ProwJobLabel],
+		BuildID:   labels[BuildIDLabel],
+	}
+	if sec, err := strconv.ParseInt(labels[ExpiresAtLabel], 10, 64); err == nil {
+		o.ExpiresAt = time.Unix(sec, 0)
+	}
+	return o, o != Owner{}
+}
+
+// Expired checks if the cluster expired at t
+func (o Owner) Expired(t time.Time) bool {
+	return !o.ExpiresAt.IsZero() && t.After(o.ExpiresAt)
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-z0-9_-]`)
+
+// SanitizeValue returns a valid GCP label value from val, by lower casing it,
+// replacing the invalid characters with "_" and truncating it to 63
+// characters
+func SanitizeValue(val string) string {
+	val = invalidLabelChars.ReplaceAllString(strings.ToLower(val), "_")
+	if len(val) > 63 {
+		val = val[:63]
+	}
+	return val
+}
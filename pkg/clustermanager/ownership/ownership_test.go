@@ -0,0 +1,94 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ownership
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	oldGetenv, oldNow := getenv, now
+	defer func() {
+		getenv, now = oldGetenv, oldNow
+	}()
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return created }
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		ttl  time.Duration
+		want map[string]string
+	}{{
+		name: "prow",
+		env: map[string]string{
+			"CI": "true", "PROW_JOB_ID": "0c3d6a1e-4b2f-11eb-9f3a-6a2c3b4d5e6f",
+			"JOB_NAME": "pull-knative-serving-Integration.Tests", "BUILD_ID": "1343225067289825280", "USER": "root",
+		},
+		ttl: 2 * time.Hour,
+		want: map[string]string{
+			CreatorLabel:   "prow",
+			ProwJobIDLabel: "0c3d6a1e-4b2f-11eb-9f3a-6a2c3b4d5e6f",
+			ProwJobLabel:   "pull-knative-serving-integration_tests",
+			BuildIDLabel:   "1343225067289825280",
+			ExpiresAtLabel: "1577844000",
+		},
+	}, {
+		name: "user with the default TTL",
+		env:  map[string]string{"USER": "Jane.Doe"},
+		want: map[string]string{CreatorLabel: "jane_doe", ExpiresAtLabel: "1577923200"},
+	}, {
+		name: "never expires",
+		env:  map[string]string{"USER": "jane"},
+		ttl:  -1,
+		want: map[string]string{CreatorLabel: "jane"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv = func(key string) string { return tt.env[key] }
+			o := New(tt.ttl)
+			labels := o.Labels()
+			if !reflect.DeepEqual(labels, tt.want) {
+				t.Fatalf("Expected labels %v, but got %v", tt.want, labels)
+			}
+			got, ok := FromLabels(labels)
+			if !ok || !got.ExpiresAt.Equal(o.ExpiresAt) || got.Creator != tt.want[CreatorLabel] {
+				t.Fatalf("Expected the owner %+v from the labels, but got %+v", o, got)
+			}
+		})
+	}
+}
+
+func TestExpired(t *testing.T) {
+	expiresAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	o, ok := FromLabels(map[string]string{ExpiresAtLabel: "1577836800", "team": "serving"})
+	if !ok || !o.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("Expected the owner to expire at %v, but got %+v", expiresAt, o)
+	}
+	if o.Expired(expiresAt) || !o.Expired(expiresAt.Add(time.Second)) {
+		t.Fatalf("Expected the owner to expire after %v", expiresAt)
+	}
+	if o, ok := FromLabels(map[string]string{"team": "serving"}); ok || o.Expired(expiresAt) {
+		t.Fatalf("Expected no owner from unrelated labels, but got %+v", o)
+	}
+	labels := Owner{Creator: "jane"}.AddLabels(map[string]string{CreatorLabel: "john"})
+	if labels[CreatorLabel] != "john" {
+		t.Fatalf("Expected the labels already set to be kept, but got %v", labels)
+	}
+}
@@ -18,6 +18,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 
 	testPkg "knative.dev/test-infra/pkg/clustermanager/perf-tests/pkg"
@@ -28,6 +29,7 @@ var (
 	isRecreate          bool
 	isReconcile         bool
 	isDelete            bool
+	isPlan              bool
 	gcpProjectName      string
 	repoName            string
 	benchmarkRootFolder string
@@ -42,6 +44,7 @@ func main() {
 	flag.BoolVar(&isRecreate, "recreate", false, "is recreate operation or not")
 	flag.BoolVar(&isReconcile, "reconcile", false, "is reconcile operation or not")
 	flag.BoolVar(&isDelete, "delete", false, "is delete operation or not")
+	flag.BoolVar(&isPlan, "plan", false, "print what the operation would create, delete or recreate without touching anything")
 	flag.Parse()
 
 	if (isRecreate && isReconcile) || (isRecreate && isDelete) || (isReconcile && isDelete) {
@@ -52,6 +55,27 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed setting up GKE client, cannot proceed: %v", err)
 	}
+	if isPlan {
+		var op testPkg.Operation
+		switch {
+		case isRecreate:
+			op = testPkg.OperationRecreate
+		case isReconcile:
+			op = testPkg.OperationReconcile
+		case isDelete:
+			op = testPkg.OperationDelete
+		default:
+			log.Fatal("One operation must be specified to plan, either recreate, reconcile or delete")
+		}
+		changes, err := client.Plan(op, gcpProjectName, repoName, benchmarkRootFolder)
+		if err != nil {
+			log.Fatalf("Failed planning to %s clusters for repo %q: %v", op, repoName, err)
+		}
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+		return
+	}
 	switch {
 	case isRecreate:
 		if err := client.RecreateClusters(gcpProjectName, repoName, benchmarkRootFolder); err != nil {
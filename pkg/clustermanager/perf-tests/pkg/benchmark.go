@@ -17,6 +17,8 @@ limitations under the License.
 package pkg
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -25,6 +27,8 @@ import (
 	"strings"
 
 	yaml "gopkg.in/yaml.v2"
+
+	"knative.dev/test-infra/pkg/gke"
 )
 
 const (
@@ -54,6 +58,41 @@ type ClusterConfig struct {
 	NodeCount int64  `yaml:"nodeCount,omitempty"`
 	NodeType  string `yaml:"nodeType,omitempty"`
 	Addons    string `yaml:"addons,omitempty"`
+
+	// Version is the GKE version of the cluster, only one of Version and
+	// ReleaseChannel can be specified.
+	Version        string `yaml:"version,omitempty"`
+	ReleaseChannel string `yaml:"releaseChannel,omitempty"`
+	// NodePools are the node pools of the cluster, NodeCount and NodeType
+	// are ignored if they are specified.
+	NodePools []NodePoolConfig `yaml:"nodePools,omitempty"`
+	// Labels are the GCP labels of the cluster.
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// EnableWorkloadIdentity and ServiceAccount default to the
+	// --enable-workload-identity and --service-account flags.
+	EnableWorkloadIdentity bool   `yaml:"enableWorkloadIdentity,omitempty"`
+	ServiceAccount         string `yaml:"serviceAccount,omitempty"`
+}
+
+// NodePoolConfig is config for a node pool of the cluster
+type NodePoolConfig struct {
+	Name       string            `yaml:"name"`
+	MinNodes   int64             `yaml:"minNodes,omitempty"`
+	MaxNodes   int64             `yaml:"maxNodes,omitempty"`
+	NodeType   string            `yaml:"nodeType,omitempty"`
+	Labels     map[string]string `yaml:"labels,omitempty"`
+	Taints     []TaintConfig     `yaml:"taints,omitempty"`
+	Spot       bool              `yaml:"spot,omitempty"`
+	DiskSizeGB int64             `yaml:"diskSizeGB,omitempty"`
+	DiskType   string            `yaml:"diskType,omitempty"`
+	ImageType  string            `yaml:"imageType,omitempty"`
+}
+
+// TaintConfig is config for a Kubernetes taint of the nodes of a node pool
+type TaintConfig struct {
+	Key    string `yaml:"key"`
+	Value  string `yaml:"value,omitempty"`
+	Effect string `yaml:"effect"`
 }
 
 // benchmarkNames returns names of the benchmarks.
@@ -76,9 +115,9 @@ func benchmarkNames(benchmarkRoot string) ([]string, error) {
 }
 
 // benchmarkClusters returns the cluster configs for all benchmarks.
-func benchmarkClusters(repo, benchmarkRoot string) (map[string]ClusterConfig, error) {
+func benchmarkClusters(benchmarkRoot string) (map[string]ClusterConfig, error) {
 	// clusters is a map of cluster configs
-	// key is the cluster name, value is the cluster config
+	// key is the benchmark name, value is the cluster config
 	clusters := make(map[string]ClusterConfig)
 	benchmarkNames, err := benchmarkNames(benchmarkRoot)
 	if err != nil {
@@ -86,9 +125,7 @@ func benchmarkClusters(repo, benchmarkRoot string) (map[string]ClusterConfig, er
 	}
 
 	for _, benchmarkName := range benchmarkNames {
-		clusterConfig := clusterConfigForBenchmark(benchmarkName, benchmarkRoot)
-		clusterName := clusterNameForBenchmark(benchmarkName, repo)
-		clusters[clusterName] = clusterConfig
+		clusters[benchmarkName] = clusterConfigForBenchmark(benchmarkName, benchmarkRoot)
 	}
 
 	return clusters, nil
@@ -106,6 +143,9 @@ func clusterConfigForBenchmark(benchmarkName, benchmarkRoot string) ClusterConfi
 			NodeCount: defaultNodeCount,
 			NodeType:  defaultNodeType,
 			Addons:    defaultAddons,
+
+			EnableWorkloadIdentity: *enableWorkloadIdentity,
+			ServiceAccount:         *serviceAccount,
 		},
 	}
 
@@ -124,13 +164,81 @@ func clusterConfigForBenchmark(benchmarkName, benchmarkRoot string) ClusterConfi
 	return gkeCluster.Config
 }
 
+// request returns the request for creating the cluster with the config, and
+// with the labels on top of the labels of the config.
+func (c ClusterConfig) request(gcpProject, name string, labels map[string]string) *gke.Request {
+	var resourceLabels map[string]string
+	if len(c.Labels)+len(labels) != 0 {
+		resourceLabels = make(map[string]string, len(c.Labels)+len(labels))
+		for k, v := range c.Labels {
+			resourceLabels[k] = v
+		}
+		for k, v := range labels {
+			resourceLabels[k] = v
+		}
+	}
+	var addons []string
+	if strings.TrimSpace(c.Addons) != "" {
+		addons = strings.Split(c.Addons, ",")
+	}
+	req := &gke.Request{
+		Project:                gcpProject,
+		ClusterName:            name,
+		GKEVersion:             c.Version,
+		ReleaseChannel:         c.ReleaseChannel,
+		MinNodes:               c.NodeCount,
+		MaxNodes:               c.NodeCount,
+		NodeType:               c.NodeType,
+		Addons:                 addons,
+		EnableWorkloadIdentity: c.EnableWorkloadIdentity,
+		ServiceAccount:         c.ServiceAccount,
+		ResourceLabels:         resourceLabels,
+	}
+	for _, pool := range c.NodePools {
+		np := gke.NodePool{
+			Name:       pool.Name,
+			MinNodes:   pool.MinNodes,
+			MaxNodes:   pool.MaxNodes,
+			NodeType:   pool.NodeType,
+			Labels:     pool.Labels,
+			Spot:       pool.Spot,
+			DiskSizeGB: pool.DiskSizeGB,
+			DiskType:   pool.DiskType,
+			ImageType:  pool.ImageType,
+		}
+		for _, taint := range pool.Taints {
+			np.Taints = append(np.Taints, gke.Taint{Key: taint.Key, Value: taint.Value, Effect: taint.Effect})
+		}
+		req.NodePools = append(req.NodePools, np)
+	}
+	return req
+}
+
 // clusterNameForBenchmark prepends repo name to the benchmark name, and use it as the cluster name.
+// The clusters are identified by their labels, so if the name is longer than what GKE allows, it's
+// hashed, see hashedClusterName.
 func clusterNameForBenchmark(benchmarkName, repo string) string {
-	return repoPrefix(repo) + benchmarkName
+	name := repoPrefix(repo) + benchmarkName
+	if len(name) <= maxClusterNameLength {
+		return name
+	}
+	return hashedClusterName(name)
+}
+
+// hashedClusterName truncates the cluster name to leave room for its hash, and suffixes it with the
+// hash to keep it unique.
+func hashedClusterName(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	suffix := hex.EncodeToString(sum[:])[:clusterNameHashLength]
+	if len(name) > maxClusterNameLength-len(suffix)-1 {
+		name = name[:maxClusterNameLength-len(suffix)-1]
+	}
+	return strings.TrimRight(name, "-") + "-" + suffix
 }
 
 // benchmarkNameForCluster removes repo name prefix from the cluster name, to get the real benchmark name.
 // If the cluster does not belong to the given repo, return an empty string.
+// It's only used for the clusters created before the ownership labels, see ownerOfCluster.
 func benchmarkNameForCluster(clusterName, repo string) string {
 	if !clusterBelongsToRepo(clusterName, repo) {
 		return ""
@@ -139,6 +247,7 @@ func benchmarkNameForCluster(clusterName, repo string) string {
 }
 
 // clusterBelongsToRepo determines if the cluster belongs to the repo, by checking if it has the repo prefix.
+// It's only used for the clusters created before the ownership labels, see ownerOfCluster.
 func clusterBelongsToRepo(clusterName, repo string) bool {
 	return strings.HasPrefix(clusterName, repoPrefix(repo))
 }
@@ -78,6 +78,24 @@ func TestClusterConfigForBenchmark(t *testing.T) {
 		benchmarkName: "test-benchmark4",
 		expectedClusterConfig: ClusterConfig{
 			Location: defaultLocation, NodeCount: defaultNodeCount, NodeType: defaultNodeType, Addons: defaultAddons},
+	}, {
+		benchmarkRoot: "testdir-full",
+		benchmarkName: "test-benchmark-full",
+		expectedClusterConfig: ClusterConfig{
+			Location: "us-west1", NodeCount: defaultNodeCount, NodeType: defaultNodeType, Addons: "istio",
+			Version:                "1.17",
+			Labels:                 map[string]string{"team": "serving"},
+			EnableWorkloadIdentity: true,
+			ServiceAccount:         "perf-tests@p.iam.gserviceaccount.com",
+			NodePools: []NodePoolConfig{{
+				Name: "system", MinNodes: 1, MaxNodes: 1, NodeType: "e2-standard-4",
+			}, {
+				Name: "benchmark", MinNodes: 3, MaxNodes: 5, NodeType: "e2-standard-8",
+				Labels:     map[string]string{"role": "benchmark"},
+				Taints:     []TaintConfig{{Key: "dedicated", Value: "benchmark", Effect: "NO_SCHEDULE"}},
+				DiskSizeGB: 200, DiskType: "pd-ssd",
+			}},
+		},
 	}}
 
 	for _, tc := range testCases {
@@ -17,14 +17,18 @@ limitations under the License.
 package pkg
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"sync"
 
 	"google.golang.org/api/option"
 
+	"knative.dev/test-infra/pkg/clustermanager/ownership"
 	"knative.dev/test-infra/pkg/gke"
 	"knative.dev/test-infra/pkg/helpers"
 
@@ -42,7 +46,8 @@ const (
 	statusStopping     = "STOPPING"
 )
 
-// Extra configurations we want to support for cluster creation request.
+// Extra configurations we want to support for cluster creation request, they
+// are the defaults of the benchmarks' cluster configs.
 var (
 	enableWorkloadIdentity = flag.Bool("enable-workload-identity", false, "whether to enable Workload Identity")
 	serviceAccount         = flag.String("service-account", "", "service account that will be used on this cluster")
@@ -71,18 +76,66 @@ func NewClient(environment string) (*Client, error) {
 	return client, nil
 }
 
+// Operation is an operation on the clusters of the benchmarks.
+type Operation string
+
+// The supported operations
+const (
+	// OperationRecreate recreates the clusters, even if they are unchanged.
+	OperationRecreate Operation = "recreate"
+	// OperationReconcile makes the clusters consistent with the benchmarks' cluster configs.
+	OperationReconcile Operation = "reconcile"
+	// OperationDelete deletes the clusters.
+	OperationDelete Operation = "delete"
+)
+
+// Action is what is done to a cluster for an operation.
+type Action string
+
+// The actions on the clusters
+const (
+	ActionCreate   Action = "create"
+	ActionDelete   Action = "delete"
+	ActionRecreate Action = "recreate"
+	// ActionKeep keeps the cluster since it's unchanged.
+	ActionKeep Action = "keep"
+	// ActionSkip skips the cluster since it's being created or deleted by another job.
+	ActionSkip Action = "skip"
+	// ActionLabel sets the ownership labels on the cluster since it's unchanged, but it's created
+	// before the labels, or the hash of its config is stale.
+	ActionLabel Action = "label"
+)
+
+// Change is the planned change of a cluster.
+type Change struct {
+	Cluster   string
+	Location  string
+	Benchmark string
+	Action    Action
+	// Diffs are the differences between the cluster and its config that
+	// cause it to be recreated or labeled on reconcile.
+	Diffs []string
+
+	// config is the config the cluster is created with, if it's created.
+	config ClusterConfig
+	// labels are the ownership labels of the cluster, if it's created or labeled.
+	labels map[string]string
+	// existing is the existing cluster, if any.
+	existing *container.Cluster
+}
+
+func (c Change) String() string {
+	s := fmt.Sprintf("%s %q in %q for benchmark %q", c.Action, c.Cluster, c.Location, c.Benchmark)
+	if len(c.Diffs) != 0 {
+		s += ": " + strings.Join(c.Diffs, ", ")
+	}
+	return s
+}
+
 // RecreateClusters will delete and recreate the existing clusters, it will also create the clusters if they do
 // not exist for the corresponding benchmarks.
 func (gc *Client) RecreateClusters(gcpProject, repo, benchmarkRoot string) error {
-	handleExistingCluster := func(cluster container.Cluster, configExists bool, config ClusterConfig) error {
-		// always delete the cluster, even if the cluster config is unchanged
-		return gc.handleExistingClusterHelper(gcpProject, cluster, configExists, config, false)
-	}
-	handleNewClusterConfig := func(clusterName string, clusterConfig ClusterConfig) error {
-		// create a new cluster with the new cluster config
-		return gc.createClusterWithRetries(gcpProject, clusterName, clusterConfig)
-	}
-	return gc.processClusters(gcpProject, repo, benchmarkRoot, handleExistingCluster, handleNewClusterConfig)
+	return gc.run(OperationRecreate, gcpProject, repo, benchmarkRoot)
 }
 
 // ReconcileClusters will reconcile all clusters to make them consistent with the benchmarks' cluster configs.
@@ -92,73 +145,130 @@ func (gc *Client) RecreateClusters(gcpProject, repo, benchmarkRoot string) error
 // 2. If the benchmark's config is changed, delete the old cluster and create a new one with the new config
 // 3. If the benchmark is renamed, delete the old cluster and create a new one with the new name
 // 4. If the benchmark is deleted, delete the corresponding cluster
+//
+// The config is changed if any field of it differs from the cluster, see diffCluster.
 func (gc *Client) ReconcileClusters(gcpProject, repo, benchmarkRoot string) error {
-	handleExistingCluster := func(cluster container.Cluster, configExists bool, config ClusterConfig) error {
-		// retain the cluster, if the cluster config is unchanged
-		return gc.handleExistingClusterHelper(gcpProject, cluster, configExists, config, true)
-	}
-	handleNewClusterConfig := func(clusterName string, clusterConfig ClusterConfig) error {
-		// create a new cluster with the new cluster config
-		return gc.createClusterWithRetries(gcpProject, clusterName, clusterConfig)
-	}
-	return gc.processClusters(gcpProject, repo, benchmarkRoot, handleExistingCluster, handleNewClusterConfig)
+	return gc.run(OperationReconcile, gcpProject, repo, benchmarkRoot)
 }
 
 // DeleteClusters will delete all existing clusters.
 func (gc *Client) DeleteClusters(gcpProject, repo, benchmarkRoot string) error {
-	handleExistingCluster := func(cluster container.Cluster, configExists bool, config ClusterConfig) error {
-		// retain the cluster, if the cluster config is unchanged
-		return gc.deleteClusterWithRetries(gcpProject, cluster)
-	}
-	handleNewClusterConfig := func(clusterName string, clusterConfig ClusterConfig) error {
-		// do nothing
-		return nil
+	return gc.run(OperationDelete, gcpProject, repo, benchmarkRoot)
+}
+
+func (gc *Client) run(op Operation, gcpProject, repo, benchmarkRoot string) error {
+	changes, err := gc.Plan(op, gcpProject, repo, benchmarkRoot)
+	if err != nil {
+		return err
 	}
-	return gc.processClusters(gcpProject, repo, benchmarkRoot, handleExistingCluster, handleNewClusterConfig)
+	return gc.Apply(gcpProject, changes)
 }
 
-// processClusters will process existing clusters and configs for new clusters,
-// with the corresponding functions provided by callers.
-func (gc *Client) processClusters(
-	gcpProject, repo, benchmarkRoot string,
-	handleExistingCluster func(cluster container.Cluster, configExists bool, config ClusterConfig) error,
-	handleNewClusterConfig func(name string, config ClusterConfig) error,
-) error {
-	curtClusters, err := gc.listClustersForRepo(gcpProject, repo)
+// Plan returns the changes of the clusters of the repo for the operation,
+// sorted by cluster name, without touching anything.
+//
+// The clusters of the repo are the ones labeled with it, and the ones created before the
+// ownership labels with its prefix, which are labeled on reconcile if they are unchanged.
+// The clusters with the hash of the current config are unchanged, the others are compared
+// with the config, see diffCluster.
+func (gc *Client) Plan(op Operation, gcpProject, repo, benchmarkRoot string) ([]Change, error) {
+	curtClusters, takenNames, err := gc.listClustersForRepo(gcpProject, repo)
 	if err != nil {
-		return fmt.Errorf("failed getting clusters for the repo %q: %w", repo, err)
+		return nil, fmt.Errorf("failed getting clusters for the repo %q: %w", repo, err)
 	}
-	clusterConfigs, err := benchmarkClusters(repo, benchmarkRoot)
+	clusterConfigs, err := benchmarkClusters(benchmarkRoot)
 	if err != nil {
-		return fmt.Errorf("failed getting cluster configs for benchmarks in repo %q: %w", repo, err)
+		return nil, fmt.Errorf("failed getting cluster configs for benchmarks in repo %q: %w", repo, err)
+	}
+	// the benchmark labels of the clusters are sanitized benchmark names, they must tell the benchmarks apart
+	benchmarks := make(map[string]string, len(clusterConfigs))
+	for name := range clusterConfigs {
+		label := ownership.SanitizeValue(name)
+		if other, ok := benchmarks[label]; ok {
+			names := []string{name, other}
+			sort.Strings(names)
+			return nil, fmt.Errorf("benchmarks %q and %q have the same label %q in repo %q, rename one of them", names[0], names[1], label, repo)
+		}
+		benchmarks[label] = name
 	}
 
-	errCh := make(chan error, len(curtClusters)+len(clusterConfigs))
-	wg := sync.WaitGroup{}
-	// handle all existing clusters
+	var changes []Change
+	// plan all existing clusters
 	for i := range curtClusters {
-		wg.Add(1)
-		cluster := curtClusters[i]
-		config, configExists := clusterConfigs[cluster.Name]
-		go func() {
-			defer wg.Done()
-			if err := handleExistingCluster(cluster, configExists, config); err != nil {
-				errCh <- fmt.Errorf("failed handling cluster %v: %w", cluster, err)
+		cluster := &curtClusters[i].cluster
+		benchmark := curtClusters[i].benchmark
+		if name, ok := benchmarks[benchmark]; ok && !curtClusters[i].legacy {
+			benchmark = name
+		}
+		config, configExists := clusterConfigs[benchmark]
+		// remove the config as it's already been planned, the other clusters of the benchmark are deleted
+		delete(clusterConfigs, benchmark)
+		labels := ownerLabels(repo, benchmark, config)
+		change := Change{
+			Cluster: cluster.Name, Location: cluster.Location, Benchmark: benchmark,
+			existing: cluster, config: config, labels: labels,
+		}
+		switch {
+		case op == OperationDelete:
+			change.Action = ActionDelete
+		// if the cluster is currently being created or deleted, skip it as that job will handle it properly
+		case cluster.Status == statusProvisioning || cluster.Status == statusStopping:
+			change.Action = ActionSkip
+		case !configExists:
+			change.Action = ActionDelete
+		case op == OperationRecreate:
+			change.Action = ActionRecreate
+		case !curtClusters[i].legacy && cluster.ResourceLabels[configHashLabel] == labels[configHashLabel]:
+			change.Action = ActionKeep
+		default:
+			creq, err := gke.NewCreateClusterRequest(config.request(gcpProject, cluster.Name, labels))
+			if err != nil {
+				return nil, fmt.Errorf("invalid cluster config for %q: %w", cluster.Name, err)
 			}
-		}()
-		// remove the cluster from clusterConfigs as it's already been handled
-		delete(clusterConfigs, cluster.Name)
+			change.Action = ActionRecreate
+			if change.Diffs = diffCluster(cluster, config, creq.Cluster); len(change.Diffs) == 0 {
+				change.Action = ActionLabel
+				if curtClusters[i].legacy {
+					change.Diffs = []string{"created before the ownership labels"}
+				} else {
+					change.Diffs = []string{fmt.Sprintf("config hash: %q -> %q", cluster.ResourceLabels[configHashLabel], labels[configHashLabel])}
+				}
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	// plan all other cluster configs
+	if op != OperationDelete {
+		for benchmark, config := range clusterConfigs {
+			name := clusterNameForBenchmark(benchmark, repo)
+			// the name can be taken by a cluster of another repo created before the ownership labels
+			if takenNames[name] {
+				name = hashedClusterName(name)
+			}
+			changes = append(changes, Change{
+				Cluster: name, Location: config.Location, Benchmark: benchmark,
+				Action: ActionCreate, config: config, labels: ownerLabels(repo, benchmark, config),
+			})
+		}
 	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Cluster < changes[j].Cluster
+	})
+	return changes, nil
+}
 
-	// handle all other cluster configs
-	for name, config := range clusterConfigs {
+// Apply applies the changes of the clusters concurrently.
+func (gc *Client) Apply(gcpProject string, changes []Change) error {
+	errCh := make(chan error, len(changes))
+	wg := sync.WaitGroup{}
+	for i := range changes {
+		change := changes[i]
 		wg.Add(1)
-		// recreate them to avoid the issue with iterations of multiple Go routines
-		name, config := name, config
 		go func() {
 			defer wg.Done()
-			if err := handleNewClusterConfig(name, config); err != nil {
-				errCh <- fmt.Errorf("failed handling new cluster config %v: %w", config, err)
+			if err := gc.apply(gcpProject, change); err != nil {
+				errCh <- fmt.Errorf("failed to %s cluster %q: %w", change.Action, change.Cluster, err)
 			}
 		}()
 	}
@@ -166,7 +276,7 @@ func (gc *Client) processClusters(
 	wg.Wait()
 	close(errCh)
 
-	errs := make([]error, len(errCh))
+	errs := make([]error, 0, len(errCh))
 	for err := range errCh {
 		errs = append(errs, err)
 	}
@@ -174,55 +284,67 @@ func (gc *Client) processClusters(
 	return helpers.CombineErrors(errs)
 }
 
-// handleExistingClusterHelper is a helper function for handling an existing cluster.
-func (gc *Client) handleExistingClusterHelper(
-	gcpProject string,
-	cluster container.Cluster, configExists bool, config ClusterConfig,
-	retainIfUnchanged bool,
-) error {
-	// if the cluster is currently being created or deleted, return directly as that job will handle it properly
-	if cluster.Status == statusProvisioning || cluster.Status == statusStopping {
-		log.Printf("Cluster %q is being handled by another job, skip it", cluster.Name)
-		return nil
-	}
-
-	curtNodeCount := cluster.CurrentNodeCount
-	// if it's a regional cluster, the nodes will be in 3 zones. The CurrentNodeCount we get here is
-	// the total node count, so we'll need to divide with 3 to get the actual regional node count
-	if _, zone := gke.RegionZoneFromLoc(cluster.Location); zone == "" {
-		curtNodeCount /= 3
-	}
-	// if retainIfUnchanged is set to true, and the cluster config does not change, do nothing
-	// TODO(chizhg): also check the addons config
-	if configExists && retainIfUnchanged &&
-		curtNodeCount == config.NodeCount && cluster.Location == config.Location {
-		log.Printf("Cluster config is unchanged for %q, skip it", cluster.Name)
-		return nil
-	}
-
-	if err := gc.deleteClusterWithRetries(gcpProject, cluster); err != nil {
-		return fmt.Errorf("failed deleting cluster %q in %q: %w", cluster.Name, cluster.Location, err)
-	}
-	if configExists {
-		return gc.createClusterWithRetries(gcpProject, cluster.Name, config)
+// apply applies the change of a cluster.
+func (gc *Client) apply(gcpProject string, change Change) error {
+	switch change.Action {
+	case ActionSkip:
+		log.Printf("Cluster %q is being handled by another job, skip it", change.Cluster)
+	case ActionKeep:
+		log.Printf("Cluster config is unchanged for %q, skip it", change.Cluster)
+	case ActionCreate:
+		return gc.createClusterWithRetries(gcpProject, change.Cluster, change.config, change.labels)
+	case ActionDelete:
+		return gc.deleteClusterWithRetries(gcpProject, *change.existing)
+	case ActionRecreate:
+		if len(change.Diffs) != 0 {
+			log.Printf("Cluster config is changed for %q: %s", change.Cluster, strings.Join(change.Diffs, ", "))
+		}
+		if err := gc.deleteClusterWithRetries(gcpProject, *change.existing); err != nil {
+			return fmt.Errorf("failed deleting cluster %q in %q: %w", change.Cluster, change.Location, err)
+		}
+		return gc.createClusterWithRetries(gcpProject, change.Cluster, change.config, change.labels)
+	case ActionLabel:
+		log.Printf("Labeling cluster %q: %s", change.Cluster, strings.Join(change.Diffs, ", "))
+		labels := configLabels(change.existing.ResourceLabels)
+		if labels == nil {
+			labels = make(map[string]string, len(change.labels))
+		}
+		for k, v := range change.labels {
+			labels[k] = v
+		}
+		region, zone := gke.RegionZoneFromLoc(change.Location)
+		return gc.ops.SetResourceLabels(context.Background(), gcpProject, region, zone, change.Cluster, labels)
 	}
 	return nil
 }
 
-// listClustersForRepo will list all the clusters under the gcpProject that belong to the given repo.
-func (gc *Client) listClustersForRepo(gcpProject, repo string) ([]container.Cluster, error) {
-	allClusters, err := gc.ops.ListClustersInProject(gcpProject)
+// repoCluster is a cluster of the repo, and the benchmark it belongs to.
+type repoCluster struct {
+	owner
+	cluster container.Cluster
+}
+
+// listClustersForRepo will list all the clusters under the gcpProject that belong to the given repo,
+// the labeled clusters first so that the legacy clusters of the same benchmarks are deleted.
+// It also returns the names of all the clusters under the gcpProject.
+func (gc *Client) listClustersForRepo(gcpProject, repo string) ([]repoCluster, map[string]bool, error) {
+	allClusters, err := gc.ops.ListClustersInProject(context.Background(), gcpProject)
 	if err != nil {
-		return nil, fmt.Errorf("failed listing clusters in project %q: %w", gcpProject, err)
+		return nil, nil, fmt.Errorf("failed listing clusters in project %q: %w", gcpProject, err)
 	}
 
-	clusters := make([]container.Cluster, 0)
+	clusters := make([]repoCluster, 0)
+	names := make(map[string]bool, len(allClusters))
 	for _, cluster := range allClusters {
-		if clusterBelongsToRepo(cluster.Name, repo) {
-			clusters = append(clusters, *cluster)
+		names[cluster.Name] = true
+		if owner, ok := ownerOfCluster(cluster, repo); ok {
+			clusters = append(clusters, repoCluster{owner: owner, cluster: *cluster})
 		}
 	}
-	return clusters, nil
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return !clusters[i].legacy && clusters[j].legacy
+	})
+	return clusters, names, nil
 }
 
 // deleteClusterWithRetries will delete the given cluster,
@@ -233,7 +355,7 @@ func (gc *Client) deleteClusterWithRetries(gcpProject string, cluster container.
 	region, zone := gke.RegionZoneFromLoc(cluster.Location)
 	var err error
 	for i := 0; i < retryTimes; i++ {
-		if err = gc.ops.DeleteCluster(gcpProject, region, zone, cluster.Name); err == nil {
+		if err = gc.ops.DeleteCluster(context.Background(), gcpProject, region, zone, cluster.Name); err == nil {
 			break
 		}
 	}
@@ -249,37 +371,29 @@ func (gc *Client) deleteClusterWithRetries(gcpProject string, cluster container.
 // createClusterWithRetries will create a new cluster with the given config,
 // and retry for a maximum of retryTimes if there is an error.
 // TODO(chizhg): maybe move it to clustermanager library.
-func (gc *Client) createClusterWithRetries(gcpProject, name string, config ClusterConfig) error {
+func (gc *Client) createClusterWithRetries(gcpProject, name string, config ClusterConfig, labels map[string]string) error {
 	log.Printf("Creating cluster %q under project %q with config %v", name, gcpProject, config)
-	var addons []string
-	if strings.TrimSpace(config.Addons) != "" {
-		addons = strings.Split(config.Addons, ",")
-	}
-	req := &gke.Request{
-		Project:                gcpProject,
-		ClusterName:            name,
-		MinNodes:               config.NodeCount,
-		MaxNodes:               config.NodeCount,
-		NodeType:               config.NodeType,
-		Addons:                 addons,
-		EnableWorkloadIdentity: *enableWorkloadIdentity,
-		ServiceAccount:         *serviceAccount,
-	}
+	req := config.request(gcpProject, name, labels)
 	creq, err := gke.NewCreateClusterRequest(req)
 	if err != nil {
 		return fmt.Errorf("cannot create cluster with request %v: %w", req, err)
 	}
 
 	region, zone := gke.RegionZoneFromLoc(config.Location)
+	ctx := context.Background()
 	for i := 0; i < retryTimes; i++ {
 		// TODO(chizhg): retry with different requests, based on the error type
-		if err = gc.ops.CreateCluster(gcpProject, region, zone, creq); err != nil {
+		if err = gc.ops.CreateCluster(ctx, gcpProject, region, zone, creq); err != nil {
 			// If the cluster is actually created in the end, recreating it with the same name will fail again for sure,
 			// so we need to delete the broken cluster before retry.
 			// It is a best-effort delete, and won't throw any errors if the deletion fails.
-			if cluster, _ := gc.ops.GetCluster(gcpProject, region, zone, name); cluster != nil {
+			if cluster, _ := gc.ops.GetCluster(ctx, gcpProject, region, zone, name); cluster != nil {
 				gc.deleteClusterWithRetries(gcpProject, *cluster)
 			}
+			// Retrying with the same request won't help if the quota or the version is the problem.
+			if errors.Is(err, gke.ErrQuotaExceeded) || errors.Is(err, gke.ErrInvalidVersion) {
+				break
+			}
 		} else {
 			break
 		}
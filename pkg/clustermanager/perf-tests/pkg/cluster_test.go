@@ -17,7 +17,12 @@ limitations under the License.
 package pkg
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -141,12 +146,12 @@ func TestRecreateClusters(t *testing.T) {
 				Addons:      addons,
 			}
 			creq, _ := gke.NewCreateClusterRequest(req)
-			client.ops.CreateCluster(fakeProject, region, zone, creq)
+			client.ops.CreateCluster(context.Background(), fakeProject, region, zone, creq)
 		}
 		err := client.RecreateClusters(fakeProject, fakeRepository, testBenchmarkRoot)
 		fmt.Println(err)
 
-		clusters, _ := client.ops.ListClustersInProject(fakeProject)
+		clusters, _ := client.ops.ListClustersInProject(context.Background(), fakeProject)
 		actual := make(map[string]ClusterConfig)
 		for _, cluster := range clusters {
 			actual[cluster.Name] = ClusterConfig{
@@ -271,12 +276,12 @@ func TestReconcileClusters(t *testing.T) {
 				Addons:      addons,
 			}
 			creq, _ := gke.NewCreateClusterRequest(req)
-			client.ops.CreateCluster(fakeProject, region, zone, creq)
+			client.ops.CreateCluster(context.Background(), fakeProject, region, zone, creq)
 		}
 		err := client.ReconcileClusters(fakeProject, fakeRepository, testBenchmarkRoot)
 		fmt.Println(err)
 
-		clusters, _ := client.ops.ListClustersInProject(fakeProject)
+		clusters, _ := client.ops.ListClustersInProject(context.Background(), fakeProject)
 		actual := make(map[string]ClusterConfig)
 		for _, cluster := range clusters {
 			actual[cluster.Name] = ClusterConfig{
@@ -368,12 +373,12 @@ func TestDeleteClusters(t *testing.T) {
 				Addons:      addons,
 			}
 			creq, _ := gke.NewCreateClusterRequest(req)
-			client.ops.CreateCluster(fakeProject, region, zone, creq)
+			client.ops.CreateCluster(context.Background(), fakeProject, region, zone, creq)
 		}
 		err := client.DeleteClusters(fakeProject, fakeRepository, testBenchmarkRoot)
 		fmt.Println(err)
 
-		clusters, _ := client.ops.ListClustersInProject(fakeProject)
+		clusters, _ := client.ops.ListClustersInProject(context.Background(), fakeProject)
 		actual := make(map[string]ClusterConfig)
 		for _, cluster := range clusters {
 			actual[cluster.Name] = ClusterConfig{
@@ -391,6 +396,252 @@ func TestDeleteClusters(t *testing.T) {
 	}
 }
 
+func TestCreateClusterWithRetries(t *testing.T) {
+	config := ClusterConfig{Location: "us-central1", NodeCount: 2, NodeType: "n1-standard-4"}
+	testCases := []struct {
+		testName string
+		setup    func(fgsc *gkeFake.GKESDKClient)
+		// expectedErr is the error expected with errors.Is, nil if the creation succeeds
+		expectedErr error
+		// expectedCreations is the number of attempts to create the cluster
+		expectedCreations int
+	}{{
+		testName: "transient stockout is retried",
+		setup: func(fgsc *gkeFake.GKESDKClient) {
+			fgsc.InjectFault(gkeFake.Fault{Method: gkeFake.MethodCreateCluster, Code: gkeFake.CodeStockout, Message: "stockout", Times: 2})
+		},
+		expectedCreations: 3,
+	}, {
+		testName:          "persistent stockout fails after all retries",
+		setup:             func(fgsc *gkeFake.GKESDKClient) { fgsc.SetCapacity("us-central1", 1) },
+		expectedErr:       gke.ErrStockout,
+		expectedCreations: retryTimes,
+	}, {
+		testName:          "quota exceeded is not retried",
+		setup:             func(fgsc *gkeFake.GKESDKClient) { fgsc.SetQuota(fakeProject, "us-central1", 1) },
+		expectedErr:       gke.ErrQuotaExceeded,
+		expectedCreations: 1,
+	}, {
+		testName: "invalid version is not retried",
+		setup: func(fgsc *gkeFake.GKESDKClient) {
+			fgsc.InjectFault(gkeFake.Fault{Method: gkeFake.MethodCreateCluster, Message: `Master version "1.99.0-gke.1" is unsupported.`})
+		},
+		expectedErr:       gke.ErrInvalidVersion,
+		expectedCreations: 1,
+	}}
+
+	for _, tc := range testCases {
+		client := setupFakeGKEClient()
+		fgsc := client.ops.(*gkeFake.GKESDKClient)
+		tc.setup(fgsc)
+		err := client.createClusterWithRetries(fakeProject, "test-cluster", config, nil)
+		if (tc.expectedErr == nil && err != nil) || (tc.expectedErr != nil && !errors.Is(err, tc.expectedErr)) {
+			t.Fatalf("Test %q fails, expected error %v, but got %v", tc.testName, tc.expectedErr, err)
+		}
+
+		creations := 0
+		for _, call := range fgsc.Calls() {
+			if call.Method == gkeFake.MethodCreateCluster {
+				creations++
+			}
+		}
+		if creations != tc.expectedCreations {
+			t.Fatalf("Test %q fails, expected %d attempts to create the cluster, but got %d", tc.testName, tc.expectedCreations, creations)
+		}
+		// The broken clusters are deleted before retrying, only the created cluster is left.
+		wantClusters := 0
+		if tc.expectedErr == nil {
+			wantClusters = 1
+		}
+		if clusters := fgsc.Clusters()["projects/p/locations/us-central1"]; len(clusters) != wantClusters {
+			t.Fatalf("Test %q fails, expected %d clusters, but got %v", tc.testName, wantClusters, clusters)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	benchmark1 := clusterConfigForBenchmark("test-benchmark1", testBenchmarkRoot)
+	benchmark2 := clusterConfigForBenchmark("test-benchmark2", testBenchmarkRoot)
+	stale := benchmark2
+	stale.NodeType = "n1-standard-4"
+	precreatedClusters := []struct {
+		name   string
+		config ClusterConfig
+		labels map[string]string
+	}{
+		// unchanged
+		{"r--test-benchmark1", benchmark1, ownerLabels(fakeRepository, "test-benchmark1", benchmark1)},
+		// changed
+		{"r--test-benchmark2", stale, ownerLabels(fakeRepository, "test-benchmark2", stale)},
+		// unchanged, but created before the ownership labels
+		{"r--test-benchmark3", clusterConfigForBenchmark("test-benchmark3", testBenchmarkRoot), nil},
+		// created before the ownership labels, without benchmark
+		{"r--random-cluster", stale, nil},
+		// labeled for another repo, even if it has the repo prefix
+		{"r--test-benchmark4", benchmark2, ownerLabels("r--test", "benchmark4", benchmark2)},
+	}
+	testCases := []struct {
+		op              Operation
+		expectedChanges []Change
+	}{{
+		op: OperationReconcile,
+		expectedChanges: []Change{
+			{Cluster: "r--random-cluster", Location: defaultLocation, Benchmark: "random-cluster", Action: ActionDelete},
+			{Cluster: "r--test-benchmark1", Location: "us-west1", Benchmark: "test-benchmark1", Action: ActionKeep},
+			{Cluster: "r--test-benchmark2", Location: defaultLocation, Benchmark: "test-benchmark2", Action: ActionRecreate,
+				Diffs: []string{`nodePools[default-pool].nodeType: "n1-standard-4" -> "e2-standard-4"`}},
+			{Cluster: "r--test-benchmark3", Location: defaultLocation, Benchmark: "test-benchmark3", Action: ActionLabel,
+				Diffs: []string{"created before the ownership labels"}},
+			// the name is taken by the cluster of the other repo
+			{Cluster: hashedClusterName("r--test-benchmark4"), Location: defaultLocation, Benchmark: "test-benchmark4", Action: ActionCreate},
+		},
+	}, {
+		op: OperationRecreate,
+		expectedChanges: []Change{
+			{Cluster: "r--random-cluster", Location: defaultLocation, Benchmark: "random-cluster", Action: ActionDelete},
+			{Cluster: "r--test-benchmark1", Location: "us-west1", Benchmark: "test-benchmark1", Action: ActionRecreate},
+			{Cluster: "r--test-benchmark2", Location: defaultLocation, Benchmark: "test-benchmark2", Action: ActionRecreate},
+			{Cluster: "r--test-benchmark3", Location: defaultLocation, Benchmark: "test-benchmark3", Action: ActionRecreate},
+			{Cluster: hashedClusterName("r--test-benchmark4"), Location: defaultLocation, Benchmark: "test-benchmark4", Action: ActionCreate},
+		},
+	}, {
+		op: OperationDelete,
+		expectedChanges: []Change{
+			{Cluster: "r--random-cluster", Location: defaultLocation, Benchmark: "random-cluster", Action: ActionDelete},
+			{Cluster: "r--test-benchmark1", Location: "us-west1", Benchmark: "test-benchmark1", Action: ActionDelete},
+			{Cluster: "r--test-benchmark2", Location: defaultLocation, Benchmark: "test-benchmark2", Action: ActionDelete},
+			{Cluster: "r--test-benchmark3", Location: defaultLocation, Benchmark: "test-benchmark3", Action: ActionDelete},
+		},
+	}}
+
+	for _, tc := range testCases {
+		client := setupFakeGKEClient()
+		fgsc := client.ops.(*gkeFake.GKESDKClient)
+		for _, cluster := range precreatedClusters {
+			createCluster(t, client, cluster.name, cluster.config, cluster.labels)
+		}
+		fgsc.ClearCalls()
+
+		changes, err := client.Plan(tc.op, fakeProject, fakeRepository, testBenchmarkRoot)
+		if err != nil {
+			t.Fatalf("Plan(%q) fails with error: %v", tc.op, err)
+		}
+		// only compare the planned changes, not the configs and clusters they are applied with
+		for i := range changes {
+			changes[i].config, changes[i].labels, changes[i].existing = ClusterConfig{}, nil, nil
+		}
+		if diff := cmp.Diff(tc.expectedChanges, changes, cmp.AllowUnexported(Change{})); diff != "" {
+			t.Fatalf("Plan(%q) returns wrong result (-want +got):\n%s", tc.op, diff)
+		}
+		// planning doesn't touch anything
+		if calls := fgsc.Calls(); len(calls) != 0 {
+			t.Fatalf("Plan(%q) is expected to not change any cluster, but got calls %v", tc.op, calls)
+		}
+	}
+}
+
+func TestReconcileKeepsUnchangedClusters(t *testing.T) {
+	client := setupFakeGKEClient()
+	fgsc := client.ops.(*gkeFake.GKESDKClient)
+	// created before the ownership labels
+	unchanged := clusterNameForBenchmark("test-benchmark1", fakeRepository)
+	createCluster(t, client, unchanged, clusterConfigForBenchmark("test-benchmark1", testBenchmarkRoot), nil)
+	changed := clusterNameForBenchmark("test-benchmark3", fakeRepository)
+	createCluster(t, client, changed, ClusterConfig{Location: defaultLocation, NodeCount: 1, NodeType: defaultNodeType}, nil)
+	fgsc.ClearCalls()
+
+	if err := client.ReconcileClusters(fakeProject, fakeRepository, testBenchmarkRoot); err != nil {
+		t.Fatalf("ReconcileClusters fails with error: %v", err)
+	}
+	var deleted, labeled []string
+	for _, call := range fgsc.Calls() {
+		switch call.Method {
+		case gkeFake.MethodDeleteCluster:
+			deleted = append(deleted, call.Cluster)
+		case gkeFake.MethodSetResourceLabels:
+			labeled = append(labeled, call.Cluster)
+		}
+	}
+	// the addons of test-benchmark3 are changed
+	if diff := cmp.Diff([]string{changed}, deleted); diff != "" {
+		t.Fatalf("ReconcileClusters deletes wrong clusters (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{unchanged}, labeled); diff != "" {
+		t.Fatalf("ReconcileClusters labels wrong clusters (-want +got):\n%s", diff)
+	}
+
+	// all the clusters are labeled with the hash of their configs after reconciling
+	fgsc.ClearCalls()
+	if err := client.ReconcileClusters(fakeProject, fakeRepository, testBenchmarkRoot); err != nil {
+		t.Fatalf("ReconcileClusters fails with error: %v", err)
+	}
+	for _, call := range fgsc.Calls() {
+		t.Errorf("ReconcileClusters is expected to keep all the reconciled clusters, but got call %v", call)
+	}
+}
+
+func TestReconcileLongBenchmarkNames(t *testing.T) {
+	root, err := ioutil.TempDir("", "benchmarks")
+	if err != nil {
+		t.Fatalf("Failed creating the benchmark root: %v", err)
+	}
+	defer os.RemoveAll(root)
+	benchmark := "a-benchmark-with-a-name-longer-than-gke-allows"
+	if err := os.Mkdir(filepath.Join(root, benchmark), 0755); err != nil {
+		t.Fatalf("Failed creating the benchmark: %v", err)
+	}
+
+	client := setupFakeGKEClient()
+	if err := client.ReconcileClusters(fakeProject, fakeRepository, root); err != nil {
+		t.Fatalf("ReconcileClusters fails with error: %v", err)
+	}
+	changes, err := client.Plan(OperationReconcile, fakeProject, fakeRepository, root)
+	if err != nil {
+		t.Fatalf("Plan fails with error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Benchmark != benchmark || changes[0].Action != ActionKeep {
+		t.Fatalf("Expected to keep the cluster of benchmark %q, but got %v", benchmark, changes)
+	}
+	if len(changes[0].Cluster) > maxClusterNameLength {
+		t.Fatalf("Expected a cluster name of at most %d characters, but got %q", maxClusterNameLength, changes[0].Cluster)
+	}
+}
+
+func TestPlanBenchmarkLabelCollision(t *testing.T) {
+	root, err := ioutil.TempDir("", "benchmarks")
+	if err != nil {
+		t.Fatalf("Failed creating the benchmark root: %v", err)
+	}
+	defer os.RemoveAll(root)
+	// both benchmarks are labeled "a_benchmark"
+	for _, benchmark := range []string{"A.Benchmark", "a_benchmark"} {
+		if err := os.Mkdir(filepath.Join(root, benchmark), 0755); err != nil {
+			t.Fatalf("Failed creating the benchmark: %v", err)
+		}
+	}
+
+	client := setupFakeGKEClient()
+	if _, err := client.Plan(OperationReconcile, fakeProject, fakeRepository, root); err == nil || !strings.Contains(err.Error(), "same label") {
+		t.Fatalf("Plan is expected to fail for benchmarks with the same label, but got error: %v", err)
+	}
+	for _, call := range client.ops.(*gkeFake.GKESDKClient).Calls() {
+		if call.Method == gkeFake.MethodCreateCluster {
+			t.Errorf("Plan is expected to not create any cluster, but got call %v", call)
+		}
+	}
+}
+
+func createCluster(t *testing.T, client Client, name string, config ClusterConfig, labels map[string]string) {
+	region, zone := gke.RegionZoneFromLoc(config.Location)
+	creq, err := gke.NewCreateClusterRequest(config.request(fakeProject, name, labels))
+	if err != nil {
+		t.Fatalf("Failed creating the request for cluster %q: %v", name, err)
+	}
+	if err := client.ops.CreateCluster(context.Background(), fakeProject, region, zone, creq); err != nil {
+		t.Fatalf("Failed creating cluster %q: %v", name, err)
+	}
+}
+
 // Return addons as a string slice for the given cluster.
 // In this test we only use istio so only checking istio is enough here.
 func getAddonsForCluster(cluster *container.Cluster) string {
@@ -0,0 +1,191 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkg
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	container "google.golang.org/api/container/v1beta1"
+
+	"knative.dev/test-infra/pkg/gke"
+)
+
+// defaultServiceAccount is the service account GKE reports for the nodes if
+// none is specified
+const defaultServiceAccount = "default"
+
+// diffCluster returns the differences between the existing cluster and the
+// cluster config, one per field in the form of "field: current -> wanted",
+// or nothing if the cluster is up to date. want is the cluster created with
+// the config.
+func diffCluster(cluster *container.Cluster, config ClusterConfig, want *container.Cluster) []string {
+	var diffs []string
+	add := func(field string, got, want interface{}) {
+		if !reflect.DeepEqual(got, want) {
+			diffs = append(diffs, fmt.Sprintf("%s: %v -> %v", field, format(got), format(want)))
+		}
+	}
+
+	add("location", cluster.Location, config.Location)
+	// The version of the cluster is resolved by GKE, so only the explicit
+	// versions are compared, as prefixes, e.g. 1.17 of 1.17.9-gke.1504.
+	if config.Version != "" && config.Version != "latest" &&
+		!strings.HasPrefix(cluster.InitialClusterVersion, config.Version) {
+		add("version", cluster.InitialClusterVersion, config.Version)
+	}
+	add("releaseChannel", releaseChannel(cluster), config.ReleaseChannel)
+	add("addons", addons(cluster.AddonsConfig, want.AddonsConfig), addons(want.AddonsConfig, want.AddonsConfig))
+	add("labels", configLabels(cluster.ResourceLabels), configLabels(want.ResourceLabels))
+	add("enableWorkloadIdentity",
+		cluster.WorkloadIdentityConfig != nil && cluster.WorkloadIdentityConfig.WorkloadPool != "",
+		config.EnableWorkloadIdentity)
+
+	pools := make(map[string]*container.NodePool, len(cluster.NodePools))
+	for _, np := range cluster.NodePools {
+		pools[np.Name] = np
+	}
+	for _, wnp := range want.NodePools {
+		np, ok := pools[wnp.Name]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("nodePools[%s]: missing", wnp.Name))
+			continue
+		}
+		delete(pools, wnp.Name)
+		diffs = append(diffs, diffNodePool(np, wnp)...)
+	}
+	var extra []string
+	for name := range pools {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		diffs = append(diffs, fmt.Sprintf("nodePools[%s]: not in the config", name))
+	}
+	return diffs
+}
+
+// diffNodePool returns the differences between the existing node pool and the
+// wanted node pool.
+func diffNodePool(np, want *container.NodePool) []string {
+	var diffs []string
+	add := func(field string, got, want interface{}) {
+		if !reflect.DeepEqual(got, want) {
+			diffs = append(diffs, fmt.Sprintf("nodePools[%s].%s: %v -> %v", np.Name, field, format(got), format(want)))
+		}
+	}
+
+	var minNodes, maxNodes int64
+	if np.Autoscaling != nil {
+		minNodes, maxNodes = np.Autoscaling.MinNodeCount, np.Autoscaling.MaxNodeCount
+	}
+	add("minNodes", minNodes, want.Autoscaling.MinNodeCount)
+	add("maxNodes", maxNodes, want.Autoscaling.MaxNodeCount)
+
+	config := np.Config
+	if config == nil {
+		config = &container.NodeConfig{}
+	}
+	wantConfig := want.Config
+	add("nodeType", config.MachineType, wantConfig.MachineType)
+	add("labels", nonEmpty(config.Labels), nonEmpty(wantConfig.Labels))
+	add("taints", taints(config.Taints), taints(wantConfig.Taints))
+	add("spot", config.Preemptible, wantConfig.Preemptible)
+	add("serviceAccount", nodeServiceAccount(config.ServiceAccount), nodeServiceAccount(wantConfig.ServiceAccount))
+	// GKE picks the disk and the image of the nodes if they are not
+	// specified, so they are only compared if they are.
+	if wantConfig.DiskSizeGb != 0 {
+		add("diskSizeGB", config.DiskSizeGb, wantConfig.DiskSizeGb)
+	}
+	if wantConfig.DiskType != "" {
+		add("diskType", config.DiskType, wantConfig.DiskType)
+	}
+	if wantConfig.ImageType != "" {
+		add("imageType", strings.ToUpper(config.ImageType), strings.ToUpper(wantConfig.ImageType))
+	}
+	return diffs
+}
+
+// addons returns the sorted addons enabled in ac. GKE enables some addons by
+// default, they are only returned if they are also enabled in want.
+func addons(ac, want *container.AddonsConfig) []string {
+	wanted := make(map[string]bool)
+	for _, name := range gke.EnabledAddons(want) {
+		wanted[name] = true
+	}
+	var res []string
+	for _, name := range gke.EnabledAddons(ac) {
+		if !gke.DefaultAddon(name) || wanted[name] {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func releaseChannel(cluster *container.Cluster) string {
+	if cluster.ReleaseChannel == nil {
+		return ""
+	}
+	return cluster.ReleaseChannel.Channel
+}
+
+func nodeServiceAccount(sa string) string {
+	if sa == "" {
+		return defaultServiceAccount
+	}
+	return sa
+}
+
+// taints returns the taints in the form of key=value:effect, sorted
+func taints(nts []*container.NodeTaint) []string {
+	var res []string
+	for _, nt := range nts {
+		res = append(res, fmt.Sprintf("%s=%s:%s", nt.Key, nt.Value, nt.Effect))
+	}
+	sort.Strings(res)
+	return res
+}
+
+// nonEmpty returns nil for empty maps, so that they equal nil maps
+func nonEmpty(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// format formats the value of a field for the differences
+func format(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case []string:
+		return fmt.Sprintf("%q", v)
+	case map[string]string:
+		pairs := make([]string, 0, len(v))
+		for k, val := range v {
+			pairs = append(pairs, k+"="+val)
+		}
+		sort.Strings(pairs)
+		return fmt.Sprintf("%q", pairs)
+	default:
+		return fmt.Sprint(v)
+	}
+}
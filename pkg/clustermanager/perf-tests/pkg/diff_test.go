@@ -0,0 +1,158 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkg
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	container "google.golang.org/api/container/v1beta1"
+
+	"knative.dev/test-infra/pkg/gke"
+)
+
+func TestDiffCluster(t *testing.T) {
+	basic := ClusterConfig{Location: "us-central1", NodeCount: 2, NodeType: "e2-standard-4", Addons: "istio"}
+	full := ClusterConfig{
+		Location:               "us-west1",
+		Version:                "1.17",
+		Labels:                 map[string]string{"team": "serving"},
+		EnableWorkloadIdentity: true,
+		NodePools: []NodePoolConfig{{
+			Name: "system", MinNodes: 1, MaxNodes: 1, NodeType: "e2-standard-4",
+		}, {
+			Name: "benchmark", MinNodes: 3, MaxNodes: 5, NodeType: "e2-standard-8",
+			Taints:     []TaintConfig{{Key: "dedicated", Value: "benchmark", Effect: gke.TaintEffectNoSchedule}},
+			DiskSizeGB: 200,
+		}},
+	}
+	testCases := []struct {
+		testName string
+		config   ClusterConfig
+		// change changes the cluster created with the config
+		change        func(cluster *container.Cluster)
+		expectedDiffs []string
+	}{{
+		testName: "unchanged cluster",
+		config:   basic,
+		change:   func(cluster *container.Cluster) {},
+	}, {
+		testName: "unchanged cluster with node pools",
+		config:   full,
+		change:   func(cluster *container.Cluster) {},
+	}, {
+		testName: "node type is changed",
+		config:   basic,
+		change: func(cluster *container.Cluster) {
+			cluster.NodePools[0].Config.MachineType = "n1-standard-4"
+		},
+		expectedDiffs: []string{`nodePools[default-pool].nodeType: "n1-standard-4" -> "e2-standard-4"`},
+	}, {
+		testName: "node count and location are changed",
+		config:   basic,
+		change: func(cluster *container.Cluster) {
+			cluster.Location = "us-west1"
+			cluster.NodePools[0].Autoscaling.MaxNodeCount = 3
+		},
+		expectedDiffs: []string{
+			`location: "us-west1" -> "us-central1"`,
+			`nodePools[default-pool].maxNodes: 3 -> 2`,
+		},
+	}, {
+		testName: "addon is removed",
+		config:   basic,
+		change: func(cluster *container.Cluster) {
+			cluster.AddonsConfig = &container.AddonsConfig{}
+		},
+		expectedDiffs: []string{`addons: [] -> ["istio"]`},
+	}, {
+		testName: "addons enabled by GKE by default are ignored",
+		config:   basic,
+		change: func(cluster *container.Cluster) {
+			cluster.AddonsConfig.HorizontalPodAutoscaling = &container.HorizontalPodAutoscaling{}
+			cluster.AddonsConfig.HttpLoadBalancing = &container.HttpLoadBalancing{}
+		},
+	}, {
+		testName: "version resolved by GKE is unchanged",
+		config:   full,
+		change: func(cluster *container.Cluster) {
+			cluster.InitialClusterVersion = "1.17.9-gke.1504"
+		},
+	}, {
+		testName: "version is changed",
+		config:   full,
+		change: func(cluster *container.Cluster) {
+			cluster.InitialClusterVersion = "1.16.13-gke.401"
+		},
+		expectedDiffs: []string{`version: "1.16.13-gke.401" -> "1.17"`},
+	}, {
+		testName: "labels and workload identity are changed",
+		config:   full,
+		change: func(cluster *container.Cluster) {
+			cluster.ResourceLabels = nil
+			cluster.WorkloadIdentityConfig = nil
+		},
+		expectedDiffs: []string{
+			`labels: [] -> ["team=serving"]`,
+			`enableWorkloadIdentity: false -> true`,
+		},
+	}, {
+		testName: "node pool settings are changed",
+		config:   full,
+		change: func(cluster *container.Cluster) {
+			cluster.NodePools[1].Config.Taints = nil
+			cluster.NodePools[1].Config.DiskSizeGb = 100
+			cluster.NodePools[1].Config.ServiceAccount = "sa@p.iam.gserviceaccount.com"
+		},
+		expectedDiffs: []string{
+			`nodePools[benchmark].taints: [] -> ["dedicated=benchmark:NO_SCHEDULE"]`,
+			`nodePools[benchmark].serviceAccount: "sa@p.iam.gserviceaccount.com" -> "default"`,
+			`nodePools[benchmark].diskSizeGB: 100 -> 200`,
+		},
+	}, {
+		testName: "default service account is unchanged",
+		config:   full,
+		change: func(cluster *container.Cluster) {
+			cluster.NodePools[0].Config.ServiceAccount = defaultServiceAccount
+		},
+	}, {
+		testName: "node pools are added and removed",
+		config:   full,
+		change: func(cluster *container.Cluster) {
+			cluster.NodePools[1].Name = "old"
+		},
+		expectedDiffs: []string{
+			`nodePools[benchmark]: missing`,
+			`nodePools[old]: not in the config`,
+		},
+	}}
+
+	for _, tc := range testCases {
+		want, err := gke.NewCreateClusterRequest(tc.config.request(fakeProject, "test-cluster", nil))
+		if err != nil {
+			t.Fatalf("Test %q fails, unexpected error creating the request: %v", tc.testName, err)
+		}
+		cluster, _ := gke.NewCreateClusterRequest(tc.config.request(fakeProject, "test-cluster", nil))
+		cluster.Cluster.Location = tc.config.Location
+		tc.change(cluster.Cluster)
+
+		diffs := diffCluster(cluster.Cluster, tc.config, want.Cluster)
+		if diff := cmp.Diff(tc.expectedDiffs, diffs); diff != "" {
+			t.Fatalf("Test %q fails, diffCluster returns wrong result (-want +got):\n%s", tc.testName, diff)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	container "google.golang.org/api/container/v1beta1"
+
+	"knative.dev/test-infra/pkg/clustermanager/ownership"
+)
+
+// The clusters are labeled with the repo and the benchmark they belong to,
+// and the hash of the config they are created with. The labels are managed by
+// perf-tests, they are not part of the cluster configs.
+const (
+	managedLabelPrefix = "knative-perf-"
+	repoLabel          = managedLabelPrefix + "repo"
+	benchmarkLabel     = managedLabelPrefix + "benchmark"
+	configHashLabel    = managedLabelPrefix + "config-hash"
+)
+
+const (
+	// maxClusterNameLength is the maximum length of the GKE cluster names
+	maxClusterNameLength = 40
+	// clusterNameHashLength is the length of the hash suffixing the cluster
+	// names that are too long
+	clusterNameHashLength = 8
+	// configHashLength is the length of the config hash in the label
+	configHashLength = 32
+)
+
+// owner is the repo and the benchmark a cluster belongs to
+type owner struct {
+	benchmark string
+	// legacy is set for the clusters created before the ownership labels,
+	// which are identified by their repo prefix
+	legacy bool
+}
+
+// ownerLabels returns the labels of the cluster of the benchmark in the repo
+// created with the config.
+func ownerLabels(repo, benchmark string, config ClusterConfig) map[string]string {
+	return map[string]string{
+		repoLabel:       ownership.SanitizeValue(repo),
+		benchmarkLabel:  ownership.SanitizeValue(benchmark),
+		configHashLabel: configHash(config),
+	}
+}
+
+// ownerOfCluster returns the benchmark label of the cluster if it belongs to
+// the repo. The clusters without the labels belong to the repo if they have
+// its prefix, in which case their benchmark is the rest of their name.
+func ownerOfCluster(cluster *container.Cluster, repo string) (owner, bool) {
+	if labelRepo, ok := cluster.ResourceLabels[repoLabel]; ok {
+		if labelRepo != ownership.SanitizeValue(repo) {
+			return owner{}, false
+		}
+		return owner{benchmark: cluster.ResourceLabels[benchmarkLabel]}, true
+	}
+	if !clusterBelongsToRepo(cluster.Name, repo) {
+		return owner{}, false
+	}
+	return owner{benchmark: benchmarkNameForCluster(cluster.Name, repo), legacy: true}, true
+}
+
+// configHash returns the hash of the config, so that the clusters created
+// with a config can be told unchanged without comparing their specs.
+func configHash(config ClusterConfig) string {
+	// Marshaling can't fail with the types of ClusterConfig, and the keys of
+	// the maps are sorted so the hash is stable.
+	data, _ := json.Marshal(config)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:configHashLength]
+}
+
+// configLabels returns the labels that are not managed by perf-tests, or nil
+// if there is none.
+func configLabels(labels map[string]string) map[string]string {
+	var res map[string]string
+	for k, v := range labels {
+		if strings.HasPrefix(k, managedLabelPrefix) {
+			continue
+		}
+		if res == nil {
+			res = make(map[string]string)
+		}
+		res[k] = v
+	}
+	return res
+}
@@ -121,39 +121,23 @@ func runCommands(cmdLines ...string) (string, error) {
 }
 
 // RunCommandsInParallel will run the commands in parallel.
-// It will always finish running all commands, and return all standard output and errors together.
+// It will always finish running all commands, and return all standard output and errors together,
+// in the same order as cmdLines.
 func runCommandsInParallel(cmdLines ...string) (string, error) {
-	errCh := make(chan error, len(cmdLines))
-	outputCh := make(chan string, len(cmdLines))
-	mx := sync.Mutex{}
+	outputs := make([]string, len(cmdLines))
+	errs := make([]error, len(cmdLines))
 	wg := sync.WaitGroup{}
 	for i := range cmdLines {
-		cmdLine := cmdLines[i]
+		i := i
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			output, err := RunCommand(cmdLine)
-			mx.Lock()
-			outputCh <- output
-			errCh <- err
-			mx.Unlock()
+			outputs[i], errs[i] = RunCommand(cmdLines[i])
 		}()
 	}
-
 	wg.Wait()
-	close(outputCh)
-	close(errCh)
-
-	os := make([]string, 0, len(cmdLines))
-	es := make([]error, 0, len(cmdLines))
-	for o := range outputCh {
-		os = append(os, o)
-	}
-	for e := range errCh {
-		es = append(es, e)
-	}
 
-	return strings.Join(os, separator), helpers.CombineErrors(es)
+	return strings.Join(outputs, separator), helpers.CombineErrors(errs)
 }
 
 // getErrorCode extracts the exit code of an *ExitError type
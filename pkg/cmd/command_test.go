@@ -159,18 +159,23 @@ func TestRunCommandsInParallel(t *testing.T) {
 	}{
 		{
 			[]string{"echo 123", "echo 234"},
-			[]string{"123\n\n234\n", "234\n\n123\n"},
+			[]string{"123\n\n234\n"},
 			nil,
 		},
 		{
 			[]string{"", "echo 123"},
-			[]string{"\n123\n", "123\n\n"},
-			[]string{invalidInputErrorPrefix + "", invalidInputErrorPrefix + ""},
+			[]string{"\n123\n"},
+			[]string{invalidInputErrorPrefix + ""},
 		},
 		{
 			[]string{"bash -c 'echo foo; exit 1'", "bash -c 'echo bar > /dev/stderr; exit 1'"},
-			[]string{"\nfoo\n", "foo\n\n"},
-			[]string{"bar\n\n", "\nbar\n"},
+			[]string{"foo\n\n"},
+			[]string{"\nbar\n"},
+		},
+		{
+			[]string{"bash -c 'sleep 0.2; echo slow'", "echo fast"},
+			[]string{"slow\n\nfast\n"},
+			nil,
 		},
 	}
 	for _, c := range testCases {
@@ -0,0 +1,345 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	shell "github.com/kballard/go-shellquote"
+
+	"knative.dev/test-infra/pkg/helpers"
+)
+
+// These vars are defined for easy mocking in unit tests.
+var (
+	RunCommandContext            = runCommandContext
+	RunCommandsContext           = runCommandsContext
+	RunCommandsInParallelContext = runCommandsInParallelContext
+)
+
+// Stream identifies the output stream a line was read from.
+type Stream int
+
+const (
+	// Stdout is the standard output stream of a command.
+	Stdout Stream = iota
+	// Stderr is the standard error stream of a command.
+	Stderr
+)
+
+func (s Stream) String() string {
+	if s == Stderr {
+		return "stderr"
+	}
+	return "stdout"
+}
+
+// Line is a single line of output emitted by a running command.
+type Line struct {
+	Command string
+	Stream  Stream
+	Text    string
+}
+
+// Result is the structured outcome of running a single command.
+type Result struct {
+	Command  string
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Duration time.Duration
+}
+
+// RunOption enables further configuration of the context-aware run functions.
+type RunOption func(*runConfig)
+
+type runConfig struct {
+	cmdOptions  []Option
+	timeout     time.Duration
+	stdout      io.Writer
+	stderr      io.Writer
+	lineHandler func(Line)
+	parallelism int
+
+	// mu serializes writes to the shared writers and calls to the line
+	// handler, since they can be shared by commands running in parallel.
+	mu sync.Mutex
+}
+
+// WithCmdOptions returns an option that applies the given Options to every Cmd.
+func WithCmdOptions(options ...Option) RunOption {
+	return func(c *runConfig) {
+		c.cmdOptions = append(c.cmdOptions, options...)
+	}
+}
+
+// WithTimeout returns an option that kills a command if it runs longer than
+// the given duration. The timeout applies to each command separately.
+func WithTimeout(timeout time.Duration) RunOption {
+	return func(c *runConfig) {
+		c.timeout = timeout
+	}
+}
+
+// WithStdoutWriter returns an option that copies the standard output of the
+// command to w while it is still being captured in the Result.
+func WithStdoutWriter(w io.Writer) RunOption {
+	return func(c *runConfig) {
+		c.stdout = w
+	}
+}
+
+// WithStderrWriter returns an option that copies the standard error of the
+// command to w while it is still being captured in the Result.
+func WithStderrWriter(w io.Writer) RunOption {
+	return func(c *runConfig) {
+		c.stderr = w
+	}
+}
+
+// WithLineHandler returns an option that calls f for every line the command
+// writes to stdout or stderr, as soon as the line is complete.
+// Calls to f are serialized, even when commands run in parallel.
+func WithLineHandler(f func(Line)) RunOption {
+	return func(c *runConfig) {
+		c.lineHandler = f
+	}
+}
+
+// WithParallelism returns an option that limits how many commands
+// RunCommandsInParallelContext runs at the same time. Zero or a negative value
+// means no limit.
+func WithParallelism(n int) RunOption {
+	return func(c *runConfig) {
+		c.parallelism = n
+	}
+}
+
+func newRunConfig(options []RunOption) *runConfig {
+	c := &runConfig{}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// RunCommandContext will run the command and return its Result, plus error if there is one.
+// The command, and every process it started, is killed once ctx is done or the
+// timeout configured with WithTimeout expires. The returned error is always a
+// *CommandLineError, whose Cause is the context error if the command was killed.
+func runCommandContext(ctx context.Context, cmdLine string, options ...RunOption) (*Result, error) {
+	return newRunConfig(options).run(ctx, cmdLine)
+}
+
+// RunCommandsContext will run the commands sequentially.
+// If there is an error when running a command, it will return directly with the
+// results so far and the error.
+func runCommandsContext(ctx context.Context, cmdLines []string, options ...RunOption) ([]*Result, error) {
+	c := newRunConfig(options)
+	results := make([]*Result, 0, len(cmdLines))
+	for _, cmdLine := range cmdLines {
+		res, err := c.run(ctx, cmdLine)
+		results = append(results, res)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// RunCommandsInParallelContext will run the commands in parallel, at most
+// WithParallelism commands at a time.
+// It will always finish running all commands, and return the results in the
+// same order as cmdLines with all errors combined.
+func runCommandsInParallelContext(ctx context.Context, cmdLines []string, options ...RunOption) ([]*Result, error) {
+	c := newRunConfig(options)
+	results := make([]*Result, len(cmdLines))
+	errs := make([]error, len(cmdLines))
+
+	limit := c.parallelism
+	if limit <= 0 || limit > len(cmdLines) {
+		limit = len(cmdLines)
+	}
+	sem := make(chan struct{}, limit)
+	wg := sync.WaitGroup{}
+	for i := range cmdLines {
+		i := i
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i], errs[i] = c.run(ctx, cmdLines[i])
+		}()
+	}
+	wg.Wait()
+
+	return results, helpers.CombineErrors(errs)
+}
+
+func (c *runConfig) run(ctx context.Context, cmdLine string) (*Result, error) {
+	res := &Result{Command: cmdLine}
+	cmdSplit, err := shell.Split(cmdLine)
+	if len(cmdSplit) == 0 || err != nil {
+		res.ExitCode = defaultErrCode
+		return res, &CommandLineError{
+			Command:     cmdLine,
+			ErrorOutput: []byte(invalidInputErrorPrefix + cmdLine),
+			ErrorCode:   defaultErrCode,
+		}
+	}
+
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	cmd := exec.Command(cmdSplit[0], cmdSplit[1:]...)
+	for _, option := range c.cmdOptions {
+		option(cmd)
+	}
+
+	var ob, eb bytes.Buffer
+	stdoutLines := c.newLineWriter(cmdLine, Stdout)
+	stderrLines := c.newLineWriter(cmdLine, Stderr)
+	cmd.Stdout = c.teeWriter(&ob, cmd.Stdout, c.stdout, stdoutLines)
+	cmd.Stderr = c.teeWriter(&eb, cmd.Stderr, c.stderr, stderrLines)
+	setProcessGroup(cmd)
+
+	killed := false
+	start := time.Now()
+	err = cmd.Start()
+	if err == nil {
+		done := make(chan struct{})
+		exited := make(chan struct{})
+		go func() {
+			defer close(exited)
+			select {
+			case <-ctx.Done():
+				killed = true
+				killProcessGroup(cmd)
+			case <-done:
+			}
+		}()
+		err = cmd.Wait()
+		close(done)
+		<-exited
+	}
+	res.Duration = time.Since(start)
+	if stdoutLines != nil {
+		stdoutLines.flush()
+	}
+	if stderrLines != nil {
+		stderrLines.flush()
+	}
+
+	res.Stdout = ob.String()
+	res.Stderr = eb.String()
+	if err == nil && !killed {
+		return res, nil
+	}
+
+	res.ExitCode = getErrorCode(err)
+	cle := &CommandLineError{
+		Command:     cmdLine,
+		ErrorOutput: eb.Bytes(),
+		ErrorCode:   res.ExitCode,
+	}
+	if killed {
+		cle.Cause = ctx.Err()
+	} else if _, ok := err.(*exec.ExitError); !ok {
+		// The command could not be started at all, e.g. the binary does not exist.
+		cle.Cause = err
+	}
+	return res, cle
+}
+
+// teeWriter returns a writer that writes to buf and every other non-nil writer.
+func (c *runConfig) teeWriter(buf *bytes.Buffer, cmdWriter, shared io.Writer, lines *lineWriter) io.Writer {
+	writers := []io.Writer{buf}
+	if cmdWriter != nil {
+		writers = append(writers, cmdWriter)
+	}
+	if shared != nil {
+		writers = append(writers, &lockedWriter{mu: &c.mu, w: shared})
+	}
+	if lines != nil {
+		writers = append(writers, lines)
+	}
+	return io.MultiWriter(writers...)
+}
+
+func (c *runConfig) newLineWriter(cmdLine string, stream Stream) *lineWriter {
+	if c.lineHandler == nil {
+		return nil
+	}
+	return &lineWriter{
+		emit: func(text string) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.lineHandler(Line{Command: cmdLine, Stream: stream, Text: text})
+		},
+	}
+}
+
+// lockedWriter guards a writer that is shared between commands.
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// lineWriter splits everything written to it into lines, and emits each of
+// them without the trailing newline.
+type lineWriter struct {
+	buf  []byte
+	emit func(string)
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.emit(string(bytes.TrimSuffix(l.buf[:i], []byte("\r"))))
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush emits the last line if it was not terminated by a newline.
+func (l *lineWriter) flush() {
+	if len(l.buf) > 0 {
+		l.emit(string(l.buf))
+		l.buf = nil
+	}
+}
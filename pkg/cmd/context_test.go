@@ -0,0 +1,206 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunCommandContext(t *testing.T) {
+	testCases := []struct {
+		command           string
+		options           []RunOption
+		expectedStdout    string
+		expectedStderr    string
+		expectedErrorCode int
+		expectedCause     error
+	}{{
+		"",
+		nil,
+		"",
+		"",
+		1,
+		nil,
+	}, {
+		"echo hello, world",
+		nil,
+		"hello, world\n",
+		"",
+		0,
+		nil,
+	}, {
+		"bash -c 'echo out; echo err > /dev/stderr; exit 3'",
+		nil,
+		"out\n",
+		"err\n",
+		3,
+		nil,
+	}, {
+		"bash -c 'echo ${HELLO}'",
+		[]RunOption{WithCmdOptions(WithEnvs([]string{"HELLO=hello, world"}))},
+		"hello, world\n",
+		"",
+		0,
+		nil,
+	}, {
+		"bash -c 'echo start; sleep 10; echo end'",
+		[]RunOption{WithTimeout(200 * time.Millisecond)},
+		"start\n",
+		"",
+		-1,
+		context.DeadlineExceeded,
+	}, {
+		// The child sleep keeps stdout open, so the whole process group must be killed.
+		"bash -c 'sleep 10 & wait'",
+		[]RunOption{WithTimeout(200 * time.Millisecond)},
+		"",
+		"",
+		-1,
+		context.DeadlineExceeded,
+	}}
+	for _, c := range testCases {
+		res, err := RunCommandContext(context.Background(), c.command, c.options...)
+		if res.Stdout != c.expectedStdout {
+			t.Fatalf("Expect stdout %q but actual is %q", c.expectedStdout, res.Stdout)
+		}
+		if res.Stderr != c.expectedStderr {
+			t.Fatalf("Expect stderr %q but actual is %q", c.expectedStderr, res.Stderr)
+		}
+		if res.ExitCode != c.expectedErrorCode {
+			t.Fatalf("Expect exit code %d but actual is %d", c.expectedErrorCode, res.ExitCode)
+		}
+		if res.Duration > 5*time.Second {
+			t.Fatalf("Expect %q to finish quickly but it took %v", c.command, res.Duration)
+		}
+		if c.expectedErrorCode == 0 {
+			if err != nil {
+				t.Fatalf("Expect to get no error but got %v", err)
+			}
+			continue
+		}
+		ce, ok := err.(*CommandLineError)
+		if !ok {
+			t.Fatalf("Expect to get a CommandLineError but got %s", reflect.TypeOf(err))
+		}
+		if ce.ErrorCode != c.expectedErrorCode {
+			t.Fatalf("Expect to get error code %d but got %d", c.expectedErrorCode, ce.ErrorCode)
+		}
+		if c.expectedCause != nil && !errors.Is(err, c.expectedCause) {
+			t.Fatalf("Expect error to be caused by %v but got %v", c.expectedCause, err)
+		}
+	}
+}
+
+func TestRunCommandContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+	res, err := RunCommandContext(ctx, "sleep 10")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expect to get a context.Canceled error but got %v", err)
+	}
+	if res.Duration > 5*time.Second {
+		t.Fatalf("Expect the command to be killed on cancel but it took %v", res.Duration)
+	}
+}
+
+func TestRunCommandContextStreaming(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	var lines []Line
+	res, err := RunCommandContext(context.Background(),
+		"bash -c 'echo a; echo b > /dev/stderr; printf c'",
+		WithStdoutWriter(&stdout),
+		WithStderrWriter(&stderr),
+		WithLineHandler(func(l Line) { lines = append(lines, l) }),
+	)
+	if err != nil {
+		t.Fatalf("Expect to get no error but got %v", err)
+	}
+	if stdout.String() != "a\nc" || res.Stdout != "a\nc" {
+		t.Fatalf("Expect stdout to be both streamed and captured, got %q and %q", stdout.String(), res.Stdout)
+	}
+	if stderr.String() != "b\n" || res.Stderr != "b\n" {
+		t.Fatalf("Expect stderr to be both streamed and captured, got %q and %q", stderr.String(), res.Stderr)
+	}
+
+	got := map[Stream][]string{}
+	for _, l := range lines {
+		got[l.Stream] = append(got[l.Stream], l.Text)
+	}
+	want := map[Stream][]string{
+		Stdout: {"a", "c"},
+		Stderr: {"b"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expect lines %v but got %v", want, got)
+	}
+}
+
+func TestRunCommandsContext(t *testing.T) {
+	results, err := RunCommandsContext(context.Background(),
+		[]string{"echo 123", "bash -c 'exit 10'", "echo 234"})
+	if len(results) != 2 {
+		t.Fatalf("Expect to stop after the failed command but got %d results", len(results))
+	}
+	if results[0].Stdout != "123\n" || results[1].ExitCode != 10 {
+		t.Fatalf("Unexpected results %+v, %+v", results[0], results[1])
+	}
+	if ce, ok := err.(*CommandLineError); !ok || ce.ErrorCode != 10 {
+		t.Fatalf("Expect to get a CommandLineError with code 10 but got %v", err)
+	}
+}
+
+func TestRunCommandsInParallelContext(t *testing.T) {
+	cmdLines := []string{
+		"bash -c 'sleep 0.3; echo first'",
+		"bash -c 'echo second; exit 2'",
+		"echo third",
+	}
+	results, err := RunCommandsInParallelContext(context.Background(), cmdLines)
+	if err == nil {
+		t.Fatal("Expect to get an error but got nil")
+	}
+	for i, want := range []struct {
+		stdout   string
+		exitCode int
+	}{{"first\n", 0}, {"second\n", 2}, {"third\n", 0}} {
+		if results[i].Command != cmdLines[i] {
+			t.Fatalf("Expect result %d to be for %q but got %q", i, cmdLines[i], results[i].Command)
+		}
+		if results[i].Stdout != want.stdout || results[i].ExitCode != want.exitCode {
+			t.Fatalf("Expect result %d to be %+v but got %+v", i, want, results[i])
+		}
+	}
+}
+
+func TestRunCommandsInParallelContextParallelism(t *testing.T) {
+	cmdLines := []string{"sleep 0.2", "sleep 0.2", "sleep 0.2", "sleep 0.2"}
+	start := time.Now()
+	if _, err := RunCommandsInParallelContext(context.Background(), cmdLines, WithParallelism(2)); err != nil {
+		t.Fatalf("Expect to get no error but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("Expect at most 2 commands to run at a time but all finished in %v", elapsed)
+	}
+}
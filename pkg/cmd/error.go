@@ -21,8 +21,22 @@ type CommandLineError struct {
 	Command     string
 	ErrorCode   int
 	ErrorOutput []byte
+	// Cause is the underlying error when the command did not exit on its own,
+	// e.g. context.DeadlineExceeded if it was killed after a timeout.
+	Cause error
 }
 
 func (c CommandLineError) Error() string {
-	return string(c.ErrorOutput)
+	if c.Cause == nil {
+		return string(c.ErrorOutput)
+	}
+	if len(c.ErrorOutput) == 0 {
+		return c.Cause.Error()
+	}
+	return c.Cause.Error() + ": " + string(c.ErrorOutput)
+}
+
+// Unwrap returns the underlying cause of the error, if any.
+func (c CommandLineError) Unwrap() error {
+	return c.Cause
 }
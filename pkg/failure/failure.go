@@ -0,0 +1,285 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package failure classifies the failures of cluster creation and decides how
+// to retry them, so that all the tools creating clusters react the same way to
+// the same failure.
+//
+// The classes and their policies are loaded from a YAML file, for example:
+//
+//	classes:
+//	- class: stockout
+//	  patterns: ["does not have enough resources available to fulfill"]
+//	  policy:
+//	    action: next-machine-type
+//	    then: next-region
+//	- class: node-registration
+//	  patterns: ['only \d+ nodes out of \d+ have registered']
+//	  policy:
+//	    action: retry-same-region
+//	    backoff: 1m
+//	    maxRetries: 1
+//	    then: next-region
+//
+// The first class with a pattern matching the error message wins, the failures
+// matching no class are unknown and fail fast unless the unknown class has a
+// policy.
+package failure
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Class is a class of failure
+type Class string
+
+// The classes of the default classifier
+const (
+	// ClassStockout is when the location doesn't have enough resources
+	ClassStockout Class = "stockout"
+	// ClassQuota is when the project doesn't have enough quota in the location
+	ClassQuota Class = "quota"
+	// ClassUnsupportedVersion is when the version isn't available in the
+	// location, e.g. not available yet
+	ClassUnsupportedVersion Class = "unsupported-version"
+	// ClassNodeRegistration is when the nodes failed to register with the
+	// master, which is usually transient
+	ClassNodeRegistration Class = "node-registration"
+	// ClassPermission is when the account isn't allowed to create the cluster
+	ClassPermission Class = "permission"
+	// ClassUnknown is the class of the failures matching no class
+	ClassUnknown Class = "unknown"
+)
+
+// Action is what to do after a failure
+type Action string
+
+// The actions after a failure
+const (
+	// ActionRetrySameRegion retries in the same region after the backoff
+	ActionRetrySameRegion Action = "retry-same-region"
+	// ActionNextRegion retries in the next region
+	ActionNextRegion Action = "next-region"
+	// ActionNextMachineType retries in the same region with the next machine type
+	ActionNextMachineType Action = "next-machine-type"
+	// ActionFailFast doesn't retry
+	ActionFailFast Action = "fail-fast"
+)
+
+// Policy is how to react to the failures of a class
+type Policy struct {
+	// Action is the action to take after a failure
+	Action Action `yaml:"action"`
+	// Backoff is how long to wait before retrying in the same region
+	Backoff time.Duration `yaml:"backoff,omitempty"`
+	// MaxRetries is how many times to retry in the same region, 1 if 0
+	MaxRetries int `yaml:"maxRetries,omitempty"`
+	// Then is the action to take once Action can't be taken anymore, e.g. once
+	// all the machine types were tried, fail-fast if empty
+	Then Action `yaml:"then,omitempty"`
+}
+
+// Rule classifies the failures matching its patterns
+type Rule struct {
+	Class Class `yaml:"class"`
+	// Patterns are regular expressions matched against the error messages
+	Patterns []string `yaml:"patterns,omitempty"`
+	Policy   Policy   `yaml:"policy"`
+
+	regexps []*regexp.Regexp
+}
+
+// Classifier classifies the failures with rules
+type Classifier struct {
+	Classes []Rule `yaml:"classes"`
+}
+
+// Classified is implemented by the errors knowing their class, e.g. the errors
+// of the GKE operations. The patterns still take precedence over it.
+type Classified interface {
+	FailureClass() Class
+}
+
+// Default returns the default classifier, which is the same as
+// config/failure/classes.yaml
+func Default() *Classifier {
+	c, err := Parse([]byte(defaultClasses))
+	if err != nil {
+		panic(fmt.Sprintf("invalid default failure classes: %v", err))
+	}
+	return c
+}
+
+const defaultClasses = `
+classes:
+- class: stockout
+  patterns:
+  - does not have enough resources available to fulfill
+  - ZONE_RESOURCE_POOL_EXHAUSTED
+  policy:
+    action: next-machine-type
+    then: next-region
+- class: node-registration
+  patterns:
+  - only \d+ nodes out of \d+ have registered
+  policy:
+    action: retry-same-region
+    backoff: 1m
+    maxRetries: 1
+    then: next-region
+- class: quota
+  patterns:
+  - (?i)quota exceeded|insufficient (regional )?quota|exceeded .*quota
+  policy:
+    action: fail-fast
+- class: unsupported-version
+  patterns:
+  - Master version "[0-9a-z\-.]+" is unsupported
+  - No valid versions with the prefix "[0-9.]+" found
+  - (?i)invalid (master |node )?version
+  policy:
+    action: next-region
+- class: permission
+  patterns:
+  - (?i)permission denied|PERMISSION_DENIED|required '[a-z.]+' permission|does not have .*permission
+  policy:
+    action: fail-fast
+- class: unknown
+  policy:
+    action: next-region
+`
+
+// Load loads the classifier from a YAML file, the default classifier if path
+// is empty
+func Load(path string) (*Classifier, error) {
+	if path == "" {
+		return Default(), nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading the failure classes: %w", err)
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid failure classes %q: %w", path, err)
+	}
+	return c, nil
+}
+
+// Parse parses the classifier from YAML
+func Parse(data []byte) (*Classifier, error) {
+	c := &Classifier{}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, err
+	}
+	for i := range c.Classes {
+		r := &c.Classes[i]
+		if r.Class == "" {
+			return nil, fmt.Errorf("class %d: missing class name", i+1)
+		}
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("class %s: %w", r.Class, err)
+		}
+	}
+	return c, nil
+}
+
+func (r *Rule) compile() error {
+	if len(r.Patterns) == 0 && r.Class != ClassUnknown {
+		return errors.New("no patterns")
+	}
+	r.regexps = nil
+	for _, p := range r.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return err
+		}
+		r.regexps = append(r.regexps, re)
+	}
+	p := &r.Policy
+	switch p.Action {
+	case ActionRetrySameRegion, ActionNextRegion, ActionNextMachineType, ActionFailFast:
+	default:
+		return fmt.Errorf("unknown action %q", p.Action)
+	}
+	switch p.Then {
+	case "", ActionNextRegion, ActionNextMachineType, ActionFailFast:
+	default:
+		return fmt.Errorf("unknown or invalid then action %q", p.Then)
+	}
+	if p.Backoff < 0 || p.MaxRetries < 0 {
+		return errors.New("negative backoff or maxRetries")
+	}
+	if p.Action == ActionRetrySameRegion && p.MaxRetries == 0 {
+		p.MaxRetries = 1
+	}
+	return nil
+}
+
+// Classify returns the class of err, empty if err is nil. A nil Classifier is
+// the default one.
+func (c *Classifier) Classify(err error) Class {
+	if err == nil {
+		return ""
+	}
+	if class := c.ClassifyMessage(err.Error()); class != ClassUnknown {
+		return class
+	}
+	var classified Classified
+	if errors.As(err, &classified) {
+		if class := classified.FailureClass(); class != "" {
+			return class
+		}
+	}
+	return ClassUnknown
+}
+
+// ClassifyMessage returns the class of an error message, ClassUnknown if it
+// matches no class
+func (c *Classifier) ClassifyMessage(msg string) Class {
+	if c == nil {
+		c = defaultClassifier
+	}
+	for _, r := range c.Classes {
+		for _, re := range r.regexps {
+			if re.MatchString(msg) {
+				return r.Class
+			}
+		}
+	}
+	return ClassUnknown
+}
+
+// Policy returns the policy of a class, fail-fast if the class has none
+func (c *Classifier) Policy(class Class) Policy {
+	if c == nil {
+		c = defaultClassifier
+	}
+	for _, r := range c.Classes {
+		if r.Class == class {
+			return r.Policy
+		}
+	}
+	return Policy{Action: ActionFailFast}
+}
+
+var defaultClassifier = Default()
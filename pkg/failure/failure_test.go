@@ -0,0 +1,115 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package failure
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type classifiedError struct {
+	class Class
+}
+
+func (e classifiedError) Error() string {
+	return "operation failed"
+}
+
+func (e classifiedError) FailureClass() Class {
+	return e.class
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Class
+	}{
+		{"nil", nil, ""},
+		{"stockout", errors.New("Google Compute Engine does not have enough resources available to fulfill request: us-central1-a."), ClassStockout},
+		{"node registration", errors.New("All cluster resources were brought up, but: only 2 nodes out of 3 have registered; this is likely due to Nodes failing to start correctly"), ClassNodeRegistration},
+		{"quota", errors.New("Insufficient regional quota to satisfy request: resource \"CPUS\""), ClassQuota},
+		{"unsupported version", errors.New(`Master version "1.99.0-gke.1" is unsupported.`), ClassUnsupportedVersion},
+		{"permission", errors.New("Required 'container.clusters.create' permission for 'projects/p'"), ClassPermission},
+		{"wrapped", fmt.Errorf("failed creating the cluster: %w", errors.New("PERMISSION_DENIED")), ClassPermission},
+		{"classified error", fmt.Errorf("wrapped: %w", classifiedError{ClassQuota}), ClassQuota},
+		{"unknown", errors.New("something went wrong"), ClassUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (*Classifier)(nil).Classify(tt.err); got != tt.want {
+				t.Fatalf("Expected class %q, but got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	c, err := Parse([]byte(`
+classes:
+- class: custom
+  patterns: [boom]
+  policy: {action: retry-same-region, backoff: 2s}
+`))
+	if err != nil {
+		t.Fatalf("Expected no error parsing the classes, but got '%v'", err)
+	}
+	if got := c.Classify(errors.New("boom")); got != "custom" {
+		t.Fatalf("Expected class %q, but got %q", "custom", got)
+	}
+	want := Policy{Action: ActionRetrySameRegion, Backoff: 2e9, MaxRetries: 1}
+	if got := c.Policy("custom"); got != want {
+		t.Fatalf("Expected policy %+v, but got %+v", want, got)
+	}
+	if got := c.Policy(ClassStockout); got.Action != ActionFailFast {
+		t.Fatalf("Expected the classes without policy to fail fast, but got %+v", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	invalid := map[string]string{
+		"missing class":     "classes: [{patterns: [a], policy: {action: fail-fast}}]",
+		"no patterns":       "classes: [{class: quota, policy: {action: fail-fast}}]",
+		"invalid pattern":   "classes: [{class: quota, patterns: ['('], policy: {action: fail-fast}}]",
+		"unknown action":    "classes: [{class: quota, patterns: [a], policy: {action: give-up}}]",
+		"invalid then":      "classes: [{class: quota, patterns: [a], policy: {action: next-region, then: retry-same-region}}]",
+		"negative backoff":  "classes: [{class: quota, patterns: [a], policy: {action: retry-same-region, backoff: -1s}}]",
+		"unknown field":     "classes: [{class: quota, patterns: [a], policy: {action: fail-fast, retries: 2}}]",
+		"invalid durations": "classes: [{class: quota, patterns: [a], policy: {action: retry-same-region, backoff: soon}}]",
+	}
+	for name, data := range invalid {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error, but got none", name)
+		}
+	}
+}
+
+func TestDefault(t *testing.T) {
+	// The default classes are the same as the classes in the config.
+	c, err := Load("../../config/failure/classes.yaml")
+	if err != nil {
+		t.Fatalf("Expected no error loading the classes, but got '%v'", err)
+	}
+	if d := Default(); !reflect.DeepEqual(c.Classes, d.Classes) {
+		t.Fatalf("Expected the default classes %+v, but got %+v", d.Classes, c.Classes)
+	}
+	if c, err := Load(""); err != nil || len(c.Classes) != len(Default().Classes) {
+		t.Fatalf("Expected the default classes, but got %+v and '%v'", c, err)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package failure
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+
+	"knative.dev/test-infra/pkg/junit"
+	"knative.dev/test-infra/pkg/metautil"
+)
+
+// Metadata keys of the results of the cluster creation
+const (
+	// AttemptsKey is the number of attempts
+	AttemptsKey = "E2E:CreationAttempts"
+	// FailuresKey are the classes of the failed attempts, comma separated
+	FailuresKey = "E2E:CreationFailures"
+	// ResultKey is "success", or the class of the last failure
+	ResultKey = "E2E:CreationResult"
+)
+
+const (
+	junitSuite = "cluster-creation"
+	junitFile  = "junit_cluster-creation.xml"
+)
+
+// Report records the results of the attempts in the metadata and in a JUnit
+// file of dir, the artifacts directory if empty
+func Report(dir string, results []Result) error {
+	client, err := metautil.NewClient(dir)
+	if err != nil {
+		return fmt.Errorf("failed creating the metadata client: %w", err)
+	}
+	result := "success"
+	var classes []string
+	for _, res := range results {
+		result = "success"
+		if res.Err != nil {
+			classes = append(classes, string(res.Class))
+			result = string(res.Class)
+		}
+	}
+	for key, val := range map[string]string{
+		AttemptsKey: strconv.Itoa(len(results)),
+		FailuresKey: strings.Join(classes, ","),
+		ResultKey:   result,
+	} {
+		if err := client.Set(key, val); err != nil {
+			return fmt.Errorf("failed setting %s: %w", key, err)
+		}
+	}
+	data, err := JUnit(results).ToBytes("", "  ")
+	if err != nil {
+		return fmt.Errorf("failed marshaling the JUnit results: %w", err)
+	}
+	return ioutil.WriteFile(path.Join(path.Dir(client.Path), junitFile), data, 0644)
+}
+
+// JUnit returns the results as a JUnit suite with one test case per attempt,
+// the failures have their class as type
+func JUnit(results []Result) *junit.TestSuites {
+	suite := junit.TestSuite{Name: junitSuite}
+	var total float64
+	for _, res := range results {
+		name := "create cluster"
+		if res.Region != "" {
+			name += " in " + res.Region
+		}
+		if res.MachineType != "" {
+			name += " with " + res.MachineType
+		}
+		tc := junit.TestCase{
+			Name:      fmt.Sprintf("%s (attempt %d)", name, res.Number+1),
+			ClassName: junitSuite,
+			Time:      fmt.Sprintf("%.3f", res.Duration.Seconds()),
+		}
+		total += res.Duration.Seconds()
+		if res.Err != nil {
+			tc.Failure = &junit.Result{Message: res.Err.Error(), Type: string(res.Class), Value: res.Err.Error()}
+			tc.AddProperty("class", string(res.Class))
+			tc.AddProperty("action", string(res.Action))
+		}
+		suite.AddTestCase(tc)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total)
+	suites := &junit.TestSuites{}
+	suites.AddTestSuite(&suite)
+	return suites
+}
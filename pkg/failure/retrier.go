@@ -0,0 +1,170 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package failure
+
+import (
+	"time"
+)
+
+// Attempt is an attempt to create a cluster
+type Attempt struct {
+	// Number is the number of the attempt, from 0
+	Number int
+	Region string
+	// MachineType is empty if no machine types were given to the Retrier
+	MachineType string
+}
+
+// Result is the result of an attempt
+type Result struct {
+	Attempt
+	Duration time.Duration
+	// Err is the error of the attempt, nil if it succeeded
+	Err error
+	// Class and Action are the class of the failure and the action taken after
+	// it, empty if the attempt succeeded
+	Class  Class
+	Action Action
+}
+
+// Retrier decides where to retry creating a cluster after each failure, from
+// the policy of the class of the failure. For example:
+//
+//	r := failure.NewRetrier(classifier, regions, machineTypes)
+//	for {
+//		a := r.Attempt()
+//		err = create(a.Region, a.MachineType)
+//		if !r.Next(err) {
+//			break
+//		}
+//	}
+type Retrier struct {
+	// Sleep waits for the backoff before retrying in the same region,
+	// time.Sleep by default
+	Sleep func(time.Duration)
+
+	classifier   *Classifier
+	regions      []string
+	machineTypes []string
+	region       int
+	machineType  int
+	retries      int
+	attempt      Attempt
+	start        time.Time
+	results      []Result
+}
+
+// NewRetrier returns a Retrier trying the regions and the machine types in
+// order, starting with the first ones. A nil classifier is the default one.
+func NewRetrier(classifier *Classifier, regions, machineTypes []string) *Retrier {
+	if len(regions) == 0 {
+		regions = []string{""}
+	}
+	r := &Retrier{
+		Sleep:        time.Sleep,
+		classifier:   classifier,
+		regions:      regions,
+		machineTypes: machineTypes,
+	}
+	r.attempt = r.current(0)
+	r.start = time.Now()
+	return r
+}
+
+// Attempt returns the current attempt
+func (r *Retrier) Attempt() Attempt {
+	return r.attempt
+}
+
+// Next records the result of the current attempt, and returns true if it
+// should be retried with the next Attempt, after waiting for the backoff if
+// any. It returns false if the attempt succeeded, or if the failure shouldn't
+// or can't be retried.
+func (r *Retrier) Next(err error) bool {
+	res := Result{Attempt: r.attempt, Duration: time.Since(r.start), Err: err}
+	if err == nil {
+		r.results = append(r.results, res)
+		return false
+	}
+	res.Class = r.classifier.Classify(err)
+	policy := r.classifier.Policy(res.Class)
+	res.Action = r.apply(policy)
+	r.results = append(r.results, res)
+	if res.Action == ActionFailFast {
+		return false
+	}
+	if res.Action == ActionRetrySameRegion && policy.Backoff > 0 {
+		r.Sleep(policy.Backoff)
+	}
+	r.attempt = r.current(r.attempt.Number + 1)
+	r.start = time.Now()
+	return true
+}
+
+// Stop records the failure of the current attempt without retrying it,
+// whatever the policy of its class, e.g. when it's not sure the attempt failed
+// to create the cluster
+func (r *Retrier) Stop(err error) {
+	r.results = append(r.results, Result{
+		Attempt:  r.attempt,
+		Duration: time.Since(r.start),
+		Err:      err,
+		Class:    r.classifier.Classify(err),
+		Action:   ActionFailFast,
+	})
+}
+
+// Results returns the results of the attempts, in order
+func (r *Retrier) Results() []Result {
+	return append([]Result(nil), r.results...)
+}
+
+// apply moves to the next attempt following the policy, and returns the
+// action taken
+func (r *Retrier) apply(p Policy) Action {
+	for _, a := range []Action{p.Action, p.Then} {
+		switch a {
+		case ActionRetrySameRegion:
+			if r.retries < p.MaxRetries {
+				r.retries++
+				return a
+			}
+		case ActionNextMachineType:
+			if r.machineType+1 < len(r.machineTypes) {
+				r.machineType++
+				r.retries = 0
+				return a
+			}
+		case ActionNextRegion:
+			if r.region+1 < len(r.regions) {
+				r.region++
+				r.machineType = 0
+				r.retries = 0
+				return a
+			}
+		}
+	}
+	return ActionFailFast
+}
+
+func (r *Retrier) current(number int) Attempt {
+	a := Attempt{Number: number, Region: r.regions[r.region]}
+	if len(r.machineTypes) > 0 {
+		a.MachineType = r.machineTypes[r.machineType]
+	}
+	return a
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package failure
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"knative.dev/test-infra/pkg/junit"
+)
+
+var (
+	errStockout     = errors.New("does not have enough resources available to fulfill request")
+	errRegistration = errors.New("only 2 nodes out of 3 have registered")
+	errQuota        = errors.New("Quota exceeded for quota metric 'CPUS'")
+)
+
+func TestRetrier(t *testing.T) {
+	tests := []struct {
+		name  string
+		errs  []error
+		want  []Attempt
+		wantA []Action
+		// wantSleeps are the backoffs waited for
+		wantSleeps []time.Duration
+	}{{
+		name:  "success",
+		errs:  []error{nil},
+		want:  []Attempt{{0, "r1", "m1"}},
+		wantA: []Action{""},
+	}, {
+		name: "stockout then node registration",
+		errs: []error{errStockout, errStockout, errRegistration, errRegistration},
+		want: []Attempt{{0, "r1", "m1"}, {1, "r1", "m2"}, {2, "r2", "m1"}, {3, "r2", "m1"}},
+		wantA: []Action{
+			ActionNextMachineType, ActionNextRegion, ActionRetrySameRegion, ActionFailFast,
+		},
+		wantSleeps: []time.Duration{time.Minute},
+	}, {
+		name:  "fail fast",
+		errs:  []error{errQuota},
+		want:  []Attempt{{0, "r1", "m1"}},
+		wantA: []Action{ActionFailFast},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRetrier(nil, []string{"r1", "r2"}, []string{"m1", "m2"})
+			var sleeps []time.Duration
+			r.Sleep = func(d time.Duration) {
+				sleeps = append(sleeps, d)
+			}
+			var attempts []Attempt
+			for i := 0; ; i++ {
+				attempts = append(attempts, r.Attempt())
+				if !r.Next(tt.errs[i]) {
+					break
+				}
+			}
+			if !reflect.DeepEqual(attempts, tt.want) {
+				t.Fatalf("Expected attempts %v, but got %v", tt.want, attempts)
+			}
+			var actions []Action
+			for _, res := range r.Results() {
+				actions = append(actions, res.Action)
+			}
+			if !reflect.DeepEqual(actions, tt.wantA) {
+				t.Fatalf("Expected actions %v, but got %v", tt.wantA, actions)
+			}
+			if !reflect.DeepEqual(sleeps, tt.wantSleeps) {
+				t.Fatalf("Expected backoffs %v, but got %v", tt.wantSleeps, sleeps)
+			}
+		})
+	}
+}
+
+func TestStop(t *testing.T) {
+	r := NewRetrier(nil, []string{"r1", "r2"}, nil)
+	r.Stop(errStockout)
+	want := []Result{{Attempt: Attempt{0, "r1", ""}, Err: errStockout, Class: ClassStockout, Action: ActionFailFast}}
+	got := r.Results()
+	for i := range got {
+		got[i].Duration = 0
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected results %+v, but got %+v", want, got)
+	}
+}
+
+func TestReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "failure")
+	if err != nil {
+		t.Fatalf("Expected no error creating the directory, but got '%v'", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := NewRetrier(nil, []string{"r1", "r2"}, nil)
+	r.Next(errStockout)
+	r.Next(nil)
+	if err := Report(dir, r.Results()); err != nil {
+		t.Fatalf("Expected no error reporting the results, but got '%v'", err)
+	}
+
+	data, err := ioutil.ReadFile(path.Join(dir, "metadata.json"))
+	if err != nil {
+		t.Fatalf("Expected no error reading the metadata, but got '%v'", err)
+	}
+	var metadata map[string]string
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		t.Fatalf("Expected no error parsing the metadata, but got '%v'", err)
+	}
+	want := map[string]string{AttemptsKey: "2", FailuresKey: "stockout", ResultKey: "success"}
+	if !reflect.DeepEqual(metadata, want) {
+		t.Fatalf("Expected metadata %v, but got %v", want, metadata)
+	}
+
+	data, err = ioutil.ReadFile(path.Join(dir, junitFile))
+	if err != nil {
+		t.Fatalf("Expected no error reading the JUnit file, but got '%v'", err)
+	}
+	suites, err := junit.UnMarshal(data)
+	if err != nil {
+		t.Fatalf("Expected no error parsing the JUnit file, but got '%v'", err)
+	}
+	cases := suites.Suites[0].TestCases
+	if len(cases) != 2 || suites.Suites[0].Failures != 1 {
+		t.Fatalf("Expected 2 test cases with 1 failure, but got %+v", suites.Suites[0])
+	}
+	if got := cases[0]; got.Name != "create cluster in r1 (attempt 1)" || got.Failure == nil || got.Failure.Type != "stockout" {
+		t.Fatalf("Expected the first attempt to fail with a stockout in r1, but got %+v", got)
+	}
+	if got := cases[1]; got.Name != "create cluster in r2 (attempt 2)" || got.Failure != nil {
+		t.Fatalf("Expected the second attempt to succeed in r2, but got %+v", got)
+	}
+}
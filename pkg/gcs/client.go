@@ -18,10 +18,16 @@ package gcs
 
 import (
 	"context"
+	"errors"
+	"io"
 
 	"cloud.google.com/go/storage"
 )
 
+// ErrPreconditionFailed is returned when a write or an update is made with a
+// generation precondition that the object doesn't match
+var ErrPreconditionFailed = errors.New("gcs: object generation precondition failed")
+
 // Client defines the interface for GCS operations.
 type Client interface {
 	// NewStorageBucket creates a new bucket in GCS with uniform access policy
@@ -34,21 +40,113 @@ type Client interface {
 	ListChildrenFiles(ctx context.Context, bkt, dirPath string) ([]string, error)
 	// ListDirectChildren lists direct children paths (incl. files and dir)
 	ListDirectChildren(ctx context.Context, bkt, dirPath string) ([]string, error)
+	// ListObjects lists one page of the objects matching the query, with their attributes
+	ListObjects(ctx context.Context, bkt string, query ListQuery) (*ObjectsPage, error)
 	// AttrObject returns the object attributes
 	AttrObject(ctx context.Context, bkt, objPath string) (*storage.ObjectAttrs, error)
+	// UpdateObject sets the content type and adds the metadata of an object
+	UpdateObject(ctx context.Context, bkt, objPath string, opts ...WriteOption) (*storage.ObjectAttrs, error)
 	// CopyObject copies objects from one location to another, assuming both src and dst
 	// buckets both exist
 	CopyObject(ctx context.Context, srcBkt, srcObjPath, dstBkt, dstObjPath string) error
-	// NewReader creates a new Reader of a gcs file.
-	NewReader(ctx context.Context, bucketName, objPath string) (*storage.Reader, error)
+	// NewReader creates a new Reader of a gcs file, caller must close it when done
+	NewReader(ctx context.Context, bucketName, objPath string) (io.ReadCloser, error)
+	// NewWriter creates a new Writer of a gcs file, the object is only written
+	// once the Writer is closed successfully
+	NewWriter(ctx context.Context, bkt, objPath string, opts ...WriteOption) (io.WriteCloser, error)
 	// ReadObject reads a GCS object and returns then contents in []byte
 	ReadObject(ctx context.Context, bkt, objPath string) ([]byte, error)
 	// WriteObject writes []byte content to a GCS object
-	WriteObject(ctx context.Context, bkt, objPath string, content []byte) (int, error)
+	WriteObject(ctx context.Context, bkt, objPath string, content []byte, opts ...WriteOption) (int, error)
 	// DeleteObject deletes an object
 	DeleteObject(ctx context.Context, bkt, objPath string) error
 	// Download downloads GCS object to a local file, assuming bucket exists
 	Download(ctx context.Context, bktName, objPath, filePath string) error
 	// Upload uploads a local file to a GCS object, assuming bucket exists
-	Upload(ctx context.Context, bktName, objPath, filePath string) error
+	Upload(ctx context.Context, bktName, objPath, filePath string, opts ...WriteOption) error
+}
+
+// ListQuery selects the objects returned by ListObjects
+type ListQuery struct {
+	// Prefix filters the objects whose name starts with it
+	Prefix string
+	// Delimiter groups the objects whose name contains it after the prefix,
+	// e.g. "/" lists the direct children of the prefix
+	Delimiter string
+	// PageSize is the maximum number of objects and prefixes returned, 0 means
+	// the default page size of the implementation
+	PageSize int
+	// PageToken is the NextPageToken of the previous page, "" for the first page
+	PageToken string
+}
+
+// ObjectsPage is a page of objects returned by ListObjects
+type ObjectsPage struct {
+	// Objects are sorted by name
+	Objects []*storage.ObjectAttrs
+	// Prefixes are the names grouped by the delimiter, ending with the delimiter
+	Prefixes []string
+	// NextPageToken is "" on the last page
+	NextPageToken string
+}
+
+// WriteOptions are the options of writing or updating an object
+type WriteOptions struct {
+	// ContentType is the MIME type of the object, guessed from its content by
+	// GCS if empty
+	ContentType string
+	// Metadata are custom key/value pairs of the object
+	Metadata map[string]string
+	// IfGenerationMatch makes the write fail with ErrPreconditionFailed unless
+	// the object is at this generation, 0 meaning the object must not exist.
+	// This allows safe read-modify-write of objects like latest-build.txt.
+	IfGenerationMatch *int64
+}
+
+// WriteOption sets an option of WriteOptions
+type WriteOption func(*WriteOptions)
+
+// WithContentType sets the content type of the object
+func WithContentType(contentType string) WriteOption {
+	return func(o *WriteOptions) {
+		o.ContentType = contentType
+	}
+}
+
+// WithMetadata sets custom metadata of the object
+func WithMetadata(metadata map[string]string) WriteOption {
+	return func(o *WriteOptions) {
+		o.Metadata = metadata
+	}
+}
+
+// IfGenerationMatch only writes the object if its generation matches
+func IfGenerationMatch(generation int64) WriteOption {
+	return func(o *WriteOptions) {
+		o.IfGenerationMatch = &generation
+	}
+}
+
+// IfNotExist only writes the object if it doesn't exist yet
+func IfNotExist() WriteOption {
+	return IfGenerationMatch(0)
+}
+
+// NewWriteOptions applies the options, for implementations of Client
+func NewWriteOptions(opts ...WriteOption) WriteOptions {
+	var o WriteOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// CheckGeneration returns ErrPreconditionFailed if the options have a
+// generation precondition not matched by the current generation, where 0
+// means the object doesn't exist
+func (o WriteOptions) CheckGeneration(current int64) error {
+	if o.IfGenerationMatch != nil && *o.IfGenerationMatch != current {
+		return ErrPreconditionFailed
+	}
+	return nil
 }
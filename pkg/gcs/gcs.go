@@ -22,11 +22,15 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
@@ -35,8 +39,22 @@ type storageClient struct {
 	*storage.Client
 }
 
-// NewClient creates new GCS client with given service account
-func NewClient(ctx context.Context, serviceAccount string) (Client, error) {
+// NewClient creates a new client for the storage the URL points to:
+//   - "" or "gs://" for GCS, authenticated with the given service account
+//   - "file:///<dir>" for a local directory, see NewLocalClient
+func NewClient(ctx context.Context, storageURL, serviceAccount string) (Client, error) {
+	u, err := url.Parse(storageURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage URL %q: %w", storageURL, err)
+	}
+	switch u.Scheme {
+	case "", "gs":
+	case "file":
+		return NewLocalClient(filepath.FromSlash(u.Path)), nil
+	default:
+		return nil, fmt.Errorf("unsupported storage URL %q, must start with gs:// or file://", storageURL)
+	}
+
 	client, err := storage.NewClient(ctx, option.WithCredentialsFile(serviceAccount))
 	if err != nil {
 		return nil, err
@@ -183,10 +201,11 @@ func (g *storageClient) Download(ctx context.Context, bucketName, objPath, dstPa
 		return err
 	}
 
-	dst, err := os.OpenFile(dstPath, os.O_RDWR|os.O_CREATE, 0755)
+	dst, err := os.OpenFile(dstPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
 	if err != nil {
 		return err
 	}
+	defer dst.Close()
 	src, err := handle.NewReader(ctx)
 	if err != nil {
 		return err
@@ -197,15 +216,23 @@ func (g *storageClient) Download(ctx context.Context, bucketName, objPath, dstPa
 }
 
 // Upload file to gcs object
-func (g *storageClient) Upload(ctx context.Context, bucketName, objPath, srcPath string) error {
+func (g *storageClient) Upload(ctx context.Context, bucketName, objPath, srcPath string, opts ...WriteOption) error {
 	src, err := os.Open(srcPath)
 	if err != nil {
 		return err
 	}
-	dst := g.Bucket(bucketName).Object(objPath).NewWriter(ctx)
-	defer dst.Close()
-	_, err = io.Copy(dst, src)
-	return err
+	defer src.Close()
+	// Canceling the context aborts the upload if the copy fails.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	dst, err := g.NewWriter(ctx, bucketName, objPath, opts...)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+	return dst.Close()
 }
 
 // AttrObject returns the object attributes
@@ -227,7 +254,7 @@ func (g *storageClient) ReadObject(ctx context.Context, bucketName, objPath stri
 
 // NewReader creates a new Reader of a gcs file.
 // Important: caller must call Close on the returned Reader when done reading
-func (g *storageClient) NewReader(ctx context.Context, bucketName, objPath string) (*storage.Reader, error) {
+func (g *storageClient) NewReader(ctx context.Context, bucketName, objPath string) (io.ReadCloser, error) {
 	o := g.Bucket(bucketName).Object(objPath)
 	if _, err := o.Attrs(ctx); err != nil {
 		return nil, err
@@ -243,8 +270,11 @@ func (g *storageClient) DeleteObject(ctx context.Context, bucketName, objPath st
 
 // WriteObject writes the content to a gcs object
 func (g *storageClient) WriteObject(ctx context.Context, bucketName, objPath string,
-	content []byte) (n int, err error) {
-	objWriter := g.Bucket(bucketName).Object(objPath).NewWriter(ctx)
+	content []byte, opts ...WriteOption) (n int, err error) {
+	objWriter, err := g.NewWriter(ctx, bucketName, objPath, opts...)
+	if err != nil {
+		return 0, err
+	}
 	defer func() {
 		cerr := objWriter.Close()
 		if err == nil {
@@ -256,6 +286,85 @@ func (g *storageClient) WriteObject(ctx context.Context, bucketName, objPath str
 	return
 }
 
+// objectHandle returns the handle of an object, with the generation
+// precondition of the options
+func (g *storageClient) objectHandle(bucketName, objPath string, o WriteOptions) *storage.ObjectHandle {
+	handle := g.Bucket(bucketName).Object(objPath)
+	switch {
+	case o.IfGenerationMatch == nil:
+		return handle
+	case *o.IfGenerationMatch == 0:
+		return handle.If(storage.Conditions{DoesNotExist: true})
+	default:
+		return handle.If(storage.Conditions{GenerationMatch: *o.IfGenerationMatch})
+	}
+}
+
+// objectWriter converts the precondition failures of storage.Writer
+type objectWriter struct {
+	*storage.Writer
+}
+
+// Close finishes the upload of the object
+func (w *objectWriter) Close() error {
+	return convertError(w.Writer.Close())
+}
+
+// convertError converts the precondition failures of GCS to ErrPreconditionFailed
+func convertError(err error) error {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+		return fmt.Errorf("%w: %v", ErrPreconditionFailed, err)
+	}
+	return err
+}
+
+// NewWriter creates a new Writer of a gcs file.
+// Important: caller must call Close on the returned Writer to write the object
+func (g *storageClient) NewWriter(ctx context.Context, bucketName, objPath string, opts ...WriteOption) (io.WriteCloser, error) {
+	o := NewWriteOptions(opts...)
+	w := g.objectHandle(bucketName, objPath, o).NewWriter(ctx)
+	w.ContentType = o.ContentType
+	w.Metadata = o.Metadata
+	return &objectWriter{Writer: w}, nil
+}
+
+// UpdateObject sets the content type and metadata of a gcs object, the metadata
+// keys are added to the existing ones
+func (g *storageClient) UpdateObject(ctx context.Context, bucketName, objPath string, opts ...WriteOption) (*storage.ObjectAttrs, error) {
+	o := NewWriteOptions(opts...)
+	var update storage.ObjectAttrsToUpdate
+	if o.ContentType != "" {
+		update.ContentType = o.ContentType
+	}
+	update.Metadata = o.Metadata
+	attrs, err := g.objectHandle(bucketName, objPath, o).Update(ctx, update)
+	return attrs, convertError(err)
+}
+
+// ListObjects lists one page of the objects matching the query
+func (g *storageClient) ListObjects(ctx context.Context, bucketName string, query ListQuery) (*ObjectsPage, error) {
+	pageSize := query.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	it := g.getObjectsIter(ctx, bucketName, query.Prefix, query.Delimiter)
+	var all []*storage.ObjectAttrs
+	token, err := iterator.NewPager(it, pageSize, query.PageToken).NextPage(&all)
+	if err != nil {
+		return nil, err
+	}
+	page := &ObjectsPage{NextPageToken: token}
+	for _, attrs := range all {
+		if attrs.Prefix != "" {
+			page.Prefixes = append(page.Prefixes, attrs.Prefix)
+		} else {
+			page.Objects = append(page.Objects, attrs)
+		}
+	}
+	return page, nil
+}
+
 // ReadURL reads from a gsUrl and return a log structure
 func (g *storageClient) ReadURL(ctx context.Context, gcsURL string) ([]byte, error) {
 	bucket, obj, err := linkToBucketAndObject(gcsURL)
@@ -21,8 +21,13 @@ import (
 	"net/url"
 	"path"
 	"strings"
+
+	"cloud.google.com/go/storage"
 )
 
+// defaultPageSize is the page size of ListObjects when not set, same as GCS
+const defaultPageSize = 1000
+
 // get the bucket and object from the gsURL
 func linkToBucketAndObject(gsURL string) (string, string, error) {
 	gsURL = strings.Replace(gsURL, "gs://", "", 1)
@@ -56,3 +61,42 @@ func GetConsoleURL(gcsURL string) (string, error) {
 	u.Host = "console.cloud.google.com"
 	return u.String(), nil
 }
+
+// PaginateObjects returns the page of objects matching the query, for Client
+// implementations that cannot list page by page. objects must be sorted by name.
+// The page token is the last object name or prefix of the previous page.
+func PaginateObjects(objects []*storage.ObjectAttrs, query ListQuery) *ObjectsPage {
+	pageSize := query.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	page := &ObjectsPage{}
+	last := ""
+	for _, o := range objects {
+		if !strings.HasPrefix(o.Name, query.Prefix) {
+			continue
+		}
+		// Names sharing a prefix up to the delimiter are consecutive, and
+		// grouped into this prefix.
+		key, isPrefix := o.Name, false
+		if query.Delimiter != "" {
+			if i := strings.Index(o.Name[len(query.Prefix):], query.Delimiter); i >= 0 {
+				key, isPrefix = o.Name[:len(query.Prefix)+i+len(query.Delimiter)], true
+			}
+		}
+		if key <= query.PageToken || key == last {
+			continue
+		}
+		if len(page.Objects)+len(page.Prefixes) == pageSize {
+			page.NextPageToken = last
+			break
+		}
+		if isPrefix {
+			page.Prefixes = append(page.Prefixes, key)
+		} else {
+			page.Objects = append(page.Objects, o)
+		}
+		last = key
+	}
+	return page
+}
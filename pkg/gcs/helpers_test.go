@@ -20,6 +20,8 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+
+	"cloud.google.com/go/storage"
 )
 
 func TestGetConsoleURL(t *testing.T) {
@@ -119,3 +121,60 @@ func TestLinkToBucketAndObject(t *testing.T) {
 		})
 	}
 }
+
+func TestPaginateObjects(t *testing.T) {
+	var objects []*storage.ObjectAttrs
+	for _, name := range []string{"a", "logs/1/build-log.txt", "logs/1/started.json", "logs/2/started.json", "logs/latest-build.txt", "z"} {
+		objects = append(objects, &storage.ObjectAttrs{Name: name})
+	}
+	names := func(page *ObjectsPage) []string {
+		res := append([]string{}, page.Prefixes...)
+		for _, o := range page.Objects {
+			res = append(res, o.Name)
+		}
+		return res
+	}
+	tests := []struct {
+		name  string
+		query ListQuery
+		want  []string
+		next  string
+	}{
+		{
+			name:  "All objects",
+			query: ListQuery{},
+			want:  []string{"a", "logs/1/build-log.txt", "logs/1/started.json", "logs/2/started.json", "logs/latest-build.txt", "z"},
+		},
+		{
+			name:  "Direct children",
+			query: ListQuery{Prefix: "logs/", Delimiter: "/"},
+			want:  []string{"logs/1/", "logs/2/", "logs/latest-build.txt"},
+		},
+		{
+			name:  "First page",
+			query: ListQuery{Prefix: "logs/", Delimiter: "/", PageSize: 2},
+			want:  []string{"logs/1/", "logs/2/"},
+			next:  "logs/2/",
+		},
+		{
+			name:  "Last page",
+			query: ListQuery{Prefix: "logs/", Delimiter: "/", PageSize: 2, PageToken: "logs/2/"},
+			want:  []string{"logs/latest-build.txt"},
+		},
+		{
+			name:  "Page of objects",
+			query: ListQuery{Prefix: "logs/", PageSize: 2, PageToken: "logs/1/build-log.txt"},
+			want:  []string{"logs/1/started.json", "logs/2/started.json"},
+			next:  "logs/2/started.json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := PaginateObjects(objects, tt.query)
+			if got := names(page); !reflect.DeepEqual(got, tt.want) || page.NextPageToken != tt.next {
+				t.Errorf("PaginateObjects(%+v), got: %v and token %q, want: %v and token %q",
+					tt.query, got, page.NextPageToken, tt.want, tt.next)
+			}
+		})
+	}
+}
@@ -0,0 +1,565 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// local.go implements Client with a local directory, so that tools can run
+// against a local fixture tree without a GCP bucket
+
+package gcs
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+)
+
+const (
+	// metadataDir stores the content type and metadata of the objects, as
+	// <root>/.metadata/<bucket>/<object>.json. Bucket names cannot start with
+	// a dot, so this never conflicts with a bucket.
+	metadataDir = ".metadata"
+	// tmpDir stores the objects being written
+	tmpDir = ".tmp"
+)
+
+// localClient stores each bucket as a subdirectory of root, and each object as
+// a file under the bucket directory
+type localClient struct {
+	root string
+	// mu makes checking the generation of an object and writing it atomic
+	mu sync.Mutex
+}
+
+// localAttrs are the attributes of an object that cannot be generated from its file
+type localAttrs struct {
+	ContentType string            `json:"contentType,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	// Generation is incremented each time the object is written, and kept
+	// when it is deleted so that a recreated object never reuses a generation
+	Generation int64 `json:"generation,omitempty"`
+	// Metageneration is incremented each time the attributes are updated,
+	// and reset to 1 when the object is written
+	Metageneration int64 `json:"metageneration,omitempty"`
+}
+
+var _ Client = (*localClient)(nil)
+
+// NewLocalClient creates a Client storing buckets as subdirectories of root,
+// e.g. the object "logs/job/1/started.json" of bucket "knative-prow" is the file
+// <root>/knative-prow/logs/job/1/started.json. Files can also be added to the
+// tree directly, their attributes are then generated with generation 1.
+func NewLocalClient(root string) Client {
+	return &localClient{root: root}
+}
+
+func (l *localClient) bucketPath(bkt string) string {
+	return filepath.Join(l.root, filepath.FromSlash(path.Clean("/"+bkt)))
+}
+
+// objectPath converts an object path to the file path, making sure it cannot
+// point outside of the bucket directory
+func (l *localClient) objectPath(bkt, objPath string) string {
+	return filepath.Join(l.bucketPath(bkt), filepath.FromSlash(path.Clean("/"+objPath)))
+}
+
+// attrsPath returns the path of the file storing the attributes of an object
+func (l *localClient) attrsPath(bkt, objPath string) string {
+	return filepath.Join(l.root, metadataDir, filepath.FromSlash(path.Clean("/"+bkt)),
+		filepath.FromSlash(path.Clean("/"+objPath))+".json")
+}
+
+// readAttrs reads the attributes stored for an object, if any
+func (l *localClient) readAttrs(bkt, objPath string) (*localAttrs, error) {
+	attrs := &localAttrs{}
+	content, err := ioutil.ReadFile(l.attrsPath(bkt, objPath))
+	if os.IsNotExist(err) {
+		return attrs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return attrs, json.Unmarshal(content, attrs)
+}
+
+// writeAttrs stores the attributes of an object
+func (l *localClient) writeAttrs(bkt, objPath string, attrs *localAttrs) error {
+	p := l.attrsPath(bkt, objPath)
+	content, err := json.Marshal(attrs)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, content, 0644)
+}
+
+// generation returns the generation of an object, 0 if it doesn't exist
+func (l *localClient) generation(bkt, objPath string, attrs *localAttrs) int64 {
+	info, err := os.Stat(l.objectPath(bkt, objPath))
+	if err != nil || info.IsDir() {
+		return 0
+	}
+	return attrs.generation()
+}
+
+// generation returns the stored generation, 1 for files added to the tree
+// directly
+func (a *localAttrs) generation() int64 {
+	if a.Generation == 0 {
+		return 1
+	}
+	return a.Generation
+}
+
+// metageneration returns the stored metageneration, 1 for files added to the
+// tree directly
+func (a *localAttrs) metageneration() int64 {
+	if a.Metageneration == 0 {
+		return 1
+	}
+	return a.Metageneration
+}
+
+// checkBucket returns storage.ErrBucketNotExist if the bucket doesn't exist
+func (l *localClient) checkBucket(bkt string) error {
+	if info, err := os.Stat(l.bucketPath(bkt)); err != nil || !info.IsDir() {
+		return storage.ErrBucketNotExist
+	}
+	return nil
+}
+
+// openObject opens an object for reading, returns storage.ErrObjectNotExist if
+// it doesn't exist
+func (l *localClient) openObject(bkt, objPath string) (*os.File, os.FileInfo, error) {
+	if err := l.checkBucket(bkt); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(l.objectPath(bkt, objPath))
+	if os.IsNotExist(err) {
+		return nil, nil, storage.ErrObjectNotExist
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, nil, storage.ErrObjectNotExist
+	}
+	return f, info, nil
+}
+
+// NewStorageBucket creates the directory of the bucket, project is ignored
+func (l *localClient) NewStorageBucket(ctx context.Context, bkt, project string) error {
+	if bkt == "" {
+		return errors.New("a bucket name must be provided")
+	}
+	if _, err := os.Stat(l.bucketPath(bkt)); err == nil {
+		return fmt.Errorf("bucket %s already exists", bkt)
+	}
+	return os.MkdirAll(l.bucketPath(bkt), 0755)
+}
+
+// DeleteStorageBucket removes the directory of the bucket, force if not empty
+func (l *localClient) DeleteStorageBucket(ctx context.Context, bkt string, force bool) error {
+	children, err := l.ListChildrenFiles(ctx, bkt, "")
+	if err != nil {
+		return err
+	}
+	if len(children) != 0 && !force {
+		return fmt.Errorf("bucket %s not empty, please use force=true", bkt)
+	}
+	if err := os.RemoveAll(filepath.Join(l.root, metadataDir, filepath.FromSlash(path.Clean("/"+bkt)))); err != nil {
+		return err
+	}
+	return os.RemoveAll(l.bucketPath(bkt))
+}
+
+// Exists check if an object or a directory exists under a bucket
+func (l *localClient) Exists(ctx context.Context, bkt, objPath string) bool {
+	if l.checkBucket(bkt) != nil {
+		return false
+	}
+	_, err := os.Stat(l.objectPath(bkt, objPath))
+	return err == nil
+}
+
+// ListChildrenFiles recursively lists all children files
+func (l *localClient) ListChildrenFiles(ctx context.Context, bkt, dirPath string) ([]string, error) {
+	if err := l.checkBucket(bkt); err != nil {
+		return nil, err
+	}
+	bktRoot := l.bucketPath(bkt)
+	dir := l.objectPath(bkt, dirPath)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		// Same as GCS, a missing directory has no children.
+		return nil, nil
+	}
+	var files []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(bktRoot, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// ListDirectChildren lists direct children paths (including files and directories)
+func (l *localClient) ListDirectChildren(ctx context.Context, bkt, dirPath string) ([]string, error) {
+	if err := l.checkBucket(bkt); err != nil {
+		return nil, err
+	}
+	dir := l.objectPath(bkt, dirPath)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, nil
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	children := make([]string, 0, len(infos))
+	for _, info := range infos {
+		children = append(children, path.Join(strings.Trim(dirPath, " /"), info.Name()))
+	}
+	sort.Strings(children)
+	return children, nil
+}
+
+// AttrObject returns the object attributes, generated from the file
+func (l *localClient) AttrObject(ctx context.Context, bkt, objPath string) (*storage.ObjectAttrs, error) {
+	f, info, err := l.openObject(bkt, objPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	md5Hash := md5.New()
+	crcHash := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	if _, err := io.Copy(io.MultiWriter(md5Hash, crcHash), f); err != nil {
+		return nil, err
+	}
+	stored, err := l.readAttrs(bkt, objPath)
+	if err != nil {
+		return nil, err
+	}
+	contentType := stored.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(objPath))
+	}
+	return &storage.ObjectAttrs{
+		Bucket:         bkt,
+		Name:           objPath,
+		ContentType:    contentType,
+		Metadata:       stored.Metadata,
+		Size:           info.Size(),
+		MD5:            md5Hash.Sum(nil),
+		CRC32C:         crcHash.Sum32(),
+		Generation:     stored.generation(),
+		Metageneration: stored.metageneration(),
+		StorageClass:   "STANDARD",
+		Created:        info.ModTime(),
+		Updated:        info.ModTime(),
+	}, nil
+}
+
+// CopyObject copies objects from one location to another, assuming both src and dst
+// buckets both exist
+func (l *localClient) CopyObject(ctx context.Context, srcBkt, srcObjPath, dstBkt, dstObjPath string) error {
+	content, err := l.ReadObject(ctx, srcBkt, srcObjPath)
+	if err != nil {
+		return err
+	}
+	attrs, err := l.readAttrs(srcBkt, srcObjPath)
+	if err != nil {
+		return err
+	}
+	_, err = l.WriteObject(ctx, dstBkt, dstObjPath, content,
+		WithContentType(attrs.ContentType), WithMetadata(attrs.Metadata))
+	return err
+}
+
+// NewReader creates a new Reader of a file, caller must close it when done
+func (l *localClient) NewReader(ctx context.Context, bkt, objPath string) (io.ReadCloser, error) {
+	f, _, err := l.openObject(bkt, objPath)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ReadObject reads the content of a file
+func (l *localClient) ReadObject(ctx context.Context, bkt, objPath string) ([]byte, error) {
+	f, _, err := l.openObject(bkt, objPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// localWriter writes an object to a temporary file, moved to the object path
+// when closed so that readers never see a partially written object, the same
+// as GCS
+type localWriter struct {
+	*os.File
+	l            *localClient
+	bkt, objPath string
+	opts         WriteOptions
+}
+
+// Close moves the temporary file to the object path if the generation
+// precondition is met
+func (w *localWriter) Close() error {
+	err := w.File.Close()
+	if err == nil {
+		err = w.l.commit(w.Name(), w.bkt, w.objPath, w.opts)
+	}
+	if err != nil {
+		os.Remove(w.Name())
+	}
+	return err
+}
+
+// abort discards the content written so far
+func (w *localWriter) abort() {
+	w.File.Close()
+	os.Remove(w.Name())
+}
+
+// commit moves a written temporary file to the object path
+func (l *localClient) commit(tmpPath, bkt, objPath string, o WriteOptions) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stored, err := l.readAttrs(bkt, objPath)
+	if err != nil {
+		return err
+	}
+	if err := o.CheckGeneration(l.generation(bkt, objPath, stored)); err != nil {
+		return err
+	}
+	dst := l.objectPath(bkt, objPath)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	// Same as GCS, the attributes are replaced with the object, which gets
+	// a new generation.
+	attrs := &localAttrs{
+		ContentType:    o.ContentType,
+		Metadata:       o.Metadata,
+		Generation:     stored.Generation + 1,
+		Metageneration: 1,
+	}
+	if err := l.writeAttrs(bkt, objPath, attrs); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, dst)
+}
+
+// NewWriter creates a new Writer of a file, caller must close it to write the file
+func (l *localClient) NewWriter(ctx context.Context, bkt, objPath string, opts ...WriteOption) (io.WriteCloser, error) {
+	return l.newWriter(bkt, objPath, opts...)
+}
+
+func (l *localClient) newWriter(bkt, objPath string, opts ...WriteOption) (*localWriter, error) {
+	if err := l.checkBucket(bkt); err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(l.root, tmpDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile(dir, "object-")
+	if err != nil {
+		return nil, err
+	}
+	return &localWriter{File: f, l: l, bkt: bkt, objPath: objPath, opts: NewWriteOptions(opts...)}, nil
+}
+
+// WriteObject writes the content to a file, creating its parent directories
+func (l *localClient) WriteObject(ctx context.Context, bkt, objPath string, content []byte, opts ...WriteOption) (int, error) {
+	w, err := l.newWriter(bkt, objPath, opts...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(content)
+	if err != nil {
+		w.abort()
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// UpdateObject sets the content type and adds the metadata of a file
+func (l *localClient) UpdateObject(ctx context.Context, bkt, objPath string, opts ...WriteOption) (*storage.ObjectAttrs, error) {
+	f, _, err := l.openObject(bkt, objPath)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	o := NewWriteOptions(opts...)
+
+	l.mu.Lock()
+	err = func() error {
+		defer l.mu.Unlock()
+		attrs, err := l.readAttrs(bkt, objPath)
+		if err != nil {
+			return err
+		}
+		if err := o.CheckGeneration(l.generation(bkt, objPath, attrs)); err != nil {
+			return err
+		}
+		attrs.Generation = attrs.generation()
+		attrs.Metageneration = attrs.metageneration() + 1
+		if o.ContentType != "" {
+			attrs.ContentType = o.ContentType
+		}
+		if o.Metadata != nil && len(o.Metadata) == 0 {
+			attrs.Metadata = nil
+		}
+		for k, v := range o.Metadata {
+			if attrs.Metadata == nil {
+				attrs.Metadata = make(map[string]string)
+			}
+			attrs.Metadata[k] = v
+		}
+		return l.writeAttrs(bkt, objPath, attrs)
+	}()
+	if err != nil {
+		return nil, err
+	}
+	return l.AttrObject(ctx, bkt, objPath)
+}
+
+// ListObjects lists one page of the files matching the query
+func (l *localClient) ListObjects(ctx context.Context, bkt string, query ListQuery) (*ObjectsPage, error) {
+	// Only walk the deepest directory containing all the matching files.
+	dir := query.Prefix
+	if i := strings.LastIndex(dir, "/"); i >= 0 {
+		dir = dir[:i]
+	} else {
+		dir = ""
+	}
+	files, err := l.ListChildrenFiles(ctx, bkt, dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	var objects []*storage.ObjectAttrs
+	for _, f := range files {
+		if !strings.HasPrefix(f, query.Prefix) || f <= query.PageToken {
+			continue
+		}
+		attrs, err := l.AttrObject(ctx, bkt, f)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, attrs)
+	}
+	return PaginateObjects(objects, query), nil
+}
+
+// DeleteObject deletes a file, and its parent directories once they are empty
+// since GCS directories only exist as prefixes of objects
+func (l *localClient) DeleteObject(ctx context.Context, bkt, objPath string) error {
+	f, _, err := l.openObject(bkt, objPath)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	attrs, err := l.readAttrs(bkt, objPath)
+	if err != nil {
+		return err
+	}
+	p := l.objectPath(bkt, objPath)
+	if err := os.Remove(p); err != nil {
+		return err
+	}
+	// Only keep the generation, so that it keeps increasing if the object
+	// is written again.
+	if err := l.writeAttrs(bkt, objPath, &localAttrs{Generation: attrs.generation()}); err != nil {
+		return err
+	}
+	bktRoot := l.bucketPath(bkt)
+	for dir := filepath.Dir(p); dir != bktRoot && strings.HasPrefix(dir, bktRoot); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// Download copies a file to a local file, assuming bucket exists
+func (l *localClient) Download(ctx context.Context, bktName, objPath, filePath string) error {
+	content, err := l.ReadObject(ctx, bktName, objPath)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filePath, content, 0644)
+}
+
+// Upload copies a local file to a file, assuming bucket exists
+func (l *localClient) Upload(ctx context.Context, bktName, objPath, filePath string, opts ...WriteOption) error {
+	src, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	w, err := l.newWriter(bktName, objPath, opts...)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		w.abort()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,262 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/storage"
+)
+
+func TestLocalClient(t *testing.T) {
+	root, err := ioutil.TempDir("", "gcs")
+	if err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	ctx := context.Background()
+	c, err := NewClient(ctx, "file://"+filepath.ToSlash(root), "")
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+
+	if _, err := c.WriteObject(ctx, "bkt", "a/b.txt", []byte("hello")); !errors.Is(err, storage.ErrBucketNotExist) {
+		t.Fatalf("Expected ErrBucketNotExist writing to a missing bucket, actual '%v'", err)
+	}
+	if err := c.NewStorageBucket(ctx, "bkt", "project"); err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	if err := c.NewStorageBucket(ctx, "bkt", "project"); err == nil {
+		t.Fatal("Expected an error creating an existing bucket, actual nil")
+	}
+	for p, content := range map[string]string{
+		"logs/job/1/started.json":           `{"timestamp": 1}`,
+		"logs/job/1/artifacts/junit_01.xml": "<testsuites/>",
+		"logs/job/2/started.json":           `{"timestamp": 2}`,
+		"logs/jobs.txt":                     "job",
+	} {
+		if n, err := c.WriteObject(ctx, "bkt", p, []byte(content)); err != nil || n != len(content) {
+			t.Fatalf("Expected %d bytes written, actual %d, '%v'", len(content), n, err)
+		}
+	}
+
+	if !c.Exists(ctx, "bkt", "logs/job") || !c.Exists(ctx, "bkt", "logs/jobs.txt") || c.Exists(ctx, "bkt", "logs/job/3") {
+		t.Fatal("Expected logs/job and logs/jobs.txt to exist, and logs/job/3 not to exist")
+	}
+	children, err := c.ListDirectChildren(ctx, "bkt", "logs/")
+	if want := []string{"logs/job", "logs/jobs.txt"}; err != nil || !reflect.DeepEqual(children, want) {
+		t.Fatalf("Expected %v, actual %v, '%v'", want, children, err)
+	}
+	files, err := c.ListChildrenFiles(ctx, "bkt", "logs/job/1")
+	if want := []string{"logs/job/1/artifacts/junit_01.xml", "logs/job/1/started.json"}; err != nil || !reflect.DeepEqual(files, want) {
+		t.Fatalf("Expected %v, actual %v, '%v'", want, files, err)
+	}
+	if files, err := c.ListChildrenFiles(ctx, "bkt", "logs/jobs.txt"); err != nil || len(files) != 0 {
+		t.Fatalf("Expected a file to have no children, actual %v, '%v'", files, err)
+	}
+
+	attrs, err := c.AttrObject(ctx, "bkt", "logs/job/1/started.json")
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	sum := md5.Sum([]byte(`{"timestamp": 1}`))
+	if attrs.Size != 16 || !bytes.Equal(attrs.MD5, sum[:]) || attrs.ContentType != "application/json" || attrs.Updated.IsZero() {
+		t.Fatalf("Expected generated attributes of started.json, actual %+v", attrs)
+	}
+	if _, err := c.AttrObject(ctx, "bkt", "logs/job"); !errors.Is(err, storage.ErrObjectNotExist) {
+		t.Fatalf("Expected ErrObjectNotExist for a directory, actual '%v'", err)
+	}
+
+	if err := c.CopyObject(ctx, "bkt", "logs/jobs.txt", "bkt", "copy/jobs.txt"); err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	r, err := c.NewReader(ctx, "bkt", "copy/jobs.txt")
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	content, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(content) != "job" {
+		t.Fatalf("Expected 'job', actual %q", string(content))
+	}
+
+	// Directories are virtual, they are gone with their last object.
+	if err := c.DeleteObject(ctx, "bkt", "copy/jobs.txt"); err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	if c.Exists(ctx, "bkt", "copy") {
+		t.Fatal("Expected the empty directory to be deleted")
+	}
+	if _, err := c.ReadObject(ctx, "bkt", "copy/jobs.txt"); !errors.Is(err, storage.ErrObjectNotExist) {
+		t.Fatalf("Expected ErrObjectNotExist, actual '%v'", err)
+	}
+	if _, err := c.ReadObject(ctx, "bkt", "../../etc/passwd"); !errors.Is(err, storage.ErrObjectNotExist) {
+		t.Fatalf("Expected paths not to escape the bucket, actual '%v'", err)
+	}
+
+	if err := c.DeleteStorageBucket(ctx, "bkt", false); err == nil {
+		t.Fatal("Expected an error deleting a non empty bucket, actual nil")
+	}
+	if err := c.DeleteStorageBucket(ctx, "bkt", true); err != nil || c.Exists(ctx, "bkt", "") {
+		t.Fatalf("Expected the bucket to be deleted, actual '%v'", err)
+	}
+}
+
+func TestLocalClientWriteOptions(t *testing.T) {
+	root, err := ioutil.TempDir("", "gcs")
+	if err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	ctx := context.Background()
+	c := NewLocalClient(root)
+	if err := c.NewStorageBucket(ctx, "bkt", ""); err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+
+	// Only one of two concurrent writers of a new object succeeds.
+	w1, _ := c.NewWriter(ctx, "bkt", "logs/latest-build.txt", IfNotExist(), WithContentType("text/plain"))
+	w2, _ := c.NewWriter(ctx, "bkt", "logs/latest-build.txt", IfNotExist())
+	w1.Write([]byte("1"))
+	w2.Write([]byte("2"))
+	if c.Exists(ctx, "bkt", "logs/latest-build.txt") {
+		t.Fatal("Expected the object not to exist before the writer is closed")
+	}
+	if err := w1.Close(); err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	if err := w2.Close(); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("Expected ErrPreconditionFailed, actual '%v'", err)
+	}
+
+	attrs, err := c.UpdateObject(ctx, "bkt", "logs/latest-build.txt", WithMetadata(map[string]string{"build": "1"}))
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	if attrs.ContentType != "text/plain" || attrs.Metadata["build"] != "1" {
+		t.Fatalf("Expected the content type and metadata to be set, actual %+v", attrs)
+	}
+	if _, err := c.WriteObject(ctx, "bkt", "logs/latest-build.txt", []byte("2"), IfGenerationMatch(attrs.Generation+1)); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("Expected ErrPreconditionFailed, actual '%v'", err)
+	}
+	if _, err := c.WriteObject(ctx, "bkt", "logs/latest-build.txt", []byte("2"), IfGenerationMatch(attrs.Generation)); err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	// Attributes are replaced with the object.
+	if attrs, _ := c.AttrObject(ctx, "bkt", "logs/latest-build.txt"); attrs.Metadata != nil || attrs.ContentType != "text/plain; charset=utf-8" {
+		t.Fatalf("Expected the attributes to be reset, actual %+v", attrs)
+	}
+
+	for _, p := range []string{"logs/1/build-log.txt", "logs/2/build-log.txt", "logs/3/build-log.txt"} {
+		c.WriteObject(ctx, "bkt", p, []byte(p))
+	}
+	var got []string
+	query := ListQuery{Prefix: "logs/", Delimiter: "/", PageSize: 2}
+	for {
+		page, err := c.ListObjects(ctx, "bkt", query)
+		if err != nil {
+			t.Fatalf("Expected '', actual '%v'", err)
+		}
+		got = append(got, page.Prefixes...)
+		for _, o := range page.Objects {
+			got = append(got, o.Name)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		query.PageToken = page.NextPageToken
+	}
+	if want := []string{"logs/1/", "logs/2/", "logs/3/", "logs/latest-build.txt"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %v, actual %v", want, got)
+	}
+}
+
+func TestLocalClientGeneration(t *testing.T) {
+	root, err := ioutil.TempDir("", "gcs")
+	if err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	ctx := context.Background()
+	c := NewLocalClient(root)
+	if err := c.NewStorageBucket(ctx, "bkt", ""); err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	generations := func(objPath string) (int64, int64) {
+		attrs, err := c.AttrObject(ctx, "bkt", objPath)
+		if err != nil {
+			t.Fatalf("Expected '', actual '%v'", err)
+		}
+		return attrs.Generation, attrs.Metageneration
+	}
+
+	// Files added to the tree directly have the first generation.
+	if err := ioutil.WriteFile(filepath.Join(root, "bkt", "fixture.txt"), []byte("fixture"), 0644); err != nil {
+		t.Fatalf("cannot write file: %v", err)
+	}
+	if gen, metagen := generations("fixture.txt"); gen != 1 || metagen != 1 {
+		t.Fatalf("Expected generation 1/1, actual %d/%d", gen, metagen)
+	}
+	if _, err := c.WriteObject(ctx, "bkt", "fixture.txt", []byte("written"), IfGenerationMatch(1)); err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+
+	for i, step := range []struct {
+		name         string
+		do           func() error
+		gen, metagen int64
+	}{
+		{"write", func() error { _, err := c.WriteObject(ctx, "bkt", "obj", []byte("1")); return err }, 1, 1},
+		{"update", func() error { _, err := c.UpdateObject(ctx, "bkt", "obj", WithContentType("text/plain")); return err }, 1, 2},
+		{"rewrite", func() error { _, err := c.WriteObject(ctx, "bkt", "obj", []byte("2")); return err }, 2, 1},
+		{"recreate", func() error {
+			if err := c.DeleteObject(ctx, "bkt", "obj"); err != nil {
+				return err
+			}
+			_, err := c.WriteObject(ctx, "bkt", "obj", []byte("3"), IfNotExist())
+			return err
+		}, 3, 1},
+	} {
+		if err := step.do(); err != nil {
+			t.Fatalf("step %d (%s): Expected '', actual '%v'", i, step.name, err)
+		}
+		if gen, metagen := generations("obj"); gen != step.gen || metagen != step.metagen {
+			t.Fatalf("step %d (%s): Expected generation %d/%d, actual %d/%d", i, step.name, step.gen, step.metagen, gen, metagen)
+		}
+	}
+	// A precondition on the generation of the deleted object fails.
+	if _, err := c.WriteObject(ctx, "bkt", "obj", []byte("4"), IfGenerationMatch(2)); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("Expected ErrPreconditionFailed, actual '%v'", err)
+	}
+}
+
+func TestNewClientURL(t *testing.T) {
+	if _, err := NewClient(context.Background(), "s3://bucket", ""); err == nil {
+		t.Fatal("Expected an error for an unsupported scheme, actual nil")
+	}
+}
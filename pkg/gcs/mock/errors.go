@@ -18,6 +18,8 @@ package mock
 
 import (
 	"fmt"
+
+	"cloud.google.com/go/storage"
 )
 
 type notEmptyBucketError struct {
@@ -44,6 +46,11 @@ func (e *noBucketError) Error() string {
 	return fmt.Sprintf("no bucket %q", e.bkt)
 }
 
+// Is makes errors.Is(err, storage.ErrBucketNotExist) true, as with a real client
+func (e *noBucketError) Is(target error) bool {
+	return target == storage.ErrBucketNotExist
+}
+
 type bucketExistError struct {
 	bkt string
 }
@@ -74,3 +81,8 @@ func (e *noObjectError) Error() string {
 	return fmt.Sprintf("bucket %q does not contain object %q under path %q",
 		e.bkt, e.obj, e.path)
 }
+
+// Is makes errors.Is(err, storage.ErrObjectNotExist) true, as with a real client
+func (e *noObjectError) Is(target error) bool {
+	return target == storage.ErrObjectNotExist
+}
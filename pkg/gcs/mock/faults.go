@@ -0,0 +1,159 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// faults.go injects faults into the calls of the mock client, and records
+// the calls so that tests can assert on them
+
+package mock
+
+import (
+	"context"
+	"path"
+	"time"
+)
+
+// Call is a call made to the mock client
+type Call struct {
+	Method Method
+	Bucket string
+	// Path is the object or directory path of the call, or the prefix for
+	// ListObjects
+	Path string
+	// DstBucket and DstPath are the destination of CopyObject, in which case
+	// Bucket and Path are the source
+	DstBucket string
+	DstPath   string
+}
+
+// Rule injects a fault into the calls matching it. For example, to fail reading
+// the logs of any build twice before succeeding:
+//
+//	c.AddRule(Rule{
+//		Method: MethodReadObject,
+//		Path:   "logs/*/*/build-log.txt",
+//		Times:  2,
+//		Err:    errors.New("transient error"),
+//	})
+type Rule struct {
+	// Method matches the calls of this method, all the methods if empty
+	Method Method
+	// Bucket matches the calls on this bucket, all the buckets if empty
+	Bucket string
+	// Path matches the paths of the calls with path.Match, all the paths if empty
+	Path string
+	// After is the number of matching calls before the rule applies
+	After int
+	// Times is the number of matching calls the rule applies to before it's
+	// removed, 0 means forever
+	Times int
+	// Latency delays the matching calls, or until their context is done
+	Latency time.Duration
+	// Err is returned by the matching calls instead of calling the method,
+	// the method is called if nil
+	Err error
+}
+
+// matches checks if the rule applies to a call
+func (r *Rule) matches(call Call) bool {
+	if r.Method != "" && r.Method != call.Method {
+		return false
+	}
+	if r.Bucket != "" && r.Bucket != call.Bucket {
+		return false
+	}
+	if r.Path != "" {
+		if ok, _ := path.Match(r.Path, call.Path); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// AddRule adds a rule injecting faults, the first rule matching a call applies
+func (c *clientMocker) AddRule(r Rule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rules = append(c.rules, &r)
+}
+
+// ClearRules removes all the rules
+func (c *clientMocker) ClearRules() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rules = nil
+}
+
+// Calls returns the calls made to the client, in order
+func (c *clientMocker) Calls() []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Call(nil), c.calls...)
+}
+
+// ClearCalls clears the journal of calls
+func (c *clientMocker) ClearCalls() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls = nil
+}
+
+// intercept records a call and applies the first rule matching it, then the
+// errors set with SetError. It returns true if the call must return err
+// instead of calling the method.
+func (c *clientMocker) intercept(ctx context.Context, call Call) (bool, error) {
+	c.mu.Lock()
+	c.calls = append(c.calls, call)
+	var rule *Rule
+	for i, r := range c.rules {
+		if !r.matches(call) {
+			continue
+		}
+		if r.After > 0 {
+			r.After--
+			break
+		}
+		rule = r
+		if r.Times > 0 {
+			r.Times--
+			if r.Times == 0 {
+				c.rules = append(c.rules[:i], c.rules[i+1:]...)
+			}
+		}
+		break
+	}
+	override, err := c.getError(call.Method)
+	c.mu.Unlock()
+
+	if rule == nil {
+		return override, err
+	}
+	if rule.Latency > 0 {
+		// The lock is released so that other calls aren't delayed.
+		select {
+		case <-time.After(rule.Latency):
+		case <-ctx.Done():
+			return true, ctx.Err()
+		}
+	}
+	if rule.Err != nil {
+		return true, rule.Err
+	}
+	return override, err
+}
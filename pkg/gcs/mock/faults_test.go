@@ -0,0 +1,140 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mock
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+func TestRules(t *testing.T) {
+	ctx := context.Background()
+	mockClient := NewClientMocker()
+	bktName := "test-bucket"
+	errTransient := errors.New("transient error")
+
+	mockClient.NewStorageBucket(ctx, bktName, "test-project")
+	mockClient.WriteObject(ctx, bktName, "logs/job/1/build-log.txt", []byte("log 1"))
+	mockClient.WriteObject(ctx, bktName, "logs/job/2/build-log.txt", []byte("log 2"))
+
+	// The first read of any build log succeeds, the next two fail.
+	mockClient.AddRule(Rule{
+		Method: MethodReadObject,
+		Path:   "logs/job/*/build-log.txt",
+		After:  1,
+		Times:  2,
+		Err:    errTransient,
+	})
+	var errs []error
+	for i := 0; i < 4; i++ {
+		_, err := mockClient.ReadObject(ctx, bktName, "logs/job/1/build-log.txt")
+		errs = append(errs, err)
+	}
+	if want := []error{nil, errTransient, errTransient, nil}; !reflect.DeepEqual(errs, want) {
+		t.Fatalf("expected errors %v, got errors %v", want, errs)
+	}
+
+	// Rules only apply to the matching calls.
+	mockClient.AddRule(Rule{Bucket: "other-bucket", Err: errTransient})
+	mockClient.AddRule(Rule{Method: MethodAttrObject, Path: "logs/job/2/*", Err: errTransient})
+	if _, err := mockClient.AttrObject(ctx, bktName, "logs/job/1/build-log.txt"); err != nil {
+		t.Fatalf("expected error %v, got error %v", nil, err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := mockClient.AttrObject(ctx, bktName, "logs/job/2/build-log.txt"); err != errTransient {
+			t.Fatalf("expected error %v, got error %v", errTransient, err)
+		}
+	}
+	mockClient.ClearRules()
+	if _, err := mockClient.AttrObject(ctx, bktName, "logs/job/2/build-log.txt"); err != nil {
+		t.Fatalf("expected error %v, got error %v", nil, err)
+	}
+
+	// Latency is cut short by the context.
+	mockClient.AddRule(Rule{Method: MethodNewReader, Latency: time.Hour})
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := mockClient.NewReader(timeoutCtx, bktName, "logs/job/1/build-log.txt"); err != context.DeadlineExceeded {
+		t.Fatalf("expected error %v, got error %v", context.DeadlineExceeded, err)
+	}
+	mockClient.ClearRules()
+	mockClient.AddRule(Rule{Method: MethodNewReader, Latency: 10 * time.Millisecond})
+	start := time.Now()
+	if _, err := mockClient.NewReader(ctx, bktName, "logs/job/1/build-log.txt"); err != nil || time.Since(start) < 10*time.Millisecond {
+		t.Fatalf("expected the call to be delayed by 10ms, got %v and error %v", time.Since(start), err)
+	}
+}
+
+func TestCalls(t *testing.T) {
+	ctx := context.Background()
+	mockClient := NewClientMocker()
+	bktName := "test-bucket"
+
+	mockClient.NewStorageBucket(ctx, bktName, "test-project")
+	mockClient.WriteObject(ctx, bktName, "dir/object1", []byte("Hello World"))
+	mockClient.CopyObject(ctx, bktName, "dir/object1", bktName, "dir/object2")
+	mockClient.Exists(ctx, bktName, "dir")
+
+	want := []Call{
+		{Method: MethodNewStorageBucket, Bucket: bktName},
+		{Method: MethodWriteObject, Bucket: bktName, Path: "dir/object1"},
+		{Method: MethodCopyObject, Bucket: bktName, Path: "dir/object1", DstBucket: bktName, DstPath: "dir/object2"},
+		{Method: MethodExists, Bucket: bktName, Path: "dir"},
+	}
+	if got := mockClient.Calls(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected calls %v, got calls %v", want, got)
+	}
+	mockClient.ClearCalls()
+	if got := mockClient.Calls(); len(got) != 0 {
+		t.Fatalf("expected no calls, got calls %v", got)
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	ctx := context.Background()
+	mockClient := NewClientMocker()
+	bktName := "test-bucket"
+	objPath := "dir/object"
+
+	mockClient.NewStorageBucket(ctx, bktName, "test-project")
+	mockClient.WriteObject(ctx, bktName, objPath, []byte("Hello World"))
+
+	r, err := mockClient.NewReader(ctx, bktName, objPath)
+	if err != nil {
+		t.Fatalf("expected error %v, got error %v", nil, err)
+	}
+	// The reader isn't affected by writes.
+	mockClient.WriteObject(ctx, bktName, objPath, []byte("Bye"))
+	content, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(content) != "Hello World" {
+		t.Fatalf("expected content %v, got content %v", "Hello World", string(content))
+	}
+
+	if _, err := mockClient.NewReader(ctx, bktName, "dir/non-existent"); !errors.Is(err, storage.ErrObjectNotExist) {
+		t.Fatalf("expected error %v, got error %v", storage.ErrObjectNotExist, err)
+	}
+	if _, err := mockClient.NewReader(ctx, "non-existent-bucket", objPath); !errors.Is(err, storage.ErrBucketNotExist) {
+		t.Fatalf("expected error %v, got error %v", storage.ErrBucketNotExist, err)
+	}
+}
@@ -17,14 +17,21 @@ limitations under the License.
 package mock
 
 import (
+	"bytes"
 	"context"
-	"errors"
+	"crypto/md5"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/storage"
+
+	"knative.dev/test-infra/pkg/gcs"
 )
 
 // I don't know if it is easier or not to use go mock, but we really only need two things:
@@ -40,10 +47,15 @@ import (
 var (
 	MethodNewStorageBucket    = Method("NewStorageBucket")
 	MethodDeleteStorageBucket = Method("NewDeleteStorageBucket")
+	MethodExists              = Method("Exists")
 	MethodListChildrenFiles   = Method("ListChildrenFiles")
 	MethodListDirectChildren  = Method("ListDirectChildren")
+	MethodListObjects         = Method("ListObjects")
 	MethodAttrObject          = Method("AttrObject")
+	MethodUpdateObject        = Method("UpdateObject")
 	MethodCopyObject          = Method("CopyObject")
+	MethodNewReader           = Method("NewReader")
+	MethodNewWriter           = Method("NewWriter")
 	MethodReadObject          = Method("ReadObject")
 	MethodWriteObject         = Method("WriteObject")
 	MethodDeleteObject        = Method("DeleteObject")
@@ -53,6 +65,9 @@ var (
 
 // mock GCS Client
 type clientMocker struct {
+	// mu protects all the fields, as the client can be used concurrently
+	// e.g. by gcs.SyncDir
+	mu sync.Mutex
 	// project with buckets
 	gcp map[project]*buckets
 	// error map
@@ -60,12 +75,22 @@ type clientMocker struct {
 	//	in this library, you can use SetError(map[Method]*ReturnError) or ClearError()
 	//	to create the error return values you want. Default is nil.
 	err map[Method]*ReturnError
+	// rules inject faults into the calls matching them, see AddRule
+	rules []*Rule
+	// calls is the journal of all the calls made to the client, see Calls
+	calls []Call
 
 	// reverse index to lookup which project a bucket is under as GCS has a global
 	// bucket namespace.
 	revIndex map[bucket]project
+
+	// generation is the last generation given to an object, generations are
+	// unique across buckets like in GCS
+	generation int64
 }
 
+var _ gcs.Client = (*clientMocker)(nil)
+
 func NewClientMocker() *clientMocker {
 	c := &clientMocker{
 		gcp:      make(map[project]*buckets),
@@ -78,11 +103,17 @@ func NewClientMocker() *clientMocker {
 // SetError sets the number of calls of an interface function before an error is returned.
 // Otherwise it will return the err of the mock function itself (which is usually nil).
 func (c *clientMocker) SetError(m map[Method]*ReturnError) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.err = m
 }
 
 // ClearError clears the error map in mock client
 func (c *clientMocker) ClearError() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	for k := range c.err {
 		// Apparently Go is okay with deleting keys as you iterate.
 		delete(c.err, k)
@@ -117,10 +148,13 @@ func (c *clientMocker) getBucketRoot(bkt string) *objects {
 
 // NewStorageBucket mock creates a new storage bucket in gcp
 func (c *clientMocker) NewStorageBucket(ctx context.Context, bkt, projectName string) error {
-	if override, err := c.getError(MethodNewStorageBucket); override {
+	if override, err := c.intercept(ctx, Call{Method: MethodNewStorageBucket, Bucket: bkt}); override {
 		return err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	p := project(projectName)
 
 	if _, ok := c.revIndex[bucket(bkt)]; ok {
@@ -141,10 +175,13 @@ func (c *clientMocker) NewStorageBucket(ctx context.Context, bkt, projectName st
 
 // DeleteStorageBucket mock deletes a storage bucket from gcp, force if not empty
 func (c *clientMocker) DeleteStorageBucket(ctx context.Context, bkt string, force bool) error {
-	if override, err := c.getError(MethodDeleteStorageBucket); override {
+	if override, err := c.intercept(ctx, Call{Method: MethodDeleteStorageBucket, Bucket: bkt}); override {
 		return err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	bktName := bucket(bkt)
 
 	p, ok := c.revIndex[bktName]
@@ -163,6 +200,13 @@ func (c *clientMocker) DeleteStorageBucket(ctx context.Context, bkt string, forc
 
 // Exists mock check if an object exists
 func (c *clientMocker) Exists(ctx context.Context, bkt, objPath string) bool {
+	if override, _ := c.intercept(ctx, Call{Method: MethodExists, Bucket: bkt, Path: objPath}); override {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	bktRoot := c.getBucketRoot(bkt)
 	if bktRoot == nil {
 		return false
@@ -192,10 +236,13 @@ func (c *clientMocker) Exists(ctx context.Context, bkt, objPath string) bool {
 
 // ListChildrenFiles mock lists all children recursively
 func (c *clientMocker) ListChildrenFiles(ctx context.Context, bkt, dirPath string) ([]string, error) {
-	if override, err := c.getError(MethodListChildrenFiles); override {
+	if override, err := c.intercept(ctx, Call{Method: MethodListChildrenFiles, Bucket: bkt, Path: dirPath}); override {
 		return nil, err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	bktRoot := c.getBucketRoot(bkt)
 	if bktRoot == nil {
 		return nil, NewNoBucketError(bkt)
@@ -216,10 +263,13 @@ func (c *clientMocker) ListChildrenFiles(ctx context.Context, bkt, dirPath strin
 
 // mock lists all direct children recursively
 func (c *clientMocker) ListDirectChildren(ctx context.Context, bkt, dirPath string) ([]string, error) {
-	if override, err := c.getError(MethodListDirectChildren); override {
+	if override, err := c.intercept(ctx, Call{Method: MethodListDirectChildren, Bucket: bkt, Path: dirPath}); override {
 		return nil, err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	bktRoot := c.getBucketRoot(bkt)
 	if bktRoot == nil {
 		return nil, NewNoBucketError(bkt)
@@ -240,10 +290,13 @@ func (c *clientMocker) ListDirectChildren(ctx context.Context, bkt, dirPath stri
 
 // AttrObject mock returns the attribute of an object
 func (c *clientMocker) AttrObject(ctx context.Context, bkt, objPath string) (*storage.ObjectAttrs, error) {
-	if override, err := c.getError(MethodAttrObject); override {
+	if override, err := c.intercept(ctx, Call{Method: MethodAttrObject, Bucket: bkt, Path: objPath}); override {
 		return nil, err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	bktRoot := c.getBucketRoot(bkt)
 	if bktRoot == nil {
 		return nil, NewNoBucketError(bkt)
@@ -258,19 +311,128 @@ func (c *clientMocker) AttrObject(ctx context.Context, bkt, objPath string) (*st
 		return nil, NewNoObjectError(bkt, obj, dir)
 	}
 
+	return o.attrs(), nil
+}
+
+// attrs returns the attributes of an object
+func (o *object) attrs() *storage.ObjectAttrs {
+	sum := md5.Sum(o.content)
+	var metadata map[string]string
+	if len(o.metadata) != 0 {
+		metadata = make(map[string]string, len(o.metadata))
+		for k, v := range o.metadata {
+			metadata[k] = v
+		}
+	}
 	return &storage.ObjectAttrs{
-		Bucket: bkt,
-		Name:   objPath,
-		Size:   int64(len(o.content)),
-	}, nil
+		Bucket:      o.bkt,
+		Name:        o.name.toString(),
+		Size:        int64(len(o.content)),
+		MD5:         sum[:],
+		ContentType: o.contentType,
+		Metadata:    metadata,
+		Generation:  o.generation,
+		Created:     o.updated,
+		Updated:     o.updated,
+	}
+}
+
+// putObject creates or replaces an object if the generation precondition of
+// the options is met
+func (c *clientMocker) putObject(bktRoot *objects, bkt string, mockPath mockpath, content []byte, o gcs.WriteOptions) error {
+	var current int64
+	if obj, ok := bktRoot.obj[mockPath]; ok {
+		current = obj.generation
+	}
+	if err := o.CheckGeneration(current); err != nil {
+		return err
+	}
+	c.generation++
+	bktRoot.obj[mockPath] = &object{
+		name:        mockPath,
+		bkt:         bkt,
+		content:     append([]byte{}, content...),
+		contentType: o.ContentType,
+		metadata:    o.Metadata,
+		generation:  c.generation,
+		updated:     time.Now(),
+	}
+	return nil
+}
+
+// UpdateObject mocks setting the content type and adding metadata to an object
+func (c *clientMocker) UpdateObject(ctx context.Context, bkt, objPath string, opts ...gcs.WriteOption) (*storage.ObjectAttrs, error) {
+	if override, err := c.intercept(ctx, Call{Method: MethodUpdateObject, Bucket: bkt, Path: objPath}); override {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bktRoot := c.getBucketRoot(bkt)
+	if bktRoot == nil {
+		return nil, NewNoBucketError(bkt)
+	}
+
+	dir, objName := filepath.Split(objPath)
+	obj, ok := bktRoot.obj[newMockPath(dir, objName)]
+	if !ok {
+		return nil, NewNoObjectError(bkt, objName, dir)
+	}
+
+	o := gcs.NewWriteOptions(opts...)
+	if err := o.CheckGeneration(obj.generation); err != nil {
+		return nil, err
+	}
+	if o.ContentType != "" {
+		obj.contentType = o.ContentType
+	}
+	if o.Metadata != nil && len(o.Metadata) == 0 {
+		obj.metadata = nil
+	}
+	for k, v := range o.Metadata {
+		if obj.metadata == nil {
+			obj.metadata = make(map[string]string)
+		}
+		obj.metadata[k] = v
+	}
+	obj.updated = time.Now()
+	return obj.attrs(), nil
+}
+
+// ListObjects mocks listing one page of objects with their attributes
+func (c *clientMocker) ListObjects(ctx context.Context, bkt string, query gcs.ListQuery) (*gcs.ObjectsPage, error) {
+	if override, err := c.intercept(ctx, Call{Method: MethodListObjects, Bucket: bkt, Path: query.Prefix}); override {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bktRoot := c.getBucketRoot(bkt)
+	if bktRoot == nil {
+		return nil, NewNoBucketError(bkt)
+	}
+
+	all := make([]*storage.ObjectAttrs, 0, len(bktRoot.obj))
+	for _, obj := range bktRoot.obj {
+		all = append(all, obj.attrs())
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Name < all[j].Name
+	})
+	return gcs.PaginateObjects(all, query), nil
 }
 
 // CopyObject mocks the copying of one object to another
 func (c *clientMocker) CopyObject(ctx context.Context, srcBkt, srcObjPath, dstBkt, dstObjPath string) error {
-	if override, err := c.getError(MethodCopyObject); override {
+	if override, err := c.intercept(ctx, Call{Method: MethodCopyObject, Bucket: srcBkt, Path: srcObjPath, DstBucket: dstBkt, DstPath: dstObjPath}); override {
 		return err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	srcBktRoot := c.getBucketRoot(srcBkt)
 	if srcBktRoot == nil {
 		return NewNoBucketError(srcBkt)
@@ -299,26 +461,94 @@ func (c *clientMocker) CopyObject(ctx context.Context, srcBkt, srcObjPath, dstBk
 		return NewNoObjectError(srcBkt, srcObjName, srcDir)
 	}
 
-	dstBktRoot.obj[dstMockPath] = &object{
-		name:    srcObj.name,
-		bkt:     dstBkt,
-		content: make([]byte, len(srcBktRoot.obj[srcMockPath].content)),
+	return c.putObject(dstBktRoot, dstBkt, dstMockPath, srcObj.content, gcs.WriteOptions{
+		ContentType: srcObj.contentType,
+		Metadata:    srcObj.metadata,
+	})
+}
+
+// objectWriter buffers the content written to an object until it is closed
+type objectWriter struct {
+	bytes.Buffer
+	c        *clientMocker
+	bkt      string
+	mockPath mockpath
+	opts     gcs.WriteOptions
+}
+
+// Close writes the object
+func (w *objectWriter) Close() error {
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+
+	bktRoot := w.c.getBucketRoot(w.bkt)
+	if bktRoot == nil {
+		return NewNoBucketError(w.bkt)
 	}
-	copy(dstBktRoot.obj[dstMockPath].content, srcBktRoot.obj[srcMockPath].content)
-	return nil
+	return w.c.putObject(bktRoot, w.bkt, w.mockPath, w.Bytes(), w.opts)
 }
 
-// NewReader creates a new Reader of a gcs file.
-func (c *clientMocker) NewReader(ctx context.Context, bucketName, objPath string) (*storage.Reader, error) {
-	return nil, errors.New("not implemented")
+// NewWriter mocks creating a Writer of an object, written when it's closed
+func (c *clientMocker) NewWriter(ctx context.Context, bkt, objPath string, opts ...gcs.WriteOption) (io.WriteCloser, error) {
+	if override, err := c.intercept(ctx, Call{Method: MethodNewWriter, Bucket: bkt, Path: objPath}); override {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.getBucketRoot(bkt) == nil {
+		return nil, NewNoBucketError(bkt)
+	}
+
+	dir, objName := filepath.Split(objPath)
+	if objName == "" {
+		return nil, NewNoObjectError(bkt, objName, dir)
+	}
+
+	return &objectWriter{
+		c:        c,
+		bkt:      bkt,
+		mockPath: newMockPath(dir, objName),
+		opts:     gcs.NewWriteOptions(opts...),
+	}, nil
+}
+
+// NewReader mocks creating a Reader of an object, the content is read as of
+// the call even if the object is written before the Reader is closed
+func (c *clientMocker) NewReader(ctx context.Context, bkt, objPath string) (io.ReadCloser, error) {
+	if override, err := c.intercept(ctx, Call{Method: MethodNewReader, Bucket: bkt, Path: objPath}); override {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bktRoot := c.getBucketRoot(bkt)
+	if bktRoot == nil {
+		return nil, NewNoBucketError(bkt)
+	}
+
+	dir, objName := filepath.Split(objPath)
+	obj, ok := bktRoot.obj[newMockPath(dir, objName)]
+	if !ok {
+		return nil, NewNoObjectError(bkt, objName, dir)
+	}
+
+	// Objects are replaced rather than modified when written, so the content
+	// can be read without copying it.
+	return ioutil.NopCloser(bytes.NewReader(obj.content)), nil
 }
 
 // ReadObject mocks reading from an object
 func (c *clientMocker) ReadObject(ctx context.Context, bkt, objPath string) ([]byte, error) {
-	if override, err := c.getError(MethodReadObject); override {
+	if override, err := c.intercept(ctx, Call{Method: MethodReadObject, Bucket: bkt, Path: objPath}); override {
 		return nil, err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	bktRoot := c.getBucketRoot(bkt)
 	if bktRoot == nil {
 		return nil, NewNoBucketError(bkt)
@@ -338,11 +568,14 @@ func (c *clientMocker) ReadObject(ctx context.Context, bkt, objPath string) ([]b
 }
 
 // WriteObject mocks writing to an object
-func (c *clientMocker) WriteObject(ctx context.Context, bkt, objPath string, content []byte) (int, error) {
-	if override, err := c.getError(MethodWriteObject); override {
+func (c *clientMocker) WriteObject(ctx context.Context, bkt, objPath string, content []byte, opts ...gcs.WriteOption) (int, error) {
+	if override, err := c.intercept(ctx, Call{Method: MethodWriteObject, Bucket: bkt, Path: objPath}); override {
 		return -1, err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	bktRoot := c.getBucketRoot(bkt)
 	if bktRoot == nil {
 		return -1, NewNoBucketError(bkt)
@@ -353,22 +586,21 @@ func (c *clientMocker) WriteObject(ctx context.Context, bkt, objPath string, con
 		return -1, NewNoObjectError(bkt, objName, dir)
 	}
 
-	mockPath := newMockPath(dir, objName)
-	bktRoot.obj[mockPath] = &object{
-		name:    mockPath,
-		bkt:     bkt,
-		content: make([]byte, len(content)),
+	if err := c.putObject(bktRoot, bkt, newMockPath(dir, objName), content, gcs.NewWriteOptions(opts...)); err != nil {
+		return -1, err
 	}
-	copy(bktRoot.obj[mockPath].content, content)
 	return len(content), nil
 }
 
 // DeleteObject mocks deleting an object
 func (c *clientMocker) DeleteObject(ctx context.Context, bkt, objPath string) error {
-	if override, err := c.getError(MethodDeleteObject); override {
+	if override, err := c.intercept(ctx, Call{Method: MethodDeleteObject, Bucket: bkt, Path: objPath}); override {
 		return err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	bktRoot := c.getBucketRoot(bkt)
 	if bktRoot == nil {
 		return nil
@@ -385,10 +617,13 @@ func (c *clientMocker) DeleteObject(ctx context.Context, bkt, objPath string) er
 
 // Download mocks downloading an object to a local file
 func (c *clientMocker) Download(ctx context.Context, bkt, objPath, filePath string) error {
-	if override, err := c.getError(MethodDownload); override {
+	if override, err := c.intercept(ctx, Call{Method: MethodDownload, Bucket: bkt, Path: objPath}); override {
 		return err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	bktRoot := c.getBucketRoot(bkt)
 	if bktRoot == nil {
 		return NewNoBucketError(bkt)
@@ -404,7 +639,7 @@ func (c *clientMocker) Download(ctx context.Context, bkt, objPath, filePath stri
 		return NewNoObjectError(bkt, objName, dir)
 	}
 
-	f, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0755)
+	f, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
 	if err != nil {
 		return err
 	}
@@ -415,11 +650,14 @@ func (c *clientMocker) Download(ctx context.Context, bkt, objPath, filePath stri
 }
 
 // Upload mocks uploading a local file to an object
-func (c *clientMocker) Upload(ctx context.Context, bkt, objPath, filePath string) error {
-	if override, err := c.getError(MethodUpload); override {
+func (c *clientMocker) Upload(ctx context.Context, bkt, objPath, filePath string, opts ...gcs.WriteOption) error {
+	if override, err := c.intercept(ctx, Call{Method: MethodUpload, Bucket: bkt, Path: objPath}); override {
 		return err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	bktRoot := c.getBucketRoot(bkt)
 	if bktRoot == nil {
 		return NewNoBucketError(bkt)
@@ -435,12 +673,5 @@ func (c *clientMocker) Upload(ctx context.Context, bkt, objPath, filePath string
 		return err
 	}
 
-	mockPath := newMockPath(dir, objName)
-	bktRoot.obj[mockPath] = &object{
-		name:    mockPath,
-		bkt:     bkt,
-		content: make([]byte, len(content)),
-	}
-	copy(bktRoot.obj[mockPath].content, content)
-	return nil
+	return c.putObject(bktRoot, bkt, newMockPath(dir, objName), content, gcs.NewWriteOptions(opts...))
 }
@@ -56,7 +56,7 @@ func topFunction(c gcs.Client) error {
 	return nil
 }
 
-func ExampleSetError() {
+func Example_setError() {
 	mockClient := NewClientMocker()
 
 	// Call to ReadObject, first call should return error, but returns nil
@@ -77,3 +77,28 @@ func ExampleSetError() {
 	// Output:
 	// no bucket "NewBkt"
 }
+
+func Example_addRule() {
+	ctx := context.Background()
+	mockClient := NewClientMocker()
+	mockClient.NewStorageBucket(ctx, bkt, proj)
+	mockClient.WriteObject(ctx, bkt, "logs/build-log.txt", []byte("log"))
+
+	// Reading any object under logs/ fails twice, then succeeds.
+	mockClient.AddRule(Rule{
+		Method: MethodReadObject,
+		Path:   "logs/*",
+		Times:  2,
+		Err:    fmt.Errorf("transient error"),
+	})
+	for i := 0; i < 3; i++ {
+		_, err := mockClient.ReadObject(ctx, bkt, "logs/build-log.txt")
+		fmt.Println(err)
+	}
+	fmt.Println(len(mockClient.Calls()))
+	// Output:
+	// transient error
+	// transient error
+	// <nil>
+	// 5
+}
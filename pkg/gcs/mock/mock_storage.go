@@ -18,6 +18,7 @@ package mock
 
 import (
 	"path/filepath"
+	"time"
 )
 
 // more friendly type casts for better readability of what some strings are
@@ -50,8 +51,17 @@ type object struct {
 	//	Size
 	//	Bucket
 	//	Name
-	bkt     string
-	content []byte
+	//	MD5
+	//	ContentType
+	//	Metadata
+	//	Generation
+	//	Updated
+	bkt         string
+	content     []byte
+	contentType string
+	metadata    map[string]string
+	generation  int64
+	updated     time.Time
 }
 
 // bucket of objects - structure is flat
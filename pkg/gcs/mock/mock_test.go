@@ -19,6 +19,7 @@ package mock
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -26,6 +27,8 @@ import (
 	"reflect"
 	"sort"
 	"testing"
+
+	"knative.dev/test-infra/pkg/gcs"
 )
 
 func TestSetError(t *testing.T) {
@@ -1096,3 +1099,92 @@ func TestUpload(t *testing.T) {
 		})
 	}
 }
+
+func TestNewWriter(t *testing.T) {
+	ctx := context.Background()
+	mockClient := NewClientMocker()
+	bktName := "test-bucket"
+	objPath := "dir/latest-build.txt"
+
+	mockClient.NewStorageBucket(ctx, bktName, "test-project")
+
+	if _, err := mockClient.NewWriter(ctx, "non-existent-bucket", objPath); err == nil {
+		t.Fatal("expected error for a non existent bucket, got nil")
+	}
+
+	w, err := mockClient.NewWriter(ctx, bktName, objPath, gcs.IfNotExist(), gcs.WithContentType("text/plain"))
+	if err != nil {
+		t.Fatalf("expected error %v, got error %v", nil, err)
+	}
+	w.Write([]byte("1"))
+	if mockClient.Exists(ctx, bktName, objPath) {
+		t.Fatal("expected object to only be written on Close")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("expected error %v, got error %v", nil, err)
+	}
+
+	attrs, _ := mockClient.AttrObject(ctx, bktName, objPath)
+	if attrs.ContentType != "text/plain" || attrs.Generation == 0 {
+		t.Fatalf("expected content type text/plain and a generation, got %+v", attrs)
+	}
+	if _, err := mockClient.WriteObject(ctx, bktName, objPath, []byte("2"), gcs.IfNotExist()); !errors.Is(err, gcs.ErrPreconditionFailed) {
+		t.Fatalf("expected error %v, got error %v", gcs.ErrPreconditionFailed, err)
+	}
+	if _, err := mockClient.WriteObject(ctx, bktName, objPath, []byte("2"), gcs.IfGenerationMatch(attrs.Generation)); err != nil {
+		t.Fatalf("expected error %v, got error %v", nil, err)
+	}
+	if content, _ := mockClient.ReadObject(ctx, bktName, objPath); string(content) != "2" {
+		t.Fatalf("expected content %v, got content %v", "2", string(content))
+	}
+}
+
+func TestUpdateObject(t *testing.T) {
+	ctx := context.Background()
+	mockClient := NewClientMocker()
+	bktName := "test-bucket"
+	objPath := "dir/object"
+
+	mockClient.NewStorageBucket(ctx, bktName, "test-project")
+	mockClient.WriteObject(ctx, bktName, objPath, []byte("Hello World"), gcs.WithMetadata(map[string]string{"a": "1"}))
+
+	attrs, err := mockClient.UpdateObject(ctx, bktName, objPath, gcs.WithContentType("text/plain"), gcs.WithMetadata(map[string]string{"b": "2"}))
+	if err != nil {
+		t.Fatalf("expected error %v, got error %v", nil, err)
+	}
+	if want := map[string]string{"a": "1", "b": "2"}; !reflect.DeepEqual(attrs.Metadata, want) || attrs.ContentType != "text/plain" {
+		t.Fatalf("expected metadata %v and content type text/plain, got %+v", want, attrs)
+	}
+	if _, err := mockClient.UpdateObject(ctx, bktName, objPath, gcs.IfGenerationMatch(attrs.Generation+1)); !errors.Is(err, gcs.ErrPreconditionFailed) {
+		t.Fatalf("expected error %v, got error %v", gcs.ErrPreconditionFailed, err)
+	}
+	if _, err := mockClient.UpdateObject(ctx, bktName, "dir/non-existent"); err == nil {
+		t.Fatal("expected error for a non existent object, got nil")
+	}
+}
+
+func TestListObjects(t *testing.T) {
+	ctx := context.Background()
+	mockClient := NewClientMocker()
+	bktName := "test-bucket"
+
+	mockClient.NewStorageBucket(ctx, bktName, "test-project")
+	for _, p := range []string{"logs/1/build-log.txt", "logs/2/build-log.txt", "logs/latest-build.txt"} {
+		mockClient.WriteObject(ctx, bktName, p, []byte(p))
+	}
+
+	page, err := mockClient.ListObjects(ctx, bktName, gcs.ListQuery{Prefix: "logs/", Delimiter: "/", PageSize: 2})
+	if err != nil {
+		t.Fatalf("expected error %v, got error %v", nil, err)
+	}
+	if want := []string{"logs/1/", "logs/2/"}; !reflect.DeepEqual(page.Prefixes, want) || page.NextPageToken == "" {
+		t.Fatalf("expected prefixes %v and a next page, got %+v", want, page)
+	}
+	page, err = mockClient.ListObjects(ctx, bktName, gcs.ListQuery{Prefix: "logs/", Delimiter: "/", PageSize: 2, PageToken: page.NextPageToken})
+	if err != nil {
+		t.Fatalf("expected error %v, got error %v", nil, err)
+	}
+	if len(page.Objects) != 1 || page.Objects[0].Name != "logs/latest-build.txt" || len(page.Objects[0].MD5) == 0 {
+		t.Fatalf("expected logs/latest-build.txt with its MD5, got %+v", page.Objects)
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// sync.go synchronizes local directories with GCS directories, like gsutil rsync
+
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"knative.dev/test-infra/pkg/helpers"
+)
+
+// defaultSyncParallelism is the number of files copied at the same time by default
+const defaultSyncParallelism = 8
+
+// SyncResult lists the files of a sync, relative to the synchronized directories
+type SyncResult struct {
+	// Copied are the files uploaded or downloaded
+	Copied []string
+	// Skipped are the files with the same content on both sides
+	Skipped []string
+}
+
+type syncOptions struct {
+	parallelism int
+	writeOpts   []WriteOption
+}
+
+// SyncOption sets an option of SyncDir and DownloadDir
+type SyncOption func(*syncOptions)
+
+// WithParallelism sets the number of files copied at the same time
+func WithParallelism(n int) SyncOption {
+	return func(o *syncOptions) {
+		if n > 0 {
+			o.parallelism = n
+		}
+	}
+}
+
+// WithWriteOptions sets the options of the uploaded objects
+func WithWriteOptions(opts ...WriteOption) SyncOption {
+	return func(o *syncOptions) {
+		o.writeOpts = opts
+	}
+}
+
+// SyncDir uploads the files of localDir recursively under prefix in the bucket.
+// Files whose MD5 matches the one of the object are skipped. Objects without
+// a local file are kept.
+func SyncDir(ctx context.Context, c Client, localDir, bkt, prefix string, opts ...SyncOption) (*SyncResult, error) {
+	o := newSyncOptions(opts...)
+	remote, err := listMD5s(ctx, c, bkt, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	err = filepath.Walk(localDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return syncFiles(o.parallelism, files, func(rel string) (bool, error) {
+		localPath := filepath.Join(localDir, filepath.FromSlash(rel))
+		if sum, ok := remote[rel]; ok {
+			if same, err := fileHasMD5(localPath, sum); err != nil || same {
+				return false, err
+			}
+		}
+		return true, c.Upload(ctx, bkt, path.Join(prefix, rel), localPath, o.writeOpts...)
+	})
+}
+
+// DownloadDir downloads the objects under prefix in the bucket recursively to
+// localDir. Objects whose MD5 matches the one of the local file are skipped.
+// Local files without an object are kept.
+func DownloadDir(ctx context.Context, c Client, bkt, prefix, localDir string, opts ...SyncOption) (*SyncResult, error) {
+	o := newSyncOptions(opts...)
+	remote, err := listMD5s(ctx, c, bkt, prefix)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(remote))
+	for rel := range remote {
+		files = append(files, rel)
+	}
+
+	return syncFiles(o.parallelism, files, func(rel string) (bool, error) {
+		// Make sure the object cannot be written outside of localDir.
+		localPath := filepath.Join(localDir, filepath.FromSlash(path.Clean("/"+rel)))
+		if same, err := fileHasMD5(localPath, remote[rel]); err != nil || same {
+			return false, err
+		}
+		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			return false, err
+		}
+		return true, c.Download(ctx, bkt, path.Join(prefix, rel), localPath)
+	})
+}
+
+func newSyncOptions(opts ...SyncOption) *syncOptions {
+	o := &syncOptions{parallelism: defaultSyncParallelism}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// listMD5s returns the MD5 of the objects under prefix, keyed by their path
+// relative to prefix
+func listMD5s(ctx context.Context, c Client, bkt, prefix string) (map[string][]byte, error) {
+	if prefix != "" {
+		prefix = strings.TrimRight(prefix, " /") + "/"
+	}
+	md5s := make(map[string][]byte)
+	query := ListQuery{Prefix: prefix}
+	for {
+		page, err := c.ListObjects(ctx, bkt, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed listing gs://%s/%s: %w", bkt, prefix, err)
+		}
+		for _, attrs := range page.Objects {
+			md5s[strings.TrimPrefix(attrs.Name, prefix)] = attrs.MD5
+		}
+		if page.NextPageToken == "" {
+			return md5s, nil
+		}
+		query.PageToken = page.NextPageToken
+	}
+}
+
+// fileHasMD5 checks if a local file exists with the given MD5
+func fileHasMD5(filePath string, sum []byte) (bool, error) {
+	if len(sum) == 0 {
+		// Composite objects don't have an MD5.
+		return false, nil
+	}
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false, err
+	}
+	return bytes.Equal(h.Sum(nil), sum), nil
+}
+
+// syncFiles calls syncFile on all the files with bounded parallelism,
+// syncFile returns whether the file was copied
+func syncFiles(parallelism int, files []string, syncFile func(string) (bool, error)) (*SyncResult, error) {
+	copied := make([]bool, len(files))
+	errs := make([]error, len(files))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			copied[i], errs[i] = syncFile(files[i])
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("failed syncing %q: %w", files[i], errs[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	res := &SyncResult{}
+	for i, f := range files {
+		if errs[i] != nil {
+			continue
+		}
+		if copied[i] {
+			res.Copied = append(res.Copied, f)
+		} else {
+			res.Skipped = append(res.Skipped, f)
+		}
+	}
+	sort.Strings(res.Copied)
+	sort.Strings(res.Skipped)
+	return res, helpers.CombineErrors(errs)
+}
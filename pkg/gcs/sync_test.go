@@ -0,0 +1,96 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeLocalFiles(t *testing.T, dir string, files map[string]string) {
+	for p, content := range files {
+		p = filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("cannot create directory: %v", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("cannot write file: %v", err)
+		}
+	}
+}
+
+func TestSyncDir(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gcs")
+	if err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	ctx := context.Background()
+	c := NewLocalClient(filepath.Join(tmp, "gcs"))
+	if err := c.NewStorageBucket(ctx, "bkt", ""); err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	c.WriteObject(ctx, "bkt", "artifacts/junit_01.xml", []byte("<testsuites/>"))
+	c.WriteObject(ctx, "bkt", "artifacts/build-log.txt", []byte("old log"))
+
+	src := filepath.Join(tmp, "src")
+	writeLocalFiles(t, src, map[string]string{
+		"junit_01.xml":       "<testsuites/>",
+		"build-log.txt":      "new log",
+		"cluster/nodes.yaml": "nodes",
+	})
+	res, err := SyncDir(ctx, c, src, "bkt", "artifacts", WithParallelism(2))
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	want := &SyncResult{Copied: []string{"build-log.txt", "cluster/nodes.yaml"}, Skipped: []string{"junit_01.xml"}}
+	if !reflect.DeepEqual(res, want) {
+		t.Fatalf("Expected %+v, actual %+v", want, res)
+	}
+	if content, _ := c.ReadObject(ctx, "bkt", "artifacts/build-log.txt"); string(content) != "new log" {
+		t.Fatalf("Expected 'new log', actual %q", string(content))
+	}
+
+	// Downloading back only copies the files that changed.
+	dst := filepath.Join(tmp, "dst")
+	writeLocalFiles(t, dst, map[string]string{
+		"junit_01.xml":  "<testsuites/>",
+		"build-log.txt": "a longer local log",
+		"local.txt":     "kept",
+	})
+	res, err = DownloadDir(ctx, c, "bkt", "artifacts/", dst)
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Fatalf("Expected %+v, actual %+v", want, res)
+	}
+	for p, want := range map[string]string{"build-log.txt": "new log", "cluster/nodes.yaml": "nodes", "local.txt": "kept"} {
+		if content, _ := ioutil.ReadFile(filepath.Join(dst, p)); string(content) != want {
+			t.Fatalf("Expected %q in %s, actual %q", want, p, string(content))
+		}
+	}
+
+	if _, err := SyncDir(ctx, c, src, "missing-bkt", ""); err == nil {
+		t.Fatal("Expected an error syncing to a missing bucket, actual nil")
+	}
+}
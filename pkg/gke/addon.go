@@ -53,3 +53,35 @@ func GetAddonsConfig(addons []string) *container.AddonsConfig {
 
 	return ac
 }
+
+// EnabledAddons returns the names of the supported addons enabled in the
+// AddonsConfig, the reverse of GetAddonsConfig.
+func EnabledAddons(ac *container.AddonsConfig) []string {
+	var addons []string
+	if ac == nil {
+		return addons
+	}
+	if ac.IstioConfig != nil && !ac.IstioConfig.Disabled {
+		addons = append(addons, istio)
+	}
+	if ac.HorizontalPodAutoscaling != nil && !ac.HorizontalPodAutoscaling.Disabled {
+		addons = append(addons, hpa)
+	}
+	if ac.HttpLoadBalancing != nil && !ac.HttpLoadBalancing.Disabled {
+		addons = append(addons, hlb)
+	}
+	if ac.CloudRunConfig != nil && !ac.CloudRunConfig.Disabled {
+		addons = append(addons, cloudRun)
+	}
+	return addons
+}
+
+// DefaultAddon returns whether GKE enables the addon by default, even if it's
+// not in the AddonsConfig the cluster is created with.
+func DefaultAddon(name string) bool {
+	switch strings.ToLower(name) {
+	case hpa, hlb:
+		return true
+	}
+	return false
+}
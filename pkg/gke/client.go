@@ -17,23 +17,40 @@ limitations under the License.
 package gke
 
 import (
+	"context"
 	"fmt"
 
 	container "google.golang.org/api/container/v1beta1"
 	option "google.golang.org/api/option"
-
-	"golang.org/x/net/context"
 )
 
-// SDKOperations wraps GKE SDK related functions
+// SDKOperations wraps GKE SDK related functions.
+// The synchronous functions wait for the operation with Wait, see WaitOption
+// for the options. Errors are classified as in ClassifyError.
 type SDKOperations interface {
-	CreateCluster(project, region, zone string, req *container.CreateClusterRequest) error
-	CreateClusterAsync(project, region, zone string, req *container.CreateClusterRequest) (*container.Operation, error)
-	DeleteCluster(project, region, zone, clusterName string) error
-	DeleteClusterAsync(project, region, zone, clusterName string) (*container.Operation, error)
-	GetCluster(project, region, zone, clusterName string) (*container.Cluster, error)
-	GetOperation(project, region, zone, opName string) (*container.Operation, error)
-	ListClustersInProject(project string) ([]*container.Cluster, error)
+	CreateCluster(ctx context.Context, project, region, zone string, req *container.CreateClusterRequest, opts ...WaitOption) error
+	CreateClusterAsync(ctx context.Context, project, region, zone string, req *container.CreateClusterRequest) (*container.Operation, error)
+	DeleteCluster(ctx context.Context, project, region, zone, clusterName string, opts ...WaitOption) error
+	DeleteClusterAsync(ctx context.Context, project, region, zone, clusterName string) (*container.Operation, error)
+	GetCluster(ctx context.Context, project, region, zone, clusterName string) (*container.Cluster, error)
+	GetOperation(ctx context.Context, project, region, zone, opName string) (*container.Operation, error)
+	ListClustersInProject(ctx context.Context, project string) ([]*container.Cluster, error)
+
+	CreateNodePool(ctx context.Context, project, region, zone, clusterName string, req *container.CreateNodePoolRequest, opts ...WaitOption) error
+	CreateNodePoolAsync(ctx context.Context, project, region, zone, clusterName string, req *container.CreateNodePoolRequest) (*container.Operation, error)
+	DeleteNodePool(ctx context.Context, project, region, zone, clusterName, poolName string, opts ...WaitOption) error
+	DeleteNodePoolAsync(ctx context.Context, project, region, zone, clusterName, poolName string) (*container.Operation, error)
+	GetNodePool(ctx context.Context, project, region, zone, clusterName, poolName string) (*container.NodePool, error)
+	ResizeNodePool(ctx context.Context, project, region, zone, clusterName, poolName string, nodeCount int64, opts ...WaitOption) error
+	ResizeNodePoolAsync(ctx context.Context, project, region, zone, clusterName, poolName string, nodeCount int64) (*container.Operation, error)
+	SetNodePoolAutoscaling(ctx context.Context, project, region, zone, clusterName, poolName string, autoscaling *container.NodePoolAutoscaling, opts ...WaitOption) error
+	SetNodePoolAutoscalingAsync(ctx context.Context, project, region, zone, clusterName, poolName string, autoscaling *container.NodePoolAutoscaling) (*container.Operation, error)
+	UpgradeMaster(ctx context.Context, project, region, zone, clusterName, version string, opts ...WaitOption) error
+	UpgradeMasterAsync(ctx context.Context, project, region, zone, clusterName, version string) (*container.Operation, error)
+	UpgradeNodePool(ctx context.Context, project, region, zone, clusterName, poolName, version string, opts ...WaitOption) error
+	UpgradeNodePoolAsync(ctx context.Context, project, region, zone, clusterName, poolName, version string) (*container.Operation, error)
+	SetResourceLabels(ctx context.Context, project, region, zone, clusterName string, labels map[string]string, opts ...WaitOption) error
+	SetResourceLabelsAsync(ctx context.Context, project, region, zone, clusterName string, labels map[string]string) (*container.Operation, error)
 }
 
 // sdkClient Implement SDKOperations
@@ -52,63 +69,74 @@ func NewSDKClient(opts ...option.ClientOption) (SDKOperations, error) {
 
 // CreateCluster creates a new GKE cluster, and wait until it finishes or timeout or there is an error.
 func (gsc *sdkClient) CreateCluster(
+	ctx context.Context,
 	project, region, zone string,
 	rb *container.CreateClusterRequest,
+	opts ...WaitOption,
 ) error {
-	op, err := gsc.CreateClusterAsync(project, region, zone, rb)
+	op, err := gsc.CreateClusterAsync(ctx, project, region, zone, rb)
 	if err == nil {
-		err = Wait(gsc, project, region, zone, op.Name, creationTimeout)
+		err = Wait(ctx, gsc, project, region, zone, op.Name, append([]WaitOption{WithTimeout(creationTimeout)}, opts...)...)
 	}
 	return err
 }
 
 // CreateClusterAsync creates a new GKE cluster asynchronously.
 func (gsc *sdkClient) CreateClusterAsync(
+	ctx context.Context,
 	project, region, zone string,
 	rb *container.CreateClusterRequest,
 ) (*container.Operation, error) {
 	location := GetClusterLocation(region, zone)
+	var op *container.Operation
+	var err error
 	if zone != "" {
-		return gsc.Projects.Zones.Clusters.Create(project, location, rb).Context(context.Background()).Do()
+		op, err = gsc.Projects.Zones.Clusters.Create(project, location, rb).Context(ctx).Do()
+	} else {
+		parent := fmt.Sprintf("projects/%s/locations/%s", project, location)
+		op, err = gsc.Projects.Locations.Clusters.Create(parent, rb).Context(ctx).Do()
 	}
-	parent := fmt.Sprintf("projects/%s/locations/%s", project, location)
-	return gsc.Projects.Locations.Clusters.Create(parent, rb).Context(context.Background()).Do()
+	return op, ClassifyError(err)
 }
 
 // DeleteCluster deletes the GKE cluster, and wait until it finishes or timeout or there is an error.
-func (gsc *sdkClient) DeleteCluster(project, region, zone, clusterName string) error {
-	op, err := gsc.DeleteClusterAsync(project, region, zone, clusterName)
+func (gsc *sdkClient) DeleteCluster(ctx context.Context, project, region, zone, clusterName string, opts ...WaitOption) error {
+	op, err := gsc.DeleteClusterAsync(ctx, project, region, zone, clusterName)
 	if err == nil {
-		err = Wait(gsc, project, region, zone, op.Name, deletionTimeout)
+		err = Wait(ctx, gsc, project, region, zone, op.Name, append([]WaitOption{WithTimeout(deletionTimeout)}, opts...)...)
 	}
 	return err
 }
 
 // DeleteClusterAsync deletes the GKE cluster asynchronously.
-func (gsc *sdkClient) DeleteClusterAsync(project, region, zone, clusterName string) (*container.Operation, error) {
+func (gsc *sdkClient) DeleteClusterAsync(ctx context.Context, project, region, zone, clusterName string) (*container.Operation, error) {
 	location := GetClusterLocation(region, zone)
+	var op *container.Operation
+	var err error
 	if zone != "" {
-		return gsc.Projects.Zones.Clusters.Delete(project, location, clusterName).Context(context.Background()).Do()
+		op, err = gsc.Projects.Zones.Clusters.Delete(project, location, clusterName).Context(ctx).Do()
+	} else {
+		clusterFullPath := fmt.Sprintf("projects/%s/locations/%s/clusters/%s", project, location, clusterName)
+		op, err = gsc.Projects.Locations.Clusters.Delete(clusterFullPath).Context(ctx).Do()
 	}
-	clusterFullPath := fmt.Sprintf("projects/%s/locations/%s/clusters/%s", project, location, clusterName)
-	return gsc.Projects.Locations.Clusters.Delete(clusterFullPath).Context(context.Background()).Do()
+	return op, ClassifyError(err)
 }
 
 // GetCluster gets the GKE cluster with the given cluster name.
-func (gsc *sdkClient) GetCluster(project, region, zone, clusterName string) (*container.Cluster, error) {
+func (gsc *sdkClient) GetCluster(ctx context.Context, project, region, zone, clusterName string) (*container.Cluster, error) {
 	location := GetClusterLocation(region, zone)
 	if zone != "" {
-		return gsc.Projects.Zones.Clusters.Get(project, location, clusterName).Context(context.Background()).Do()
+		return gsc.Projects.Zones.Clusters.Get(project, location, clusterName).Context(ctx).Do()
 	}
 	clusterFullPath := fmt.Sprintf("projects/%s/locations/%s/clusters/%s", project, location, clusterName)
-	return gsc.Projects.Locations.Clusters.Get(clusterFullPath).Context(context.Background()).Do()
+	return gsc.Projects.Locations.Clusters.Get(clusterFullPath).Context(ctx).Do()
 }
 
 // ListClustersInProject lists all the GKE clusters created in the given project.
-func (gsc *sdkClient) ListClustersInProject(project string) ([]*container.Cluster, error) {
+func (gsc *sdkClient) ListClustersInProject(ctx context.Context, project string) ([]*container.Cluster, error) {
 	var clusters []*container.Cluster
 	projectFullPath := fmt.Sprintf("projects/%s/locations/-", project)
-	resp, err := gsc.Projects.Locations.Clusters.List(projectFullPath).Do()
+	resp, err := gsc.Projects.Locations.Clusters.List(projectFullPath).Context(ctx).Do()
 	if err != nil {
 		return clusters, fmt.Errorf("failed to list clusters under project %s: %v", project, err)
 	}
@@ -116,11 +144,196 @@ func (gsc *sdkClient) ListClustersInProject(project string) ([]*container.Cluste
 }
 
 // GetOperation gets the operation ref with the given operation name.
-func (gsc *sdkClient) GetOperation(project, region, zone, opName string) (*container.Operation, error) {
+func (gsc *sdkClient) GetOperation(ctx context.Context, project, region, zone, opName string) (*container.Operation, error) {
 	location := GetClusterLocation(region, zone)
 	if zone != "" {
-		return gsc.Service.Projects.Zones.Operations.Get(project, location, opName).Do()
+		return gsc.Service.Projects.Zones.Operations.Get(project, location, opName).Context(ctx).Do()
 	}
 	opsFullPath := fmt.Sprintf("projects/%s/locations/%s/operations/%s", project, location, opName)
-	return gsc.Service.Projects.Locations.Operations.Get(opsFullPath).Do()
+	return gsc.Service.Projects.Locations.Operations.Get(opsFullPath).Context(ctx).Do()
+}
+
+// clusterFullPath returns the full path of a cluster in the locations API,
+// which supports both the regional and the zonal clusters.
+func clusterFullPath(project, region, zone, clusterName string) string {
+	return fmt.Sprintf("projects/%s/locations/%s/clusters/%s", project, GetClusterLocation(region, zone), clusterName)
+}
+
+// nodePoolFullPath returns the full path of a node pool in the locations API.
+func nodePoolFullPath(project, region, zone, clusterName, poolName string) string {
+	return fmt.Sprintf("%s/nodePools/%s", clusterFullPath(project, region, zone, clusterName), poolName)
+}
+
+// CreateNodePool creates a new node pool in the GKE cluster, and wait until it finishes or timeout or there is an error.
+func (gsc *sdkClient) CreateNodePool(
+	ctx context.Context,
+	project, region, zone, clusterName string,
+	req *container.CreateNodePoolRequest,
+	opts ...WaitOption,
+) error {
+	op, err := gsc.CreateNodePoolAsync(ctx, project, region, zone, clusterName, req)
+	if err == nil {
+		err = Wait(ctx, gsc, project, region, zone, op.Name, append([]WaitOption{WithTimeout(nodePoolTimeout)}, opts...)...)
+	}
+	return err
+}
+
+// CreateNodePoolAsync creates a new node pool in the GKE cluster asynchronously.
+func (gsc *sdkClient) CreateNodePoolAsync(
+	ctx context.Context,
+	project, region, zone, clusterName string,
+	req *container.CreateNodePoolRequest,
+) (*container.Operation, error) {
+	parent := clusterFullPath(project, region, zone, clusterName)
+	op, err := gsc.Projects.Locations.Clusters.NodePools.Create(parent, req).Context(ctx).Do()
+	return op, ClassifyError(err)
+}
+
+// DeleteNodePool deletes the node pool of the GKE cluster, and wait until it finishes or timeout or there is an error.
+func (gsc *sdkClient) DeleteNodePool(ctx context.Context, project, region, zone, clusterName, poolName string, opts ...WaitOption) error {
+	op, err := gsc.DeleteNodePoolAsync(ctx, project, region, zone, clusterName, poolName)
+	if err == nil {
+		err = Wait(ctx, gsc, project, region, zone, op.Name, append([]WaitOption{WithTimeout(nodePoolTimeout)}, opts...)...)
+	}
+	return err
+}
+
+// DeleteNodePoolAsync deletes the node pool of the GKE cluster asynchronously.
+func (gsc *sdkClient) DeleteNodePoolAsync(ctx context.Context, project, region, zone, clusterName, poolName string) (*container.Operation, error) {
+	name := nodePoolFullPath(project, region, zone, clusterName, poolName)
+	op, err := gsc.Projects.Locations.Clusters.NodePools.Delete(name).Context(ctx).Do()
+	return op, ClassifyError(err)
+}
+
+// GetNodePool gets the node pool of the GKE cluster with the given node pool name.
+func (gsc *sdkClient) GetNodePool(ctx context.Context, project, region, zone, clusterName, poolName string) (*container.NodePool, error) {
+	name := nodePoolFullPath(project, region, zone, clusterName, poolName)
+	return gsc.Projects.Locations.Clusters.NodePools.Get(name).Context(ctx).Do()
+}
+
+// ResizeNodePool sets the number of nodes of the node pool, and wait until it finishes or timeout or there is an error.
+func (gsc *sdkClient) ResizeNodePool(
+	ctx context.Context,
+	project, region, zone, clusterName, poolName string,
+	nodeCount int64,
+	opts ...WaitOption,
+) error {
+	op, err := gsc.ResizeNodePoolAsync(ctx, project, region, zone, clusterName, poolName, nodeCount)
+	if err == nil {
+		err = Wait(ctx, gsc, project, region, zone, op.Name, append([]WaitOption{WithTimeout(nodePoolTimeout)}, opts...)...)
+	}
+	return err
+}
+
+// ResizeNodePoolAsync sets the number of nodes of the node pool asynchronously.
+func (gsc *sdkClient) ResizeNodePoolAsync(
+	ctx context.Context,
+	project, region, zone, clusterName, poolName string,
+	nodeCount int64,
+) (*container.Operation, error) {
+	name := nodePoolFullPath(project, region, zone, clusterName, poolName)
+	req := &container.SetNodePoolSizeRequest{NodeCount: nodeCount}
+	op, err := gsc.Projects.Locations.Clusters.NodePools.SetSize(name, req).Context(ctx).Do()
+	return op, ClassifyError(err)
+}
+
+// SetNodePoolAutoscaling sets the autoscaling settings of the node pool, and wait until it finishes or timeout or there is an error.
+func (gsc *sdkClient) SetNodePoolAutoscaling(
+	ctx context.Context,
+	project, region, zone, clusterName, poolName string,
+	autoscaling *container.NodePoolAutoscaling,
+	opts ...WaitOption,
+) error {
+	op, err := gsc.SetNodePoolAutoscalingAsync(ctx, project, region, zone, clusterName, poolName, autoscaling)
+	if err == nil {
+		err = Wait(ctx, gsc, project, region, zone, op.Name, append([]WaitOption{WithTimeout(nodePoolTimeout)}, opts...)...)
+	}
+	return err
+}
+
+// SetNodePoolAutoscalingAsync sets the autoscaling settings of the node pool asynchronously.
+func (gsc *sdkClient) SetNodePoolAutoscalingAsync(
+	ctx context.Context,
+	project, region, zone, clusterName, poolName string,
+	autoscaling *container.NodePoolAutoscaling,
+) (*container.Operation, error) {
+	name := nodePoolFullPath(project, region, zone, clusterName, poolName)
+	req := &container.SetNodePoolAutoscalingRequest{Autoscaling: autoscaling}
+	op, err := gsc.Projects.Locations.Clusters.NodePools.SetAutoscaling(name, req).Context(ctx).Do()
+	return op, ClassifyError(err)
+}
+
+// UpgradeMaster upgrades the master of the GKE cluster to the given version,
+// and wait until it finishes or timeout or there is an error.
+func (gsc *sdkClient) UpgradeMaster(ctx context.Context, project, region, zone, clusterName, version string, opts ...WaitOption) error {
+	op, err := gsc.UpgradeMasterAsync(ctx, project, region, zone, clusterName, version)
+	if err == nil {
+		err = Wait(ctx, gsc, project, region, zone, op.Name, append([]WaitOption{WithTimeout(upgradeTimeout)}, opts...)...)
+	}
+	return err
+}
+
+// UpgradeMasterAsync upgrades the master of the GKE cluster to the given version asynchronously.
+func (gsc *sdkClient) UpgradeMasterAsync(ctx context.Context, project, region, zone, clusterName, version string) (*container.Operation, error) {
+	name := clusterFullPath(project, region, zone, clusterName)
+	req := &container.UpdateMasterRequest{MasterVersion: version}
+	op, err := gsc.Projects.Locations.Clusters.UpdateMaster(name, req).Context(ctx).Do()
+	return op, ClassifyError(err)
+}
+
+// SetResourceLabels replaces the GCP labels of the GKE cluster, and wait until it finishes or timeout or there is an error.
+func (gsc *sdkClient) SetResourceLabels(ctx context.Context, project, region, zone, clusterName string, labels map[string]string, opts ...WaitOption) error {
+	op, err := gsc.SetResourceLabelsAsync(ctx, project, region, zone, clusterName, labels)
+	if err == nil {
+		err = Wait(ctx, gsc, project, region, zone, op.Name, append([]WaitOption{WithTimeout(labelsTimeout)}, opts...)...)
+	}
+	return err
+}
+
+// SetResourceLabelsAsync replaces the GCP labels of the GKE cluster asynchronously.
+func (gsc *sdkClient) SetResourceLabelsAsync(ctx context.Context, project, region, zone, clusterName string, labels map[string]string) (*container.Operation, error) {
+	// The fingerprint of the current labels is required by the API, so
+	// that concurrent changes of the labels are not lost.
+	cluster, err := gsc.GetCluster(ctx, project, region, zone, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting cluster %q: %w", clusterName, err)
+	}
+	name := clusterFullPath(project, region, zone, clusterName)
+	req := &container.SetLabelsRequest{ResourceLabels: labels, LabelFingerprint: cluster.LabelFingerprint}
+	op, err := gsc.Projects.Locations.Clusters.SetResourceLabels(name, req).Context(ctx).Do()
+	return op, ClassifyError(err)
+}
+
+// UpgradeNodePool upgrades the nodes of the node pool to the given version,
+// and wait until it finishes or timeout or there is an error.
+func (gsc *sdkClient) UpgradeNodePool(
+	ctx context.Context,
+	project, region, zone, clusterName, poolName, version string,
+	opts ...WaitOption,
+) error {
+	op, err := gsc.UpgradeNodePoolAsync(ctx, project, region, zone, clusterName, poolName, version)
+	if err == nil {
+		err = Wait(ctx, gsc, project, region, zone, op.Name, append([]WaitOption{WithTimeout(upgradeTimeout)}, opts...)...)
+	}
+	return err
+}
+
+// UpgradeNodePoolAsync upgrades the nodes of the node pool to the given version asynchronously.
+func (gsc *sdkClient) UpgradeNodePoolAsync(
+	ctx context.Context,
+	project, region, zone, clusterName, poolName, version string,
+) (*container.Operation, error) {
+	// The image type is required by the API, keep the current one.
+	pool, err := gsc.GetNodePool(ctx, project, region, zone, clusterName, poolName)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting node pool %q: %w", poolName, err)
+	}
+	var imageType string
+	if pool.Config != nil {
+		imageType = pool.Config.ImageType
+	}
+	name := nodePoolFullPath(project, region, zone, clusterName, poolName)
+	req := &container.UpdateNodePoolRequest{NodeVersion: version, ImageType: imageType}
+	op, err := gsc.Projects.Locations.Clusters.NodePools.Update(name, req).Context(ctx).Do()
+	return op, ClassifyError(err)
 }
@@ -0,0 +1,189 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gke
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	container "google.golang.org/api/container/v1beta1"
+	"knative.dev/test-infra/pkg/failure"
+)
+
+// Errors the GKE operations can be checked against with errors.Is, so that
+// callers don't need to match error messages. They also carry their class of
+// failure, see failure.Classified.
+var (
+	// ErrTimeout is returned when an operation isn't done before the timeout
+	ErrTimeout error = &kindError{"timed out waiting for the operation", failure.ClassUnknown}
+	// ErrQuotaExceeded is returned when the project doesn't have enough quota
+	// in the location
+	ErrQuotaExceeded error = &kindError{"quota exceeded", failure.ClassQuota}
+	// ErrStockout is returned when the location doesn't have enough resources,
+	// retrying in another location usually works
+	ErrStockout error = &kindError{"not enough resources available in the location", failure.ClassStockout}
+	// ErrInvalidVersion is returned when the requested GKE version is invalid,
+	// or not available in the location yet
+	ErrInvalidVersion error = &kindError{"invalid or unsupported version", failure.ClassUnsupportedVersion}
+	// ErrOperationFailed is returned when an operation failed for another reason
+	ErrOperationFailed error = &kindError{"operation failed", failure.ClassUnknown}
+)
+
+// kindError is a kind of error of the GKE operations
+type kindError struct {
+	msg   string
+	class failure.Class
+}
+
+func (e *kindError) Error() string {
+	return e.msg
+}
+
+// FailureClass returns the class of failure of the kind of error
+func (e *kindError) FailureClass() failure.Class {
+	return e.class
+}
+
+// StatusCondition codes of GKE, see
+// https://cloud.google.com/kubernetes-engine/docs/reference/rest/v1beta1/StatusCondition
+const (
+	conditionStockout      = "GCE_STOCKOUT"
+	conditionQuotaExceeded = "GCE_QUOTA_EXCEEDED"
+)
+
+// classErrors are the kinds of error of the classes of failure, the error
+// messages are classified with the default failure classes
+var classErrors = map[failure.Class]error{
+	failure.ClassQuota:              ErrQuotaExceeded,
+	failure.ClassStockout:           ErrStockout,
+	failure.ClassNodeRegistration:   ErrStockout,
+	failure.ClassUnsupportedVersion: ErrInvalidVersion,
+}
+
+var classifier = failure.Default()
+
+// OperationError is returned when an operation failed or timed out, it
+// matches one of the errors above with errors.Is
+type OperationError struct {
+	// Name and Type are the name and the type of the operation, e.g. CREATE_CLUSTER
+	Name string
+	Type string
+	// Status and Message are the last status and status message of the operation
+	Status  string
+	Message string
+	// Progress is the last progress of the operation, see Progress
+	Progress int
+	// Err is one of the errors above
+	Err error
+}
+
+func (e *OperationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("operation ")
+	if e.Type != "" {
+		sb.WriteString(e.Type + " ")
+	}
+	fmt.Fprintf(&sb, "%q: %v", e.Name, e.Err)
+	if e.Status != "" {
+		fmt.Fprintf(&sb, ", last status %s", e.Status)
+		if e.Progress >= 0 {
+			fmt.Fprintf(&sb, " (%d%%)", e.Progress)
+		}
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&sb, ": %s", e.Message)
+	}
+	return sb.String()
+}
+
+// Unwrap returns the kind of error, e.g. ErrTimeout
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// newOperationError returns the error of a done operation, nil if it succeeded.
+// Operations that succeeded can still have a status message, e.g. a warning, so
+// it's only an error if a condition or a message is classified as a failure.
+func newOperationError(op *container.Operation) error {
+	var err error
+	messages := []string{op.StatusMessage}
+	for _, c := range op.ClusterConditions {
+		switch c.Code {
+		case conditionStockout:
+			err = ErrStockout
+		case conditionQuotaExceeded:
+			err = ErrQuotaExceeded
+		}
+		messages = append(messages, c.Message)
+	}
+	if err == nil {
+		for _, m := range messages {
+			if class := classifier.ClassifyMessage(m); m != "" && class != failure.ClassUnknown {
+				if err = classErrors[class]; err == nil {
+					err = ErrOperationFailed
+				}
+				break
+			}
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	message := op.StatusMessage
+	if message == "" {
+		message = op.ClusterConditions[0].Message
+	}
+	return &OperationError{
+		Name:     op.Name,
+		Type:     op.OperationType,
+		Status:   op.Status,
+		Message:  message,
+		Progress: progressPercent(op),
+		Err:      err,
+	}
+}
+
+// classifyMessage returns the kind of error of an error message, nil if unknown
+func classifyMessage(msg string) error {
+	return classErrors[classifier.ClassifyMessage(msg)]
+}
+
+// ClassifyError wraps err with the kind of error its message matches, so that
+// it can be checked with errors.Is, e.g. errors.Is(err, ErrStockout).
+// err is returned as is if it's nil or its kind is unknown.
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, kind := range []error{ErrTimeout, ErrQuotaExceeded, ErrStockout, ErrInvalidVersion, ErrOperationFailed} {
+		if errors.Is(err, kind) {
+			return err
+		}
+	}
+	if kind := classifyMessage(err.Error()); kind != nil {
+		return fmt.Errorf("%w: %v", kind, err)
+	}
+	return err
+}
+
+// IsRetryableCreationError checks if creating a cluster in another location
+// could succeed after this error
+func IsRetryableCreationError(err error) bool {
+	err = ClassifyError(err)
+	return errors.Is(err, ErrStockout) || errors.Is(err, ErrInvalidVersion)
+}
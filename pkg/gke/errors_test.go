@@ -0,0 +1,70 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gke
+
+import (
+	"errors"
+	"testing"
+
+	"knative.dev/test-infra/pkg/failure"
+)
+
+func TestClassifyError(t *testing.T) {
+	datas := []struct {
+		err       error
+		want      error
+		retryable bool
+	}{
+		{nil, nil, false},
+		{errors.New("some error"), nil, false},
+		{errors.New("Quota exceeded for quota metric 'CPUS'"), ErrQuotaExceeded, false},
+		{errors.New("does not have enough resources available to fulfill the request"), ErrStockout, true},
+		{errors.New(`Master version "1.99.0-gke.1" is unsupported.`), ErrInvalidVersion, true},
+		{errors.New(`No valid versions with the prefix "1.99" found.`), ErrInvalidVersion, true},
+		{&OperationError{Name: "op", Err: ErrTimeout}, ErrTimeout, false},
+	}
+	for _, data := range datas {
+		err := ClassifyError(data.err)
+		if data.want == nil {
+			if err != data.err {
+				t.Errorf("Expected '%v' to be returned as is, but got '%v'", data.err, err)
+			}
+		} else if !errors.Is(err, data.want) {
+			t.Errorf("Expected '%v' to be classified as '%v', but got '%v'", data.err, data.want, err)
+		}
+		if got := IsRetryableCreationError(data.err); got != data.retryable {
+			t.Errorf("Expected '%v' to be retryable: %v, but got %v", data.err, data.retryable, got)
+		}
+	}
+}
+
+func TestFailureClass(t *testing.T) {
+	datas := []struct {
+		err  error
+		want failure.Class
+	}{
+		{&OperationError{Name: "op", Err: ErrStockout}, failure.ClassStockout},
+		{&OperationError{Name: "op", Err: ErrStockout, Message: "only 1 nodes out of 3 have registered"}, failure.ClassNodeRegistration},
+		{ClassifyError(errors.New("Quota exceeded for quota metric 'CPUS'")), failure.ClassQuota},
+		{&OperationError{Name: "op", Err: ErrTimeout}, failure.ClassUnknown},
+	}
+	for _, data := range datas {
+		if got := failure.Default().Classify(data.err); got != data.want {
+			t.Errorf("Expected '%v' to be classified as %q, but got %q", data.err, data.want, got)
+		}
+	}
+}
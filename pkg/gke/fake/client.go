@@ -17,9 +17,9 @@ limitations under the License.
 package fake
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -36,68 +36,79 @@ var (
 )
 
 // GKESDKClient is a fake client for unit tests.
+// The operations are DONE immediately by default, see SetLifecycle to make
+// them progress with a clock, and InjectFault, SetCapacity and SetQuota to
+// make them fail.
 type GKESDKClient struct {
 	// map of parent: clusters slice
 	clusters map[string][]*container.Cluster
 	// map of operationID: operation
-	ops map[string]*container.Operation
+	ops map[string]*operation
+	// opNames are the names of the operations in the order they were started
+	opNames []string
 
 	// An incremental number for new ops
 	opNumber int
-	// A lookup table for determining ops statuses
+	// A lookup table for forcing ops statuses, e.g.
+	// fgsc.OpStatus[strconv.Itoa(opNumber)] = "PENDING" makes this operation
+	// pending forever
 	OpStatus map[string]string
 
+	lifecycle Lifecycle
+	// map of region: number of nodes available
+	capacity map[string]int64
+	// map of project/region: number of nodes allowed
+	quota  map[string]int64
+	faults []*Fault
+	calls  []Call
+
 	mutex sync.Mutex
 }
 
 // NewGKESDKClient returns a new fake gkeSDKClient that can be used in unit tests.
 func NewGKESDKClient() *GKESDKClient {
 	return &GKESDKClient{
-		clusters: make(map[string][]*container.Cluster),
-		ops:      make(map[string]*container.Operation),
-		OpStatus: make(map[string]string),
+		clusters:  make(map[string][]*container.Cluster),
+		ops:       make(map[string]*operation),
+		OpStatus:  make(map[string]string),
+		lifecycle: Lifecycle{Clock: realClock{}},
+		capacity:  make(map[string]int64),
+		quota:     make(map[string]int64),
 	}
 }
 
-// automatically registers new ops, and mark it "DONE" by default. Update
-// fgsc.opStatus by fgsc.opStatus[string(fgsc.opNumber+1)]="PENDING" to make the
-// next operation pending
-func (fgsc *GKESDKClient) newOp() *container.Operation {
-	opName := strconv.Itoa(fgsc.opNumber)
-	op := &container.Operation{
-		Name:   opName,
-		Status: "DONE",
-	}
-	if status, ok := fgsc.OpStatus[opName]; ok {
-		op.Status = status
-	}
-	fgsc.opNumber++
-	fgsc.ops[opName] = op
-	return op
-}
-
 // CreateCluster creates a new cluster, and wait until it finishes or timeout or there is an error.
 func (fgsc *GKESDKClient) CreateCluster(
+	ctx context.Context,
 	project, region, zone string,
 	rb *container.CreateClusterRequest,
+	opts ...gke.WaitOption,
 ) error {
-	op, err := fgsc.CreateClusterAsync(project, region, zone, rb)
+	op, err := fgsc.CreateClusterAsync(ctx, project, region, zone, rb)
 	if err == nil {
-		err = gke.Wait(fgsc, project, region, zone, op.Name, CreationTimeout)
+		err = gke.Wait(ctx, fgsc, project, region, zone, op.Name, append([]gke.WaitOption{gke.WithTimeout(CreationTimeout)}, opts...)...)
 	}
 	return err
 }
 
 // CreateClusterAsync creates a new cluster asynchronously.
+// The cluster is PROVISIONING until the operation is done, and ERROR if the
+// operation failed.
 func (fgsc *GKESDKClient) CreateClusterAsync(
+	ctx context.Context,
 	project, region, zone string,
 	rb *container.CreateClusterRequest,
-) (*container.Operation, error) {
+) (op *container.Operation, err error) {
 	fgsc.mutex.Lock()
 	defer fgsc.mutex.Unlock()
+	fgsc.advanceAll()
 	location := gke.GetClusterLocation(region, zone)
 	parent := fmt.Sprintf("projects/%s/locations/%s", project, location)
 	name := rb.Cluster.Name
+	defer func() {
+		fgsc.record(Call{Method: MethodCreateCluster, Project: project, Location: location, Cluster: name}, op, err)
+	}()
+
 	if cls, ok := fgsc.clusters[parent]; ok {
 		for _, cl := range cls {
 			if cl.Name == name {
@@ -107,81 +118,134 @@ func (fgsc *GKESDKClient) CreateClusterAsync(
 	} else {
 		fgsc.clusters[parent] = make([]*container.Cluster, 0)
 	}
-	cluster := &container.Cluster{
-		Name:         name,
-		Location:     location,
-		Status:       "RUNNING",
-		AddonsConfig: rb.Cluster.AddonsConfig,
-		NodePools:    rb.Cluster.NodePools,
+	pools := make(map[string]bool, len(rb.Cluster.NodePools))
+	for _, np := range rb.Cluster.NodePools {
+		if pools[np.Name] {
+			return nil, fmt.Errorf("node pool %q already exist", np.Name)
+		}
+		pools[np.Name] = true
 	}
-	if rb.Cluster.NodePools != nil {
-		cluster.NodePools = rb.Cluster.NodePools
+	if rb.Cluster.PrivateClusterConfig != nil && rb.Cluster.PrivateClusterConfig.EnablePrivateNodes &&
+		(rb.Cluster.IpAllocationPolicy == nil || !rb.Cluster.IpAllocationPolicy.UseIpAliases) {
+		return nil, errors.New("private clusters must be VPC-native")
+	}
+	cluster := &container.Cluster{
+		Name:                 name,
+		Location:             location,
+		Status:               "PROVISIONING",
+		AddonsConfig:         rb.Cluster.AddonsConfig,
+		NodePools:            rb.Cluster.NodePools,
+		Network:              rb.Cluster.Network,
+		Subnetwork:           rb.Cluster.Subnetwork,
+		PrivateClusterConfig: rb.Cluster.PrivateClusterConfig,
+		IpAllocationPolicy:   rb.Cluster.IpAllocationPolicy,
+
+		ResourceLabels:         rb.Cluster.ResourceLabels,
+		WorkloadIdentityConfig: rb.Cluster.WorkloadIdentityConfig,
+		ReleaseChannel:         rb.Cluster.ReleaseChannel,
+		InitialClusterVersion:  rb.Cluster.InitialClusterVersion,
 	}
 	if rb.Cluster.MasterAuth != nil {
 		cluster.MasterAuth = &container.MasterAuth{
 			Username: rb.Cluster.MasterAuth.Username,
 		}
 	}
+	fault, err := fgsc.checkCall(MethodCreateCluster, region, clusterLink(project, location, name))
+	if err != nil {
+		return nil, err
+	}
+	if err := fgsc.checkQuota(project, region, clusterNodes(cluster)); err != nil {
+		return nil, err
+	}
 
 	fgsc.clusters[parent] = append(fgsc.clusters[parent], cluster)
-	return fgsc.newOp(), nil
+	return fgsc.startOp("CREATE_CLUSTER", clusterLink(project, location, name), clusterLink(project, location, name), func() (string, string) {
+		if fault != nil {
+			cluster.Status = "ERROR"
+			cluster.StatusMessage = fault.Message
+			return fault.Message, fault.Code
+		}
+		if !fgsc.hasCapacity(region, cluster) {
+			message, code := stockout(location)
+			cluster.Status = "ERROR"
+			cluster.StatusMessage = message
+			return message, code
+		}
+		cluster.Status = "RUNNING"
+		return "", ""
+	}), nil
 }
 
 // DeleteCluster deletes the cluster, and wait until it finishes or timeout or there is an error.
 func (fgsc *GKESDKClient) DeleteCluster(
+	ctx context.Context,
 	project, region, zone, clusterName string,
+	opts ...gke.WaitOption,
 ) error {
-	op, err := fgsc.DeleteClusterAsync(project, region, zone, clusterName)
+	op, err := fgsc.DeleteClusterAsync(ctx, project, region, zone, clusterName)
 	if err == nil {
-		err = gke.Wait(fgsc, project, region, zone, op.Name, DeletionTimeout)
+		err = gke.Wait(ctx, fgsc, project, region, zone, op.Name, append([]gke.WaitOption{gke.WithTimeout(DeletionTimeout)}, opts...)...)
 	}
 	return err
 }
 
 // DeleteClusterAsync deletes the cluster asynchronously.
+// The cluster is STOPPING until the operation is done.
 func (fgsc *GKESDKClient) DeleteClusterAsync(
+	ctx context.Context,
 	project, region, zone, clusterName string,
-) (*container.Operation, error) {
+) (op *container.Operation, err error) {
 	fgsc.mutex.Lock()
 	defer fgsc.mutex.Unlock()
+	fgsc.advanceAll()
 	location := gke.GetClusterLocation(region, zone)
 	parent := fmt.Sprintf("projects/%s/locations/%s", project, location)
-	found := -1
-	if clusters, ok := fgsc.clusters[parent]; ok {
-		for i, cluster := range clusters {
-			if cluster.Name == clusterName {
-				found = i
-			}
-		}
-	}
-	if found == -1 {
+	defer func() {
+		fgsc.record(Call{Method: MethodDeleteCluster, Project: project, Location: location, Cluster: clusterName}, op, err)
+	}()
+
+	cluster, err := fgsc.findCluster(project, region, zone, clusterName)
+	if err != nil {
 		return nil, fmt.Errorf("cluster %q not found for deletion", clusterName)
 	}
-	// Delete this cluster
-	fgsc.clusters[parent] = append(fgsc.clusters[parent][:found], fgsc.clusters[parent][found+1:]...)
-	return fgsc.newOp(), nil
+	fault, err := fgsc.checkCall(MethodDeleteCluster, region, clusterLink(project, location, clusterName))
+	if err != nil {
+		return nil, err
+	}
+	status := cluster.Status
+	cluster.Status = "STOPPING"
+	return fgsc.startOp("DELETE_CLUSTER", clusterLink(project, location, clusterName), clusterLink(project, location, clusterName), func() (string, string) {
+		if fault != nil {
+			cluster.Status = status
+			return fault.Message, fault.Code
+		}
+		for i, cl := range fgsc.clusters[parent] {
+			if cl == cluster {
+				fgsc.clusters[parent] = append(fgsc.clusters[parent][:i], fgsc.clusters[parent][i+1:]...)
+				break
+			}
+		}
+		return "", ""
+	}), nil
 }
 
 // GetCluster gets the cluster with the given settings.
-func (fgsc *GKESDKClient) GetCluster(project, region, zone, cluster string) (*container.Cluster, error) {
+func (fgsc *GKESDKClient) GetCluster(ctx context.Context, project, region, zone, cluster string) (*container.Cluster, error) {
 	fgsc.mutex.Lock()
 	defer fgsc.mutex.Unlock()
-	location := gke.GetClusterLocation(region, zone)
-	parent := fmt.Sprintf("projects/%s/locations/%s", project, location)
-	if cls, ok := fgsc.clusters[parent]; ok {
-		for _, cl := range cls {
-			if cl.Name == cluster {
-				return cl, nil
-			}
-		}
+	fgsc.advanceAll()
+	cl, err := fgsc.findCluster(project, region, zone, cluster)
+	if err != nil {
+		return nil, fmt.Errorf("cluster not found")
 	}
-	return nil, fmt.Errorf("cluster not found")
+	return cl, nil
 }
 
 // ListClustersInProject lists all the GKE clusters created in the given project.
-func (fgsc *GKESDKClient) ListClustersInProject(project string) ([]*container.Cluster, error) {
+func (fgsc *GKESDKClient) ListClustersInProject(ctx context.Context, project string) ([]*container.Cluster, error) {
 	fgsc.mutex.Lock()
 	defer fgsc.mutex.Unlock()
+	fgsc.advanceAll()
 	allClusters := make([]*container.Cluster, 0)
 	projectPath := fmt.Sprintf("projects/%s", project)
 	for location, cls := range fgsc.clusters {
@@ -194,12 +258,92 @@ func (fgsc *GKESDKClient) ListClustersInProject(project string) ([]*container.Cl
 }
 
 // GetOperation gets the operation with the given settings.
-func (fgsc *GKESDKClient) GetOperation(project, region, zone, opName string) (*container.Operation, error) {
+func (fgsc *GKESDKClient) GetOperation(ctx context.Context, project, region, zone, opName string) (*container.Operation, error) {
 	fgsc.mutex.Lock()
-	op, ok := fgsc.ops[opName]
-	fgsc.mutex.Unlock()
-	if ok {
-		return op, nil
+	defer fgsc.mutex.Unlock()
+	if c, ok := fgsc.lifecycle.Clock.(*FakeClock); ok && fgsc.lifecycle.PollAdvance > 0 {
+		c.Advance(fgsc.lifecycle.PollAdvance)
+	}
+	fgsc.advanceAll()
+	if o, ok := fgsc.ops[opName]; ok {
+		return copyOp(o.op), nil
 	}
 	return nil, errors.New(opName + " operation not found")
 }
+
+// SetResourceLabels replaces the GCP labels of the cluster, and wait until it finishes or timeout or there is an error.
+func (fgsc *GKESDKClient) SetResourceLabels(
+	ctx context.Context,
+	project, region, zone, clusterName string,
+	labels map[string]string,
+	opts ...gke.WaitOption,
+) error {
+	op, err := fgsc.SetResourceLabelsAsync(ctx, project, region, zone, clusterName, labels)
+	if err == nil {
+		err = gke.Wait(ctx, fgsc, project, region, zone, op.Name, append([]gke.WaitOption{gke.WithTimeout(CreationTimeout)}, opts...)...)
+	}
+	return err
+}
+
+// SetResourceLabelsAsync replaces the GCP labels of the cluster asynchronously.
+func (fgsc *GKESDKClient) SetResourceLabelsAsync(
+	ctx context.Context,
+	project, region, zone, clusterName string,
+	labels map[string]string,
+) (op *container.Operation, err error) {
+	fgsc.mutex.Lock()
+	defer fgsc.mutex.Unlock()
+	fgsc.advanceAll()
+	location := gke.GetClusterLocation(region, zone)
+	defer func() {
+		fgsc.record(Call{Method: MethodSetResourceLabels, Project: project, Location: location, Cluster: clusterName}, op, err)
+	}()
+
+	cluster, err := fgsc.findCluster(project, region, zone, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	fault, err := fgsc.checkCall(MethodSetResourceLabels, region, clusterLink(project, location, clusterName))
+	if err != nil {
+		return nil, err
+	}
+	return fgsc.startOp("SET_LABELS", clusterLink(project, location, clusterName), clusterLink(project, location, clusterName), func() (string, string) {
+		if fault != nil {
+			return fault.Message, fault.Code
+		}
+		cluster.ResourceLabels = labels
+		return "", ""
+	}), nil
+}
+
+// findCluster returns the cluster with the given settings, the caller must hold the mutex
+func (fgsc *GKESDKClient) findCluster(project, region, zone, clusterName string) (*container.Cluster, error) {
+	location := gke.GetClusterLocation(region, zone)
+	parent := fmt.Sprintf("projects/%s/locations/%s", project, location)
+	for _, cl := range fgsc.clusters[parent] {
+		if cl.Name == clusterName {
+			return cl, nil
+		}
+	}
+	return nil, fmt.Errorf("cluster %q not found", clusterName)
+}
+
+// findNodePool returns the index of the node pool in the cluster with the
+// given settings, the caller must hold the mutex
+func (fgsc *GKESDKClient) findNodePool(project, region, zone, clusterName, poolName string) (*container.Cluster, int, error) {
+	cluster, err := fgsc.findCluster(project, region, zone, clusterName)
+	if err != nil {
+		return nil, -1, err
+	}
+	for i, np := range cluster.NodePools {
+		if np.Name == poolName {
+			return cluster, i, nil
+		}
+	}
+	return nil, -1, fmt.Errorf("node pool %q not found in cluster %q", poolName, clusterName)
+}
+
+// clusterLink returns the target link of the operations on a cluster
+func clusterLink(project, location, clusterName string) string {
+	return fmt.Sprintf("projects/%s/locations/%s/clusters/%s", project, location, clusterName)
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	container "google.golang.org/api/container/v1beta1"
+	"knative.dev/test-infra/pkg/gke"
+)
+
+func TestCreateClusterNodePools(t *testing.T) {
+	ctx := context.Background()
+	fgsc := NewGKESDKClient()
+	rb, err := gke.NewCreateClusterRequest(&gke.Request{
+		Project:     "project-a",
+		ClusterName: "name-a",
+		NodePools: []gke.NodePool{{
+			Name:     "system",
+			MinNodes: 1,
+			MaxNodes: 1,
+			NodeType: "e2-standard-4",
+			Taints:   []gke.Taint{{Key: "dedicated", Value: "system", Effect: gke.TaintEffectNoSchedule}},
+		}, {
+			Name:     "spot",
+			MinNodes: 0,
+			MaxNodes: 10,
+			NodeType: "e2-standard-8",
+			Spot:     true,
+		}},
+		Network:            "network-a",
+		EnablePrivateNodes: true,
+		MasterIPv4CIDR:     "172.16.0.32/28",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if err := fgsc.CreateCluster(ctx, "project-a", "us-central1", "", rb); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	cluster, err := fgsc.GetCluster(ctx, "project-a", "us-central1", "", "name-a")
+	if err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if len(cluster.NodePools) != 2 || cluster.NodePools[0].Name != "system" || !cluster.NodePools[1].Config.Preemptible {
+		t.Errorf("Expected node pools 'system' and spot 'spot', but got %+v", cluster.NodePools)
+	}
+	if cluster.Network != "network-a" || cluster.PrivateClusterConfig == nil || !cluster.PrivateClusterConfig.EnablePrivateNodes {
+		t.Errorf("Expected a private cluster in 'network-a', but got network %q and private config %+v", cluster.Network, cluster.PrivateClusterConfig)
+	}
+
+	// The fake rejects the requests GKE would reject.
+	rb.Cluster.Name = "name-b"
+	rb.Cluster.NodePools = append(rb.Cluster.NodePools, &container.NodePool{Name: "spot"})
+	if err := fgsc.CreateCluster(ctx, "project-a", "us-central1", "", rb); err == nil {
+		t.Error("Expected an error creating a cluster with duplicated node pools, but got nil")
+	}
+	rb.Cluster.NodePools = rb.Cluster.NodePools[:2]
+	rb.Cluster.IpAllocationPolicy = nil
+	if err := fgsc.CreateCluster(ctx, "project-a", "us-central1", "", rb); err == nil {
+		t.Error("Expected an error creating a private cluster that isn't VPC-native, but got nil")
+	}
+}
+
+func TestNodePoolOperations(t *testing.T) {
+	ctx := context.Background()
+	fgsc := NewGKESDKClient()
+	rb, _ := gke.NewCreateClusterRequest(&gke.Request{
+		ClusterName: "name-a",
+		MinNodes:    1,
+		MaxNodes:    3,
+		NodeType:    "e2-standard-4",
+	})
+	if err := fgsc.CreateCluster(ctx, "project-a", "us-central1", "", rb); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+
+	npr, err := gke.NewCreateNodePoolRequest(gke.NodePool{Name: "spot", MinNodes: 0, MaxNodes: 5, NodeType: "e2-standard-8", Spot: true}, "")
+	if err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if err := fgsc.CreateNodePool(ctx, "project-a", "us-central1", "", "name-a", npr); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if err := fgsc.CreateNodePool(ctx, "project-a", "us-central1", "", "name-a", npr); err == nil {
+		t.Error("Expected an error creating an existing node pool, but got nil")
+	}
+	if err := fgsc.ResizeNodePool(ctx, "project-a", "us-central1", "", "name-a", "spot", 2); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	autoscaling := &container.NodePoolAutoscaling{Enabled: true, MinNodeCount: 1, MaxNodeCount: 10}
+	if err := fgsc.SetNodePoolAutoscaling(ctx, "project-a", "us-central1", "", "name-a", "spot", autoscaling); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	np, err := fgsc.GetNodePool(ctx, "project-a", "us-central1", "", "name-a", "spot")
+	if err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if np.InitialNodeCount != 2 || np.Autoscaling.MaxNodeCount != 10 || !np.Config.Preemptible {
+		t.Errorf("Expected a spot node pool of 2 nodes autoscaled up to 10, but got %+v", np)
+	}
+
+	// The nodes are upgraded after the master, and the master cannot be downgraded.
+	if err := fgsc.UpgradeNodePool(ctx, "project-a", "us-central1", "", "name-a", "spot", "1.17.9-gke.1504"); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if err := fgsc.UpgradeMaster(ctx, "project-a", "us-central1", "", "name-a", "1.16.13-gke.401"); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if err := fgsc.UpgradeNodePool(ctx, "project-a", "us-central1", "", "name-a", "spot", "1.17.9-gke.1504"); !errors.Is(err, gke.ErrInvalidVersion) {
+		t.Errorf("Expected error '%v', but got '%v'", gke.ErrInvalidVersion, err)
+	}
+	if err := fgsc.UpgradeNodePool(ctx, "project-a", "us-central1", "", "name-a", "spot", "-"); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if np.Version != "1.16.13-gke.401" {
+		t.Errorf("Expected node version '1.16.13-gke.401', but got %q", np.Version)
+	}
+	if err := fgsc.UpgradeMaster(ctx, "project-a", "us-central1", "", "name-a", "1.16.9-gke.2"); !errors.Is(err, gke.ErrInvalidVersion) {
+		t.Errorf("Expected error '%v', but got '%v'", gke.ErrInvalidVersion, err)
+	}
+
+	labels := map[string]string{"team": "serving"}
+	if err := fgsc.SetResourceLabels(ctx, "project-a", "us-central1", "", "name-a", labels); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if cluster, _ := fgsc.GetCluster(ctx, "project-a", "us-central1", "", "name-a"); !reflect.DeepEqual(cluster.ResourceLabels, labels) {
+		t.Errorf("Expected labels %v, but got %v", labels, cluster.ResourceLabels)
+	}
+
+	if err := fgsc.DeleteNodePool(ctx, "project-a", "us-central1", "", "name-a", "spot"); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if _, err := fgsc.GetNodePool(ctx, "project-a", "us-central1", "", "name-a", "spot"); err == nil {
+		t.Error("Expected an error getting a deleted node pool, but got nil")
+	}
+	if err := fgsc.DeleteNodePool(ctx, "project-a", "us-central1", "", "name-a", "default-pool"); err == nil {
+		t.Error("Expected an error deleting the last node pool, but got nil")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	datas := []struct {
+		a, b string
+		want int
+	}{
+		{"1.17.9-gke.1504", "1.17.9-gke.1504", 0},
+		{"1.16.13-gke.401", "1.17.9-gke.1504", -1},
+		{"1.17.9-gke.1504", "1.17.9-gke.600", 1},
+		{"1.17", "1.17.9-gke.1504", -1},
+		{"latest", "1.17.9-gke.1504", 1},
+		{"", "1.16", -1},
+	}
+	for _, data := range datas {
+		got := compareVersions(data.a, data.b)
+		if (got > 0) != (data.want > 0) || (got < 0) != (data.want < 0) {
+			t.Errorf("Expected compareVersions(%q, %q) to be %d, but got %d", data.a, data.b, data.want, got)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// faults.go makes the calls and the operations of the fake client fail like
+// GKE does, and records the calls so that tests can assert on them
+
+package fake
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	container "google.golang.org/api/container/v1beta1"
+	"knative.dev/test-infra/pkg/gke"
+)
+
+// Method is a method of the fake client starting an operation
+type Method string
+
+// The methods of the fake client starting an operation, the synchronous
+// methods call their asynchronous variant
+const (
+	MethodCreateCluster          = Method("CreateCluster")
+	MethodDeleteCluster          = Method("DeleteCluster")
+	MethodCreateNodePool         = Method("CreateNodePool")
+	MethodDeleteNodePool         = Method("DeleteNodePool")
+	MethodResizeNodePool         = Method("ResizeNodePool")
+	MethodSetNodePoolAutoscaling = Method("SetNodePoolAutoscaling")
+	MethodUpgradeMaster          = Method("UpgradeMaster")
+	MethodUpgradeNodePool        = Method("UpgradeNodePool")
+	MethodSetResourceLabels      = Method("SetResourceLabels")
+)
+
+// Condition codes of the failed operations, see
+// https://cloud.google.com/kubernetes-engine/docs/reference/rest/v1beta1/StatusCondition
+const (
+	CodeStockout      = "GCE_STOCKOUT"
+	CodeQuotaExceeded = "GCE_QUOTA_EXCEEDED"
+)
+
+// Fault makes the matching calls or operations fail. For example, to fail
+// creating clusters in us-central1 because the version isn't available yet:
+//
+//	fgsc.InjectFault(Fault{
+//		Method:  MethodCreateCluster,
+//		Region:  "us-central1",
+//		Message: `Master version "1.99.0-gke.1" is unsupported.`,
+//	})
+type Fault struct {
+	// Method matches the calls of this method, all the methods if empty
+	Method Method
+	// Region matches the calls in this region, all the regions if empty
+	Region string
+	// Message is the error message, e.g. one of the error messages GKE returns
+	Message string
+	// Code is the condition code of the failed operation, e.g. CodeStockout
+	Code string
+	// Sync makes the call itself fail instead of the operation it starts
+	Sync bool
+	// Times is the number of matching calls the fault applies to before it's
+	// removed, 0 means forever
+	Times int
+}
+
+// Call is a call to a method of the fake client starting an operation
+type Call struct {
+	Method   Method
+	Project  string
+	Location string
+	Cluster  string
+	// NodePool is the node pool of the node pool methods
+	NodePool string
+	// Operation is the name of the operation started, empty if the call failed
+	Operation string
+	Err       error
+}
+
+// InjectFault adds a fault, the first fault matching a call applies
+func (fgsc *GKESDKClient) InjectFault(f Fault) {
+	fgsc.mutex.Lock()
+	defer fgsc.mutex.Unlock()
+	fgsc.faults = append(fgsc.faults, &f)
+}
+
+// ClearFaults removes all the faults
+func (fgsc *GKESDKClient) ClearFaults() {
+	fgsc.mutex.Lock()
+	defer fgsc.mutex.Unlock()
+	fgsc.faults = nil
+}
+
+// SetCapacity sets the number of nodes available in the region. Creating
+// clusters or node pools over the capacity fails with a stockout once the
+// operation is done, like GKE does. The capacity is unlimited by default.
+func (fgsc *GKESDKClient) SetCapacity(region string, nodes int64) {
+	fgsc.mutex.Lock()
+	defer fgsc.mutex.Unlock()
+	fgsc.capacity[region] = nodes
+}
+
+// SetQuota sets the number of nodes the project can have in the region.
+// Creating clusters or node pools over the quota fails immediately, like GKE
+// does. The quota is unlimited by default.
+func (fgsc *GKESDKClient) SetQuota(project, region string, nodes int64) {
+	fgsc.mutex.Lock()
+	defer fgsc.mutex.Unlock()
+	fgsc.quota[project+"/"+region] = nodes
+}
+
+// Calls returns the calls starting an operation made to the client, in order
+func (fgsc *GKESDKClient) Calls() []Call {
+	fgsc.mutex.Lock()
+	defer fgsc.mutex.Unlock()
+	return append([]Call(nil), fgsc.calls...)
+}
+
+// ClearCalls clears the journal of calls
+func (fgsc *GKESDKClient) ClearCalls() {
+	fgsc.mutex.Lock()
+	defer fgsc.mutex.Unlock()
+	fgsc.calls = nil
+}
+
+// Operations returns the current state of all the operations, in order
+func (fgsc *GKESDKClient) Operations() []*container.Operation {
+	fgsc.mutex.Lock()
+	defer fgsc.mutex.Unlock()
+	fgsc.advanceAll()
+	ops := make([]*container.Operation, 0, len(fgsc.opNames))
+	for _, name := range fgsc.opNames {
+		ops = append(ops, copyOp(fgsc.ops[name].op))
+	}
+	return ops
+}
+
+// Clusters returns the names of the clusters in each location, keyed by
+// "projects/PROJECT/locations/LOCATION"
+func (fgsc *GKESDKClient) Clusters() map[string][]string {
+	fgsc.mutex.Lock()
+	defer fgsc.mutex.Unlock()
+	fgsc.advanceAll()
+	clusters := make(map[string][]string, len(fgsc.clusters))
+	for parent, cls := range fgsc.clusters {
+		for _, cl := range cls {
+			clusters[parent] = append(clusters[parent], cl.Name)
+		}
+	}
+	return clusters
+}
+
+// record records a call and its result. The caller must hold the mutex.
+func (fgsc *GKESDKClient) record(call Call, op *container.Operation, err error) {
+	if op != nil {
+		call.Operation = op.Name
+	}
+	call.Err = err
+	fgsc.calls = append(fgsc.calls, call)
+}
+
+// fault returns the first fault matching a call, nil if none. The caller must
+// hold the mutex.
+func (fgsc *GKESDKClient) fault(method Method, region string) *Fault {
+	for i, f := range fgsc.faults {
+		if (f.Method != "" && f.Method != method) || (f.Region != "" && f.Region != region) {
+			continue
+		}
+		if f.Times > 0 {
+			if f.Times--; f.Times == 0 {
+				fgsc.faults = append(fgsc.faults[:i], fgsc.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// checkCall checks the faults and the conflicting operations before starting
+// an operation on a cluster. It returns the fault to apply to the operation
+// once it's done, if any. The caller must hold the mutex.
+func (fgsc *GKESDKClient) checkCall(method Method, region, cluster string) (*Fault, error) {
+	f := fgsc.fault(method, region)
+	if f != nil && f.Sync {
+		return nil, gke.ClassifyError(errors.New(f.Message))
+	}
+	// GKE allows deleting a cluster while another operation is running on it.
+	if method != MethodDeleteCluster {
+		if op := fgsc.inProgress(cluster); op != nil {
+			return nil, fmt.Errorf("operation %s is already in progress on cluster %q, try again later", op.Name, cluster)
+		}
+	}
+	return f, nil
+}
+
+// checkQuota checks the project has the quota for extra nodes in the region.
+// The caller must hold the mutex.
+func (fgsc *GKESDKClient) checkQuota(project, region string, extra int64) error {
+	quota, ok := fgsc.quota[project+"/"+region]
+	if !ok || extra <= 0 {
+		return nil
+	}
+	used := fgsc.nodesIn(project, region, func(*container.Cluster) bool { return true })
+	if used+extra > quota {
+		return gke.ClassifyError(fmt.Errorf(
+			"Insufficient regional quota to satisfy request: resource \"NODES\": request requires '%d' and is short '%d'. "+
+				"project has a quota of '%d' with '%d' available", extra, used+extra-quota, quota, quota-used))
+	}
+	return nil
+}
+
+// hasCapacity checks the region has the capacity for the nodes of a cluster,
+// on top of the nodes of the other clusters. The caller must hold the mutex.
+func (fgsc *GKESDKClient) hasCapacity(region string, cluster *container.Cluster) bool {
+	capacity, ok := fgsc.capacity[region]
+	if !ok {
+		return true
+	}
+	used := fgsc.nodesIn("", region, func(cl *container.Cluster) bool {
+		return cl != cluster && cl.Status != "ERROR" && cl.Status != "PROVISIONING"
+	})
+	return used+clusterNodes(cluster) <= capacity
+}
+
+// stockout returns the status message and the condition code of an operation
+// failing with a stockout
+func stockout(location string) (string, string) {
+	return fmt.Sprintf("Try a different location, or try again later: Google Compute Engine "+
+		"does not have enough resources available to fulfill request: %s.", location), CodeStockout
+}
+
+// nodesIn returns the number of nodes of the counted clusters of the project
+// in the region, of all the projects if project is empty. The caller must
+// hold the mutex.
+func (fgsc *GKESDKClient) nodesIn(project, region string, counted func(*container.Cluster) bool) int64 {
+	var nodes int64
+	for parent, cls := range fgsc.clusters {
+		// parent is in the form of projects/PROJECT/locations/LOCATION
+		parts := strings.Split(parent, "/")
+		if len(parts) != 4 || (project != "" && parts[1] != project) {
+			continue
+		}
+		if r, _ := gke.RegionZoneFromLoc(parts[3]); r != region {
+			continue
+		}
+		for _, cl := range cls {
+			if counted(cl) {
+				nodes += clusterNodes(cl)
+			}
+		}
+	}
+	return nodes
+}
+
+// clusterNodes returns the number of nodes of the cluster
+func clusterNodes(cluster *container.Cluster) int64 {
+	var nodes int64
+	for _, np := range cluster.NodePools {
+		if np.Status != "ERROR" {
+			nodes += np.InitialNodeCount
+		}
+	}
+	return nodes
+}
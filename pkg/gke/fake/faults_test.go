@@ -0,0 +1,142 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"knative.dev/test-infra/pkg/gke"
+)
+
+func TestCapacity(t *testing.T) {
+	ctx := context.Background()
+	fgsc := NewGKESDKClient()
+	fgsc.SetCapacity("us-central1", 3)
+
+	if err := fgsc.CreateCluster(ctx, "project-a", "us-central1", "", newCreateRequest(t, "project-a", "name-a", 2)); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	err := fgsc.CreateCluster(ctx, "project-b", "us-central1", "", newCreateRequest(t, "project-b", "name-b", 2))
+	if !errors.Is(err, gke.ErrStockout) || !gke.IsRetryableCreationError(err) {
+		t.Fatalf("Expected error '%v', but got '%v'", gke.ErrStockout, err)
+	}
+	cluster, _ := fgsc.GetCluster(ctx, "project-b", "us-central1", "", "name-b")
+	if cluster.Status != "ERROR" {
+		t.Fatalf("Expected cluster status ERROR, but got %s", cluster.Status)
+	}
+	// Other regions are not affected.
+	if err := fgsc.CreateCluster(ctx, "project-b", "us-west1", "", newCreateRequest(t, "project-b", "name-b", 2)); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	// Nodes are freed when clusters are deleted.
+	if err := fgsc.DeleteCluster(ctx, "project-a", "us-central1", "", "name-a"); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if err := fgsc.CreateCluster(ctx, "project-a", "us-central1", "", newCreateRequest(t, "project-a", "name-c", 3)); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	ctx := context.Background()
+	fgsc := NewGKESDKClient()
+	fgsc.SetQuota("project-a", "us-central1", 3)
+
+	if err := fgsc.CreateCluster(ctx, "project-a", "us-central1", "", newCreateRequest(t, "project-a", "name-a", 2)); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	_, err := fgsc.CreateClusterAsync(ctx, "project-a", "us-central1", "", newCreateRequest(t, "project-a", "name-b", 2))
+	if !errors.Is(err, gke.ErrQuotaExceeded) || gke.IsRetryableCreationError(err) {
+		t.Fatalf("Expected error '%v', but got '%v'", gke.ErrQuotaExceeded, err)
+	}
+	err = fgsc.ResizeNodePool(ctx, "project-a", "us-central1", "", "name-a", "default-pool", 4)
+	if !errors.Is(err, gke.ErrQuotaExceeded) {
+		t.Fatalf("Expected error '%v', but got '%v'", gke.ErrQuotaExceeded, err)
+	}
+	// The quota is per project.
+	if err := fgsc.CreateCluster(ctx, "project-b", "us-central1", "", newCreateRequest(t, "project-b", "name-b", 2)); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+}
+
+func TestInjectFault(t *testing.T) {
+	ctx := context.Background()
+	fgsc := NewGKESDKClient()
+	fgsc.InjectFault(Fault{
+		Method:  MethodCreateCluster,
+		Region:  "us-central1",
+		Message: `Master version "1.99.0-gke.1" is unsupported.`,
+		Sync:    true,
+		Times:   1,
+	})
+	fgsc.InjectFault(Fault{
+		Method:  MethodCreateCluster,
+		Region:  "us-west1",
+		Message: "Deploy error: Not all instances running in IGM after 32m. Expect 3. Current errors: [ZONE_RESOURCE_POOL_EXHAUSTED]",
+	})
+
+	rb := newCreateRequest(t, "project-a", "name-a", 1)
+	if _, err := fgsc.CreateClusterAsync(ctx, "project-a", "us-central1", "", rb); !errors.Is(err, gke.ErrInvalidVersion) {
+		t.Fatalf("Expected error '%v', but got '%v'", gke.ErrInvalidVersion, err)
+	}
+	// The fault only applied once.
+	if err := fgsc.CreateCluster(ctx, "project-a", "us-central1", "", rb); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	// Asynchronous faults make the operations fail.
+	op, err := fgsc.CreateClusterAsync(ctx, "project-a", "us-west1", "", rb)
+	if err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	err = gke.Wait(ctx, fgsc, "project-a", "us-west1", "", op.Name)
+	if !errors.Is(err, gke.ErrStockout) {
+		t.Fatalf("Expected error '%v', but got '%v'", gke.ErrStockout, err)
+	}
+	fgsc.ClearFaults()
+	if err := fgsc.CreateCluster(ctx, "project-a", "us-east1", "", rb); err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+
+	wantCalls := []Call{
+		{Method: MethodCreateCluster, Project: "project-a", Location: "us-central1", Cluster: "name-a"},
+		{Method: MethodCreateCluster, Project: "project-a", Location: "us-central1", Cluster: "name-a", Operation: "0"},
+		{Method: MethodCreateCluster, Project: "project-a", Location: "us-west1", Cluster: "name-a", Operation: "1"},
+		{Method: MethodCreateCluster, Project: "project-a", Location: "us-east1", Cluster: "name-a", Operation: "2"},
+	}
+	calls := fgsc.Calls()
+	if len(calls) != len(wantCalls) || calls[0].Err == nil {
+		t.Fatalf("Expected calls %+v, but got %+v", wantCalls, calls)
+	}
+	calls[0].Err = nil
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Fatalf("Expected calls %+v, but got %+v", wantCalls, calls)
+	}
+	wantClusters := map[string][]string{
+		"projects/project-a/locations/us-central1": {"name-a"},
+		"projects/project-a/locations/us-west1":    {"name-a"},
+		"projects/project-a/locations/us-east1":    {"name-a"},
+	}
+	if clusters := fgsc.Clusters(); !reflect.DeepEqual(clusters, wantClusters) {
+		t.Fatalf("Expected clusters %v, but got %v", wantClusters, clusters)
+	}
+	if ops := fgsc.Operations(); len(ops) != 3 || ops[1].Status != doneStatus || len(ops[1].ClusterConditions) != 0 {
+		t.Fatalf("Expected 3 DONE operations, the second one failed without condition, but got %+v", ops)
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// lifecycle.go makes the operations of the fake client go through
+// PENDING, RUNNING and DONE with a clock, like the operations of GKE
+
+package fake
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	container "google.golang.org/api/container/v1beta1"
+)
+
+const (
+	pendingStatus = "PENDING"
+	runningStatus = "RUNNING"
+	doneStatus    = "DONE"
+)
+
+// Clock is the source of time of the fake client
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock is a Clock that only moves when it's advanced
+type FakeClock struct {
+	now   time.Time
+	mutex sync.Mutex
+}
+
+// NewFakeClock returns a FakeClock set to now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the current time of the clock
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Lifecycle configures how the operations of the fake client progress
+type Lifecycle struct {
+	// Clock is the clock the operations progress with, the real clock if nil
+	Clock Clock
+	// PendingDuration and RunningDuration are how long the operations stay
+	// PENDING then RUNNING, they are DONE immediately if both are 0
+	PendingDuration time.Duration
+	RunningDuration time.Duration
+	// PollAdvance advances Clock on each GetOperation if it's a FakeClock, so
+	// that waiting for an operation doesn't need another goroutine advancing
+	// the clock
+	PollAdvance time.Duration
+}
+
+// SetLifecycle sets how the next operations progress, the operations are DONE
+// immediately by default
+func (fgsc *GKESDKClient) SetLifecycle(l Lifecycle) {
+	fgsc.mutex.Lock()
+	defer fgsc.mutex.Unlock()
+	if l.Clock == nil {
+		l.Clock = realClock{}
+	}
+	fgsc.lifecycle = l
+}
+
+// operation is an operation of the fake client
+type operation struct {
+	op      *container.Operation
+	start   time.Time
+	pending time.Duration
+	running time.Duration
+	// cluster is the full path of the cluster the operation runs on
+	cluster string
+	// finish applies the effects of the operation once it's done, it returns
+	// the status message and the condition code if the operation failed
+	finish func() (message, code string)
+	// forced is true if the status is forced with OpStatus, in which case the
+	// effects are applied immediately and the status never changes
+	forced bool
+}
+
+// startOp registers a new operation of the given type on a cluster and target,
+// e.g. a node pool, then returns a copy of it. The caller must hold the mutex.
+func (fgsc *GKESDKClient) startOp(opType, cluster, target string, finish func() (string, string)) *container.Operation {
+	name := strconv.Itoa(fgsc.opNumber)
+	fgsc.opNumber++
+	now := fgsc.lifecycle.Clock.Now()
+	o := &operation{
+		op: &container.Operation{
+			Name:          name,
+			OperationType: opType,
+			Status:        pendingStatus,
+			TargetLink:    target,
+			StartTime:     now.Format(time.RFC3339),
+		},
+		start:   now,
+		pending: fgsc.lifecycle.PendingDuration,
+		running: fgsc.lifecycle.RunningDuration,
+		cluster: cluster,
+		finish:  finish,
+	}
+	if status, ok := fgsc.OpStatus[name]; ok {
+		o.forced = true
+		o.op.Status = status
+		finish()
+	}
+	fgsc.ops[name] = o
+	fgsc.opNames = append(fgsc.opNames, name)
+	fgsc.advance(o)
+	return copyOp(o.op)
+}
+
+// advance updates the status of the operation from the clock, and applies its
+// effects once it's done. The caller must hold the mutex.
+func (fgsc *GKESDKClient) advance(o *operation) {
+	if o.forced || o.op.Status == doneStatus {
+		return
+	}
+	now := fgsc.lifecycle.Clock.Now()
+	elapsed := now.Sub(o.start)
+	switch {
+	case elapsed < o.pending:
+		o.op.Status = pendingStatus
+	case elapsed < o.pending+o.running:
+		o.op.Status = runningStatus
+		o.op.Progress = &container.OperationProgress{
+			Status: runningStatus,
+			Metrics: []*container.Metric{
+				{Name: "STEPS_DONE", IntValue: int64((elapsed - o.pending) * 100 / o.running)},
+				{Name: "STEPS_TOTAL", IntValue: 100},
+			},
+		}
+	default:
+		message, code := o.finish()
+		o.op.Status = doneStatus
+		o.op.Progress = nil
+		o.op.EndTime = now.Format(time.RFC3339)
+		o.op.StatusMessage = message
+		if code != "" {
+			o.op.ClusterConditions = []*container.StatusCondition{{Code: code, Message: message}}
+		}
+	}
+}
+
+// advanceAll advances all the operations in the order they were started, so
+// that their effects are visible. The caller must hold the mutex.
+func (fgsc *GKESDKClient) advanceAll() {
+	for _, name := range fgsc.opNames {
+		fgsc.advance(fgsc.ops[name])
+	}
+}
+
+// inProgress returns the operation in progress on the cluster, nil if none.
+// The caller must hold the mutex.
+func (fgsc *GKESDKClient) inProgress(cluster string) *container.Operation {
+	for _, name := range fgsc.opNames {
+		if o := fgsc.ops[name]; o.cluster == cluster && o.op.Status != doneStatus {
+			return o.op
+		}
+	}
+	return nil
+}
+
+func copyOp(op *container.Operation) *container.Operation {
+	cp := *op
+	return &cp
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	container "google.golang.org/api/container/v1beta1"
+	"knative.dev/test-infra/pkg/gke"
+)
+
+// newCreateRequest returns a request creating a cluster with a single node
+// pool of the given number of nodes
+func newCreateRequest(t *testing.T, project, name string, nodes int64) *container.CreateClusterRequest {
+	t.Helper()
+	rb, err := gke.NewCreateClusterRequest(&gke.Request{
+		Project:     project,
+		ClusterName: name,
+		MinNodes:    nodes,
+		MaxNodes:    nodes,
+		NodeType:    "e2-standard-4",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	return rb
+}
+
+func TestLifecycle(t *testing.T) {
+	ctx := context.Background()
+	fgsc := NewGKESDKClient()
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	fgsc.SetLifecycle(Lifecycle{Clock: clock, PendingDuration: time.Minute, RunningDuration: 4 * time.Minute})
+
+	op, err := fgsc.CreateClusterAsync(ctx, "project-a", "us-central1", "", newCreateRequest(t, "project-a", "name-a", 1))
+	if err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if op.Status != pendingStatus || op.OperationType != "CREATE_CLUSTER" {
+		t.Fatalf("Expected a PENDING CREATE_CLUSTER operation, but got %s %s", op.Status, op.OperationType)
+	}
+	cluster, _ := fgsc.GetCluster(ctx, "project-a", "us-central1", "", "name-a")
+	if cluster.Status != "PROVISIONING" {
+		t.Fatalf("Expected cluster status PROVISIONING, but got %s", cluster.Status)
+	}
+
+	// Another operation can't run on the cluster in the meantime.
+	_, err = fgsc.UpgradeMasterAsync(ctx, "project-a", "us-central1", "", "name-a", "1.16.0")
+	if err == nil || !strings.Contains(err.Error(), "already in progress") {
+		t.Fatalf("Expected an operation already in progress error, but got '%v'", err)
+	}
+
+	clock.Advance(2 * time.Minute)
+	op, _ = fgsc.GetOperation(ctx, "project-a", "us-central1", "", op.Name)
+	if op.Status != runningStatus || op.Progress == nil || op.Progress.Metrics[0].IntValue != 25 {
+		t.Fatalf("Expected a RUNNING operation at 25%%, but got %s with progress %+v", op.Status, op.Progress)
+	}
+
+	clock.Advance(3 * time.Minute)
+	op, _ = fgsc.GetOperation(ctx, "project-a", "us-central1", "", op.Name)
+	if op.Status != doneStatus || op.StatusMessage != "" {
+		t.Fatalf("Expected a successful DONE operation, but got %s: %q", op.Status, op.StatusMessage)
+	}
+	cluster, _ = fgsc.GetCluster(ctx, "project-a", "us-central1", "", "name-a")
+	if cluster.Status != "RUNNING" {
+		t.Fatalf("Expected cluster status RUNNING, but got %s", cluster.Status)
+	}
+}
+
+func TestLifecyclePollAdvance(t *testing.T) {
+	ctx := context.Background()
+	fgsc := NewGKESDKClient()
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	fgsc.SetLifecycle(Lifecycle{Clock: clock, PendingDuration: time.Minute, RunningDuration: 5 * time.Minute, PollAdvance: 3 * time.Minute})
+
+	var statuses []string
+	err := fgsc.CreateCluster(ctx, "project-a", "us-central1", "", newCreateRequest(t, "project-a", "name-a", 1),
+		gke.WithPollInterval(time.Millisecond, time.Millisecond),
+		gke.WithProgress(func(p gke.Progress) {
+			statuses = append(statuses, p.Operation.Status)
+		}))
+	if err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	if want := []string{runningStatus, doneStatus}; strings.Join(statuses, ",") != strings.Join(want, ",") {
+		t.Fatalf("Expected statuses %v, but got %v", want, statuses)
+	}
+}
@@ -0,0 +1,426 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	container "google.golang.org/api/container/v1beta1"
+	"knative.dev/test-infra/pkg/gke"
+)
+
+// nodePoolLink returns the target link of the operations on a node pool
+func nodePoolLink(project, region, zone, clusterName, poolName string) string {
+	return fmt.Sprintf("%s/nodePools/%s", clusterLink(project, gke.GetClusterLocation(region, zone), clusterName), poolName)
+}
+
+// CreateNodePool creates a new node pool, and wait until it finishes or timeout or there is an error.
+func (fgsc *GKESDKClient) CreateNodePool(
+	ctx context.Context,
+	project, region, zone, clusterName string,
+	req *container.CreateNodePoolRequest,
+	opts ...gke.WaitOption,
+) error {
+	op, err := fgsc.CreateNodePoolAsync(ctx, project, region, zone, clusterName, req)
+	if err == nil {
+		err = gke.Wait(ctx, fgsc, project, region, zone, op.Name, append([]gke.WaitOption{gke.WithTimeout(CreationTimeout)}, opts...)...)
+	}
+	return err
+}
+
+// CreateNodePoolAsync creates a new node pool asynchronously.
+// The node pool is PROVISIONING until the operation is done, and ERROR if the
+// operation failed.
+func (fgsc *GKESDKClient) CreateNodePoolAsync(
+	ctx context.Context,
+	project, region, zone, clusterName string,
+	req *container.CreateNodePoolRequest,
+) (op *container.Operation, err error) {
+	fgsc.mutex.Lock()
+	defer fgsc.mutex.Unlock()
+	fgsc.advanceAll()
+	location := gke.GetClusterLocation(region, zone)
+	defer func() {
+		fgsc.record(Call{Method: MethodCreateNodePool, Project: project, Location: location, Cluster: clusterName, NodePool: req.NodePool.Name}, op, err)
+	}()
+
+	cluster, err := fgsc.findCluster(project, region, zone, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	for _, np := range cluster.NodePools {
+		if np.Name == req.NodePool.Name {
+			return nil, fmt.Errorf("node pool %q already exist", np.Name)
+		}
+	}
+	fault, err := fgsc.checkCall(MethodCreateNodePool, region, clusterLink(project, location, clusterName))
+	if err != nil {
+		return nil, err
+	}
+	if err := fgsc.checkQuota(project, region, req.NodePool.InitialNodeCount); err != nil {
+		return nil, err
+	}
+	np := *req.NodePool
+	np.Status = "PROVISIONING"
+	np.Version = cluster.CurrentMasterVersion
+	cluster.NodePools = append(cluster.NodePools, &np)
+	return fgsc.startOp("CREATE_NODE_POOL", clusterLink(project, location, clusterName), nodePoolLink(project, region, zone, clusterName, np.Name), func() (string, string) {
+		message, code := "", ""
+		if fault != nil {
+			message, code = fault.Message, fault.Code
+		} else if !fgsc.hasCapacity(region, cluster) {
+			message, code = stockout(location)
+		}
+		if message != "" {
+			np.Status = "ERROR"
+			np.StatusMessage = message
+			return message, code
+		}
+		np.Status = "RUNNING"
+		return "", ""
+	}), nil
+}
+
+// DeleteNodePool deletes the node pool, and wait until it finishes or timeout or there is an error.
+func (fgsc *GKESDKClient) DeleteNodePool(
+	ctx context.Context,
+	project, region, zone, clusterName, poolName string,
+	opts ...gke.WaitOption,
+) error {
+	op, err := fgsc.DeleteNodePoolAsync(ctx, project, region, zone, clusterName, poolName)
+	if err == nil {
+		err = gke.Wait(ctx, fgsc, project, region, zone, op.Name, append([]gke.WaitOption{gke.WithTimeout(DeletionTimeout)}, opts...)...)
+	}
+	return err
+}
+
+// DeleteNodePoolAsync deletes the node pool asynchronously.
+// The node pool is STOPPING until the operation is done.
+func (fgsc *GKESDKClient) DeleteNodePoolAsync(
+	ctx context.Context,
+	project, region, zone, clusterName, poolName string,
+) (op *container.Operation, err error) {
+	fgsc.mutex.Lock()
+	defer fgsc.mutex.Unlock()
+	fgsc.advanceAll()
+	location := gke.GetClusterLocation(region, zone)
+	defer func() {
+		fgsc.record(Call{Method: MethodDeleteNodePool, Project: project, Location: location, Cluster: clusterName, NodePool: poolName}, op, err)
+	}()
+
+	cluster, i, err := fgsc.findNodePool(project, region, zone, clusterName, poolName)
+	if err != nil {
+		return nil, err
+	}
+	if len(cluster.NodePools) == 1 {
+		return nil, fmt.Errorf("cannot delete node pool %q, the cluster must have at least one node pool", poolName)
+	}
+	fault, err := fgsc.checkCall(MethodDeleteNodePool, region, clusterLink(project, location, clusterName))
+	if err != nil {
+		return nil, err
+	}
+	np := cluster.NodePools[i]
+	status := np.Status
+	np.Status = "STOPPING"
+	return fgsc.startOp("DELETE_NODE_POOL", clusterLink(project, location, clusterName), nodePoolLink(project, region, zone, clusterName, poolName), func() (string, string) {
+		if fault != nil {
+			np.Status = status
+			return fault.Message, fault.Code
+		}
+		for i, p := range cluster.NodePools {
+			if p == np {
+				cluster.NodePools = append(cluster.NodePools[:i], cluster.NodePools[i+1:]...)
+				break
+			}
+		}
+		return "", ""
+	}), nil
+}
+
+// GetNodePool gets the node pool with the given settings.
+func (fgsc *GKESDKClient) GetNodePool(ctx context.Context, project, region, zone, clusterName, poolName string) (*container.NodePool, error) {
+	fgsc.mutex.Lock()
+	defer fgsc.mutex.Unlock()
+	fgsc.advanceAll()
+	cluster, i, err := fgsc.findNodePool(project, region, zone, clusterName, poolName)
+	if err != nil {
+		return nil, err
+	}
+	return cluster.NodePools[i], nil
+}
+
+// ResizeNodePool sets the number of nodes of the node pool, and wait until it finishes or timeout or there is an error.
+func (fgsc *GKESDKClient) ResizeNodePool(
+	ctx context.Context,
+	project, region, zone, clusterName, poolName string,
+	nodeCount int64,
+	opts ...gke.WaitOption,
+) error {
+	op, err := fgsc.ResizeNodePoolAsync(ctx, project, region, zone, clusterName, poolName, nodeCount)
+	if err == nil {
+		err = gke.Wait(ctx, fgsc, project, region, zone, op.Name, append([]gke.WaitOption{gke.WithTimeout(CreationTimeout)}, opts...)...)
+	}
+	return err
+}
+
+// ResizeNodePoolAsync sets the number of nodes of the node pool asynchronously.
+// The number of nodes changes once the operation is done.
+func (fgsc *GKESDKClient) ResizeNodePoolAsync(
+	ctx context.Context,
+	project, region, zone, clusterName, poolName string,
+	nodeCount int64,
+) (op *container.Operation, err error) {
+	fgsc.mutex.Lock()
+	defer fgsc.mutex.Unlock()
+	fgsc.advanceAll()
+	location := gke.GetClusterLocation(region, zone)
+	defer func() {
+		fgsc.record(Call{Method: MethodResizeNodePool, Project: project, Location: location, Cluster: clusterName, NodePool: poolName}, op, err)
+	}()
+
+	if nodeCount < 0 {
+		return nil, fmt.Errorf("invalid node count %d", nodeCount)
+	}
+	cluster, i, err := fgsc.findNodePool(project, region, zone, clusterName, poolName)
+	if err != nil {
+		return nil, err
+	}
+	np := cluster.NodePools[i]
+	fault, err := fgsc.checkCall(MethodResizeNodePool, region, clusterLink(project, location, clusterName))
+	if err != nil {
+		return nil, err
+	}
+	if err := fgsc.checkQuota(project, region, nodeCount-np.InitialNodeCount); err != nil {
+		return nil, err
+	}
+	return fgsc.startOp("SET_NODE_POOL_SIZE", clusterLink(project, location, clusterName), nodePoolLink(project, region, zone, clusterName, poolName), func() (string, string) {
+		if fault != nil {
+			return fault.Message, fault.Code
+		}
+		previous := np.InitialNodeCount
+		np.InitialNodeCount = nodeCount
+		if nodeCount > previous && !fgsc.hasCapacity(region, cluster) {
+			np.InitialNodeCount = previous
+			return stockout(location)
+		}
+		return "", ""
+	}), nil
+}
+
+// SetNodePoolAutoscaling sets the autoscaling settings of the node pool, and wait until it finishes or timeout or there is an error.
+func (fgsc *GKESDKClient) SetNodePoolAutoscaling(
+	ctx context.Context,
+	project, region, zone, clusterName, poolName string,
+	autoscaling *container.NodePoolAutoscaling,
+	opts ...gke.WaitOption,
+) error {
+	op, err := fgsc.SetNodePoolAutoscalingAsync(ctx, project, region, zone, clusterName, poolName, autoscaling)
+	if err == nil {
+		err = gke.Wait(ctx, fgsc, project, region, zone, op.Name, append([]gke.WaitOption{gke.WithTimeout(CreationTimeout)}, opts...)...)
+	}
+	return err
+}
+
+// SetNodePoolAutoscalingAsync sets the autoscaling settings of the node pool asynchronously.
+// The settings change once the operation is done.
+func (fgsc *GKESDKClient) SetNodePoolAutoscalingAsync(
+	ctx context.Context,
+	project, region, zone, clusterName, poolName string,
+	autoscaling *container.NodePoolAutoscaling,
+) (op *container.Operation, err error) {
+	fgsc.mutex.Lock()
+	defer fgsc.mutex.Unlock()
+	fgsc.advanceAll()
+	location := gke.GetClusterLocation(region, zone)
+	defer func() {
+		fgsc.record(Call{Method: MethodSetNodePoolAutoscaling, Project: project, Location: location, Cluster: clusterName, NodePool: poolName}, op, err)
+	}()
+
+	if autoscaling.Enabled && (autoscaling.MinNodeCount < 0 || autoscaling.MinNodeCount > autoscaling.MaxNodeCount) {
+		return nil, fmt.Errorf("invalid autoscaling %d-%d", autoscaling.MinNodeCount, autoscaling.MaxNodeCount)
+	}
+	cluster, i, err := fgsc.findNodePool(project, region, zone, clusterName, poolName)
+	if err != nil {
+		return nil, err
+	}
+	np := cluster.NodePools[i]
+	fault, err := fgsc.checkCall(MethodSetNodePoolAutoscaling, region, clusterLink(project, location, clusterName))
+	if err != nil {
+		return nil, err
+	}
+	return fgsc.startOp("UPDATE_CLUSTER", clusterLink(project, location, clusterName), nodePoolLink(project, region, zone, clusterName, poolName), func() (string, string) {
+		if fault != nil {
+			return fault.Message, fault.Code
+		}
+		np.Autoscaling = autoscaling
+		return "", ""
+	}), nil
+}
+
+// UpgradeMaster upgrades the master to the given version, and wait until it finishes or timeout or there is an error.
+func (fgsc *GKESDKClient) UpgradeMaster(
+	ctx context.Context,
+	project, region, zone, clusterName, version string,
+	opts ...gke.WaitOption,
+) error {
+	op, err := fgsc.UpgradeMasterAsync(ctx, project, region, zone, clusterName, version)
+	if err == nil {
+		err = gke.Wait(ctx, fgsc, project, region, zone, op.Name, append([]gke.WaitOption{gke.WithTimeout(CreationTimeout)}, opts...)...)
+	}
+	return err
+}
+
+// UpgradeMasterAsync upgrades the master to the given version asynchronously.
+// Like GKE, the master cannot be downgraded, and the cluster is RECONCILING
+// until the operation is done.
+func (fgsc *GKESDKClient) UpgradeMasterAsync(
+	ctx context.Context,
+	project, region, zone, clusterName, version string,
+) (op *container.Operation, err error) {
+	fgsc.mutex.Lock()
+	defer fgsc.mutex.Unlock()
+	fgsc.advanceAll()
+	location := gke.GetClusterLocation(region, zone)
+	defer func() {
+		fgsc.record(Call{Method: MethodUpgradeMaster, Project: project, Location: location, Cluster: clusterName}, op, err)
+	}()
+
+	cluster, err := fgsc.findCluster(project, region, zone, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	if compareVersions(version, cluster.CurrentMasterVersion) < 0 {
+		return nil, fmt.Errorf("%w: cannot downgrade master version from %q to %q",
+			gke.ErrInvalidVersion, cluster.CurrentMasterVersion, version)
+	}
+	fault, err := fgsc.checkCall(MethodUpgradeMaster, region, clusterLink(project, location, clusterName))
+	if err != nil {
+		return nil, err
+	}
+	status := cluster.Status
+	cluster.Status = "RECONCILING"
+	return fgsc.startOp("UPGRADE_MASTER", clusterLink(project, location, clusterName), clusterLink(project, location, clusterName), func() (string, string) {
+		cluster.Status = status
+		if fault != nil {
+			return fault.Message, fault.Code
+		}
+		cluster.CurrentMasterVersion = version
+		return "", ""
+	}), nil
+}
+
+// UpgradeNodePool upgrades the nodes of the node pool to the given version, and wait until it finishes or timeout or there is an error.
+func (fgsc *GKESDKClient) UpgradeNodePool(
+	ctx context.Context,
+	project, region, zone, clusterName, poolName, version string,
+	opts ...gke.WaitOption,
+) error {
+	op, err := fgsc.UpgradeNodePoolAsync(ctx, project, region, zone, clusterName, poolName, version)
+	if err == nil {
+		err = gke.Wait(ctx, fgsc, project, region, zone, op.Name, append([]gke.WaitOption{gke.WithTimeout(CreationTimeout)}, opts...)...)
+	}
+	return err
+}
+
+// UpgradeNodePoolAsync upgrades the nodes of the node pool to the given version asynchronously.
+// Like GKE, the nodes cannot be newer than the master, and the node pool is
+// RECONCILING until the operation is done.
+func (fgsc *GKESDKClient) UpgradeNodePoolAsync(
+	ctx context.Context,
+	project, region, zone, clusterName, poolName, version string,
+) (op *container.Operation, err error) {
+	fgsc.mutex.Lock()
+	defer fgsc.mutex.Unlock()
+	fgsc.advanceAll()
+	location := gke.GetClusterLocation(region, zone)
+	defer func() {
+		fgsc.record(Call{Method: MethodUpgradeNodePool, Project: project, Location: location, Cluster: clusterName, NodePool: poolName}, op, err)
+	}()
+
+	cluster, i, err := fgsc.findNodePool(project, region, zone, clusterName, poolName)
+	if err != nil {
+		return nil, err
+	}
+	// "-" upgrades the nodes to the version of the master
+	if version == "-" {
+		version = cluster.CurrentMasterVersion
+	}
+	if cluster.CurrentMasterVersion != "" && compareVersions(version, cluster.CurrentMasterVersion) > 0 {
+		return nil, fmt.Errorf("%w: node version %q cannot be newer than master version %q",
+			gke.ErrInvalidVersion, version, cluster.CurrentMasterVersion)
+	}
+	fault, err := fgsc.checkCall(MethodUpgradeNodePool, region, clusterLink(project, location, clusterName))
+	if err != nil {
+		return nil, err
+	}
+	np := cluster.NodePools[i]
+	status := np.Status
+	np.Status = "RECONCILING"
+	return fgsc.startOp("UPGRADE_NODES", clusterLink(project, location, clusterName), nodePoolLink(project, region, zone, clusterName, poolName), func() (string, string) {
+		np.Status = status
+		if fault != nil {
+			return fault.Message, fault.Code
+		}
+		np.Version = version
+		cluster.CurrentNodeVersion = version
+		return "", ""
+	}), nil
+}
+
+// compareVersions compares GKE versions like 1.16.13-gke.401 by their numbers,
+// an empty version is the oldest one and "latest" the newest one.
+func compareVersions(a, b string) int {
+	if a == b {
+		return 0
+	}
+	for _, v := range []struct {
+		version string
+		cmp     int
+	}{{"", -1}, {"latest", 1}} {
+		if a == v.version {
+			return v.cmp
+		}
+		if b == v.version {
+			return -v.cmp
+		}
+	}
+	split := func(v string) []string {
+		return strings.FieldsFunc(v, func(r rune) bool { return r == '.' || r == '-' })
+	}
+	as, bs := split(a), split(b)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		if aErr != nil || bErr != nil {
+			// Non numeric parts like "gke" are compared as strings
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+			continue
+		}
+		if an != bn {
+			if an < bn {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(as) - len(bs)
+}
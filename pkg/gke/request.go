@@ -18,11 +18,27 @@ package gke
 
 import (
 	"errors"
+	"fmt"
+	"net"
+	"regexp"
 
 	container "google.golang.org/api/container/v1beta1"
 )
 
-const defaultGKEVersion = "latest"
+const (
+	defaultGKEVersion = "latest"
+	defaultNodePool   = "default-pool"
+	// masterIPv4CIDRSize is the size of the IP range of the master of private clusters
+	masterIPv4CIDRSize = 28
+)
+
+// Taint effects of the node pools, see
+// https://cloud.google.com/kubernetes-engine/docs/how-to/node-taints
+const (
+	TaintEffectNoSchedule       = "NO_SCHEDULE"
+	TaintEffectPreferNoSchedule = "PREFER_NO_SCHEDULE"
+	TaintEffectNoExecute        = "NO_EXECUTE"
+)
 
 // Request contains all settings collected for cluster creation
 type Request struct {
@@ -66,6 +82,77 @@ type Request struct {
 
 	// ServiceAccount: service account that will be used on this cluster
 	ServiceAccount string
+
+	// NodePools: node pools of the cluster. If empty, a single "default-pool"
+	// is created with MinNodes, MaxNodes and NodeType, which are ignored otherwise
+	NodePools []NodePool
+
+	// Network: the VPC network of the cluster, default to be the "default" network
+	Network string
+
+	// Subnetwork: the subnetwork of the cluster in Network
+	Subnetwork string
+
+	// EnablePrivateNodes: whether the nodes only have internal IP addresses,
+	// MasterIPv4CIDR must be provided together
+	EnablePrivateNodes bool
+
+	// EnablePrivateEndpoint: whether the master is only reachable from its
+	// internal IP address, requires EnablePrivateNodes
+	EnablePrivateEndpoint bool
+
+	// MasterIPv4CIDR: the /28 internal IP range of the master of a private
+	// cluster, e.g. 172.16.0.32/28
+	MasterIPv4CIDR string
+
+	// ResourceLabels: GCP labels of the cluster, e.g. the labels telling who
+	// owns the cluster and when it expires
+	ResourceLabels map[string]string
+}
+
+// NodePool contains the settings of a node pool of the cluster
+type NodePool struct {
+	// Name: name of the node pool, unique in the cluster
+	Name string
+
+	// MinNodes: the minimum number of nodes of the node pool, can be 0 for
+	// autoscaled node pools as long as another node pool has nodes
+	MinNodes int64
+
+	// MaxNodes: the maximum number of nodes of the node pool
+	MaxNodes int64
+
+	// NodeType: node type of the node pool, e.g. e2-standard-4, e2-standard-8
+	NodeType string
+
+	// Labels: Kubernetes labels applied to the nodes
+	Labels map[string]string
+
+	// Taints: Kubernetes taints applied to the nodes
+	Taints []Taint
+
+	// Spot: whether the nodes are spot (preemptible) VMs, which are cheaper
+	// but can be reclaimed at any time
+	Spot bool
+
+	// DiskSizeGB: size of the boot disk of the nodes, default to be 100GB
+	DiskSizeGB int64
+
+	// DiskType: type of the boot disk of the nodes, e.g. pd-standard, pd-ssd
+	DiskType string
+
+	// ImageType: image type of the nodes, e.g. COS_CONTAINERD, UBUNTU
+	ImageType string
+
+	// Zones: zones of the nodes, default to be the zones of the cluster
+	Zones []string
+}
+
+// Taint is a Kubernetes taint applied to the nodes of a node pool
+type Taint struct {
+	Key    string
+	Value  string
+	Effect string
 }
 
 // DeepCopy will make a deepcopy of the request struct.
@@ -83,7 +170,217 @@ func (r *Request) DeepCopy() *Request {
 		Addons:                 r.Addons,
 		EnableWorkloadIdentity: r.EnableWorkloadIdentity,
 		ServiceAccount:         r.ServiceAccount,
+		NodePools:              deepCopyNodePools(r.NodePools),
+		Network:                r.Network,
+		Subnetwork:             r.Subnetwork,
+		EnablePrivateNodes:     r.EnablePrivateNodes,
+		EnablePrivateEndpoint:  r.EnablePrivateEndpoint,
+		MasterIPv4CIDR:         r.MasterIPv4CIDR,
+		ResourceLabels:         deepCopyLabels(r.ResourceLabels),
+	}
+}
+
+func deepCopyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	res := make(map[string]string, len(labels))
+	for k, v := range labels {
+		res[k] = v
+	}
+	return res
+}
+
+func deepCopyNodePools(pools []NodePool) []NodePool {
+	if pools == nil {
+		return nil
+	}
+	res := make([]NodePool, len(pools))
+	for i, pool := range pools {
+		res[i] = pool
+		res[i].Labels = deepCopyLabels(pool.Labels)
+		res[i].Taints = append([]Taint(nil), pool.Taints...)
+		res[i].Zones = append([]string(nil), pool.Zones...)
+	}
+	return res
+}
+
+// nodePools returns the node pools of the request, the default one if none is specified
+func (r *Request) nodePools() []NodePool {
+	if len(r.NodePools) != 0 {
+		return r.NodePools
 	}
+	return []NodePool{{
+		Name:     defaultNodePool,
+		MinNodes: r.MinNodes,
+		MaxNodes: r.MaxNodes,
+		NodeType: r.NodeType,
+	}}
+}
+
+// validateNodePools validates the node pools of the request
+func (r *Request) validateNodePools() error {
+	if len(r.NodePools) == 0 {
+		if r.MinNodes <= 0 {
+			return errors.New("min nodes must be larger than 1")
+		}
+		if r.MinNodes > r.MaxNodes {
+			return errors.New("min nodes cannot be larger than max nodes")
+		}
+		if r.NodeType == "" {
+			return errors.New("node type cannot be empty")
+		}
+		return nil
+	}
+
+	names := make(map[string]bool, len(r.NodePools))
+	var nodes int64
+	for _, pool := range r.NodePools {
+		if names[pool.Name] {
+			return fmt.Errorf("node pool %q is specified more than once", pool.Name)
+		}
+		names[pool.Name] = true
+		if err := pool.validate(); err != nil {
+			return err
+		}
+		nodes += pool.MinNodes
+	}
+	if nodes == 0 {
+		return errors.New("at least one node pool must have min nodes larger than 0")
+	}
+	return nil
+}
+
+// validate validates the settings of the node pool
+func (p *NodePool) validate() error {
+	if p.Name == "" {
+		return errors.New("node pool name cannot be empty")
+	}
+	if p.MinNodes < 0 {
+		return fmt.Errorf("min nodes of node pool %q cannot be negative", p.Name)
+	}
+	if p.MaxNodes <= 0 {
+		return fmt.Errorf("max nodes of node pool %q must be larger than 1", p.Name)
+	}
+	if p.MinNodes > p.MaxNodes {
+		return fmt.Errorf("min nodes of node pool %q cannot be larger than max nodes", p.Name)
+	}
+	if p.NodeType == "" {
+		return fmt.Errorf("node type of node pool %q cannot be empty", p.Name)
+	}
+	if p.DiskSizeGB < 0 || (p.DiskSizeGB > 0 && p.DiskSizeGB < 10) {
+		return fmt.Errorf("disk size of node pool %q must be at least 10GB", p.Name)
+	}
+	for _, taint := range p.Taints {
+		if taint.Key == "" {
+			return fmt.Errorf("taint key of node pool %q cannot be empty", p.Name)
+		}
+		switch taint.Effect {
+		case TaintEffectNoSchedule, TaintEffectPreferNoSchedule, TaintEffectNoExecute:
+		default:
+			return fmt.Errorf("invalid taint effect %q of node pool %q", taint.Effect, p.Name)
+		}
+	}
+	for _, zone := range p.Zones {
+		if zone == "" {
+			return fmt.Errorf("zones of node pool %q cannot be empty", p.Name)
+		}
+	}
+	return nil
+}
+
+// validateNetwork validates the network settings of the request
+func (r *Request) validateNetwork() error {
+	if r.Subnetwork != "" && r.Network == "" {
+		return errors.New("network cannot be empty if subnetwork is specified")
+	}
+	if r.EnablePrivateEndpoint && !r.EnablePrivateNodes {
+		return errors.New("private endpoint requires private nodes")
+	}
+	if r.EnablePrivateNodes {
+		if r.MasterIPv4CIDR == "" {
+			return errors.New("master IPv4 CIDR cannot be empty for private nodes")
+		}
+		_, ipNet, err := net.ParseCIDR(r.MasterIPv4CIDR)
+		if err != nil {
+			return fmt.Errorf("invalid master IPv4 CIDR %q: %w", r.MasterIPv4CIDR, err)
+		}
+		if ones, bits := ipNet.Mask.Size(); ones != masterIPv4CIDRSize || bits != 32 {
+			return fmt.Errorf("master IPv4 CIDR %q must be an IPv4 /%d range", r.MasterIPv4CIDR, masterIPv4CIDRSize)
+		}
+	} else if r.MasterIPv4CIDR != "" {
+		return errors.New("master IPv4 CIDR can only be specified for private nodes")
+	}
+	return nil
+}
+
+// labelPattern is the pattern of the keys and values of the GCP labels, see
+// https://cloud.google.com/compute/docs/labeling-resources#requirements
+var labelPattern = regexp.MustCompile(`^[a-z0-9_-]{0,63}$`)
+
+// validateLabels validates the GCP labels of the cluster
+func validateLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if k == "" || !labelPattern.MatchString(k) || k[0] < 'a' || k[0] > 'z' {
+			return fmt.Errorf("invalid resource label key %q", k)
+		}
+		if !labelPattern.MatchString(v) {
+			return fmt.Errorf("invalid value %q of resource label %q", v, k)
+		}
+	}
+	return nil
+}
+
+// NewCreateNodePoolRequest returns a new CreateNodePoolRequest that can be used
+// in gcloud SDK to add a node pool to an existing cluster.
+func NewCreateNodePoolRequest(pool NodePool, serviceAccount string) (*container.CreateNodePoolRequest, error) {
+	if err := pool.validate(); err != nil {
+		return nil, err
+	}
+	return &container.CreateNodePoolRequest{NodePool: newNodePool(pool, serviceAccount)}, nil
+}
+
+// newNodePool returns a NodePool that can be used in gcloud SDK.
+func newNodePool(pool NodePool, serviceAccount string) *container.NodePool {
+	np := &container.NodePool{
+		Name:             pool.Name,
+		InitialNodeCount: pool.MinNodes,
+		Autoscaling: &container.NodePoolAutoscaling{
+			Enabled:      true,
+			MinNodeCount: pool.MinNodes,
+			MaxNodeCount: pool.MaxNodes,
+		},
+		Config: &container.NodeConfig{
+			MachineType: pool.NodeType,
+			// The set of Google API scopes to be made available on all
+			// of the node VMs under the "default" service account.
+			// If unspecified, no scopes are added, unless Cloud Logging or
+			// Cloud Monitoring are enabled, in which case their required
+			// scopes will be added.
+			// `https://www.googleapis.com/auth/devstorage.read_only` is required
+			// for communicating with **gcr.io**, and it's included in cloud-platform scope.
+			// TODO(chizhg): give more fine granular scope based on the actual needs.
+			OauthScopes: []string{container.CloudPlatformScope},
+			Labels:      pool.Labels,
+			Preemptible: pool.Spot,
+			DiskSizeGb:  pool.DiskSizeGB,
+			DiskType:    pool.DiskType,
+			ImageType:   pool.ImageType,
+			// The Google Cloud Platform Service Account to be used by the node VMs.
+			// If a service account is specified, the cloud-platform and userinfo.email scopes are used.
+			// If no Service Account is specified, the project default service account is used.
+			ServiceAccount: serviceAccount,
+		},
+		Locations: pool.Zones,
+	}
+	for _, taint := range pool.Taints {
+		np.Config.Taints = append(np.Config.Taints, &container.NodeTaint{
+			Key:    taint.Key,
+			Value:  taint.Value,
+			Effect: taint.Effect,
+		})
+	}
+	return np
 }
 
 // NewCreateClusterRequest returns a new CreateClusterRequest that can be used in gcloud SDK.
@@ -91,14 +388,14 @@ func NewCreateClusterRequest(request *Request) (*container.CreateClusterRequest,
 	if request.ClusterName == "" {
 		return nil, errors.New("cluster name cannot be empty")
 	}
-	if request.MinNodes <= 0 {
-		return nil, errors.New("min nodes must be larger than 1")
+	if err := request.validateNodePools(); err != nil {
+		return nil, err
 	}
-	if request.MinNodes > request.MaxNodes {
-		return nil, errors.New("min nodes cannot be larger than max nodes")
+	if err := request.validateNetwork(); err != nil {
+		return nil, err
 	}
-	if request.NodeType == "" {
-		return nil, errors.New("node type cannot be empty")
+	if err := validateLabels(request.ResourceLabels); err != nil {
+		return nil, err
 	}
 	if request.EnableWorkloadIdentity && request.Project == "" {
 		return nil, errors.New("project cannot be empty if you want Workload Identity")
@@ -109,29 +406,6 @@ func NewCreateClusterRequest(request *Request) (*container.CreateClusterRequest,
 
 	ccr := &container.CreateClusterRequest{
 		Cluster: &container.Cluster{
-			NodePools: []*container.NodePool{
-				{
-					Name:             "default-pool",
-					InitialNodeCount: request.MinNodes,
-					Autoscaling: &container.NodePoolAutoscaling{
-						Enabled:      true,
-						MinNodeCount: request.MinNodes,
-						MaxNodeCount: request.MaxNodes,
-					},
-					Config: &container.NodeConfig{
-						MachineType: request.NodeType,
-						// The set of Google API scopes to be made available on all
-						// of the node VMs under the "default" service account.
-						// If unspecified, no scopes are added, unless Cloud Logging or
-						// Cloud Monitoring are enabled, in which case their required
-						// scopes will be added.
-						// `https://www.googleapis.com/auth/devstorage.read_only` is required
-						// for communicating with **gcr.io**, and it's included in cloud-platform scope.
-						// TODO(chizhg): give more fine granular scope based on the actual needs.
-						OauthScopes: []string{container.CloudPlatformScope},
-					},
-				},
-			},
 			Name: request.ClusterName,
 			// Installing addons after cluster creation takes at least 5
 			// minutes, so install addons as part of cluster creation, which
@@ -141,7 +415,8 @@ func NewCreateClusterRequest(request *Request) (*container.CreateClusterRequest,
 			// later on retrieved for setting up cluster roles. Use the
 			// default username from gcloud command, the password will be
 			// automatically generated by GKE SDK
-			MasterAuth: &container.MasterAuth{Username: "admin"},
+			MasterAuth:     &container.MasterAuth{Username: "admin"},
+			ResourceLabels: request.ResourceLabels,
 		},
 	}
 	if request.EnableWorkloadIdentity {
@@ -152,11 +427,19 @@ func NewCreateClusterRequest(request *Request) (*container.CreateClusterRequest,
 			WorkloadPool: request.Project + ".svc.id.goog",
 		}
 	}
-	if request.ServiceAccount != "" {
-		// The Google Cloud Platform Service Account to be used by the node VMs.
-		// If a service account is specified, the cloud-platform and userinfo.email scopes are used.
-		// If no Service Account is specified, the project default service account is used.
-		ccr.Cluster.NodePools[0].Config.ServiceAccount = request.ServiceAccount
+	for _, pool := range request.nodePools() {
+		ccr.Cluster.NodePools = append(ccr.Cluster.NodePools, newNodePool(pool, request.ServiceAccount))
+	}
+	ccr.Cluster.Network = request.Network
+	ccr.Cluster.Subnetwork = request.Subnetwork
+	if request.EnablePrivateNodes {
+		ccr.Cluster.PrivateClusterConfig = &container.PrivateClusterConfig{
+			EnablePrivateNodes:    true,
+			EnablePrivateEndpoint: request.EnablePrivateEndpoint,
+			MasterIpv4CidrBlock:   request.MasterIPv4CIDR,
+		}
+		// Private clusters must be VPC-native, equivalent to --enable-ip-alias
+		ccr.Cluster.IpAllocationPolicy = &container.IPAllocationPolicy{UseIpAliases: true}
 	}
 
 	// Manage the GKE cluster version. Only one of initial cluster version or release channel can be specified.
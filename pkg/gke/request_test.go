@@ -16,7 +16,12 @@ limitations under the License.
 
 package gke
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+
+	container "google.golang.org/api/container/v1beta1"
+)
 
 func TestNewCreateClusterRequest(t *testing.T) {
 	datas := []struct {
@@ -168,6 +173,138 @@ func TestNewCreateClusterRequest(t *testing.T) {
 				ServiceAccount: "sa-i",
 			},
 			errorExpected: false,
+		}, {
+			req: &Request{
+				Project:     "project-j",
+				ClusterName: "name-j",
+				NodePools: []NodePool{
+					{Name: "system", MinNodes: 1, MaxNodes: 1, NodeType: "e2-standard-4"},
+					{Name: "spot", MinNodes: 0, MaxNodes: 10, NodeType: "e2-standard-8", Spot: true},
+				},
+			},
+			errorExpected: false,
+		}, {
+			req: &Request{
+				Project:     "project-k",
+				ClusterName: "name-k",
+				NodePools: []NodePool{
+					{Name: "pool", MinNodes: 1, MaxNodes: 1, NodeType: "e2-standard-4"},
+					{Name: "pool", MinNodes: 1, MaxNodes: 1, NodeType: "e2-standard-4"},
+				},
+			},
+			errorExpected: true,
+		}, {
+			req: &Request{
+				Project:     "project-l",
+				ClusterName: "name-l",
+				NodePools: []NodePool{
+					{Name: "spot", MinNodes: 0, MaxNodes: 10, NodeType: "e2-standard-8", Spot: true},
+				},
+			},
+			errorExpected: true,
+		}, {
+			req: &Request{
+				Project:     "project-m",
+				ClusterName: "name-m",
+				NodePools: []NodePool{{
+					Name: "system", MinNodes: 1, MaxNodes: 1, NodeType: "e2-standard-4",
+					Taints: []Taint{{Key: "dedicated", Value: "system", Effect: "NoSchedule"}},
+				}},
+			},
+			errorExpected: true,
+		}, {
+			req: &Request{
+				Project:     "project-n",
+				ClusterName: "name-n",
+				NodePools: []NodePool{
+					{Name: "pool", MinNodes: 1, MaxNodes: 1, NodeType: "e2-standard-4", DiskSizeGB: 5},
+				},
+			},
+			errorExpected: true,
+		}, {
+			req: &Request{
+				Project:            "project-o",
+				ClusterName:        "name-o",
+				MinNodes:           1,
+				MaxNodes:           1,
+				NodeType:           "n1-standard-4",
+				Network:            "network-o",
+				Subnetwork:         "subnetwork-o",
+				EnablePrivateNodes: true,
+				MasterIPv4CIDR:     "172.16.0.32/28",
+			},
+			errorExpected: false,
+		}, {
+			req: &Request{
+				Project:     "project-p",
+				ClusterName: "name-p",
+				MinNodes:    1,
+				MaxNodes:    1,
+				NodeType:    "n1-standard-4",
+				Subnetwork:  "subnetwork-p",
+			},
+			errorExpected: true,
+		}, {
+			req: &Request{
+				Project:            "project-q",
+				ClusterName:        "name-q",
+				MinNodes:           1,
+				MaxNodes:           1,
+				NodeType:           "n1-standard-4",
+				EnablePrivateNodes: true,
+			},
+			errorExpected: true,
+		}, {
+			req: &Request{
+				Project:            "project-r",
+				ClusterName:        "name-r",
+				MinNodes:           1,
+				MaxNodes:           1,
+				NodeType:           "n1-standard-4",
+				EnablePrivateNodes: true,
+				MasterIPv4CIDR:     "172.16.0.0/24",
+			},
+			errorExpected: true,
+		}, {
+			req: &Request{
+				Project:               "project-s",
+				ClusterName:           "name-s",
+				MinNodes:              1,
+				MaxNodes:              1,
+				NodeType:              "n1-standard-4",
+				EnablePrivateEndpoint: true,
+			},
+			errorExpected: true,
+		}, {
+			req: &Request{
+				Project:        "project-t",
+				ClusterName:    "name-t",
+				MinNodes:       1,
+				MaxNodes:       1,
+				NodeType:       "n1-standard-4",
+				ResourceLabels: map[string]string{"knative-prow-job": "ci-knative-serving-continuous", "knative-expires-at": "1600000000"},
+			},
+			errorExpected: false,
+		}, {
+			req: &Request{
+				Project:        "project-u",
+				ClusterName:    "name-u",
+				MinNodes:       1,
+				MaxNodes:       1,
+				NodeType:       "n1-standard-4",
+				ResourceLabels: map[string]string{"Owner": "me"},
+			},
+			errorExpected: true,
+		}, {
+			req: &Request{
+				Project:        "project-v",
+				ClusterName:    "name-v",
+				MinNodes:       1,
+				MaxNodes:       1,
+				NodeType:       "n1-standard-4",
+				ResourceLabels: map[string]string{"expires-at": "2020-01-01T00:00:00Z"},
+			},
+			errorExpected: true,
 		}}
 	for _, data := range datas {
 		createReq, err := NewCreateClusterRequest(data.req)
@@ -185,3 +322,88 @@ func TestNewCreateClusterRequest(t *testing.T) {
 		}
 	}
 }
+
+func TestNewCreateClusterRequestNodePools(t *testing.T) {
+	req := &Request{
+		Project:        "project-a",
+		ClusterName:    "name-a",
+		ServiceAccount: "sa-a",
+		NodePools: []NodePool{{
+			Name:     "system",
+			MinNodes: 1,
+			MaxNodes: 2,
+			NodeType: "e2-standard-4",
+			Labels:   map[string]string{"dedicated": "system"},
+			Taints:   []Taint{{Key: "dedicated", Value: "system", Effect: TaintEffectNoSchedule}},
+		}, {
+			Name:       "spot",
+			MinNodes:   0,
+			MaxNodes:   10,
+			NodeType:   "e2-standard-8",
+			Spot:       true,
+			DiskSizeGB: 50,
+			DiskType:   "pd-ssd",
+			ImageType:  "COS_CONTAINERD",
+			Zones:      []string{"us-central1-a", "us-central1-b"},
+		}},
+		Network:               "network-a",
+		Subnetwork:            "subnetwork-a",
+		EnablePrivateNodes:    true,
+		EnablePrivateEndpoint: true,
+		MasterIPv4CIDR:        "172.16.0.32/28",
+	}
+	ccr, err := NewCreateClusterRequest(req)
+	if err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	want := []*container.NodePool{{
+		Name:             "system",
+		InitialNodeCount: 1,
+		Autoscaling:      &container.NodePoolAutoscaling{Enabled: true, MinNodeCount: 1, MaxNodeCount: 2},
+		Config: &container.NodeConfig{
+			MachineType:    "e2-standard-4",
+			OauthScopes:    []string{container.CloudPlatformScope},
+			Labels:         map[string]string{"dedicated": "system"},
+			Taints:         []*container.NodeTaint{{Key: "dedicated", Value: "system", Effect: "NO_SCHEDULE"}},
+			ServiceAccount: "sa-a",
+		},
+	}, {
+		Name:             "spot",
+		InitialNodeCount: 0,
+		Autoscaling:      &container.NodePoolAutoscaling{Enabled: true, MinNodeCount: 0, MaxNodeCount: 10},
+		Config: &container.NodeConfig{
+			MachineType:    "e2-standard-8",
+			OauthScopes:    []string{container.CloudPlatformScope},
+			Preemptible:    true,
+			DiskSizeGb:     50,
+			DiskType:       "pd-ssd",
+			ImageType:      "COS_CONTAINERD",
+			ServiceAccount: "sa-a",
+		},
+		Locations: []string{"us-central1-a", "us-central1-b"},
+	}}
+	if !reflect.DeepEqual(ccr.Cluster.NodePools, want) {
+		t.Errorf("Expected node pools %+v, but got %+v", want, ccr.Cluster.NodePools)
+	}
+	if ccr.Cluster.Network != "network-a" || ccr.Cluster.Subnetwork != "subnetwork-a" {
+		t.Errorf("Expected network 'network-a' and subnetwork 'subnetwork-a', but got %q and %q", ccr.Cluster.Network, ccr.Cluster.Subnetwork)
+	}
+	wantPrivate := &container.PrivateClusterConfig{EnablePrivateNodes: true, EnablePrivateEndpoint: true, MasterIpv4CidrBlock: "172.16.0.32/28"}
+	if !reflect.DeepEqual(ccr.Cluster.PrivateClusterConfig, wantPrivate) {
+		t.Errorf("Expected private cluster config %+v, but got %+v", wantPrivate, ccr.Cluster.PrivateClusterConfig)
+	}
+	if ccr.Cluster.IpAllocationPolicy == nil || !ccr.Cluster.IpAllocationPolicy.UseIpAliases {
+		t.Errorf("Expected a VPC-native cluster, but got IP allocation policy %+v", ccr.Cluster.IpAllocationPolicy)
+	}
+
+	// DeepCopy doesn't share the node pools with the original request.
+	cp := req.DeepCopy()
+	cp.NodePools[0].Labels["dedicated"] = "other"
+	cp.NodePools[1].Zones[0] = "us-east1-b"
+	if !reflect.DeepEqual(cp.NodePools[0].Taints, req.NodePools[0].Taints) {
+		t.Errorf("Expected taints %+v, but got %+v", req.NodePools[0].Taints, cp.NodePools[0].Taints)
+	}
+	if req.NodePools[0].Labels["dedicated"] != "system" || req.NodePools[1].Zones[0] != "us-central1-a" {
+		t.Errorf("Expected the node pools of the original request to be unchanged, but got %+v", req.NodePools)
+	}
+}
@@ -17,8 +17,11 @@ limitations under the License.
 package gke
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"strings"
 	"time"
 
 	container "google.golang.org/api/container/v1beta1"
@@ -28,50 +31,185 @@ import (
 var (
 	creationTimeout = 20 * time.Minute
 	deletionTimeout = 10 * time.Minute
+	nodePoolTimeout = 20 * time.Minute
+	upgradeTimeout  = 60 * time.Minute
+	labelsTimeout   = 5 * time.Minute
 )
 
 const (
 	pendingStatus = "PENDING"
 	runningStatus = "RUNNING"
 	doneStatus    = "DONE"
+
+	// The operation is polled with exponential backoff, with a random jitter
+	// so that concurrent waits don't poll at the same time
+	defaultInitialInterval = 500 * time.Millisecond
+	defaultMaxInterval     = 15 * time.Second
+	backoffFactor          = 1.5
+	backoffJitter          = 0.2
+	// Have seen intermittent errors getting operations that fixed themselves,
+	// only fail after this number of consecutive errors, which are retried
+	// quickly in case of weird network error, or rate limiting
+	maxGetOperationErrors = 3
+	errorRetryInterval    = 50 * time.Millisecond
 )
 
+// Progress is the progress of an operation being waited for
+type Progress struct {
+	Operation *container.Operation
+	// Percent is the progress in percents computed from the metrics of the
+	// operation, -1 if unknown
+	Percent int
+}
+
+type waitOptions struct {
+	timeout         time.Duration
+	initialInterval time.Duration
+	maxInterval     time.Duration
+	progress        func(Progress)
+}
+
+// WaitOption sets an option of Wait
+type WaitOption func(*waitOptions)
+
+// WithTimeout sets the maximum time to wait, on top of the deadline of the
+// context. The synchronous functions of SDKOperations have a default timeout
+// based on the operation.
+func WithTimeout(timeout time.Duration) WaitOption {
+	return func(o *waitOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithPollInterval sets the first and maximum intervals between polls of the
+// operation
+func WithPollInterval(initial, max time.Duration) WaitOption {
+	return func(o *waitOptions) {
+		o.initialInterval = initial
+		o.maxInterval = max
+	}
+}
+
+// WithProgress calls f every time the operation is polled
+func WithProgress(f func(Progress)) WaitOption {
+	return func(o *waitOptions) {
+		o.progress = f
+	}
+}
+
 // Wait depends on unique opName(operation ID created by cloud), and waits until
-// it's done
-func Wait(gsc SDKOperations, project, region, zone, opName string, wait time.Duration) error {
-	var op *container.Operation
-	var err error
-
-	timeout := time.After(wait)
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
-	for {
-		select {
-		// Got a timeout! fail with a timeout error
-		case <-timeout:
-			return errors.New("timed out waiting")
-		case <-ticker.C:
-			// Retry 3 times in case of weird network error, or rate limiting
-			for r, w := 0, 50*time.Microsecond; r < 3; r, w = r+1, w*2 {
-				op, err = gsc.GetOperation(project, region, zone, opName)
-				if err == nil {
-					if op.Status == doneStatus {
-						return nil
-					} else if op.Status == pendingStatus || op.Status == runningStatus {
-						// Valid operation, no need to retry
-						break
-					} else {
-						// Have seen intermittent error state and fixed itself,
-						// let it retry to avoid too much flakiness
-						err = fmt.Errorf("unexpected operation status: %q", op.Status)
-					}
-				}
-				time.Sleep(w)
+// it's done, the context is done or the timeout is reached. It returns an
+// OperationError if the operation failed or timed out.
+func Wait(ctx context.Context, gsc SDKOperations, project, region, zone, opName string, opts ...WaitOption) error {
+	o := &waitOptions{
+		initialInterval: defaultInitialInterval,
+		maxInterval:     defaultMaxInterval,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+
+	// op is the last valid state of the operation
+	op := &container.Operation{Name: opName}
+	// ctxError returns the error of the wait once the context is done
+	ctxError := func() error {
+		kind := ctx.Err()
+		if errors.Is(kind, context.DeadlineExceeded) {
+			kind = ErrTimeout
+		}
+		return &OperationError{
+			Name:     opName,
+			Type:     op.OperationType,
+			Status:   op.Status,
+			Message:  op.StatusMessage,
+			Progress: progressPercent(op),
+			Err:      kind,
+		}
+	}
+	interval := o.initialInterval
+	for errCount := 0; ; {
+		got, err := gsc.GetOperation(ctx, project, region, zone, opName)
+		if err == nil && got.Status != pendingStatus && got.Status != runningStatus && got.Status != doneStatus {
+			// Have seen intermittent error state and fixed itself,
+			// let it retry to avoid too much flakiness
+			err = fmt.Errorf("unexpected operation status: %q", got.Status)
+		}
+		var wait time.Duration
+		if err != nil {
+			// The error is most likely caused by the context being done,
+			// e.g. a canceled request.
+			if ctx.Err() != nil {
+				return ctxError()
 			}
-			// If err still persist after retries, exit
-			if err != nil {
+			if errCount++; errCount >= maxGetOperationErrors {
 				return err
 			}
+			wait = errorRetryInterval << (errCount - 1)
+		} else {
+			errCount = 0
+			op = got
+			if o.progress != nil {
+				o.progress(Progress{Operation: op, Percent: progressPercent(op)})
+			}
+			if op.Status == doneStatus {
+				return newOperationError(op)
+			}
+			wait = withJitter(interval)
+			if interval = time.Duration(float64(interval) * backoffFactor); interval > o.maxInterval {
+				interval = o.maxInterval
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctxError()
+		case <-timer.C:
+		}
+	}
+}
+
+// withJitter randomizes d by +/- backoffJitter
+func withJitter(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * (1 + backoffJitter*(2*rand.Float64()-1)))
+}
+
+// progressPercent computes the progress of an operation from the metrics of
+// its progress, e.g. {"nodes done": 3, "nodes total": 4}. It returns -1 if
+// there is no such metrics.
+func progressPercent(op *container.Operation) int {
+	if op.Status == doneStatus {
+		return 100
+	}
+	if op.Progress == nil {
+		return -1
+	}
+	done := map[string]int64{}
+	total := map[string]int64{}
+	for _, m := range op.Progress.Metrics {
+		name := strings.ToLower(strings.NewReplacer("_", " ", "-", " ").Replace(m.Name))
+		switch {
+		case strings.HasSuffix(name, " done"):
+			done[strings.TrimSuffix(name, " done")] = m.IntValue
+		case strings.HasSuffix(name, " total"):
+			total[strings.TrimSuffix(name, " total")] = m.IntValue
 		}
 	}
+	var sumDone, sumTotal int64
+	for k, t := range total {
+		if d, ok := done[k]; ok && t > 0 {
+			sumDone += d
+			sumTotal += t
+		}
+	}
+	if sumTotal == 0 {
+		return -1
+	}
+	return int(sumDone * 100 / sumTotal)
 }
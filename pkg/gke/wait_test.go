@@ -0,0 +1,188 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	container "google.golang.org/api/container/v1beta1"
+)
+
+// opSequence returns the operations in sequence, then the last one forever
+type opSequence struct {
+	SDKOperations
+	ops  []*container.Operation
+	errs []error
+	// calls is the number of calls to GetOperation
+	calls int
+}
+
+func (s *opSequence) GetOperation(ctx context.Context, project, region, zone, opName string) (*container.Operation, error) {
+	i := s.calls
+	if i >= len(s.ops) {
+		i = len(s.ops) - 1
+	}
+	s.calls++
+	if i < len(s.errs) && s.errs[i] != nil {
+		return nil, s.errs[i]
+	}
+	return s.ops[i], nil
+}
+
+func TestWait(t *testing.T) {
+	running := func(done int64) *container.Operation {
+		return &container.Operation{Name: "op", Status: runningStatus, Progress: &container.OperationProgress{
+			Metrics: []*container.Metric{{Name: "NODES_DONE", IntValue: done}, {Name: "NODES_TOTAL", IntValue: 4}},
+		}}
+	}
+	errTransient := errors.New("transient error")
+	datas := []struct {
+		name      string
+		seq       *opSequence
+		timeout   time.Duration
+		wantErr   error
+		wantMsg   string
+		wantCalls int
+		// wantProgress are the percents reported, not checked if nil
+		wantProgress []int
+	}{{
+		name: "done after running",
+		seq: &opSequence{ops: []*container.Operation{
+			{Name: "op", Status: pendingStatus}, running(1), running(3), {Name: "op", Status: doneStatus},
+		}},
+		wantCalls:    4,
+		wantProgress: []int{-1, 25, 75, 100},
+	}, {
+		name: "transient errors",
+		seq: &opSequence{
+			ops:  []*container.Operation{nil, {Name: "op", Status: "WEIRD"}, running(1), nil, {Name: "op", Status: doneStatus}},
+			errs: []error{errTransient, nil, nil, errTransient},
+		},
+		wantCalls: 5,
+	}, {
+		name: "persistent errors",
+		seq: &opSequence{
+			ops:  []*container.Operation{nil, nil, nil, {Name: "op", Status: doneStatus}},
+			errs: []error{errTransient, errTransient, errTransient},
+		},
+		wantErr:   errTransient,
+		wantCalls: 3,
+	}, {
+		name: "stockout",
+		seq: &opSequence{ops: []*container.Operation{{
+			Name: "op", OperationType: "CREATE_CLUSTER", Status: doneStatus,
+			StatusMessage:     "Try a different location",
+			ClusterConditions: []*container.StatusCondition{{Code: "GCE_STOCKOUT", Message: "Try a different location"}},
+		}}},
+		wantErr:   ErrStockout,
+		wantMsg:   `operation CREATE_CLUSTER "op": not enough resources available in the location, last status DONE (100%): Try a different location`,
+		wantCalls: 1,
+	}, {
+		name: "invalid version",
+		seq: &opSequence{ops: []*container.Operation{{
+			Name: "op", Status: doneStatus, StatusMessage: `Master version "1.99" is unsupported.`,
+		}}},
+		wantErr:   ErrInvalidVersion,
+		wantCalls: 1,
+	}, {
+		name: "done with a warning",
+		seq: &opSequence{ops: []*container.Operation{{
+			Name: "op", Status: doneStatus, StatusMessage: "Node auto-upgrade is enabled by default.",
+		}}},
+		wantCalls: 1,
+	}, {
+		name: "permission denied",
+		seq: &opSequence{ops: []*container.Operation{{
+			Name: "op", Status: doneStatus, StatusMessage: "Permission denied on resource project.",
+		}}},
+		wantErr:   ErrOperationFailed,
+		wantCalls: 1,
+	}, {
+		name:      "timeout",
+		seq:       &opSequence{ops: []*container.Operation{running(2)}},
+		timeout:   50 * time.Millisecond,
+		wantErr:   ErrTimeout,
+		wantMsg:   `operation "op": timed out waiting for the operation, last status RUNNING (50%)`,
+		wantCalls: -1,
+	}}
+	for _, data := range datas {
+		t.Run(data.name, func(t *testing.T) {
+			var progress []int
+			opts := []WaitOption{
+				WithPollInterval(time.Millisecond, 5*time.Millisecond),
+				WithProgress(func(p Progress) {
+					progress = append(progress, p.Percent)
+				}),
+			}
+			if data.timeout != 0 {
+				opts = append(opts, WithTimeout(data.timeout))
+			}
+			err := Wait(context.Background(), data.seq, "project", "region", "", "op", opts...)
+			if data.wantErr == nil && err != nil {
+				t.Fatalf("Expected no error, but got '%v'", err)
+			}
+			if data.wantErr != nil && !errors.Is(err, data.wantErr) {
+				t.Fatalf("Expected error '%v', but got '%v'", data.wantErr, err)
+			}
+			if data.wantMsg != "" && err.Error() != data.wantMsg {
+				t.Fatalf("Expected error message %q, but got %q", data.wantMsg, err.Error())
+			}
+			if data.wantCalls >= 0 && data.seq.calls != data.wantCalls {
+				t.Fatalf("Expected %d calls of GetOperation, but got %d", data.wantCalls, data.seq.calls)
+			}
+			if data.wantProgress != nil && !reflect.DeepEqual(progress, data.wantProgress) {
+				t.Fatalf("Expected progress %v, but got %v", data.wantProgress, progress)
+			}
+		})
+	}
+}
+
+func TestWaitCanceled(t *testing.T) {
+	seq := &opSequence{ops: []*container.Operation{{Name: "op", Status: runningStatus}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	err := Wait(ctx, seq, "project", "region", "", "op", WithPollInterval(time.Millisecond, time.Millisecond))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected error '%v', but got '%v'", context.Canceled, err)
+	}
+}
+
+// blockingOps blocks GetOperation until the context is done
+type blockingOps struct {
+	SDKOperations
+}
+
+func (blockingOps) GetOperation(ctx context.Context, project, region, zone, opName string) (*container.Operation, error) {
+	<-ctx.Done()
+	return nil, fmt.Errorf("error getting operation: %w", ctx.Err())
+}
+
+func TestWaitTimeoutGettingOperation(t *testing.T) {
+	err := Wait(context.Background(), blockingOps{}, "project", "region", "", "op", WithTimeout(20*time.Millisecond))
+	var opErr *OperationError
+	if !errors.Is(err, ErrTimeout) || !errors.As(err, &opErr) || opErr.Name != "op" {
+		t.Fatalf("Expected an OperationError with error '%v', but got '%v'", ErrTimeout, err)
+	}
+}
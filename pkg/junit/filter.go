@@ -0,0 +1,120 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// filter.go selects and summarizes testcases of junit results
+
+package junit
+
+import (
+	"sort"
+)
+
+// Filter returns a copy of the TestSuites that only holds the testcases for
+// which keep returns true. Testsuites left without any testcase are dropped,
+// and all counts of the result are recomputed.
+func (testSuites *TestSuites) Filter(keep func(suite *TestSuite, tc *TestCase) bool) *TestSuites {
+	filtered := *testSuites
+	filtered.Suites = filterSuites(testSuites.Suites, keep)
+	filtered.UpdateCounts()
+	return &filtered
+}
+
+func filterSuites(suites []TestSuite, keep func(suite *TestSuite, tc *TestCase) bool) []TestSuite {
+	var res []TestSuite
+	for i := range suites {
+		suite := suites[i]
+		suite.TestCases = nil
+		for j := range suites[i].TestCases {
+			if keep(&suites[i], &suites[i].TestCases[j]) {
+				suite.TestCases = append(suite.TestCases, suites[i].TestCases[j])
+			}
+		}
+		suite.Suites = filterSuites(suites[i].Suites, keep)
+		if len(suite.TestCases) != 0 || len(suite.Suites) != 0 {
+			res = append(res, suite)
+		}
+	}
+	return res
+}
+
+// TestCaseResult is a testcase together with the name of its testsuite
+type TestCaseResult struct {
+	Suite string
+	TestCase
+}
+
+// FullName returns the name of the testcase prefixed with its testsuite name
+func (r *TestCaseResult) FullName() string {
+	return r.Suite + "." + r.Name
+}
+
+// Summary holds the aggregated results of TestSuites
+type Summary struct {
+	Tests   int
+	Passed  int
+	Failed  int
+	Errored int
+	Skipped int
+	// Time is the sum of the durations of all testcases, in seconds
+	Time float64
+	// Failures holds the failed and errored testcases, in the order they appear
+	Failures []TestCaseResult
+	// Slowest holds the slowest testcases, the slowest first
+	Slowest []TestCaseResult
+}
+
+// Summarize aggregates the results of all testcases, including the ones in
+// nested testsuites, and finds the slowest n of them.
+func (testSuites *TestSuites) Summarize(n int) *Summary {
+	s := &Summary{}
+	var all []TestCaseResult
+	var walk func(suites []TestSuite)
+	walk = func(suites []TestSuite) {
+		for _, suite := range suites {
+			for _, tc := range suite.TestCases {
+				r := TestCaseResult{Suite: suite.Name, TestCase: tc}
+				all = append(all, r)
+				s.Tests++
+				s.Time += tc.Seconds()
+				switch tc.GetTestStatus() {
+				case Passed:
+					s.Passed++
+				case Failed:
+					s.Failed++
+					s.Failures = append(s.Failures, r)
+				case Errored:
+					s.Errored++
+					s.Failures = append(s.Failures, r)
+				case Skipped:
+					s.Skipped++
+				}
+			}
+			walk(suite.Suites)
+		}
+	}
+	walk(testSuites.Suites)
+
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Seconds() > all[j].Seconds()
+	})
+	if n > len(all) {
+		n = len(all)
+	}
+	if n > 0 {
+		s.Slowest = all[:n]
+	}
+	return s
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// filter_test.go contains unit tests for filtering and summarizing junit results
+
+package junit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	suites := mustUnMarshal(t, goJunitReportString)
+	failing := suites.Filter(func(suite *TestSuite, tc *TestCase) bool {
+		status := tc.GetTestStatus()
+		return status == Failed || status == Errored
+	})
+	if failing.Tests != 2 || failing.Failures != 1 || failing.Errors != 1 {
+		t.Fatalf("Expected tests=2 failures=1 errors=1, actual tests=%d failures=%d errors=%d",
+			failing.Tests, failing.Failures, failing.Errors)
+	}
+	if len(suites.Suites[0].TestCases) != 4 {
+		t.Fatalf("Expected the input to be unchanged, actual %d testcases", len(suites.Suites[0].TestCases))
+	}
+
+	none := suites.Filter(func(*TestSuite, *TestCase) bool { return false })
+	if len(none.Suites) != 0 || none.Tests != 0 {
+		t.Fatalf("Expected empty suites to be dropped, actual %+v", none.Suites)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	s := mustUnMarshal(t, goJunitReportString).Summarize(2)
+	if s.Tests != 4 || s.Passed != 1 || s.Failed != 1 || s.Errored != 1 || s.Skipped != 1 {
+		t.Fatalf("Unexpected counts %+v", s)
+	}
+	if len(s.Failures) != 2 || s.Failures[0].Name != "TestBad" || s.Failures[1].Name != "TestPanic" {
+		t.Fatalf("Unexpected failures %+v", s.Failures)
+	}
+	if len(s.Slowest) != 2 || s.Slowest[0].Name != "TestGood" || s.Slowest[1].Name != "TestBad" {
+		t.Fatalf("Unexpected slowest tests %+v", s.Slowest)
+	}
+	if !strings.HasSuffix(s.Slowest[0].FullName(), "pkg/foo.TestGood") {
+		t.Fatalf("Unexpected full name %q", s.Slowest[0].FullName())
+	}
+}
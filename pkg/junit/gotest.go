@@ -0,0 +1,179 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// gotest.go converts the output of `go test -json` to junit results
+
+package junit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxLineSize is the longest line the parsers accept, test output can have
+// very long lines, e.g. when dumping a Kubernetes object
+const maxLineSize = 16 * 1024 * 1024
+
+// goTestEvent is a single event emitted by `go test -json`, see `go doc test2json`
+type goTestEvent struct {
+	Time    time.Time
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+type goTestCase struct {
+	name    string
+	action  string
+	elapsed float64
+	output  strings.Builder
+}
+
+type goTestPackage struct {
+	name      string
+	action    string
+	elapsed   float64
+	timestamp time.Time
+	output    strings.Builder
+	tests     []*goTestCase
+	testIndex map[string]*goTestCase
+}
+
+func (p *goTestPackage) test(name string) *goTestCase {
+	tc, ok := p.testIndex[name]
+	if !ok {
+		tc = &goTestCase{name: name}
+		p.testIndex[name] = tc
+		p.tests = append(p.tests, tc)
+	}
+	return tc
+}
+
+// ParseGoTestJSON converts the output of `go test -json` into TestSuites, with
+// one testsuite per package.
+// Tests that were started but never finished, e.g. because of a panic or a
+// timeout, and packages that failed without any failed test, e.g. because they
+// did not build, are reported as errors.
+// Lines that are not JSON events are ignored, so the combined output of
+// `go test -json` and `go vet` can be parsed as well.
+func ParseGoTestJSON(r io.Reader) (*TestSuites, error) {
+	var packages []*goTestPackage
+	packageIndex := make(map[string]*goTestPackage)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var ev goTestEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			continue
+		}
+
+		pkg, ok := packageIndex[ev.Package]
+		if !ok {
+			pkg = &goTestPackage{name: ev.Package, timestamp: ev.Time, testIndex: make(map[string]*goTestCase)}
+			packageIndex[ev.Package] = pkg
+			packages = append(packages, pkg)
+		}
+
+		if ev.Test == "" {
+			switch ev.Action {
+			case "output":
+				pkg.output.WriteString(ev.Output)
+			case "pass", "fail", "skip":
+				pkg.action = ev.Action
+				pkg.elapsed = ev.Elapsed
+			}
+			continue
+		}
+
+		tc := pkg.test(ev.Test)
+		switch ev.Action {
+		case "output":
+			tc.output.WriteString(ev.Output)
+		case "pass", "fail", "skip":
+			tc.action = ev.Action
+			tc.elapsed = ev.Elapsed
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading go test output: %w", err)
+	}
+
+	suites := &TestSuites{}
+	for _, pkg := range packages {
+		suites.Suites = append(suites.Suites, pkg.toTestSuite())
+	}
+	suites.UpdateCounts()
+	return suites, nil
+}
+
+func (p *goTestPackage) toTestSuite() TestSuite {
+	suite := TestSuite{
+		Name: p.name,
+		Time: formatSeconds(p.elapsed),
+	}
+	if !p.timestamp.IsZero() {
+		suite.Timestamp = p.timestamp.UTC().Format(time.RFC3339)
+	}
+
+	failed := false
+	for _, t := range p.tests {
+		tc := TestCase{
+			Name:      t.name,
+			ClassName: p.name,
+			Time:      formatSeconds(t.elapsed),
+		}
+		output := t.output.String()
+		switch t.action {
+		case "fail":
+			failed = true
+			tc.Failure = &Result{Message: "Failed", Value: output}
+		case "skip":
+			tc.Skipped = &Result{Message: "Skipped", Value: output}
+		case "pass":
+			if output != "" {
+				tc.SystemOut = []string{output}
+			}
+		default:
+			failed = true
+			tc.ErrorResult = &Result{Message: "Test did not finish", Value: output}
+		}
+		suite.AddTestCase(tc)
+	}
+
+	if p.action == "fail" && !failed {
+		// The package failed without any test failing, e.g. a build error,
+		// a panic in TestMain or a test binary timeout.
+		suite.AddTestCase(TestCase{
+			Name:        p.name,
+			ClassName:   p.name,
+			ErrorResult: &Result{Message: "Package failed", Value: p.output.String()},
+		})
+	} else if out := p.output.String(); out != "" {
+		suite.SystemOut = []string{out}
+	}
+	return suite
+}
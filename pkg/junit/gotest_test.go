@@ -0,0 +1,98 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// gotest_test.go contains unit tests for converting go test output
+
+package junit
+
+import (
+	"strings"
+	"testing"
+)
+
+var goTestJSON = `{"Time":"2020-11-10T10:20:30Z","Action":"run","Package":"knative.dev/foo","Test":"TestGood"}
+{"Time":"2020-11-10T10:20:30Z","Action":"output","Package":"knative.dev/foo","Test":"TestGood","Output":"=== RUN   TestGood\n"}
+{"Time":"2020-11-10T10:20:31Z","Action":"pass","Package":"knative.dev/foo","Test":"TestGood","Elapsed":1.5}
+{"Time":"2020-11-10T10:20:31Z","Action":"run","Package":"knative.dev/foo","Test":"TestBad"}
+{"Time":"2020-11-10T10:20:31Z","Action":"output","Package":"knative.dev/foo","Test":"TestBad","Output":"    foo_test.go:10: something bad\n"}
+{"Time":"2020-11-10T10:20:31Z","Action":"fail","Package":"knative.dev/foo","Test":"TestBad","Elapsed":0.2}
+{"Time":"2020-11-10T10:20:31Z","Action":"run","Package":"knative.dev/foo","Test":"TestSkip"}
+{"Time":"2020-11-10T10:20:31Z","Action":"skip","Package":"knative.dev/foo","Test":"TestSkip","Elapsed":0}
+{"Time":"2020-11-10T10:20:31Z","Action":"output","Package":"knative.dev/foo","Output":"FAIL\n"}
+{"Time":"2020-11-10T10:20:31Z","Action":"fail","Package":"knative.dev/foo","Elapsed":1.8}
+# knative.dev/bar
+bar.go:3:1: syntax error
+{"Time":"2020-11-10T10:20:32Z","Action":"output","Package":"knative.dev/bar","Output":"FAIL\tknative.dev/bar [build failed]\n"}
+{"Time":"2020-11-10T10:20:32Z","Action":"fail","Package":"knative.dev/bar","Elapsed":0}
+{"Time":"2020-11-10T10:20:32Z","Action":"run","Package":"knative.dev/baz","Test":"TestPanic"}
+{"Time":"2020-11-10T10:20:32Z","Action":"output","Package":"knative.dev/baz","Test":"TestPanic","Output":"panic: runtime error\n"}
+{"Time":"2020-11-10T10:20:32Z","Action":"fail","Package":"knative.dev/baz","Elapsed":0.1}
+`
+
+func TestParseGoTestJSON(t *testing.T) {
+	suites, err := ParseGoTestJSON(strings.NewReader(goTestJSON))
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	if len(suites.Suites) != 3 {
+		t.Fatalf("Expected 3 suites, actual %d", len(suites.Suites))
+	}
+	if suites.Tests != 5 || suites.Failures != 1 || suites.Errors != 2 || suites.Skipped != 1 {
+		t.Fatalf("Expected tests=5 failures=1 errors=2 skipped=1, actual tests=%d failures=%d errors=%d skipped=%d",
+			suites.Tests, suites.Failures, suites.Errors, suites.Skipped)
+	}
+
+	foo := suites.Suites[0]
+	if foo.Name != "knative.dev/foo" || foo.Time != "1.800" || foo.Timestamp != "2020-11-10T10:20:30Z" {
+		t.Fatalf("Unexpected suite attributes %+v", foo)
+	}
+	want := []struct {
+		name   string
+		time   string
+		status TestStatusEnum
+	}{{"TestGood", "1.500", Passed}, {"TestBad", "0.200", Failed}, {"TestSkip", "0.000", Skipped}}
+	for i, w := range want {
+		tc := foo.TestCases[i]
+		if tc.Name != w.name || tc.Time != w.time || tc.GetTestStatus() != w.status || tc.ClassName != foo.Name {
+			t.Errorf("Expected testcase %+v, actual %+v", w, tc)
+		}
+	}
+	if got := foo.TestCases[1].Failure.Value; got != "    foo_test.go:10: something bad\n" {
+		t.Errorf("Expected the test output as failure, actual %q", got)
+	}
+
+	bar := suites.Suites[1]
+	if len(bar.TestCases) != 1 || bar.TestCases[0].ErrorResult == nil || !strings.Contains(bar.TestCases[0].ErrorResult.Value, "build failed") {
+		t.Errorf("Expected the build failure to be reported as an error, actual %+v", bar.TestCases)
+	}
+	baz := suites.Suites[2]
+	if len(baz.TestCases) != 1 || baz.TestCases[0].GetTestStatus() != Errored {
+		t.Errorf("Expected the unfinished test to be reported as an error, actual %+v", baz.TestCases)
+	}
+}
+
+func TestParseGoTestJSONLongLine(t *testing.T) {
+	long := strings.Repeat("x", 1024*1024)
+	input := `{"Action":"output","Package":"p","Test":"TestLong","Output":"` + long + `"}` + "\n" +
+		`{"Action":"pass","Package":"p","Test":"TestLong"}` + "\n"
+	suites, err := ParseGoTestJSON(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	if got := suites.Suites[0].TestCases[0].SystemOut[0]; len(got) != len(long) {
+		t.Fatalf("Expected output of length %d, actual %d", len(long), len(got))
+	}
+}
@@ -23,6 +23,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"strconv"
+	"strings"
 )
 
 // TestStatusEnum is a enum for test result status
@@ -31,6 +33,9 @@ type TestStatusEnum string
 const (
 	// Failed means junit test failed
 	Failed TestStatusEnum = "failed"
+	// Errored means junit test could not run properly, e.g. because of an
+	// infrastructure problem or an unexpected panic
+	Errored TestStatusEnum = "errored"
 	// Skipped means junit test skipped
 	Skipped TestStatusEnum = "skipped"
 	// Passed means junit test passed
@@ -39,8 +44,18 @@ const (
 
 // TestSuites holds a <testSuites/> list of TestSuite results
 type TestSuites struct {
-	XMLName xml.Name    `xml:"testsuites"`
-	Suites  []TestSuite `xml:"testsuite"`
+	XMLName  xml.Name    `xml:"testsuites"`
+	Name     string      `xml:"name,attr,omitempty"`
+	Time     string      `xml:"time,attr,omitempty"` // Seconds
+	Tests    int         `xml:"tests,attr,omitempty"`
+	Failures int         `xml:"failures,attr,omitempty"`
+	Errors   int         `xml:"errors,attr,omitempty"`
+	Skipped  int         `xml:"skipped,attr,omitempty"`
+	Suites   []TestSuite `xml:"testsuite"`
+	// Attrs and Extra keep the attributes and elements not modeled above,
+	// so that unmarshaling and marshaling again does not lose them.
+	Attrs []xml.Attr `xml:",any,attr"`
+	Extra []Element  `xml:",any"`
 }
 
 // TestSuite holds <testSuite/> results
@@ -50,20 +65,54 @@ type TestSuite struct {
 	Time       string         `xml:"time,attr"` // Seconds
 	Failures   int            `xml:"failures,attr"`
 	Tests      int            `xml:"tests,attr"`
+	Errors     int            `xml:"errors,attr,omitempty"`
+	Skipped    int            `xml:"skipped,attr,omitempty"`
+	Disabled   int            `xml:"disabled,attr,omitempty"`
+	ID         string         `xml:"id,attr,omitempty"`
+	Package    string         `xml:"package,attr,omitempty"`
+	Hostname   string         `xml:"hostname,attr,omitempty"`
+	Timestamp  string         `xml:"timestamp,attr,omitempty"` // ISO 8601
 	TestCases  []TestCase     `xml:"testcase"`
 	Properties TestProperties `xml:"properties"`
+	// Suites holds nested <testsuite/> elements, as written by some reporters
+	Suites    []TestSuite `xml:"testsuite"`
+	SystemOut []string    `xml:"system-out,omitempty"`
+	SystemErr []string    `xml:"system-err,omitempty"`
+	Attrs     []xml.Attr  `xml:",any,attr"`
+	Extra     []Element   `xml:",any"`
 }
 
 // TestCase holds <testcase/> results
 type TestCase struct {
-	Name       string          `xml:"name,attr"`
-	Time       string          `xml:"time,attr"` // Seconds
-	ClassName  string          `xml:"classname,attr"`
-	Failure    *string         `xml:"failure,omitempty"`
-	Output     *string         `xml:"system-out,omitempty"`
-	Error      *string         `xml:"system-err,omitempty"`
-	Skipped    *string         `xml:"skipped,omitempty"`
-	Properties *TestProperties `xml:"properties,omitempty"`
+	Name      string  `xml:"name,attr"`
+	Time      string  `xml:"time,attr"` // Seconds
+	ClassName string  `xml:"classname,attr"`
+	File      string  `xml:"file,attr,omitempty"`
+	Line      string  `xml:"line,attr,omitempty"`
+	Skipped   *Result `xml:"skipped,omitempty"`
+	// ErrorResult is the <error/> element. It's not named Error, which used
+	// to hold the <system-err/> element now in SystemErr.
+	ErrorResult *Result         `xml:"error,omitempty"`
+	Failure     *Result         `xml:"failure,omitempty"`
+	SystemOut   []string        `xml:"system-out,omitempty"`
+	SystemErr   []string        `xml:"system-err,omitempty"`
+	Properties  *TestProperties `xml:"properties,omitempty"`
+	Attrs       []xml.Attr      `xml:",any,attr"`
+	Extra       []Element       `xml:",any"`
+}
+
+// Result holds the content of a <failure/>, <error/> or <skipped/> element
+type Result struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Value   string `xml:",chardata"`
+}
+
+// Element holds an arbitrary XML element that is not part of the junit schema
+type Element struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	InnerXML string     `xml:",innerxml"`
 }
 
 // TestProperties is an array of test properties
@@ -77,10 +126,29 @@ type TestProperty struct {
 	Value string `xml:"value,attr"`
 }
 
+// NewResult creates a Result holding the given text, which is used both as
+// the message attribute and the content of the element
+func NewResult(text string) *Result {
+	return &Result{Message: text, Value: text}
+}
+
+// String returns the most descriptive text of the Result
+func (r *Result) String() string {
+	if r == nil {
+		return ""
+	}
+	if r.Value != "" {
+		return r.Value
+	}
+	return r.Message
+}
+
 // GetTestStatus returns the test status as a string
 func (testCase *TestCase) GetTestStatus() TestStatusEnum {
 	testStatus := Passed
 	switch {
+	case testCase.ErrorResult != nil:
+		testStatus = Errored
 	case testCase.Failure != nil:
 		testStatus = Failed
 	case testCase.Skipped != nil:
@@ -89,6 +157,11 @@ func (testCase *TestCase) GetTestStatus() TestStatusEnum {
 	return testStatus
 }
 
+// Seconds returns the duration of the test in seconds, or 0 if it's unknown
+func (testCase *TestCase) Seconds() float64 {
+	return parseSeconds(testCase.Time)
+}
+
 // AddProperty adds property to testcase
 func (testCase *TestCase) AddProperty(name, val string) {
 	if testCase.Properties == nil {
@@ -101,22 +174,76 @@ func (testCase *TestCase) AddProperty(name, val string) {
 // AddTestCase adds a testcase to the testsuite
 func (ts *TestSuite) AddTestCase(tc TestCase) {
 	ts.Tests++
-	if tc.GetTestStatus() == Failed {
+	switch tc.GetTestStatus() {
+	case Failed:
 		ts.Failures++
+	case Errored:
+		ts.Errors++
+	case Skipped:
+		ts.Skipped++
 	}
 	ts.TestCases = append(ts.TestCases, tc)
 }
 
+// UpdateCounts recomputes the tests, failures, errors and skipped counts of
+// the testsuite from its testcases and nested testsuites
+func (ts *TestSuite) UpdateCounts() {
+	ts.Tests, ts.Failures, ts.Errors, ts.Skipped = 0, 0, 0, 0
+	for _, tc := range ts.TestCases {
+		ts.Tests++
+		switch tc.GetTestStatus() {
+		case Failed:
+			ts.Failures++
+		case Errored:
+			ts.Errors++
+		case Skipped:
+			ts.Skipped++
+		}
+	}
+	for i := range ts.Suites {
+		nested := &ts.Suites[i]
+		nested.UpdateCounts()
+		ts.Tests += nested.Tests
+		ts.Failures += nested.Failures
+		ts.Errors += nested.Errors
+		ts.Skipped += nested.Skipped
+	}
+}
+
+// AllTestCases returns the testcases of the testsuite and all of its nested
+// testsuites
+func (ts *TestSuite) AllTestCases() []TestCase {
+	cases := append([]TestCase(nil), ts.TestCases...)
+	for i := range ts.Suites {
+		cases = append(cases, ts.Suites[i].AllTestCases()...)
+	}
+	return cases
+}
+
 // GetTestSuite gets TestSuite struct by name
 func (testSuites *TestSuites) GetTestSuite(suiteName string) (*TestSuite, error) {
-	for _, testSuite := range testSuites.Suites {
-		if testSuite.Name == suiteName {
-			return &testSuite, nil
+	for i := range testSuites.Suites {
+		if testSuites.Suites[i].Name == suiteName {
+			return &testSuites.Suites[i], nil
 		}
 	}
 	return nil, fmt.Errorf("Test suite '%s' not found", suiteName)
 }
 
+// UpdateCounts recomputes the counts of every testsuite, and the totals of
+// the testsuites
+func (testSuites *TestSuites) UpdateCounts() {
+	testSuites.Tests, testSuites.Failures, testSuites.Errors, testSuites.Skipped = 0, 0, 0, 0
+	for i := range testSuites.Suites {
+		ts := &testSuites.Suites[i]
+		ts.UpdateCounts()
+		testSuites.Tests += ts.Tests
+		testSuites.Failures += ts.Failures
+		testSuites.Errors += ts.Errors
+		testSuites.Skipped += ts.Skipped
+	}
+}
+
 // AddTestSuite adds TestSuite to TestSuites
 func (testSuites *TestSuites) AddTestSuite(testSuite *TestSuite) error {
 	if _, err := testSuites.GetTestSuite(testSuite.Name); err == nil {
@@ -155,9 +282,9 @@ func UnMarshal(buf []byte) (*TestSuites, error) {
 func CreateXMLErrorMsg(testSuite, testName, errMsg, dest string) {
 	suites := TestSuites{}
 	suite := TestSuite{Name: testSuite}
-	var errP *string
+	var errP *Result
 	if errMsg != "" {
-		errP = &errMsg
+		errP = &Result{Value: errMsg}
 	}
 	suite.AddTestCase(TestCase{
 		Name:    testName,
@@ -170,3 +297,18 @@ func CreateXMLErrorMsg(testSuite, testName, errMsg, dest string) {
 	}
 	ioutil.WriteFile(dest, contents, 0644)
 }
+
+// parseSeconds parses a time attribute, ignoring the thousands separators some
+// reporters add, and returns 0 if it's empty or invalid
+func parseSeconds(s string) float64 {
+	f, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), ",", ""), 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+// formatSeconds formats seconds the way go-junit-report writes them
+func formatSeconds(f float64) string {
+	return strconv.FormatFloat(f, 'f', 3, 64)
+}
@@ -22,7 +22,10 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 var emptySuites = `
@@ -80,14 +83,13 @@ func newTestCase(name string, status TestStatusEnum) *TestCase {
 		Name: name,
 	}
 
-	var tmp string // cast const to string
 	switch {
 	case status == Failed:
-		tmp = string(Failed)
-		testCase.Failure = &tmp
+		testCase.Failure = NewResult(string(Failed))
+	case status == Errored:
+		testCase.ErrorResult = NewResult(string(Errored))
 	case status == Skipped:
-		tmp = string(Skipped)
-		testCase.Skipped = &tmp
+		testCase.Skipped = NewResult(string(Skipped))
 	}
 
 	return &testCase
@@ -127,6 +129,9 @@ func TestGetTestStatus(t *testing.T) {
 	if status := newTestCase("TestBad", Failed).GetTestStatus(); Failed != status {
 		t.Errorf("Expected '%s', actual '%s'", Failed, status)
 	}
+	if status := newTestCase("TestInfra", Errored).GetTestStatus(); Errored != status {
+		t.Errorf("Expected '%s', actual '%s'", Errored, status)
+	}
 }
 
 func TestAddTestSuite(t *testing.T) {
@@ -172,3 +177,157 @@ func TestCreateXMLErrorMsg(t *testing.T) {
 		t.Fatalf("expected:\n%q\n, got:\n%q", expected, got)
 	}
 }
+
+// goJunitReportString is a trimmed down output of go-junit-report
+var goJunitReportString = `
+<testsuites tests="4" failures="1" errors="1" skipped="1">
+	<testsuite name="knative.dev/test-infra/pkg/foo" tests="4" failures="1" errors="1" id="0" hostname="prow-pod" skipped="1" time="1.234" timestamp="2020-11-10T10:20:30Z">
+		<properties>
+			<property name="go.version" value="go1.15"></property>
+		</properties>
+		<testcase name="TestBad" classname="knative.dev/test-infra/pkg/foo" time="0.100">
+			<failure message="Failed" type="">foo_test.go:12: something bad</failure>
+		</testcase>
+		<testcase name="TestPanic" classname="knative.dev/test-infra/pkg/foo" time="0.000">
+			<error message="Runtime error" type="panic">panic: nil pointer dereference</error>
+		</testcase>
+		<testcase name="TestSkip" classname="knative.dev/test-infra/pkg/foo" time="0.000">
+			<skipped message="foo_test.go:20: not on prow"></skipped>
+		</testcase>
+		<testcase name="TestGood" classname="knative.dev/test-infra/pkg/foo" time="1.134"></testcase>
+		<system-out>ok knative.dev/test-infra/pkg/foo</system-out>
+	</testsuite>
+</testsuites>
+`
+
+// gotestsumString is a trimmed down output of gotestsum --junitfile
+var gotestsumString = `
+<testsuites tests="2" failures="1" errors="0" time="0.512">
+	<testsuite tests="2" failures="1" time="0.512" name="knative.dev/test-infra/pkg/bar" timestamp="2020-11-10T10:20:30Z">
+		<properties>
+			<property name="go.version" value="go1.15 linux/amd64"></property>
+		</properties>
+		<testcase classname="knative.dev/test-infra/pkg/bar" name="TestBad" time="0.010">
+			<failure message="Failed" type="">=== RUN   TestBad&#xA;--- FAIL: TestBad (0.01s)&#xA;</failure>
+		</testcase>
+		<testcase classname="knative.dev/test-infra/pkg/bar" name="TestGood" time="0.500"></testcase>
+	</testsuite>
+</testsuites>
+`
+
+// nestedSuitesString has nested testsuites and non-standard attributes and elements
+var nestedSuitesString = `
+<testsuites>
+	<testsuite name="parent" tests="2" failures="1" time="2" flaky="true">
+		<testsuite name="child" tests="2" failures="1" time="2">
+			<testcase name="TestA" classname="child" time="1" retries="2">
+				<failure>bad</failure>
+				<system-out>out: first line</system-out>
+				<system-out>out: second line</system-out>
+			</testcase>
+			<testcase name="TestB" classname="child" time="1"></testcase>
+		</testsuite>
+		<custom-data key="value">some <b>data</b></custom-data>
+	</testsuite>
+</testsuites>
+`
+
+func TestUnmarshalDialects(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		tests    int
+		failures int
+		errors   int
+		skipped  int
+	}{
+		{"go-junit-report", goJunitReportString, 4, 1, 1, 1},
+		{"gotestsum", gotestsumString, 2, 1, 0, 0},
+		{"nested", nestedSuitesString, 2, 1, 0, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			suites, err := UnMarshal([]byte(tc.input))
+			if err != nil {
+				t.Fatalf("Expected: succeed, actual: failed parsing suites, '%v'", err)
+			}
+			suites.UpdateCounts()
+			if suites.Tests != tc.tests || suites.Failures != tc.failures || suites.Errors != tc.errors || suites.Skipped != tc.skipped {
+				t.Fatalf("Expected tests=%d failures=%d errors=%d skipped=%d, actual tests=%d failures=%d errors=%d skipped=%d",
+					tc.tests, tc.failures, tc.errors, tc.skipped, suites.Tests, suites.Failures, suites.Errors, suites.Skipped)
+			}
+		})
+	}
+}
+
+func TestUnmarshalAttributes(t *testing.T) {
+	suites, err := UnMarshal([]byte(goJunitReportString))
+	if err != nil {
+		t.Fatalf("Expected: succeed, actual: failed parsing suites, '%v'", err)
+	}
+	suite := suites.Suites[0]
+	if suite.Hostname != "prow-pod" || suite.Timestamp != "2020-11-10T10:20:30Z" || suite.Errors != 1 || suite.Skipped != 1 {
+		t.Fatalf("Suite level attributes are not parsed correctly: %+v", suite)
+	}
+	want := Result{Message: "Runtime error", Type: "panic", Value: "panic: nil pointer dereference"}
+	if got := suite.TestCases[1].ErrorResult; got == nil || *got != want {
+		t.Fatalf("Expected error %+v, actual %+v", want, got)
+	}
+	if got := suite.TestCases[2].Skipped.String(); got != "foo_test.go:20: not on prow" {
+		t.Fatalf("Expected skipped message to be used when there is no content, actual %q", got)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, input := range []string{validSuitesString, goJunitReportString, gotestsumString, nestedSuitesString} {
+		first, err := UnMarshal([]byte(input))
+		if err != nil {
+			t.Fatalf("Expected: succeed, actual: failed parsing suites, '%v'", err)
+		}
+		buf, err := first.ToBytes("", "  ")
+		if err != nil {
+			t.Fatalf("Expected: succeed, actual: failed marshaling suites, '%v'", err)
+		}
+		second, err := UnMarshal(buf)
+		if err != nil {
+			t.Fatalf("Expected: succeed, actual: failed parsing marshaled suites, '%v'", err)
+		}
+		if diff := cmp.Diff(first, second); diff != "" {
+			t.Fatalf("Unexpected difference after round trip (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestRoundTripKeepsUnknownData(t *testing.T) {
+	suites, err := UnMarshal([]byte(nestedSuitesString))
+	if err != nil {
+		t.Fatalf("Expected: succeed, actual: failed parsing suites, '%v'", err)
+	}
+	buf, err := suites.ToBytes("", "")
+	if err != nil {
+		t.Fatalf("Expected: succeed, actual: failed marshaling suites, '%v'", err)
+	}
+	for _, want := range []string{
+		`flaky="true"`,
+		`retries="2"`,
+		`<custom-data key="value">some <b>data</b></custom-data>`,
+		`<system-out>out: first line</system-out><system-out>out: second line</system-out>`,
+	} {
+		if !strings.Contains(string(buf), want) {
+			t.Errorf("Expected %q in marshaled output, actual:\n%s", want, buf)
+		}
+	}
+}
+
+func TestGetTestSuiteIsMutable(t *testing.T) {
+	testSuites := TestSuites{}
+	testSuites.AddTestSuite(&TestSuite{Name: "suite_0"})
+	suite, err := testSuites.GetTestSuite("suite_0")
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	suite.AddTestCase(*newTestCase("TestInfra", Errored))
+	if got := testSuites.Suites[0]; got.Tests != 1 || got.Errors != 1 {
+		t.Fatalf("Expected the change to be visible in TestSuites, actual %+v", got)
+	}
+}
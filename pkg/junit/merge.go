@@ -0,0 +1,155 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// merge.go combines multiple junit results into one
+
+package junit
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+// Merge combines all given TestSuites into a single TestSuites.
+// Testsuites with the same name are merged together. If a testcase with the
+// same classname and name shows up more than once, e.g. because it was rerun
+// after a failure, only its last occurrence is kept, in the position of the
+// first one. All counts of the result are recomputed.
+func Merge(all ...*TestSuites) *TestSuites {
+	merged := &TestSuites{}
+	for _, suites := range all {
+		if suites == nil {
+			continue
+		}
+		if merged.Name == "" {
+			merged.Name = suites.Name
+		}
+		merged.Suites = mergeSuites(merged.Suites, suites.Suites)
+		merged.Extra = append(merged.Extra, suites.Extra...)
+	}
+
+	var total float64
+	for _, suite := range merged.Suites {
+		total += parseSeconds(suite.Time)
+	}
+	if total > 0 {
+		merged.Time = formatSeconds(total)
+	}
+	merged.UpdateCounts()
+	return merged
+}
+
+// MergeFiles reads and unmarshals the given junit XML files, and merges them
+// in the given order with Merge.
+func MergeFiles(paths ...string) (*TestSuites, error) {
+	all := make([]*TestSuites, 0, len(paths))
+	for _, path := range paths {
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading %q: %w", path, err)
+		}
+		suites, err := UnMarshal(buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing %q: %w", path, err)
+		}
+		all = append(all, suites)
+	}
+	return Merge(all...), nil
+}
+
+// mergeSuites merges the testsuites in src into dst, matching them by name.
+func mergeSuites(dst, src []TestSuite) []TestSuite {
+	for _, s := range src {
+		idx := -1
+		for i := range dst {
+			if dst[i].Name == s.Name {
+				idx = i
+				break
+			}
+		}
+		if idx == -1 {
+			// Copy the suite so that merging further suites into it does not
+			// modify the input.
+			dst = append(dst, TestSuite{
+				Name:      s.Name,
+				ID:        s.ID,
+				Package:   s.Package,
+				Hostname:  s.Hostname,
+				Timestamp: s.Timestamp,
+				Attrs:     s.Attrs,
+			})
+			idx = len(dst) - 1
+		}
+		mergeSuite(&dst[idx], &s)
+	}
+	return dst
+}
+
+// mergeSuite merges src into dst, which must have the same name.
+func mergeSuite(dst, src *TestSuite) {
+	dst.Time = addSeconds(dst.Time, src.Time)
+	dst.Disabled += src.Disabled
+	if dst.Timestamp == "" {
+		dst.Timestamp = src.Timestamp
+	}
+	if dst.Hostname == "" {
+		dst.Hostname = src.Hostname
+	}
+
+	for _, tc := range src.TestCases {
+		replaced := false
+		for i := range dst.TestCases {
+			if dst.TestCases[i].ClassName == tc.ClassName && dst.TestCases[i].Name == tc.Name {
+				dst.TestCases[i] = tc
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			dst.TestCases = append(dst.TestCases, tc)
+		}
+	}
+
+	for _, p := range src.Properties.Properties {
+		if !hasProperty(dst.Properties.Properties, p) {
+			dst.Properties.Properties = append(dst.Properties.Properties, p)
+		}
+	}
+
+	dst.Suites = mergeSuites(dst.Suites, src.Suites)
+	dst.SystemOut = append(dst.SystemOut, src.SystemOut...)
+	dst.SystemErr = append(dst.SystemErr, src.SystemErr...)
+	dst.Extra = append(dst.Extra, src.Extra...)
+}
+
+func addSeconds(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return formatSeconds(parseSeconds(a) + parseSeconds(b))
+}
+
+func hasProperty(props []TestProperty, p TestProperty) bool {
+	for _, prop := range props {
+		if prop == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// merge_test.go contains unit tests for merging junit results
+
+package junit
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+var firstRunString = `
+<testsuites>
+	<testsuite name="e2e" tests="3" failures="2" time="10">
+		<testcase name="TestA" classname="e2e" time="2"></testcase>
+		<testcase name="TestB" classname="e2e" time="3"><failure>flake</failure></testcase>
+		<testcase name="TestC" classname="e2e" time="5"><failure>broken</failure></testcase>
+	</testsuite>
+	<testsuite name="unit" tests="1" failures="0" time="1">
+		<testcase name="TestU" classname="unit" time="1"></testcase>
+	</testsuite>
+</testsuites>
+`
+
+var rerunString = `
+<testsuite name="e2e" tests="2" failures="1" time="8">
+	<testcase name="TestB" classname="e2e" time="3"></testcase>
+	<testcase name="TestC" classname="e2e" time="5"><error message="timeout"></error></testcase>
+</testsuite>
+`
+
+func mustUnMarshal(t *testing.T, s string) *TestSuites {
+	suites, err := UnMarshal([]byte(s))
+	if err != nil {
+		t.Fatalf("Expected: succeed, actual: failed parsing suites, '%v'", err)
+	}
+	return suites
+}
+
+func TestMerge(t *testing.T) {
+	first := mustUnMarshal(t, firstRunString)
+	rerun := mustUnMarshal(t, rerunString)
+	merged := Merge(first, rerun)
+
+	if len(merged.Suites) != 2 {
+		t.Fatalf("Expected 2 suites, actual %d", len(merged.Suites))
+	}
+	if merged.Tests != 4 || merged.Failures != 0 || merged.Errors != 1 {
+		t.Fatalf("Expected tests=4 failures=0 errors=1, actual tests=%d failures=%d errors=%d",
+			merged.Tests, merged.Failures, merged.Errors)
+	}
+	if merged.Time != "19.000" {
+		t.Fatalf("Expected time to be summed up to 19.000, actual %q", merged.Time)
+	}
+
+	e2e, err := merged.GetTestSuite("e2e")
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	wantStatus := []TestStatusEnum{Passed, Passed, Errored}
+	for i, tc := range e2e.TestCases {
+		if got := tc.GetTestStatus(); got != wantStatus[i] {
+			t.Errorf("Expected %s to be %s, actual %s", tc.Name, wantStatus[i], got)
+		}
+	}
+
+	// The inputs must not be modified.
+	if len(first.Suites[0].TestCases) != 3 || first.Suites[0].TestCases[1].Failure == nil {
+		t.Fatalf("Expected the inputs to be unchanged, actual %+v", first.Suites[0])
+	}
+}
+
+func TestMergeFiles(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "junit")
+	if err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+	defer os.RemoveAll(testDir)
+
+	var paths []string
+	for name, content := range map[string]string{"junit_01.xml": firstRunString, "junit_02.xml": rerunString} {
+		p := path.Join(testDir, name)
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("cannot write %q: %v", p, err)
+		}
+		paths = append(paths, p)
+	}
+	if paths[0] > paths[1] {
+		paths[0], paths[1] = paths[1], paths[0]
+	}
+
+	merged, err := MergeFiles(paths...)
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	if merged.Tests != 4 || merged.Errors != 1 {
+		t.Fatalf("Expected tests=4 errors=1, actual tests=%d errors=%d", merged.Tests, merged.Errors)
+	}
+
+	if _, err := MergeFiles(path.Join(testDir, "missing.xml")); err == nil {
+		t.Fatal("Expected an error merging a missing file, actual nil")
+	}
+}
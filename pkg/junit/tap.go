@@ -0,0 +1,151 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// tap.go converts Test Anything Protocol (https://testanything.org) output to junit results
+
+package junit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	tapPlanRegex = regexp.MustCompile(`^1\.\.(\d+)`)
+	tapTestRegex = regexp.MustCompile(`^(not )?ok\b\s*(\d+)?\s*-?\s*([^#]*?)\s*(?:#\s*(\w+)\b\s*(.*))?$`)
+)
+
+// ParseTAP converts TAP output into TestSuites holding a single testsuite with
+// the given name.
+// Tests marked with a SKIP directive are reported as skipped, failing tests
+// marked with a TODO directive are reported as skipped as well since they are
+// not expected to pass. "Bail out!" and a mismatch between the plan and the
+// number of tests are reported as errors.
+func ParseTAP(r io.Reader, suiteName string) (*TestSuites, error) {
+	suite := TestSuite{Name: suiteName}
+	planned := -1
+	seen := 0
+	var last *TestCase
+	var diagnostics strings.Builder
+	var yaml *strings.Builder
+
+	flush := func() {
+		if last == nil {
+			return
+		}
+		details := strings.TrimSpace(diagnostics.String())
+		if details != "" {
+			switch {
+			case last.Failure != nil:
+				last.Failure.Value = details
+			case last.Skipped != nil:
+				last.Skipped.Value = details
+			default:
+				last.SystemOut = []string{details}
+			}
+		}
+		suite.AddTestCase(*last)
+		last = nil
+		diagnostics.Reset()
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		// YAML diagnostic blocks are indented, and belong to the previous test.
+		if yaml != nil {
+			if trimmed == "..." {
+				diagnostics.WriteString(yaml.String())
+				yaml = nil
+			} else {
+				yaml.WriteString(line + "\n")
+			}
+			continue
+		}
+		if trimmed == "---" && last != nil && line != trimmed {
+			yaml = &strings.Builder{}
+			continue
+		}
+
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "TAP version"):
+		case tapPlanRegex.MatchString(trimmed):
+			planned, _ = strconv.Atoi(tapPlanRegex.FindStringSubmatch(trimmed)[1])
+		case strings.HasPrefix(trimmed, "Bail out!"):
+			flush()
+			suite.AddTestCase(TestCase{
+				Name:        "Bail out",
+				ClassName:   suiteName,
+				ErrorResult: &Result{Message: strings.TrimSpace(strings.TrimPrefix(trimmed, "Bail out!"))},
+			})
+			// Nothing after a bail out is meaningful.
+			suites := &TestSuites{Suites: []TestSuite{suite}}
+			suites.UpdateCounts()
+			return suites, nil
+		case strings.HasPrefix(trimmed, "#"):
+			if last != nil {
+				diagnostics.WriteString(strings.TrimSpace(strings.TrimPrefix(trimmed, "#")) + "\n")
+			}
+		case tapTestRegex.MatchString(trimmed):
+			flush()
+			seen++
+			m := tapTestRegex.FindStringSubmatch(trimmed)
+			failed, name, directive, reason := m[1] != "", m[3], strings.ToUpper(m[4]), m[5]
+			if name == "" {
+				name = fmt.Sprintf("test %d", seen)
+				if m[2] != "" {
+					name = "test " + m[2]
+				}
+			}
+			last = &TestCase{Name: name, ClassName: suiteName}
+			switch {
+			case strings.HasPrefix(directive, "SKIP"):
+				last.Skipped = &Result{Message: reason}
+			case directive == "TODO" && failed:
+				last.Skipped = &Result{Message: "TODO " + reason}
+			case failed:
+				last.Failure = &Result{Message: name}
+			}
+		default:
+			// Anything else is output of the test being run.
+			if last != nil {
+				diagnostics.WriteString(line + "\n")
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading TAP output: %w", err)
+	}
+	flush()
+
+	if planned >= 0 && planned != seen {
+		suite.AddTestCase(TestCase{
+			Name:        "TAP plan",
+			ClassName:   suiteName,
+			ErrorResult: &Result{Message: fmt.Sprintf("planned %d tests but ran %d", planned, seen)},
+		})
+	}
+	suites := &TestSuites{Suites: []TestSuite{suite}}
+	suites.UpdateCounts()
+	return suites, nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// tap_test.go contains unit tests for converting TAP output
+
+package junit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTAP(t *testing.T) {
+	testCases := []struct {
+		name   string
+		input  string
+		want   []TestStatusEnum
+		detail string
+	}{{
+		name: "all statuses",
+		input: `TAP version 13
+1..5
+ok 1 - first works
+not ok 2 - second is broken
+  ---
+  message: expected 1 got 2
+  ...
+ok 3 - third # SKIP no network
+not ok 4 - fourth # TODO not implemented
+ok 5
+`,
+		want:   []TestStatusEnum{Passed, Failed, Skipped, Skipped, Passed},
+		detail: "message: expected 1 got 2",
+	}, {
+		name: "plan mismatch",
+		input: `1..3
+ok 1 - first
+not ok 2 - second
+# something went wrong
+`,
+		want:   []TestStatusEnum{Passed, Failed, Errored},
+		detail: "something went wrong",
+	}, {
+		name: "bail out",
+		input: `1..3
+ok 1 - first
+Bail out! Database is down
+ok 2 - never reported
+`,
+		want: []TestStatusEnum{Passed, Errored},
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			suites, err := ParseTAP(strings.NewReader(tc.input), "bats")
+			if err != nil {
+				t.Fatalf("Expected '', actual '%v'", err)
+			}
+			suite := suites.Suites[0]
+			if suite.Name != "bats" || suite.Tests != len(tc.want) {
+				t.Fatalf("Expected suite bats with %d tests, actual %q with %d", len(tc.want), suite.Name, suite.Tests)
+			}
+			for i, want := range tc.want {
+				if got := suite.TestCases[i].GetTestStatus(); got != want {
+					t.Errorf("Expected testcase %d to be %s, actual %s", i, want, got)
+				}
+			}
+			if tc.detail != "" && !strings.Contains(suite.TestCases[1].Failure.Value, tc.detail) {
+				t.Errorf("Expected failure to contain %q, actual %q", tc.detail, suite.TestCases[1].Failure.Value)
+			}
+		})
+	}
+}
@@ -0,0 +1,392 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package protection checks the actions on projects, clusters and registries
+// against a protection policy, so that the tools don't operate on the
+// production resources by mistake.
+//
+// A policy is a list of rules loaded from a YAML file, for example:
+//
+//	rules:
+//	- name: prow-cluster
+//	  kind: cluster
+//	  names: [knative-prow]
+//	  deny: ["*"]
+//	- name: prod-clusters
+//	  kind: cluster
+//	  patterns: ["^prod-"]
+//	  selector: "env=prod,!disposable"
+//	  allow: [use]
+//	  deny: [delete, update]
+//
+// The first rule matching a resource and listing the action allows or denies
+// it, the action is allowed if no rule does.
+package protection
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Kind is a kind of resource
+type Kind string
+
+// The kinds of resources
+const (
+	KindProject Kind = "project"
+	KindCluster Kind = "cluster"
+	// KindRegistry is a container registry, e.g. gcr.io/knative-releases
+	KindRegistry Kind = "registry"
+)
+
+// Action is an action on a resource. The actions on a project also cover the
+// resources in the project, e.g. deleting the clusters of a project is
+// checked as deleting the project.
+type Action string
+
+// The actions on resources
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+	// ActionUse is using an existing resource, e.g. running tests in a cluster
+	ActionUse Action = "use"
+	// ActionAll matches all the actions in the rules
+	ActionAll Action = "*"
+)
+
+// ErrProtected is returned when an action is denied, the errors returned by
+// Check match it with errors.Is
+var ErrProtected = errors.New("protected resource")
+
+// Resource is a resource an action is checked against
+type Resource struct {
+	Kind Kind
+	// Name is the name of the project or the cluster, or the registry root,
+	// e.g. gcr.io/knative-releases
+	Name string
+	// Labels are the labels of the resource, matched by the rule selectors
+	Labels map[string]string
+}
+
+// Project returns the project resource with the name
+func Project(name string) Resource {
+	return Resource{Kind: KindProject, Name: name}
+}
+
+// Cluster returns the cluster resource with the name and the labels
+func Cluster(name string, labels map[string]string) Resource {
+	return Resource{Kind: KindCluster, Name: name, Labels: labels}
+}
+
+// Registry returns the registry resource with the root, e.g.
+// gcr.io/knative-releases
+func Registry(root string) Resource {
+	return Resource{Kind: KindRegistry, Name: root}
+}
+
+// ProtectedError is returned when a rule denies an action on a resource
+type ProtectedError struct {
+	Action   Action
+	Resource Resource
+	// Rule is the name of the rule denying the action
+	Rule string
+}
+
+func (e *ProtectedError) Error() string {
+	return fmt.Sprintf("%s %q is protected, %s is denied by rule %q", e.Resource.Kind, e.Resource.Name, e.Action, e.Rule)
+}
+
+// Unwrap returns ErrProtected
+func (e *ProtectedError) Unwrap() error {
+	return ErrProtected
+}
+
+// Rule allows or denies actions on the resources of a kind it matches. It
+// matches the resources with one of the names, the names matching one of the
+// patterns, or the labels matching the selector.
+type Rule struct {
+	// Name identifies the rule in the errors and the audit log, "rule N" if
+	// empty
+	Name string `yaml:"name,omitempty"`
+	Kind Kind   `yaml:"kind"`
+	// Names are the exact names of the resources
+	Names []string `yaml:"names,omitempty"`
+	// Patterns are regular expressions matching the names of the resources
+	Patterns []string `yaml:"patterns,omitempty"`
+	// Selector is a label selector, a comma separated list of requirements
+	// all matching the labels: "key=value", "key!=value", "key" if the label
+	// exists, "!key" if it doesn't
+	Selector string `yaml:"selector,omitempty"`
+	// Allow and Deny are the actions allowed and denied, "*" for all. Allow
+	// takes precedence over Deny.
+	Allow []Action `yaml:"allow,omitempty"`
+	Deny  []Action `yaml:"deny,omitempty"`
+
+	patterns []*regexp.Regexp
+	selector []requirement
+}
+
+// Policy is a list of rules
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+
+	// Logger is where the refused actions are logged, the standard logger if
+	// nil
+	Logger *log.Logger `yaml:"-"`
+}
+
+var (
+	defaultOnce sync.Once
+	// parsedDefault is the default policy parsed once, shared by Check on a
+	// nil policy, it's never modified
+	parsedDefault *Policy
+)
+
+// Default returns the default policy, protecting the projects, clusters and
+// registries of Prow and of the releases. It's the same as
+// config/protection/policy.yaml.
+func Default() *Policy {
+	p := *getParsedDefault()
+	p.Rules = append([]Rule(nil), p.Rules...)
+	return &p
+}
+
+// getParsedDefault returns the default policy, parsing it on the first call
+func getParsedDefault() *Policy {
+	defaultOnce.Do(func() {
+		p, err := Parse([]byte(defaultPolicy))
+		if err != nil {
+			panic(fmt.Sprintf("invalid default protection policy: %v", err))
+		}
+		parsedDefault = p
+	})
+	return parsedDefault
+}
+
+const defaultPolicy = `
+rules:
+- name: prow-project
+  kind: project
+  names: [knative-tests]
+  deny: ["*"]
+- name: prow-cluster
+  kind: cluster
+  names: [knative-prow]
+  deny: ["*"]
+- name: release-registries
+  kind: registry
+  names: [gcr.io/knative-releases, gcr.io/knative-nightly]
+  deny: ["*"]
+`
+
+// Load reads the policy from the YAML file, the default policy is returned if
+// path is empty
+func Load(path string) (*Policy, error) {
+	if path == "" {
+		return Default(), nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading the protection policy: %w", err)
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid protection policy %q: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse parses and validates the policy in YAML
+func Parse(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := yaml.UnmarshalStrict(data, p); err != nil {
+		return nil, err
+	}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Name, err)
+		}
+	}
+	return p, nil
+}
+
+// compile validates the rule and compiles its patterns and selector
+func (r *Rule) compile() error {
+	switch r.Kind {
+	case KindProject, KindCluster, KindRegistry:
+	default:
+		return fmt.Errorf("unknown kind %q", r.Kind)
+	}
+	if len(r.Names) == 0 && len(r.Patterns) == 0 && r.Selector == "" {
+		return errors.New("no names, patterns or selector")
+	}
+	for _, a := range append(append([]Action(nil), r.Allow...), r.Deny...) {
+		switch a {
+		case ActionCreate, ActionUpdate, ActionDelete, ActionUse, ActionAll:
+		default:
+			return fmt.Errorf("unknown action %q", a)
+		}
+	}
+	for _, p := range r.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	if r.Selector != "" {
+		s, err := parseSelector(r.Selector)
+		if err != nil {
+			return fmt.Errorf("invalid selector %q: %w", r.Selector, err)
+		}
+		r.selector = s
+	}
+	return nil
+}
+
+// matches checks if the rule matches the resource
+func (r *Rule) matches(res Resource) bool {
+	if r.Kind != res.Kind {
+		return false
+	}
+	for _, n := range r.Names {
+		if n == res.Name {
+			return true
+		}
+	}
+	for _, re := range r.patterns {
+		if re.MatchString(res.Name) {
+			return true
+		}
+	}
+	return r.selector != nil && matchesSelector(r.selector, res.Labels)
+}
+
+// Check checks the action is allowed on the resource. It returns a
+// ProtectedError and logs an audit line if it's denied. The default policy is
+// used if p is nil.
+func (p *Policy) Check(action Action, res Resource) error {
+	if p == nil {
+		p = getParsedDefault()
+	}
+	for _, r := range p.Rules {
+		if !r.matches(res) {
+			continue
+		}
+		if hasAction(r.Allow, action) {
+			return nil
+		}
+		if hasAction(r.Deny, action) {
+			err := &ProtectedError{Action: action, Resource: res, Rule: r.Name}
+			p.audit(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// audit logs the refused action
+func (p *Policy) audit(err *ProtectedError) {
+	line := fmt.Sprintf("AUDIT: refused to %s %s %q, denied by protection rule %q", err.Action, err.Resource.Kind, err.Resource.Name, err.Rule)
+	if p.Logger != nil {
+		p.Logger.Print(line)
+	} else {
+		log.Print(line)
+	}
+}
+
+func hasAction(actions []Action, action Action) bool {
+	for _, a := range actions {
+		if a == action || a == ActionAll {
+			return true
+		}
+	}
+	return false
+}
+
+// requirement is a requirement of a label selector
+type requirement struct {
+	key   string
+	value string
+	// op is one of "=", "!=", "exists" and "!exists"
+	op string
+}
+
+func parseSelector(selector string) ([]requirement, error) {
+	var reqs []requirement
+	for _, s := range strings.Split(selector, ",") {
+		s = strings.TrimSpace(s)
+		var req requirement
+		switch {
+		case s == "":
+			return nil, errors.New("empty requirement")
+		case strings.Contains(s, "!="):
+			parts := strings.SplitN(s, "!=", 2)
+			req = requirement{key: parts[0], value: parts[1], op: "!="}
+		case strings.Contains(s, "="):
+			parts := strings.SplitN(strings.Replace(s, "==", "=", 1), "=", 2)
+			req = requirement{key: parts[0], value: parts[1], op: "="}
+		case strings.HasPrefix(s, "!"):
+			req = requirement{key: s[1:], op: "!exists"}
+		default:
+			req = requirement{key: s, op: "exists"}
+		}
+		req.key = strings.TrimSpace(req.key)
+		req.value = strings.TrimSpace(req.value)
+		if req.key == "" {
+			return nil, fmt.Errorf("no key in requirement %q", s)
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+func matchesSelector(reqs []requirement, labels map[string]string) bool {
+	for _, req := range reqs {
+		v, ok := labels[req.key]
+		switch req.op {
+		case "=":
+			if !ok || v != req.value {
+				return false
+			}
+		case "!=":
+			if ok && v == req.value {
+				return false
+			}
+		case "exists":
+			if !ok {
+				return false
+			}
+		case "!exists":
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protection
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testPolicy = `
+rules:
+- name: prow-cluster
+  kind: cluster
+  names: [knative-prow]
+  deny: ["*"]
+- name: prod-clusters-use
+  kind: cluster
+  patterns: ["^prod-"]
+  selector: "env=prod,!disposable"
+  allow: [use]
+  deny: [delete, update]
+- kind: registry
+  names: [gcr.io/knative-releases]
+  deny: [delete]
+`
+
+func TestCheck(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("Expected no error parsing the policy, but got '%v'", err)
+	}
+	var buf bytes.Buffer
+	p.Logger = log.New(&buf, "", 0)
+
+	tests := []struct {
+		name     string
+		action   Action
+		res      Resource
+		wantRule string
+	}{
+		{"denied by name", ActionUse, Cluster("knative-prow", nil), "prow-cluster"},
+		{"denied by pattern", ActionDelete, Cluster("prod-1", nil), "prod-clusters-use"},
+		{"denied by selector", ActionUpdate, Cluster("e2e", map[string]string{"env": "prod"}), "prod-clusters-use"},
+		{"allowed by the rule", ActionUse, Cluster("prod-1", nil), ""},
+		{"not listed by the rule", ActionCreate, Cluster("prod-1", nil), ""},
+		{"selector not matching", ActionDelete, Cluster("e2e", map[string]string{"env": "prod", "disposable": "true"}), ""},
+		{"other kind", ActionDelete, Project("knative-prow"), ""},
+		{"unnamed rule", ActionDelete, Registry("gcr.io/knative-releases"), "rule 3"},
+		{"unmatched", ActionDelete, Registry("gcr.io/knative-nightly"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			err := p.Check(tt.action, tt.res)
+			if tt.wantRule == "" {
+				if err != nil {
+					t.Fatalf("Expected no error, but got '%v'", err)
+				}
+				if buf.Len() != 0 {
+					t.Fatalf("Expected no audit line, but got %q", buf.String())
+				}
+				return
+			}
+			if !errors.Is(err, ErrProtected) {
+				t.Fatalf("Expected error '%v', but got '%v'", ErrProtected, err)
+			}
+			var pe *ProtectedError
+			if !errors.As(err, &pe) || pe.Rule != tt.wantRule || pe.Action != tt.action {
+				t.Fatalf("Expected %s denied by rule %q, but got '%v'", tt.action, tt.wantRule, err)
+			}
+			if !strings.HasPrefix(buf.String(), "AUDIT: refused to "+string(tt.action)) {
+				t.Fatalf("Expected an audit line, but got %q", buf.String())
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	invalid := map[string]string{
+		"unknown kind":     "rules: [{kind: bucket, names: [a], deny: [delete]}]",
+		"unknown action":   "rules: [{kind: project, names: [a], deny: [destroy]}]",
+		"nothing matched":  "rules: [{kind: project, deny: [delete]}]",
+		"invalid pattern":  "rules: [{kind: project, patterns: ['('], deny: [delete]}]",
+		"invalid selector": "rules: [{kind: project, selector: 'a,,b', deny: [delete]}]",
+		"unknown field":    "rules: [{kind: project, names: [a], block: [delete]}]",
+	}
+	for name, data := range invalid {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error, but got none", name)
+		}
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	reqs, err := parseSelector("env = prod, tier!=test, owner, !disposable")
+	if err != nil {
+		t.Fatalf("Expected no error, but got '%v'", err)
+	}
+	want := []requirement{
+		{key: "env", value: "prod", op: "="},
+		{key: "tier", value: "test", op: "!="},
+		{key: "owner", op: "exists"},
+		{key: "disposable", op: "!exists"},
+	}
+	if !reflect.DeepEqual(reqs, want) {
+		t.Fatalf("Expected requirements %v, but got %v", want, reqs)
+	}
+	if !matchesSelector(reqs, map[string]string{"env": "prod", "owner": "me"}) {
+		t.Fatal("Expected the labels to match the selector, but they didn't")
+	}
+	if matchesSelector(reqs, map[string]string{"env": "prod", "tier": "test", "owner": "me"}) {
+		t.Fatal("Expected the labels not to match the selector, but they did")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	// The default policy is the same as the policy in the config.
+	p, err := Load("../../config/protection/policy.yaml")
+	if err != nil {
+		t.Fatalf("Expected no error loading the policy, but got '%v'", err)
+	}
+	if d := Default(); !reflect.DeepEqual(p.Rules, d.Rules) {
+		t.Fatalf("Expected the default rules %+v, but got %+v", d.Rules, p.Rules)
+	}
+	for _, res := range []Resource{Project("knative-tests"), Cluster("knative-prow", nil), Registry("gcr.io/knative-nightly")} {
+		if err := (*Policy)(nil).Check(ActionDelete, res); !errors.Is(err, ErrProtected) {
+			t.Fatalf("Expected %s %q to be protected, but got '%v'", res.Kind, res.Name, err)
+		}
+	}
+	if p, err := Load(""); err != nil || len(p.Rules) != len(Default().Rules) {
+		t.Fatalf("Expected the default policy, but got %+v and '%v'", p, err)
+	}
+	// Changing a default policy doesn't change the one checked on a nil policy.
+	Default().Rules[0] = Rule{}
+	if err := (*Policy)(nil).Check(ActionDelete, Project("knative-tests")); !errors.Is(err, ErrProtected) {
+		t.Fatalf("Expected project \"knative-tests\" to be protected, but got '%v'", err)
+	}
+}
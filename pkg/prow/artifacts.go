@@ -0,0 +1,389 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// artifacts.go defines the typed model of the files prow and our tests write
+// for each build, i.e. started.json, finished.json, prowjob.json,
+// clone-records.json and the metadata.json written by pkg/metautil
+
+package prow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+const (
+	// ProwJobJSON is the json file containing the prowjob of the build
+	ProwJobJSON = "prowjob.json"
+	// CloneRecordsJSON is the json file containing the records of cloning the refs
+	CloneRecordsJSON = "clone-records.json"
+	// MetadataJSON is the json file written by pkg/metautil in the artifacts dir
+	MetadataJSON = "metadata.json"
+
+	// Keys of the cluster metadata written into metadata.json by the cluster managers
+	MetadataProviderKey    = "E2E:Provider"
+	MetadataProjectKey     = "E2E:Project"
+	MetadataRegionKey      = "E2E:Region"
+	MetadataZoneKey        = "E2E:Zone"
+	MetadataClusterNameKey = "E2E:ClusterName"
+	// MetadataMachineKey is the machine type written by kubetest2, but the
+	// cluster name written by the e2e-tests cluster manager next to
+	// MetadataClusterNameKey
+	MetadataMachineKey  = "E2E:Machine"
+	MetadataVersionKey  = "E2E:Version"
+	MetadataMinNodesKey = "E2E:MinNodes"
+	MetadataMaxNodesKey = "E2E:MaxNodes"
+)
+
+// BuildResult is the result of a build
+type BuildResult string
+
+// Results of a build, the same as the ones used by prow in finished.json
+const (
+	ResultSuccess BuildResult = "SUCCESS"
+	ResultFailure BuildResult = "FAILURE"
+	ResultAborted BuildResult = "ABORTED"
+	ResultError   BuildResult = "ERROR"
+	// ResultPending means the build started but did not finish yet
+	ResultPending BuildResult = "PENDING"
+	// ResultUnknown means there is no information about the build
+	ResultUnknown BuildResult = "UNKNOWN"
+)
+
+// Refs describes how the repo was constructed
+type Refs struct {
+	Org       string `json:"org"`
+	Repo      string `json:"repo"`
+	RepoLink  string `json:"repo_link,omitempty"`
+	BaseRef   string `json:"base_ref,omitempty"`
+	BaseSHA   string `json:"base_sha,omitempty"`
+	BaseLink  string `json:"base_link,omitempty"`
+	Pulls     []Pull `json:"pulls,omitempty"`
+	PathAlias string `json:"path_alias,omitempty"`
+	CloneURI  string `json:"clone_uri,omitempty"`
+}
+
+// Pull describes a pull request at a particular point in time
+type Pull struct {
+	Number     int    `json:"number"`
+	Author     string `json:"author"`
+	SHA        string `json:"sha"`
+	Title      string `json:"title,omitempty"`
+	Ref        string `json:"ref,omitempty"`
+	Link       string `json:"link,omitempty"`
+	CommitLink string `json:"commit_link,omitempty"`
+	AuthorLink string `json:"author_link,omitempty"`
+}
+
+// ProwJob holds the prowjob.json values of the build, which is the ProwJob
+// custom resource that prow created for the build
+type ProwJob struct {
+	Metadata ProwJobMetadata `json:"metadata"`
+	Spec     ProwJobSpec     `json:"spec"`
+	Status   ProwJobStatus   `json:"status"`
+}
+
+// ProwJobMetadata is the object metadata of a ProwJob
+type ProwJobMetadata struct {
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace,omitempty"`
+	CreationTimestamp *time.Time        `json:"creationTimestamp,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+}
+
+// ProwJobSpec is the spec of a ProwJob
+type ProwJobSpec struct {
+	Type         string `json:"type"`
+	Agent        string `json:"agent,omitempty"`
+	Cluster      string `json:"cluster,omitempty"`
+	Namespace    string `json:"namespace,omitempty"`
+	Job          string `json:"job"`
+	Refs         *Refs  `json:"refs,omitempty"`
+	ExtraRefs    []Refs `json:"extra_refs,omitempty"`
+	Report       bool   `json:"report,omitempty"`
+	Context      string `json:"context,omitempty"`
+	RerunCommand string `json:"rerun_command,omitempty"`
+}
+
+// ProwJobStatus is the status of a ProwJob
+type ProwJobStatus struct {
+	StartTime      *time.Time `json:"startTime,omitempty"`
+	CompletionTime *time.Time `json:"completionTime,omitempty"`
+	// State is one of triggered, pending, success, failure, aborted or error
+	State       string `json:"state,omitempty"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url,omitempty"`
+	PodName     string `json:"pod_name,omitempty"`
+	BuildID     string `json:"build_id,omitempty"`
+}
+
+// CloneRecord holds the record of cloning one of the refs of the build, as
+// written to clone-records.json
+type CloneRecord struct {
+	Refs     Refs           `json:"refs"`
+	Commands []CloneCommand `json:"commands,omitempty"`
+	Failed   bool           `json:"failed,omitempty"`
+	FinalSHA string         `json:"final_sha,omitempty"`
+	Duration time.Duration  `json:"duration,omitempty"`
+}
+
+// CloneCommand is a command run while cloning refs
+type CloneCommand struct {
+	Command  string        `json:"command"`
+	Output   string        `json:"output,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// ClusterMetadata is the cluster information written into metadata.json by
+// the cluster managers
+type ClusterMetadata struct {
+	Provider    string
+	Project     string
+	Region      string
+	Zone        string
+	ClusterName string
+	// Machine is the machine type of the nodes, empty if it's unknown
+	Machine  string
+	Version  string
+	MinNodes int
+	MaxNodes int
+}
+
+// BuildInfo combines all the information about a build. Each part is nil if
+// the build doesn't have the corresponding file.
+type BuildInfo struct {
+	Started      *Started
+	Finished     *Finished
+	ProwJob      *ProwJob
+	CloneRecords []CloneRecord
+	// Metadata is the content of the metadata.json in the artifacts dir
+	Metadata map[string]string
+	// Cluster is parsed from Metadata, nil if it doesn't have any cluster information
+	Cluster *ClusterMetadata
+}
+
+// buildInfoMemo memoizes the BuildInfo of a build, it's safe for concurrent use
+type buildInfoMemo struct {
+	mutex sync.Mutex
+	info  *BuildInfo
+}
+
+// GetBuildInfo reads and parses all the information about the build, a file
+// that doesn't exist is not an error. The information is read once, unless
+// reading it fails, and the files are read from the cache if the client has one.
+func (b *Build) GetBuildInfo() (*BuildInfo, error) {
+	if b.info == nil {
+		return b.readBuildInfo()
+	}
+	b.info.mutex.Lock()
+	defer b.info.mutex.Unlock()
+	if b.info.info != nil {
+		return b.info.info, nil
+	}
+	info, err := b.readBuildInfo()
+	if err != nil {
+		return nil, err
+	}
+	b.info.info = info
+	return info, nil
+}
+
+// readBuildInfo reads and parses all the information about the build
+func (b *Build) readBuildInfo() (*BuildInfo, error) {
+	info := &BuildInfo{}
+	started, finished, prowJob := &Started{}, &Finished{}, &ProwJob{}
+	if found, err := b.readOptionalJSONFile(StartedJSON, started); err != nil {
+		return nil, err
+	} else if found {
+		info.Started = started
+	}
+	if found, err := b.readOptionalJSONFile(FinishedJSON, finished); err != nil {
+		return nil, err
+	} else if found {
+		info.Finished = finished
+	}
+	if found, err := b.readOptionalJSONFile(ProwJobJSON, prowJob); err != nil {
+		return nil, err
+	} else if found {
+		info.ProwJob = prowJob
+	}
+	if _, err := b.readOptionalJSONFile(CloneRecordsJSON, &info.CloneRecords); err != nil {
+		return nil, err
+	}
+	if _, err := b.readOptionalJSONFile(path.Join(ArtifactsDir, MetadataJSON), &info.Metadata); err != nil {
+		return nil, err
+	}
+	info.Cluster = parseClusterMetadata(info.Metadata)
+	return info, nil
+}
+
+// Result gets the result of the build
+func (b *Build) Result() (BuildResult, error) {
+	info, err := b.GetBuildInfo()
+	if err != nil {
+		return ResultUnknown, err
+	}
+	return info.Result(), nil
+}
+
+// Duration gets how long the build ran, 0 if it didn't finish
+func (b *Build) Duration() (time.Duration, error) {
+	info, err := b.GetBuildInfo()
+	if err != nil {
+		return 0, err
+	}
+	return info.Duration(), nil
+}
+
+// Refs gets the refs the build tested
+func (b *Build) Refs() ([]Refs, error) {
+	info, err := b.GetBuildInfo()
+	if err != nil {
+		return nil, err
+	}
+	return info.Refs(), nil
+}
+
+// Result gets the result of the build from finished.json, or from the state
+// of the prowjob if finished.json doesn't exist
+func (bi *BuildInfo) Result() BuildResult {
+	if bi.Finished != nil {
+		if bi.Finished.Result != "" {
+			return BuildResult(bi.Finished.Result)
+		}
+		if bi.Finished.Passed {
+			return ResultSuccess
+		}
+		return ResultFailure
+	}
+	if bi.ProwJob != nil {
+		switch bi.ProwJob.Status.State {
+		case "success":
+			return ResultSuccess
+		case "failure":
+			return ResultFailure
+		case "aborted":
+			return ResultAborted
+		case "error":
+			return ResultError
+		case "triggered", "pending":
+			return ResultPending
+		}
+	}
+	if bi.Started != nil {
+		return ResultPending
+	}
+	return ResultUnknown
+}
+
+// Duration gets how long the build ran from started.json and finished.json, or
+// from the status of the prowjob if they don't exist. Returns 0 if the build
+// didn't finish.
+func (bi *BuildInfo) Duration() time.Duration {
+	if bi.Started != nil && bi.Finished != nil {
+		return time.Duration(bi.Finished.Timestamp-bi.Started.Timestamp) * time.Second
+	}
+	if bi.ProwJob != nil && bi.ProwJob.Status.StartTime != nil && bi.ProwJob.Status.CompletionTime != nil {
+		return bi.ProwJob.Status.CompletionTime.Sub(*bi.ProwJob.Status.StartTime)
+	}
+	return 0
+}
+
+// Refs gets the refs the build tested, from the prowjob or from the clone
+// records if prowjob.json doesn't exist. The first refs are the main ones.
+func (bi *BuildInfo) Refs() []Refs {
+	var refs []Refs
+	if bi.ProwJob != nil {
+		if bi.ProwJob.Spec.Refs != nil {
+			refs = append(refs, *bi.ProwJob.Spec.Refs)
+		}
+		refs = append(refs, bi.ProwJob.Spec.ExtraRefs...)
+		return refs
+	}
+	for _, record := range bi.CloneRecords {
+		refs = append(refs, record.Refs)
+	}
+	return refs
+}
+
+// Pulls gets all the pull requests the build tested
+func (bi *BuildInfo) Pulls() []Pull {
+	var pulls []Pull
+	for _, r := range bi.Refs() {
+		pulls = append(pulls, r.Pulls...)
+	}
+	return pulls
+}
+
+// PodName gets the name of the pod the build ran in
+func (bi *BuildInfo) PodName() string {
+	if bi.ProwJob != nil && bi.ProwJob.Status.PodName != "" {
+		return bi.ProwJob.Status.PodName
+	}
+	if bi.Started != nil {
+		return bi.Started.Node
+	}
+	return ""
+}
+
+// readOptionalJSONFile reads a json file of the build into v, and returns
+// false if the file doesn't exist
+func (b *Build) readOptionalJSONFile(relPath string, v interface{}) (bool, error) {
+	contents, err := b.readCachedFile(relPath)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed reading %q: %w", path.Join(b.StoragePath, relPath), err)
+	}
+	if err := json.Unmarshal(contents, v); err != nil {
+		return false, fmt.Errorf("failed parsing %q: %w", path.Join(b.StoragePath, relPath), err)
+	}
+	return true, nil
+}
+
+// parseClusterMetadata gets the cluster information out of metadata.json,
+// returns nil if there is none
+func parseClusterMetadata(metadata map[string]string) *ClusterMetadata {
+	cm := ClusterMetadata{
+		Provider:    metadata[MetadataProviderKey],
+		Project:     metadata[MetadataProjectKey],
+		Region:      metadata[MetadataRegionKey],
+		Zone:        metadata[MetadataZoneKey],
+		ClusterName: metadata[MetadataClusterNameKey],
+		Version:     metadata[MetadataVersionKey],
+	}
+	// The e2e-tests cluster manager writes the cluster name to
+	// MetadataMachineKey too, for the legacy readers.
+	if cm.ClusterName == "" {
+		cm.Machine = metadata[MetadataMachineKey]
+	}
+	cm.MinNodes, _ = strconv.Atoi(metadata[MetadataMinNodesKey])
+	cm.MaxNodes, _ = strconv.Atoi(metadata[MetadataMaxNodesKey])
+	if cm == (ClusterMetadata{}) {
+		return nil
+	}
+	return &cm
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// artifacts_test.go contains unit tests for parsing the artifacts of builds
+
+package prow
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const prowJobString = `{
+  "kind": "ProwJob",
+  "metadata": {"name": "3f5a7c6e", "namespace": "default", "labels": {"prow.k8s.io/type": "presubmit"}},
+  "spec": {
+    "type": "presubmit",
+    "cluster": "default",
+    "job": "pull-knative-serving-build-tests",
+    "refs": {
+      "org": "knative", "repo": "serving", "base_ref": "master", "base_sha": "abc123",
+      "pulls": [{"number": 42, "author": "someone", "sha": "def456"}]
+    },
+    "extra_refs": [{"org": "knative", "repo": "test-infra", "base_ref": "master"}]
+  },
+  "status": {
+    "startTime": "2020-05-01T10:00:00Z",
+    "completionTime": "2020-05-01T10:30:00Z",
+    "state": "aborted",
+    "pod_name": "3f5a7c6e-pod",
+    "build_id": "3"
+  }
+}`
+
+func TestGetBuildInfo(t *testing.T) {
+	root, err := ioutil.TempDir("", "prow")
+	if err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		"knative-prow/logs/job_0/1/started.json": `{"timestamp": 1000, "node": "node-1", "repo-commit": "abc123"}`,
+		"knative-prow/logs/job_0/1/finished.json": `{"timestamp": 1600, "passed": false, "result": "FAILURE", "revision": "abc123",
+			"metadata": {"repo": "knative/serving", "repos": {"knative/serving": "master"}, "infra-commit": "789abc", "custom": {"a": 1}}}`,
+		"knative-prow/logs/job_0/1/clone-records.json": `[{"refs": {"org": "knative", "repo": "serving", "base_ref": "master"},
+			"commands": [{"command": "git init", "duration": 1000000}], "final_sha": "abc123"}]`,
+		"knative-prow/logs/job_0/1/artifacts/metadata.json": `{"E2E:Provider": "gke", "E2E:Region": "us-central1",
+			"E2E:Machine": "e2-standard-4", "E2E:MinNodes": "1", "E2E:MaxNodes": "3", "Custom": "value"}`,
+		"knative-prow/logs/job_0/2/started.json":  `{"timestamp": 2000}`,
+		"knative-prow/logs/job_0/3/prowjob.json":  prowJobString,
+		"knative-prow/logs/job_0/4/finished.json": `{"timestamp": `,
+		"knative-prow/logs/job_0/5/finished.json": `{"timestamp": 3000, "passed": true}`,
+	})
+	job := NewClient(NewLocalStorage(root), "").NewJob(testJobName, PeriodicJob, "", "", 0)
+
+	// A finished build with its clone records and cluster metadata.
+	build := job.NewBuild(1)
+	info, err := build.GetBuildInfo()
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	if info.Result() != ResultFailure || info.Duration() != 600*time.Second || info.PodName() != "node-1" {
+		t.Fatalf("Expected FAILURE after 10m0s on node-1, actual %s after %v on %q", info.Result(), info.Duration(), info.PodName())
+	}
+	if refs := info.Refs(); len(refs) != 1 || refs[0].Repo != "serving" {
+		t.Fatalf("Expected the refs from clone records, actual %+v", refs)
+	}
+	if info.CloneRecords[0].Commands[0].Duration != time.Millisecond {
+		t.Fatalf("Expected the clone command to take 1ms, actual %v", info.CloneRecords[0].Commands[0].Duration)
+	}
+	wantCluster := &ClusterMetadata{Provider: "gke", Region: "us-central1", Machine: "e2-standard-4", MinNodes: 1, MaxNodes: 3}
+	if diff := cmp.Diff(wantCluster, info.Cluster); diff != "" {
+		t.Fatalf("Unexpected cluster metadata (-want +got):\n%s", diff)
+	}
+	if info.Metadata["Custom"] != "value" {
+		t.Fatalf("Expected the custom metadata to be kept, actual %v", info.Metadata)
+	}
+	if result, err := build.Result(); err != nil || result != ResultFailure {
+		t.Fatalf("Expected FAILURE, actual %s, '%v'", result, err)
+	}
+	wantMetadata := Metadata{
+		Repo:        "knative/serving",
+		Repos:       map[string]string{"knative/serving": "master"},
+		InfraCommit: "789abc",
+		Extra:       map[string]json.RawMessage{"custom": json.RawMessage(`{"a": 1}`)},
+	}
+	if diff := cmp.Diff(wantMetadata, info.Finished.Metadata); diff != "" {
+		t.Fatalf("Unexpected metadata in finished.json (-want +got):\n%s", diff)
+	}
+
+	// A build that only started.
+	build = job.NewBuild(2)
+	if result, err := build.Result(); err != nil || result != ResultPending {
+		t.Fatalf("Expected PENDING, actual %s, '%v'", result, err)
+	}
+	if d, err := build.Duration(); err != nil || d != 0 {
+		t.Fatalf("Expected no duration, actual %v, '%v'", d, err)
+	}
+	if info, _ := build.GetBuildInfo(); info.Cluster != nil || info.Finished != nil {
+		t.Fatalf("Expected no cluster metadata nor finished.json, actual %+v", info)
+	}
+
+	// A build only known from its prowjob.
+	build = job.NewBuild(3)
+	refs, err := build.Refs()
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	if len(refs) != 2 || refs[0].Pulls[0].Number != 42 || refs[1].Repo != "test-infra" {
+		t.Fatalf("Expected the refs and extra refs of the prowjob, actual %+v", refs)
+	}
+	info, _ = build.GetBuildInfo()
+	if info.Result() != ResultAborted || info.Duration() != 30*time.Minute || info.PodName() != "3f5a7c6e-pod" {
+		t.Fatalf("Expected ABORTED after 30m0s in 3f5a7c6e-pod, actual %s after %v in %q", info.Result(), info.Duration(), info.PodName())
+	}
+	if pulls := info.Pulls(); len(pulls) != 1 || pulls[0].SHA != "def456" {
+		t.Fatalf("Expected the pull of the prowjob, actual %+v", pulls)
+	}
+
+	// A build with a corrupted finished.json.
+	if _, err := job.NewBuild(4).GetBuildInfo(); err == nil {
+		t.Fatal("Expected an error parsing a corrupted finished.json, actual nil")
+	}
+
+	// A build that passed without a result in finished.json.
+	if result, err := job.NewBuild(5).Result(); err != nil || result != ResultSuccess {
+		t.Fatalf("Expected SUCCESS, actual %s, '%v'", result, err)
+	}
+}
+
+func TestParseClusterMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		want     *ClusterMetadata
+	}{{
+		name: "kubetest2 writes the machine type",
+		metadata: map[string]string{"E2E:Provider": "gke", "E2E:Region": "us-central1", "E2E:Machine": "e2-standard-4",
+			"E2E:Version": "v1.17.9", "E2E:MinNodes": "1", "E2E:MaxNodes": "3"},
+		want: &ClusterMetadata{Provider: "gke", Region: "us-central1", Machine: "e2-standard-4", Version: "v1.17.9", MinNodes: 1, MaxNodes: 3},
+	}, {
+		name: "e2e-tests writes the cluster name to E2E:Machine too",
+		metadata: map[string]string{"E2E:Region": "us-central1", "E2E:Zone": "", "E2E:ClusterName": "e2e-cls",
+			"E2E:Machine": "e2e-cls", "E2E:Version": "1.17.9-gke.1504", "E2E:MinNodes": "1", "E2E:MaxNodes": "3",
+			"E2E:Project": "knative-boskos-01", "E2E:Provider": "gke", "E2E:Kubeconfig": "/tmp/kntest/gke_knative-boskos-01_us-central1_e2e-cls.kubeconfig"},
+		want: &ClusterMetadata{Provider: "gke", Project: "knative-boskos-01", Region: "us-central1", ClusterName: "e2e-cls",
+			Version: "1.17.9-gke.1504", MinNodes: 1, MaxNodes: 3},
+	}, {
+		name:     "kind only writes the cluster name",
+		metadata: map[string]string{"E2E:Provider": "kind", "E2E:ClusterName": "kind", "E2E:Version": "v1.18.2"},
+		want:     &ClusterMetadata{Provider: "kind", ClusterName: "kind", Version: "v1.18.2"},
+	}, {
+		name:     "no cluster",
+		metadata: map[string]string{"Custom": "value"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, parseClusterMetadata(tt.metadata)); diff != "" {
+				t.Errorf("Unexpected cluster metadata (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMetadataJSON(t *testing.T) {
+	data := `{"job-version":"v1","pod":"pod-1","custom":"value","repos":{"knative/serving":"master"}}`
+	var m Metadata
+	if err := json.Unmarshal([]byte(data), &m); err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	if m.JobVersion != "v1" || m.Pod != "pod-1" || string(m.Extra["custom"]) != `"value"` || len(m.Extra) != 1 {
+		t.Fatalf("Expected the typed values and the custom one in Extra, actual %+v", m)
+	}
+	// The custom values are written back along with the typed ones.
+	out, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	if string(out) != `{"custom":"value","job-version":"v1","pod":"pod-1","repos":{"knative/serving":"master"}}` {
+		t.Fatalf("Unexpected metadata written: %s", out)
+	}
+}
+
+func TestGetBuildInfoConcurrently(t *testing.T) {
+	s, cleanup := newManyBuildsStorage(t, 1)
+	defer cleanup()
+	cacheDir, err := ioutil.TempDir("", "prow-cache")
+	if err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+	defer os.RemoveAll(cacheDir)
+	cache, err := NewBuildCache(cacheDir)
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	metadata := fmt.Sprintf("%s/%s/logs/%s/1/%s/%s", s.Root, BucketName, testJobName, ArtifactsDir, MetadataJSON)
+	writeFiles(t, s.Root, map[string]string{
+		fmt.Sprintf("%s/logs/%s/1/%s/%s", BucketName, testJobName, ArtifactsDir, MetadataJSON): `{"E2E:Provider": "gke"}`,
+	})
+	newBuild := func() *Build {
+		return NewClient(s, "", WithCache(cache)).NewJob(testJobName, PeriodicJob, "", "", 0).NewBuild(1)
+	}
+
+	// The copies of the build share the information, which is read once.
+	build := newBuild()
+	reads := s.totalReads()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(b Build) {
+			defer wg.Done()
+			if info, err := b.GetBuildInfo(); err != nil || info.Finished == nil {
+				t.Errorf("Expected the info of the finished build, actual %+v, '%v'", info, err)
+			}
+		}(*build)
+	}
+	wg.Wait()
+	// started.json and finished.json are cached, the missing files aren't
+	// listed in the build directory.
+	if got := s.totalReads() - reads; got != 1 {
+		t.Fatalf("Expected only the metadata to be read, actual %d reads", got)
+	}
+
+	// Another build reads the existing files from the cache.
+	reads = s.totalReads()
+	if _, err := newBuild().GetBuildInfo(); err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	if got := s.totalReads() - reads; got != 0 {
+		t.Fatalf("Expected no reads with a warm cache, actual %d reads", got)
+	}
+
+	// An artifact written again after the build finished is read again.
+	if err := ioutil.WriteFile(metadata, []byte(`{"E2E:Provider": "kind"}`), 0644); err != nil {
+		t.Fatalf("cannot write %q: %v", metadata, err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(metadata, later, later); err != nil {
+		t.Fatalf("cannot change times of %q: %v", metadata, err)
+	}
+	reads = s.totalReads()
+	info, err := newBuild().GetBuildInfo()
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	if got := s.totalReads() - reads; got != 1 || info.Metadata["E2E:Provider"] != "kind" {
+		t.Fatalf("Expected only the new metadata to be read, actual %d reads and %v", got, info.Metadata)
+	}
+}
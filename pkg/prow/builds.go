@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// builds.go enumerates the builds of a job concurrently
+
+package prow
+
+import (
+	"sort"
+	"sync"
+)
+
+// defaultParallelism is the number of builds read at the same time by default
+const defaultParallelism = 16
+
+// ClientOption configures a Client
+type ClientOption func(*Client)
+
+// WithParallelism sets the maximum number of builds read at the same time,
+// values smaller than 1 mean builds are read one at a time
+func WithParallelism(n int) ClientOption {
+	return func(c *Client) {
+		c.parallelism = n
+	}
+}
+
+// WithCache caches the started.json and finished.json files of builds in cache
+func WithCache(cache *BuildCache) ClientOption {
+	return func(c *Client) {
+		c.cache = cache
+	}
+}
+
+// BuildIDIterator pages through the build IDs of a job, from the newest to the
+// oldest build, assuming build IDs are increasing
+type BuildIDIterator struct {
+	ids      []int
+	pageSize int
+}
+
+// NewBuildIDIterator lists the build IDs of the job, to be read pageSize at a time
+func (j *Job) NewBuildIDIterator(pageSize int) *BuildIDIterator {
+	ids := j.GetBuildIDs()
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+	if pageSize < 1 {
+		pageSize = 1
+	}
+	return &BuildIDIterator{ids: ids, pageSize: pageSize}
+}
+
+// Next returns the next page of build IDs, or nil if there is none left
+func (it *BuildIDIterator) Next() []int {
+	if len(it.ids) == 0 {
+		return nil
+	}
+	n := it.pageSize
+	if n > len(it.ids) {
+		n = len(it.ids)
+	}
+	page := it.ids[:n]
+	it.ids = it.ids[n:]
+	return page
+}
+
+// GetLatestFinishedBuilds gets the latest count builds having a finish time,
+// sorted by build ID from newest to oldest. Unlike GetLatestBuilds it only
+// reads the builds it needs, one page of builds at a time.
+// This function takes the assumption that build IDs are always incremental integers.
+func (j *Job) GetLatestFinishedBuilds(count int) []Build {
+	var builds []Build
+	it := j.NewBuildIDIterator(j.parallelism)
+	for len(builds) < count {
+		ids := it.Next()
+		if ids == nil {
+			break
+		}
+		for _, build := range j.newBuilds(ids) {
+			if build.FinishTime != nil && len(builds) < count {
+				builds = append(builds, build)
+			}
+		}
+	}
+	return builds
+}
+
+// newBuilds creates the builds of the given IDs in the same order, reading at
+// most j.parallelism builds at the same time
+func (j *Job) newBuilds(buildIDs []int) []Build {
+	parallelism := j.parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	builds := make([]Build, len(buildIDs))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, id := range buildIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i, id int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			builds[i] = *j.NewBuild(id)
+		}(i, id)
+	}
+	wg.Wait()
+	return builds
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// builds_test.go contains unit tests for enumerating and caching builds
+
+package prow
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingStorage counts the objects read from a LocalStorage
+type countingStorage struct {
+	*LocalStorage
+	mu    sync.Mutex
+	reads map[string]int
+}
+
+func (s *countingStorage) ReadObject(ctx context.Context, bkt, objPath string) ([]byte, error) {
+	s.mu.Lock()
+	s.reads[objPath]++
+	s.mu.Unlock()
+	return s.LocalStorage.ReadObject(ctx, bkt, objPath)
+}
+
+func (s *countingStorage) totalReads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0
+	for _, n := range s.reads {
+		total += n
+	}
+	return total
+}
+
+// newManyBuildsStorage creates builds 1 to n of job_0, all finished except
+// the ones in unfinished
+func newManyBuildsStorage(t *testing.T, n int, unfinished ...int) (*countingStorage, func()) {
+	root, err := ioutil.TempDir("", "prow")
+	if err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+	files := map[string]string{}
+	for i := 1; i <= n; i++ {
+		dir := fmt.Sprintf("%s/logs/%s/%d/", BucketName, testJobName, i)
+		files[dir+StartedJSON] = fmt.Sprintf(`{"timestamp": %d}`, i*100)
+		files[dir+FinishedJSON] = fmt.Sprintf(`{"timestamp": %d}`, i*100+50)
+	}
+	for _, i := range unfinished {
+		delete(files, fmt.Sprintf("%s/logs/%s/%d/%s", BucketName, testJobName, i, FinishedJSON))
+	}
+	writeFiles(t, root, files)
+	return &countingStorage{LocalStorage: NewLocalStorage(root), reads: map[string]int{}}, func() { os.RemoveAll(root) }
+}
+
+func buildIDs(builds []Build) []int {
+	var ids []int
+	for _, b := range builds {
+		ids = append(ids, b.BuildID)
+	}
+	return ids
+}
+
+func TestBuildIDIterator(t *testing.T) {
+	s, cleanup := newManyBuildsStorage(t, 5)
+	defer cleanup()
+
+	it := NewClient(s, "").NewJob(testJobName, PeriodicJob, "", "", 0).NewBuildIDIterator(2)
+	var pages [][]int
+	for page := it.Next(); page != nil; page = it.Next() {
+		pages = append(pages, page)
+	}
+	want := [][]int{{5, 4}, {3, 2}, {1}}
+	if !reflect.DeepEqual(pages, want) {
+		t.Fatalf("Expected pages %v, actual %v", want, pages)
+	}
+}
+
+func TestGetLatestFinishedBuilds(t *testing.T) {
+	s, cleanup := newManyBuildsStorage(t, 40, 40, 38)
+	defer cleanup()
+
+	job := NewClient(s, "", WithParallelism(4)).NewJob(testJobName, PeriodicJob, "", "", 0)
+	builds := job.GetLatestFinishedBuilds(3)
+	if ids := buildIDs(builds); !reflect.DeepEqual(ids, []int{39, 37, 36}) {
+		t.Fatalf("Expected builds [39 37 36], actual %v", ids)
+	}
+	if *builds[0].StartTime != 3900 || *builds[0].FinishTime != 3950 {
+		t.Fatalf("Expected build 39 to start at 3900 and finish at 3950, actual %d and %d",
+			*builds[0].StartTime, *builds[0].FinishTime)
+	}
+	// Only the first 2 pages of 4 builds are needed, each build reading 2 files.
+	if reads := s.totalReads(); reads != 16 {
+		t.Fatalf("Expected 16 reads, actual %d", reads)
+	}
+
+	if ids := buildIDs(job.GetLatestFinishedBuilds(100)); len(ids) != 38 {
+		t.Fatalf("Expected all 38 finished builds, actual %d", len(ids))
+	}
+}
+
+func TestGetBuildsKeepsOrder(t *testing.T) {
+	s, cleanup := newManyBuildsStorage(t, 30)
+	defer cleanup()
+
+	for _, parallelism := range []int{0, 1, 7, 100} {
+		job := NewClient(s, "", WithParallelism(parallelism)).NewJob(testJobName, PeriodicJob, "", "", 0)
+		builds := job.GetBuilds()
+		ids := job.GetBuildIDs()
+		if got := buildIDs(builds); !reflect.DeepEqual(got, ids) {
+			t.Fatalf("Expected builds in the order %v with parallelism %d, actual %v", ids, parallelism, got)
+		}
+		for _, b := range builds {
+			if b.StartTime == nil || *b.StartTime != int64(b.BuildID*100) {
+				t.Fatalf("Expected build %d to have its start time, actual %v", b.BuildID, b.StartTime)
+			}
+		}
+	}
+}
+
+func TestBuildCache(t *testing.T) {
+	s, cleanup := newManyBuildsStorage(t, 3, 3)
+	defer cleanup()
+	cacheDir, err := ioutil.TempDir("", "prow-cache")
+	if err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+	defer os.RemoveAll(cacheDir)
+	cache, err := NewBuildCache(cacheDir)
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+
+	newJob := func() *Job {
+		return NewClient(s, "", WithCache(cache)).NewJob(testJobName, PeriodicJob, "", "", 0)
+	}
+	if builds := newJob().GetBuilds(); len(builds) != 3 {
+		t.Fatalf("Expected 3 builds, actual %d", len(builds))
+	}
+	// The missing finished.json of the running build isn't read.
+	if reads := s.totalReads(); reads != 5 {
+		t.Fatalf("Expected 5 reads filling the cache, actual %d", reads)
+	}
+
+	// A second run reads everything from the cache, the missing finished.json
+	// of the running build isn't listed in its directory.
+	builds := newJob().GetBuilds()
+	if reads := s.totalReads(); reads != 5 {
+		t.Fatalf("Expected no more reads with a warm cache, actual %d", reads-5)
+	}
+	if *builds[1].FinishTime != 250 || builds[2].FinishTime != nil {
+		t.Fatalf("Expected the cached finish time 250 and no finish time, actual %v and %v", builds[1].FinishTime, builds[2].FinishTime)
+	}
+
+	// An object written again has a new generation, and is read again.
+	for _, f := range []string{StartedJSON, FinishedJSON} {
+		p := fmt.Sprintf("%s/%s/logs/%s/3/%s", s.Root, BucketName, testJobName, f)
+		if err := ioutil.WriteFile(p, []byte(`{"timestamp": 999}`), 0644); err != nil {
+			t.Fatalf("cannot write %q: %v", p, err)
+		}
+		later := time.Now().Add(time.Hour)
+		if err := os.Chtimes(p, later, later); err != nil {
+			t.Fatalf("cannot change times of %q: %v", p, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		build := newJob().NewBuild(3)
+		if build.FinishTime == nil || *build.FinishTime != 999 || *build.StartTime != 999 {
+			t.Fatalf("Expected the start and finish times 999, actual %v and %v", build.StartTime, build.FinishTime)
+		}
+	}
+	if reads := s.totalReads(); reads != 7 {
+		t.Fatalf("Expected only the changed objects to be read again, actual %d reads", reads-5)
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// cache.go caches build metadata on disk, so that repeated runs are cheap
+
+package prow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"cloud.google.com/go/storage"
+)
+
+// BuildCache is an on-disk cache of build files, keyed by the path and the
+// generation of the objects, so that an object written again is never served
+// from the cache. It only applies to Storages implementing GenerationStorage,
+// the generations are taken from the listing of the build directories so that
+// the objects aren't checked one by one.
+// A BuildCache can be shared by multiple Clients and processes.
+type BuildCache struct {
+	dir string
+}
+
+// cacheEntry is the content of a cache file
+type cacheEntry struct {
+	Generation int64  `json:"generation"`
+	Content    []byte `json:"content"`
+}
+
+// generationsMemo memoizes the generations of the files of a build, each
+// directory is listed once, it's safe for concurrent use
+type generationsMemo struct {
+	mutex sync.Mutex
+	dirs  map[string]map[string]int64
+}
+
+// NewBuildCache creates a BuildCache storing files under dir
+func NewBuildCache(dir string) (*BuildCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &BuildCache{dir: dir}, nil
+}
+
+func (c *BuildCache) filePath(bkt, objPath string) string {
+	sum := sha256.Sum256([]byte(path.Join(bkt, objPath)))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// get returns the cached content of an object if it has the given generation
+func (c *BuildCache) get(bkt, objPath string, generation int64) ([]byte, bool) {
+	contents, err := ioutil.ReadFile(c.filePath(bkt, objPath))
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(contents, &entry); err != nil || entry.Generation != generation {
+		return nil, false
+	}
+	return entry.Content, true
+}
+
+// put caches the content of an object, writing to a temporary file first so
+// that concurrent readers never see a partial file
+func (c *BuildCache) put(bkt, objPath string, generation int64, content []byte) error {
+	contents, err := json.Marshal(cacheEntry{Generation: generation, Content: content})
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(c.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(contents)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.filePath(bkt, objPath))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// generation returns the generation of an object of the build, from the
+// listing of its directory, and false if the object doesn't exist
+func (b *Build) generation(gs GenerationStorage, objPath string) (int64, bool, error) {
+	dir := path.Dir(objPath)
+	if b.generations == nil {
+		generations, err := gs.ListGenerations(context.Background(), b.Bucket, dir)
+		if err != nil {
+			return 0, false, err
+		}
+		generation, ok := generations[objPath]
+		return generation, ok, nil
+	}
+	b.generations.mutex.Lock()
+	defer b.generations.mutex.Unlock()
+	generations, ok := b.generations.dirs[dir]
+	if !ok {
+		var err error
+		if generations, err = gs.ListGenerations(context.Background(), b.Bucket, dir); err != nil {
+			return 0, false, err
+		}
+		if b.generations.dirs == nil {
+			b.generations.dirs = make(map[string]map[string]int64)
+		}
+		b.generations.dirs[dir] = generations
+	}
+	generation, ok := generations[objPath]
+	return generation, ok, nil
+}
+
+// readCachedFile reads a file of the build, from the cache if the object did
+// not change since it was cached
+func (b *Build) readCachedFile(relPath string) ([]byte, error) {
+	gs, ok := b.storage.(GenerationStorage)
+	if b.cache == nil || !ok {
+		return b.ReadFile(relPath)
+	}
+	objPath := path.Join(b.StoragePath, relPath)
+	generation, exists, err := b.generation(gs, objPath)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, storage.ErrObjectNotExist
+	}
+	if content, ok := b.cache.get(b.Bucket, objPath, generation); ok {
+		return content, nil
+	}
+	content, err := b.ReadFile(relPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.cache.put(b.Bucket, objPath, generation, content); err != nil {
+		log.Printf("WARNING: failed caching '%s': %v", objPath, err)
+	}
+	return content, nil
+}
@@ -0,0 +1,294 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// logsearch.go searches build logs and artifacts for lines matching patterns
+
+package prow
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+
+	"knative.dev/test-infra/pkg/helpers"
+)
+
+// DefaultMaxLineLength is the length lines are truncated to by default when
+// searching, so that a huge line doesn't need to be held in memory
+const DefaultMaxLineLength = 1024 * 1024
+
+// SearchOptions defines what to search for and where
+type SearchOptions struct {
+	// Patterns are the regular expressions to search for, a line matches if
+	// it matches any of them
+	Patterns []*regexp.Regexp
+	// Files are the files to search, relative to the build directory. Glob
+	// patterns (see path.Match) are matched against the artifacts of the build.
+	// Defaults to build-log.txt.
+	Files []string
+	// Before and After are the number of context lines to return before and
+	// after each matching line
+	Before int
+	After  int
+	// MaxMatches is the maximum number of matches returned per file, 0 means
+	// no limit
+	MaxMatches int
+	// MaxLineLength is the length longer lines are truncated to, defaults to
+	// DefaultMaxLineLength
+	MaxLineLength int
+}
+
+// LogMatch is a line matching one of the patterns
+type LogMatch struct {
+	// File is the path of the file relative to the build directory
+	File string
+	// LineNumber starts from 1
+	LineNumber int
+	Line       string
+	// Pattern is the first pattern matching the line
+	Pattern string
+	Before  []string
+	After   []string
+}
+
+// BuildMatches holds all the matches in a build
+type BuildMatches struct {
+	Build   Build
+	Matches []LogMatch
+}
+
+// NewSearchOptions compiles the patterns into SearchOptions searching build-log.txt
+func NewSearchOptions(patterns ...string) (*SearchOptions, error) {
+	opts := &SearchOptions{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		opts.Patterns = append(opts.Patterns, re)
+	}
+	return opts, nil
+}
+
+// SearchLogs searches the files of the build, files that don't exist are skipped
+func (b *Build) SearchLogs(opts SearchOptions) ([]LogMatch, error) {
+	files, err := b.searchedFiles(opts.Files)
+	if err != nil {
+		return nil, err
+	}
+	var matches []LogMatch
+	for _, f := range files {
+		r, err := b.storage.NewReader(context.Background(), b.Bucket, path.Join(b.StoragePath, f))
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		m, err := SearchReader(r, f, opts)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed searching %q: %w", path.Join(b.StoragePath, f), err)
+		}
+		matches = append(matches, m...)
+	}
+	return matches, nil
+}
+
+// searchedFiles expands the glob patterns in files with the artifacts of the build
+func (b *Build) searchedFiles(files []string) ([]string, error) {
+	if len(files) == 0 {
+		return []string{BuildLog}, nil
+	}
+	var res []string
+	var artifacts []string
+	for _, f := range files {
+		if !strings.ContainsAny(f, "*?[") {
+			res = append(res, f)
+			continue
+		}
+		if artifacts == nil {
+			paths, err := b.storage.ListChildrenFiles(context.Background(), b.Bucket, b.GetArtifactsDir())
+			if err != nil {
+				return nil, err
+			}
+			artifacts = make([]string, 0, len(paths))
+			for _, p := range paths {
+				artifacts = append(artifacts, strings.TrimPrefix(p, b.StoragePath+"/"))
+			}
+		}
+		for _, a := range artifacts {
+			if ok, err := path.Match(f, a); err != nil {
+				return nil, fmt.Errorf("invalid file pattern %q: %w", f, err)
+			} else if ok {
+				res = append(res, a)
+			}
+		}
+	}
+	return res, nil
+}
+
+// SearchReader searches the content of r, decompressing it if it's gzipped.
+// name is used as the File of the matches.
+func SearchReader(r io.Reader, name string, opts SearchOptions) ([]LogMatch, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+	}
+	maxLen := opts.MaxLineLength
+	if maxLen <= 0 {
+		maxLen = DefaultMaxLineLength
+	}
+
+	var matches []LogMatch
+	// before holds the last opts.Before lines, and pending holds the indexes of
+	// the matches still waiting for lines after them
+	var before []string
+	var pending []int
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := readLine(br, maxLen)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		remaining := pending[:0]
+		for _, i := range pending {
+			matches[i].After = append(matches[i].After, line)
+			if len(matches[i].After) < opts.After {
+				remaining = append(remaining, i)
+			}
+		}
+		pending = remaining
+
+		if opts.MaxMatches <= 0 || len(matches) < opts.MaxMatches {
+			for _, re := range opts.Patterns {
+				if !re.MatchString(line) {
+					continue
+				}
+				matches = append(matches, LogMatch{
+					File:       name,
+					LineNumber: lineNumber,
+					Line:       line,
+					Pattern:    re.String(),
+					Before:     append([]string(nil), before...),
+				})
+				if opts.After > 0 {
+					pending = append(pending, len(matches)-1)
+				}
+				break
+			}
+		} else if len(pending) == 0 {
+			break
+		}
+
+		if opts.Before > 0 {
+			if len(before) == opts.Before {
+				before = before[1:]
+			}
+			before = append(before, line)
+		}
+	}
+	return matches, nil
+}
+
+// readLine reads a line without the line ending, truncating it to maxLen,
+// and returns io.EOF only if there is nothing left to read
+func readLine(r *bufio.Reader, maxLen int) (string, error) {
+	var buf bytes.Buffer
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			if err == io.EOF && buf.Len() > 0 {
+				return buf.String(), nil
+			}
+			return "", err
+		}
+		if room := maxLen - buf.Len(); room > 0 {
+			if len(chunk) > room {
+				chunk = chunk[:room]
+			}
+			buf.Write(chunk)
+		}
+		if !isPrefix {
+			return buf.String(), nil
+		}
+	}
+}
+
+// SearchBuilds searches the builds of the job started since the given time,
+// and returns the ones with matches from the newest to the oldest build.
+// Builds are searched with the parallelism of the client. This function takes
+// the assumption that build IDs are always incremental integers.
+func (j *Job) SearchBuilds(since time.Time, opts SearchOptions) ([]BuildMatches, error) {
+	var res []BuildMatches
+	var errs []error
+	it := j.NewBuildIDIterator(j.parallelism)
+	for ids := it.Next(); ids != nil; ids = it.Next() {
+		builds := j.newBuilds(ids)
+		found := make([][]LogMatch, len(builds))
+		pageErrs := make([]error, len(builds))
+		older := 0
+
+		var wg sync.WaitGroup
+		for i := range builds {
+			if builds[i].StartTime == nil {
+				continue
+			}
+			if time.Unix(*builds[i].StartTime, 0).Before(since) {
+				older++
+				continue
+			}
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				found[i], pageErrs[i] = builds[i].SearchLogs(opts)
+			}(i)
+		}
+		wg.Wait()
+
+		for i, b := range builds {
+			if pageErrs[i] != nil {
+				errs = append(errs, fmt.Errorf("build %d: %w", b.BuildID, pageErrs[i]))
+			} else if len(found[i]) != 0 {
+				res = append(res, BuildMatches{Build: b, Matches: found[i]})
+			}
+		}
+		// Older builds only have smaller IDs, no need to look at the next pages.
+		if older > 0 {
+			break
+		}
+	}
+	return res, helpers.CombineErrors(errs)
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// logsearch_test.go contains unit tests for searching build logs
+
+package prow
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testLog = `starting
+creating cluster
+ERROR: quota exceeded
+retrying
+creating cluster
+panic: something bad
+goroutine 1
+done`
+
+func mustSearchOptions(t *testing.T, patterns ...string) SearchOptions {
+	opts, err := NewSearchOptions(patterns...)
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	return *opts
+}
+
+func TestSearchReader(t *testing.T) {
+	opts := mustSearchOptions(t, "^ERROR", "^panic:")
+	opts.Before, opts.After = 2, 1
+	matches, err := SearchReader(strings.NewReader(testLog), BuildLog, opts)
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	want := []LogMatch{{
+		File:       BuildLog,
+		LineNumber: 3,
+		Line:       "ERROR: quota exceeded",
+		Pattern:    "^ERROR",
+		Before:     []string{"starting", "creating cluster"},
+		After:      []string{"retrying"},
+	}, {
+		File:       BuildLog,
+		LineNumber: 6,
+		Line:       "panic: something bad",
+		Pattern:    "^panic:",
+		Before:     []string{"retrying", "creating cluster"},
+		After:      []string{"goroutine 1"},
+	}}
+	if diff := cmp.Diff(want, matches); diff != "" {
+		t.Fatalf("Unexpected matches (-want +got):\n%s", diff)
+	}
+
+	// Matches are limited, but still get their context.
+	opts = mustSearchOptions(t, "creating")
+	opts.MaxMatches, opts.After = 1, 3
+	matches, err = SearchReader(strings.NewReader(testLog), BuildLog, opts)
+	if err != nil || len(matches) != 1 || matches[0].LineNumber != 2 || len(matches[0].After) != 3 {
+		t.Fatalf("Expected 1 match on line 2 with 3 lines after, actual %+v, '%v'", matches, err)
+	}
+}
+
+func TestSearchReaderLongLinesAndGzip(t *testing.T) {
+	long := strings.Repeat("x", 10*1024*1024)
+	content := "first\n" + long + "ERROR at the end\nERROR after the long line\n"
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(content))
+	w.Close()
+
+	for name, data := range map[string][]byte{"plain": []byte(content), "gzip": gz.Bytes()} {
+		t.Run(name, func(t *testing.T) {
+			opts := mustSearchOptions(t, "ERROR", "x{100}")
+			opts.MaxLineLength = 1024
+			matches, err := SearchReader(bytes.NewReader(data), "log", opts)
+			if err != nil {
+				t.Fatalf("Expected '', actual '%v'", err)
+			}
+			if len(matches) != 2 {
+				t.Fatalf("Expected 2 matches, actual %d", len(matches))
+			}
+			// The long line is truncated, so only the second pattern matches it.
+			if matches[0].LineNumber != 2 || matches[0].Pattern != "x{100}" || len(matches[0].Line) != 1024 {
+				t.Fatalf("Expected the truncated line 2 to match x{100}, actual line %d matching %q with %d chars",
+					matches[0].LineNumber, matches[0].Pattern, len(matches[0].Line))
+			}
+			if matches[1].LineNumber != 3 || matches[1].Line != "ERROR after the long line" {
+				t.Fatalf("Expected line 3 to match, actual %+v", matches[1])
+			}
+		})
+	}
+}
+
+func TestSearchLogsAndBuilds(t *testing.T) {
+	root, err := ioutil.TempDir("", "prow")
+	if err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	now := time.Now()
+	files := map[string]string{}
+	for i := 1; i <= 10; i++ {
+		dir := fmt.Sprintf("%s/logs/%s/%d/", BucketName, testJobName, i)
+		// One build a day, build 10 started today.
+		files[dir+StartedJSON] = fmt.Sprintf(`{"timestamp": %d}`, now.AddDate(0, 0, i-10).Unix())
+		files[dir+BuildLog] = "all good"
+		if i%3 == 0 {
+			files[dir+BuildLog] = "ERROR: quota exceeded"
+		}
+	}
+	dir := fmt.Sprintf("%s/logs/%s/9/", BucketName, testJobName)
+	files[dir+"artifacts/junit_01.xml"] = "<failure>ERROR: timeout</failure>"
+	files[dir+"artifacts/k8s.log.txt"] = "ERROR: node not ready"
+	writeFiles(t, root, files)
+
+	job := NewClient(NewLocalStorage(root), "", WithParallelism(2)).NewJob(testJobName, PeriodicJob, "", "", 0)
+
+	opts := mustSearchOptions(t, "ERROR")
+	opts.Files = []string{BuildLog, "artifacts/*.txt", "missing.txt"}
+	matches, err := job.NewBuild(9).SearchLogs(opts)
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	var got []string
+	for _, m := range matches {
+		got = append(got, m.File)
+	}
+	if want := []string{BuildLog, "artifacts/k8s.log.txt"}; !cmp.Equal(want, got) {
+		t.Fatalf("Expected matches in %v, actual %v", want, got)
+	}
+
+	// Builds 3, 6 and 9 fail, but build 3 started a week ago.
+	found, err := job.SearchBuilds(now.AddDate(0, 0, -5), mustSearchOptions(t, "quota"))
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	got = nil
+	for _, bm := range found {
+		got = append(got, fmt.Sprint(bm.Build.BuildID))
+	}
+	if want := []string{"9", "6"}; !cmp.Equal(want, got) {
+		t.Fatalf("Expected builds %v, actual %v", want, got)
+	}
+}
+
+func TestParseLogLongLines(t *testing.T) {
+	root, err := ioutil.TempDir("", "prow")
+	if err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+	writeFiles(t, root, map[string]string{
+		fmt.Sprintf("%s/logs/%s/1/%s", BucketName, testJobName, BuildLog): strings.Repeat("x", 1024*1024) + "\nfound it\n",
+	})
+	job := NewClient(NewLocalStorage(root), "").NewJob(testJobName, PeriodicJob, "", "", 0)
+	logs, err := job.NewBuild(1).ParseLog(func(s []string) *string {
+		if len(s) == 2 && s[0] == "found" {
+			return &s[1]
+		}
+		return nil
+	})
+	if err != nil || len(logs) != 1 || logs[0] != "it" {
+		t.Fatalf("Expected [it], actual %v, '%v'", logs, err)
+	}
+}
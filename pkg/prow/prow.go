@@ -23,6 +23,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"io"
 	"log"
 	"os"
 	"path"
@@ -59,8 +60,15 @@ const (
 
 // defined here so that it can be mocked for unit testing
 var logFatalf = log.Fatalf
-var ctx = context.Background()
-var client gcs.Client
+
+// Client reads prow jobs and builds from a bucket of a Storage.
+// Use one Client per bucket to read multiple buckets in one process.
+type Client struct {
+	storage     Storage
+	bucket      string
+	parallelism int
+	cache       *BuildCache
+}
 
 // Job struct represents a job directory in gcs.
 // gcs job StoragePath will be derived from Type if it's defined,
@@ -73,6 +81,10 @@ type Job struct {
 	StoragePath string  // optional
 	PullID      int     // only for Presubmit jobs
 	Builds      []Build // optional
+
+	storage     Storage
+	parallelism int
+	cache       *BuildCache
 }
 
 // Build points to a build stored under a particular gcs path.
@@ -83,15 +95,25 @@ type Build struct {
 	Bucket      string // optional
 	StartTime   *int64
 	FinishTime  *int64
+
+	storage Storage
+	cache   *BuildCache
+	// info is shared by the copies of the build, see GetBuildInfo
+	info *buildInfoMemo
+	// generations are shared by the copies of the build, see readCachedFile
+	generations *generationsMemo
 }
 
 // Started holds the started.json values of the build.
 type Started struct {
 	Timestamp   int64             `json:"timestamp"` // epoch seconds
 	RepoVersion string            `json:"repo-version"`
+	RepoCommit  string            `json:"repo-commit,omitempty"`
+	JobVersion  string            `json:"job-version,omitempty"`
 	Node        string            `json:"node"`
 	Pull        string            `json:"pull"`
 	Repos       map[string]string `json:"repos"` // {repo: branch_or_pull} map
+	Metadata    Metadata          `json:"metadata,omitempty"`
 }
 
 // Finished holds the finished.json values of the build
@@ -99,12 +121,70 @@ type Finished struct {
 	// Timestamp is epoch seconds
 	Timestamp  int64    `json:"timestamp"`
 	Passed     bool     `json:"passed"`
+	Result     string   `json:"result,omitempty"` // e.g. SUCCESS, FAILURE or ABORTED
 	JobVersion string   `json:"job-version"`
+	Revision   string   `json:"revision,omitempty"`
 	Metadata   Metadata `json:"metadata"`
 }
 
-// Metadata contains metadata in finished.json
-type Metadata map[string]interface{}
+// Metadata contains the metadata in started.json and finished.json. The values
+// written by prow are typed, the other ones are kept in Extra.
+type Metadata struct {
+	// Repo is the main repo of the build, e.g. knative/serving
+	Repo string `json:"repo,omitempty"`
+	// Repos maps the repos of the build to their branch or pull, e.g.
+	// {"knative/serving": "master:abc123,42:def456"}
+	Repos         map[string]string `json:"repos,omitempty"`
+	RepoCommit    string            `json:"repo-commit,omitempty"`
+	InfraCommit   string            `json:"infra-commit,omitempty"`
+	JobVersion    string            `json:"job-version,omitempty"`
+	Pod           string            `json:"pod,omitempty"`
+	WorkNamespace string            `json:"work-namespace,omitempty"`
+	// Extra holds the values of the other keys, as written by the tests
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// metadataKeys are the keys of the typed values of Metadata
+var metadataKeys = []string{"repo", "repos", "repo-commit", "infra-commit", "job-version", "pod", "work-namespace"}
+
+// UnmarshalJSON parses the typed values, and keeps the other ones in Extra
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	// metadata doesn't have the methods of Metadata, so that it's parsed as a regular struct
+	type metadata Metadata
+	var typed metadata
+	if err := json.Unmarshal(data, &typed); err != nil {
+		return err
+	}
+	var extra map[string]json.RawMessage
+	if err := json.Unmarshal(data, &extra); err != nil {
+		return err
+	}
+	for _, k := range metadataKeys {
+		delete(extra, k)
+	}
+	if len(extra) != 0 {
+		typed.Extra = extra
+	}
+	*m = Metadata(typed)
+	return nil
+}
+
+// MarshalJSON writes the typed values along with the ones in Extra
+func (m Metadata) MarshalJSON() ([]byte, error) {
+	type metadata Metadata
+	data, err := json.Marshal(metadata(m))
+	if err != nil || len(m.Extra) == 0 {
+		return data, err
+	}
+	all := make(map[string]json.RawMessage, len(m.Extra))
+	for k, v := range m.Extra {
+		all[k] = v
+	}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	return json.Marshal(all)
+}
 
 // IsCI returns whether the current environment is a CI environment.
 func IsCI() bool {
@@ -126,22 +206,47 @@ func GetLocalArtifactsDir() string {
 
 /* GCS related logics */
 
-// Initialize wraps gcs authentication, have to be invoked before any other functions
-func Initialize(serviceAccount string) error {
-	var err error
-	client, err = gcs.NewClient(ctx, serviceAccount)
-	return err
+// NewClient creates a Client reading the given bucket from storage,
+// bucket defaults to BucketName if empty
+func NewClient(storage Storage, bucket string, opts ...ClientOption) *Client {
+	if bucket == "" {
+		bucket = BucketName
+	}
+	c := &Client{storage: storage, bucket: bucket, parallelism: defaultParallelism}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// NewGCSClient wraps gcs authentication, and creates a Client reading from the
+// knative-prow bucket
+func NewGCSClient(ctx context.Context, serviceAccount string, opts ...ClientOption) (*Client, error) {
+	client, err := gcs.NewClient(ctx, "gs://"+BucketName, serviceAccount)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(NewGCSStorage(client), BucketName, opts...), nil
+}
+
+// Bucket returns the name of the bucket the Client reads from
+func (c *Client) Bucket() string {
+	return c.bucket
 }
 
 // NewJob creates new job struct
 // pullID is only saved by Presubmit job for determining StoragePath
-func NewJob(jobName, jobType, orgName, repoName string, pullID int) *Job {
+func (c *Client) NewJob(jobName, jobType, orgName, repoName string, pullID int) *Job {
 	job := Job{
 		Name:   jobName,
 		Type:   jobType,
-		Bucket: BucketName,
+		Bucket: c.bucket,
 		Org:    orgName,
 		Repo:   repoName,
+
+		storage:     c.storage,
+		parallelism: c.parallelism,
+		cache:       c.cache,
 	}
 
 	switch jobType {
@@ -160,13 +265,13 @@ func NewJob(jobName, jobType, orgName, repoName string, pullID int) *Job {
 
 // PathExists checks if the storage path of a job exists in gcs or not
 func (j *Job) PathExists() bool {
-	return client.Exists(ctx, BucketName, j.StoragePath)
+	return j.storage.Exists(context.Background(), j.Bucket, j.StoragePath)
 }
 
 // GetLatestBuildNumber gets the latest build number for job
 func (j *Job) GetLatestBuildNumber() (int, error) {
 	logFilePath := path.Join(j.StoragePath, Latest)
-	contents, err := client.ReadObject(ctx, BucketName, logFilePath)
+	contents, err := j.storage.ReadObject(context.Background(), j.Bucket, logFilePath)
 	if err != nil {
 		return 0, err
 	}
@@ -181,10 +286,15 @@ func (j *Job) GetLatestBuildNumber() (int, error) {
 // No gcs operation is performed by this function
 func (j *Job) NewBuild(buildID int) *Build {
 	build := Build{
-		Bucket:      BucketName,
+		Bucket:      j.Bucket,
 		JobName:     j.Name,
 		StoragePath: path.Join(j.StoragePath, strconv.Itoa(buildID)),
 		BuildID:     buildID,
+
+		storage:     j.storage,
+		cache:       j.cache,
+		info:        &buildInfoMemo{},
+		generations: &generationsMemo{},
 	}
 
 	if startTime, err := build.GetStartTime(); err == nil {
@@ -202,7 +312,7 @@ func (j *Job) GetFinishedBuilds() []Build {
 	var finishedBuilds []Build
 	builds := j.GetBuilds()
 	for _, build := range builds {
-		if build.IsFinished() {
+		if build.FinishTime != nil || build.IsFinished() {
 			finishedBuilds = append(finishedBuilds, build)
 		}
 	}
@@ -211,21 +321,16 @@ func (j *Job) GetFinishedBuilds() []Build {
 
 // GetBuilds gets all builds from this job on gcs, precomputes start/finish time of builds
 // by parsing "Started.json" and "Finished.json" on gcs, could be very expensive if there are
-// large number of builds
+// large number of builds, see GetLatestFinishedBuilds for a cheaper alternative
 func (j *Job) GetBuilds() []Build {
-	buildIDs := j.GetBuildIDs()
-	builds := make([]Build, 0, len(buildIDs))
-	for _, ID := range buildIDs {
-		builds = append(builds, *j.NewBuild(ID))
-	}
-	return builds
+	return j.newBuilds(j.GetBuildIDs())
 }
 
 // GetBuildIDs gets all build IDs from this job on gcs, scans all direct child of gcs directory
 // for job, keeps the ones that can be parsed as integer
 func (j *Job) GetBuildIDs() []int {
 	var buildIDs []int
-	gcsBuildPaths, _ := client.ListDirectChildren(ctx, j.Bucket, j.StoragePath)
+	gcsBuildPaths, _ := j.storage.ListDirectChildren(context.Background(), j.Bucket, j.StoragePath)
 	for _, gcsBuildPath := range gcsBuildPaths {
 		if buildID, err := getBuildIDFromBuildPath(gcsBuildPath); err == nil {
 			buildIDs = append(buildIDs, buildID)
@@ -258,19 +363,19 @@ func (j *Job) GetLatestBuilds(count int) []Build {
 
 // IsStarted check if build has started by looking at "started.json" file
 func (b *Build) IsStarted() bool {
-	return client.Exists(ctx, BucketName, path.Join(b.StoragePath, StartedJSON))
+	return b.storage.Exists(context.Background(), b.Bucket, path.Join(b.StoragePath, StartedJSON))
 }
 
 // IsFinished check if build has finished by looking at "finished.json" file
 func (b *Build) IsFinished() bool {
-	return client.Exists(ctx, BucketName, path.Join(b.StoragePath, FinishedJSON))
+	return b.storage.Exists(context.Background(), b.Bucket, path.Join(b.StoragePath, FinishedJSON))
 }
 
 // GetStartTime gets started timestamp of a build,
 // returning -1 if the build didn't start or if it failed to get the timestamp
 func (b *Build) GetStartTime() (int64, error) {
 	var started Started
-	if err := unmarshalJSONFile(path.Join(b.StoragePath, StartedJSON), &started); err != nil {
+	if err := b.unmarshalJSONFile(StartedJSON, &started); err != nil {
 		return -1, err
 	}
 	return started.Timestamp, nil
@@ -280,7 +385,7 @@ func (b *Build) GetStartTime() (int64, error) {
 // returning -1 if the build didn't finish or if it failed to get the timestamp
 func (b *Build) GetFinishTime() (int64, error) {
 	var finished Finished
-	if err := unmarshalJSONFile(path.Join(b.StoragePath, FinishedJSON), &finished); err != nil {
+	if err := b.unmarshalJSONFile(FinishedJSON, &finished); err != nil {
 		return -1, err
 	}
 	return finished.Timestamp, nil
@@ -288,7 +393,7 @@ func (b *Build) GetFinishTime() (int64, error) {
 
 // GetArtifacts gets gcs path for all artifacts of current build
 func (b *Build) GetArtifacts() []string {
-	artifacts, _ := client.ListChildrenFiles(ctx, BucketName, b.GetArtifactsDir())
+	artifacts, _ := b.storage.ListChildrenFiles(context.Background(), b.Bucket, b.GetArtifactsDir())
 	return artifacts
 }
 
@@ -305,7 +410,7 @@ func (b *Build) GetBuildLogPath() string {
 // ReadFile reads given file of current build,
 // relPath is the file path relative to build directory
 func (b *Build) ReadFile(relPath string) ([]byte, error) {
-	return client.ReadObject(ctx, BucketName, path.Join(b.StoragePath, relPath))
+	return b.storage.ReadObject(context.Background(), b.Bucket, path.Join(b.StoragePath, relPath))
 }
 
 // ParseLog parses the build log and returns the lines where the checkLog func does not return an empty slice,
@@ -313,14 +418,21 @@ func (b *Build) ReadFile(relPath string) ([]byte, error) {
 func (b *Build) ParseLog(checkLog func(s []string) *string) ([]string, error) {
 	var logs []string
 
-	f, err := client.NewReader(ctx, b.Bucket, b.GetBuildLogPath())
+	f, err := b.storage.NewReader(context.Background(), b.Bucket, b.GetBuildLogPath())
 	if err != nil {
 		return logs, err
 	}
 	defer f.Close()
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		if s := checkLog(strings.Fields(scanner.Text())); s != nil {
+	r := bufio.NewReader(f)
+	for {
+		line, err := readLine(r, DefaultMaxLineLength)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return logs, err
+		}
+		if s := checkLog(strings.Fields(line)); s != nil {
 			logs = append(logs, *s)
 		}
 	}
@@ -333,10 +445,10 @@ func getBuildIDFromBuildPath(buildPath string) (int, error) {
 	return strconv.Atoi(buildIDStr)
 }
 
-// unmarshalJSONFile reads a file from gcs, parses it with xml and write to v.
+// unmarshalJSONFile reads a file of the build, parses it with json and write to v.
 // v must be an arbitrary struct, slice, or string.
-func unmarshalJSONFile(storagePath string, v interface{}) error {
-	contents, err := client.ReadObject(ctx, BucketName, storagePath)
+func (b *Build) unmarshalJSONFile(relPath string, v interface{}) error {
+	contents, err := b.readCachedFile(relPath)
 	if err != nil {
 		return err
 	}
@@ -42,7 +42,7 @@ var jobPathTests = []struct {
 
 func TestJobPath(t *testing.T) {
 	for _, testData := range jobPathTests {
-		job := NewJob(testJobName, testData.in, orgName, repoName, 0)
+		job := NewClient(NewLocalStorage(""), "").NewJob(testJobName, testData.in, orgName, repoName, 0)
 		if job.StoragePath != testData.out {
 			t.Errorf("Expected '%s', actual '%s'", testData.out, job.StoragePath)
 		}
@@ -59,7 +59,7 @@ func TestInvalidJobPath(t *testing.T) {
 		exitString = expectedExitString
 	}
 
-	NewJob(testJobName, invalidJobType, orgName, repoName, 0)
+	NewClient(NewLocalStorage(""), "").NewJob(testJobName, invalidJobType, orgName, repoName, 0)
 	if exitString != expectedExitString {
 		t.Fatalf("Expected: %s, actual: %s", exitString, expectedExitString)
 	}
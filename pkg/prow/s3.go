@@ -0,0 +1,191 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// s3.go reads prow artifacts from S3 compatible stores, e.g. a MinIO mirror
+
+package prow
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// s3DefaultRegion is the region used to look up the region of the buckets
+const s3DefaultRegion = "us-east-1"
+
+// S3Options configures an S3Storage
+type S3Options struct {
+	// Endpoint is the host[:port] of an S3 compatible store, requests are
+	// path-style (https://<endpoint>/<bucket>/<object>) if it's set,
+	// the AWS endpoint of the region otherwise
+	Endpoint string
+	// Region is the region of the buckets, it's looked up for each bucket if
+	// it's empty and Endpoint isn't set
+	Region string
+	// Insecure uses http instead of https
+	Insecure bool
+	// Credentials defaults to the default AWS credential chain: the
+	// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN env vars,
+	// the shared credentials file, then the instance role, refreshed once expired
+	Credentials *credentials.Credentials
+}
+
+// S3Storage reads prow artifacts from an S3 compatible store with the AWS SDK
+type S3Storage struct {
+	opts    S3Options
+	session *session.Session
+
+	// clients are the clients of each bucket, in the region of the bucket
+	clients map[string]s3iface.S3API
+	mutex   sync.Mutex
+}
+
+var _ Storage = (*S3Storage)(nil)
+
+// NewS3Storage creates a Storage reading from an S3 compatible store
+func NewS3Storage(opts S3Options) (*S3Storage, error) {
+	config := aws.NewConfig().WithDisableSSL(opts.Insecure).WithCredentials(opts.Credentials)
+	if opts.Endpoint != "" {
+		config = config.WithEndpoint(opts.Endpoint).WithS3ForcePathStyle(true)
+	}
+	region := opts.Region
+	if region == "" {
+		region = s3DefaultRegion
+	}
+	sess, err := session.NewSession(config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("failed creating the S3 session: %w", err)
+	}
+	return &S3Storage{opts: opts, session: sess, clients: make(map[string]s3iface.S3API)}, nil
+}
+
+// client returns the client of the bucket, looking up the region of the bucket
+// first if it's not known, so that requests aren't redirected to another region
+func (s *S3Storage) client(ctx context.Context, bkt string) (s3iface.S3API, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if c, ok := s.clients[bkt]; ok {
+		return c, nil
+	}
+	var c s3iface.S3API = s3.New(s.session)
+	if s.opts.Region == "" && s.opts.Endpoint == "" {
+		region, err := s3manager.GetBucketRegion(ctx, s.session, bkt, s3DefaultRegion)
+		if err != nil {
+			return nil, fmt.Errorf("failed getting the region of bucket %q: %w", bkt, err)
+		}
+		c = s3.New(s.session, aws.NewConfig().WithRegion(region))
+	}
+	s.clients[bkt] = c
+	return c, nil
+}
+
+// Exists checks if an object or a directory exists under a bucket
+func (s *S3Storage) Exists(ctx context.Context, bkt, objPath string) bool {
+	c, err := s.client(ctx, bkt)
+	if err != nil {
+		return false
+	}
+	if _, err := c.HeadObjectWithContext(ctx, &s3.HeadObjectInput{Bucket: aws.String(bkt), Key: aws.String(objPath)}); err == nil {
+		return true
+	}
+	// Check if this is a directory, which only exists as a prefix of objects.
+	res, err := c.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bkt),
+		Prefix:  aws.String(strings.TrimRight(objPath, " /") + "/"),
+		MaxKeys: aws.Int64(1),
+	})
+	return err == nil && (len(res.Contents) != 0 || len(res.CommonPrefixes) != 0)
+}
+
+// ListChildrenFiles recursively lists all children files
+func (s *S3Storage) ListChildrenFiles(ctx context.Context, bkt, dirPath string) ([]string, error) {
+	return s.list(ctx, bkt, dirPath, "")
+}
+
+// ListDirectChildren lists direct children paths (including files and directories)
+func (s *S3Storage) ListDirectChildren(ctx context.Context, bkt, dirPath string) ([]string, error) {
+	return s.list(ctx, bkt, dirPath, "/")
+}
+
+// NewReader creates a new Reader of an object, caller must close it when done
+func (s *S3Storage) NewReader(ctx context.Context, bkt, objPath string) (io.ReadCloser, error) {
+	c, err := s.client(ctx, bkt)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: aws.String(bkt), Key: aws.String(objPath)})
+	if err != nil {
+		if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusNotFound {
+			return nil, storage.ErrObjectNotExist
+		}
+		return nil, fmt.Errorf("failed reading %q in bucket %q: %w", objPath, bkt, err)
+	}
+	return res.Body, nil
+}
+
+// ReadObject reads the content of an object
+func (s *S3Storage) ReadObject(ctx context.Context, bkt, objPath string) ([]byte, error) {
+	r, err := s.NewReader(ctx, bkt, objPath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func (s *S3Storage) list(ctx context.Context, bkt, dirPath, delimiter string) ([]string, error) {
+	c, err := s.client(ctx, bkt)
+	if err != nil {
+		return nil, err
+	}
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bkt)}
+	if dirPath != "" {
+		input.Prefix = aws.String(strings.TrimRight(dirPath, " /") + "/")
+	}
+	if delimiter != "" {
+		input.Delimiter = aws.String(delimiter)
+	}
+	var paths []string
+	err = c.ListObjectsV2PagesWithContext(ctx, input, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, p := range page.CommonPrefixes {
+			paths = append(paths, strings.TrimSuffix(aws.StringValue(p.Prefix), "/"))
+		}
+		for _, o := range page.Contents {
+			paths = append(paths, aws.StringValue(o.Key))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed listing %q in bucket %q: %w", dirPath, bkt, err)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// s3_test.go contains unit tests for reading prow artifacts from S3 compatible stores
+
+package prow
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// fakeS3 serves ListObjectsV2 and GetObject for the given objects, returning
+// at most pageSize keys per list page
+func fakeS3(bkt string, objects map[string]string, pageSize int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// requests must be signed with AWS Signature Version 4
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/"+bkt)
+		if key != "" {
+			content, ok := objects[strings.TrimPrefix(key, "/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, content)
+			return
+		}
+
+		q := r.URL.Query()
+		prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+		var entries []string
+		seen := map[string]bool{}
+		for _, k := range sortedKeys(objects) {
+			if !strings.HasPrefix(k, prefix) {
+				continue
+			}
+			entry := "<Contents><Key>" + k + "</Key></Contents>"
+			if rest := strings.TrimPrefix(k, prefix); delimiter != "" && strings.Contains(rest, delimiter) {
+				p := prefix + rest[:strings.Index(rest, delimiter)+1]
+				if seen[p] {
+					continue
+				}
+				seen[p] = true
+				entry = "<CommonPrefixes><Prefix>" + p + "</Prefix></CommonPrefixes>"
+			}
+			entries = append(entries, entry)
+		}
+		start := 0
+		fmt.Sscanf(q.Get("continuation-token"), "%d", &start)
+		end := start + pageSize
+		truncated := end < len(entries)
+		if !truncated {
+			end = len(entries)
+		}
+		// same as S3, the last page has no continuation token
+		token := ""
+		if truncated {
+			token = fmt.Sprintf("<NextContinuationToken>%d</NextContinuationToken>", end)
+		}
+		fmt.Fprintf(w, "<ListBucketResult>%s<IsTruncated>%t</IsTruncated>%s</ListBucketResult>",
+			strings.Join(entries[start:end], ""), truncated, token)
+	}))
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestS3Storage(t *testing.T) {
+	server := fakeS3("mirror", map[string]string{
+		"logs/job_0/1/started.json":           `{"timestamp": 100}`,
+		"logs/job_0/1/finished.json":          `{"timestamp": 200}`,
+		"logs/job_0/1/artifacts/junit_01.xml": "<testsuites/>",
+		"logs/job_0/2/started.json":           `{"timestamp": 300}`,
+		"logs/job_0/3/started.json":           `{"timestamp": 500}`,
+	}, 2)
+	defer server.Close()
+
+	s, err := NewS3Storage(S3Options{
+		Endpoint:    strings.TrimPrefix(server.URL, "http://"),
+		Insecure:    true,
+		Credentials: credentials.NewStaticCredentials("minio", "minio123", ""),
+	})
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	ctx := context.Background()
+
+	children, err := s.ListDirectChildren(ctx, "mirror", "logs/job_0")
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	want := []string{"logs/job_0/1", "logs/job_0/2", "logs/job_0/3"}
+	if !reflect.DeepEqual(children, want) {
+		t.Fatalf("Expected %v, actual %v", want, children)
+	}
+
+	files, err := s.ListChildrenFiles(ctx, "mirror", "logs/job_0/1")
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	want = []string{"logs/job_0/1/artifacts/junit_01.xml", "logs/job_0/1/finished.json", "logs/job_0/1/started.json"}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("Expected %v, actual %v", want, files)
+	}
+
+	if !s.Exists(ctx, "mirror", "logs/job_0/1/started.json") || !s.Exists(ctx, "mirror", "logs/job_0/1") {
+		t.Fatal("Expected both the file and the directory to exist")
+	}
+	if s.Exists(ctx, "mirror", "logs/job_0/4") {
+		t.Fatal("Expected logs/job_0/4 not to exist")
+	}
+
+	job := NewClient(s, "mirror").NewJob(testJobName, PeriodicJob, "", "", 0)
+	builds := job.GetLatestBuilds(5)
+	if len(builds) != 1 || builds[0].BuildID != 1 || *builds[0].FinishTime != 200 {
+		t.Fatalf("Expected finished build 1, actual %+v", builds)
+	}
+	if _, err := job.NewBuild(2).ReadFile(FinishedJSON); err == nil {
+		t.Fatal("Expected an error reading a missing object, actual nil")
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// storage.go defines where prow artifacts are read from
+
+package prow
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+
+	"knative.dev/test-infra/pkg/gcs"
+)
+
+// Storage is the interface for reading prow artifacts from a bucket.
+// All paths are slash separated paths relative to the root of the bucket,
+// laid out the same way as in the prow GCS bucket.
+type Storage interface {
+	// Exists checks if an object or a directory exists under a bucket
+	Exists(ctx context.Context, bkt, objPath string) bool
+	// ListChildrenFiles recursively lists all children files
+	ListChildrenFiles(ctx context.Context, bkt, dirPath string) ([]string, error)
+	// ListDirectChildren lists direct children paths (incl. files and dir)
+	ListDirectChildren(ctx context.Context, bkt, dirPath string) ([]string, error)
+	// NewReader creates a new Reader of an object, caller must close it when done
+	NewReader(ctx context.Context, bkt, objPath string) (io.ReadCloser, error)
+	// ReadObject reads an object and returns the contents in []byte
+	ReadObject(ctx context.Context, bkt, objPath string) ([]byte, error)
+}
+
+// GenerationStorage is implemented by the Storages that can tell when the
+// objects changed without reading them, which allows caching build metadata,
+// see BuildCache
+type GenerationStorage interface {
+	// ListGenerations returns the generations of the files directly under a
+	// directory, keyed by their path. The generation of an object changes
+	// every time it's written.
+	ListGenerations(ctx context.Context, bkt, dirPath string) (map[string]int64, error)
+}
+
+// gcsStorage adapts a gcs.Client to Storage
+type gcsStorage struct {
+	gcs.Client
+}
+
+var _ GenerationStorage = (*gcsStorage)(nil)
+
+// NewGCSStorage creates a Storage reading from GCS with the given client
+func NewGCSStorage(client gcs.Client) Storage {
+	return &gcsStorage{Client: client}
+}
+
+// ListGenerations returns the generations of the gcs objects directly under a
+// directory, from the attributes returned by the listing
+func (g *gcsStorage) ListGenerations(ctx context.Context, bkt, dirPath string) (map[string]int64, error) {
+	generations := make(map[string]int64)
+	query := gcs.ListQuery{Prefix: strings.TrimRight(dirPath, " /") + "/", Delimiter: "/"}
+	for {
+		page, err := g.Client.ListObjects(ctx, bkt, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, attrs := range page.Objects {
+			generations[attrs.Name] = attrs.Generation
+		}
+		if page.NextPageToken == "" {
+			return generations, nil
+		}
+		query.PageToken = page.NextPageToken
+	}
+}
+
+// LocalStorage reads prow artifacts from a local directory with the local
+// gcs.Client, each bucket being a subdirectory of Root,
+// e.g. Root/knative-prow/logs/<job>/<build>/started.json
+type LocalStorage struct {
+	Storage
+	Root string
+}
+
+var _ GenerationStorage = (*LocalStorage)(nil)
+
+// NewLocalStorage creates a Storage reading from the given directory
+func NewLocalStorage(root string) *LocalStorage {
+	return &LocalStorage{Storage: NewGCSStorage(gcs.NewLocalClient(root)), Root: root}
+}
+
+// ListGenerations returns the modification times in nanoseconds of the files
+// directly under a directory, as the files added to the tree directly keep
+// the same generation in the local gcs.Client when they are written again
+func (l *LocalStorage) ListGenerations(ctx context.Context, bkt, dirPath string) (map[string]int64, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(l.Root, bkt, filepath.FromSlash(path.Clean("/"+dirPath))))
+	if os.IsNotExist(err) {
+		return map[string]int64{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	generations := make(map[string]int64)
+	for _, info := range infos {
+		if !info.IsDir() {
+			generations[path.Join(dirPath, info.Name())] = info.ModTime().UnixNano()
+		}
+	}
+	return generations, nil
+}
+
+// NewClientFromURL creates a Client for the bucket the URL points to. Supported
+// URLs are:
+//
+//	gs://<bucket>, authenticated with the given service account
+//	file:///<dir>/<bucket>, see LocalStorage
+//	s3://<bucket>?endpoint=<host:port>&region=<region>&insecure=true&anonymous=true,
+//	  see S3Options, with credentials from the default AWS credential chain
+//	  unless anonymous is true
+func NewClientFromURL(ctx context.Context, storageURL, serviceAccount string, opts ...ClientOption) (*Client, error) {
+	u, err := url.Parse(storageURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage URL %q: %w", storageURL, err)
+	}
+	switch u.Scheme {
+	case "gs":
+		client, err := gcs.NewClient(ctx, storageURL, serviceAccount)
+		if err != nil {
+			return nil, err
+		}
+		return NewClient(NewGCSStorage(client), u.Host, opts...), nil
+	case "file":
+		dir := filepath.Clean(filepath.FromSlash(u.Path))
+		return NewClient(NewLocalStorage(filepath.Dir(dir)), filepath.Base(dir), opts...), nil
+	case "s3":
+		q := u.Query()
+		s3Opts := S3Options{
+			Endpoint: q.Get("endpoint"),
+			Region:   q.Get("region"),
+			Insecure: q.Get("insecure") == "true",
+		}
+		if q.Get("anonymous") == "true" {
+			s3Opts.Credentials = credentials.AnonymousCredentials
+		}
+		s3, err := NewS3Storage(s3Opts)
+		if err != nil {
+			return nil, err
+		}
+		return NewClient(s3, u.Host, opts...), nil
+	default:
+		return nil, fmt.Errorf("unsupported storage URL %q, must start with gs://, file:// or s3://", storageURL)
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// storage_test.go contains unit tests for reading prow artifacts from storages
+
+package prow
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFiles creates files with the given contents under dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for p, content := range files {
+		fp := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			t.Fatalf("cannot create directory for %q: %v", p, err)
+		}
+		if err := ioutil.WriteFile(fp, []byte(content), 0644); err != nil {
+			t.Fatalf("cannot write %q: %v", p, err)
+		}
+	}
+}
+
+func newTestLocalStorage(t *testing.T) (*LocalStorage, func()) {
+	root, err := ioutil.TempDir("", "prow")
+	if err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+	writeFiles(t, root, map[string]string{
+		"knative-prow/logs/job_0/latest-build.txt":             "3\n",
+		"knative-prow/logs/job_0/1/started.json":               `{"timestamp": 100}`,
+		"knative-prow/logs/job_0/1/finished.json":              `{"timestamp": 200, "passed": true}`,
+		"knative-prow/logs/job_0/1/artifacts/junit_01.xml":     "<testsuites/>",
+		"knative-prow/logs/job_0/2/started.json":               `{"timestamp": 300}`,
+		"knative-prow/logs/job_0/2/finished.json":              `{"timestamp": 400, "passed": false}`,
+		"knative-prow/logs/job_0/3/started.json":               `{"timestamp": 500}`,
+		"knative-prow/logs/job_0/not-a-build/started.json":     `{"timestamp": 600}`,
+		"other-bucket/logs/job_0/7/started.json":               `{"timestamp": 700}`,
+		"other-bucket/logs/job_0/7/finished.json":              `{"timestamp": 800}`,
+		"other-bucket/logs/job_0/7/artifacts/build-log.txt":    "hello",
+		"other-bucket/logs/job_0/7/artifacts/nested/file.json": "{}",
+	})
+	return NewLocalStorage(root), func() { os.RemoveAll(root) }
+}
+
+func TestLocalStorage(t *testing.T) {
+	s, cleanup := newTestLocalStorage(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	if !s.Exists(ctx, BucketName, "logs/job_0/1") {
+		t.Fatal("Expected directory logs/job_0/1 to exist")
+	}
+	if !s.Exists(ctx, BucketName, "logs/job_0/1/started.json") {
+		t.Fatal("Expected file logs/job_0/1/started.json to exist")
+	}
+	if s.Exists(ctx, BucketName, "logs/job_0/7") {
+		t.Fatal("Expected logs/job_0/7 not to exist in bucket knative-prow")
+	}
+	if s.Exists(ctx, BucketName, "../other-bucket/logs/job_0/7") {
+		t.Fatal("Expected paths not to escape the bucket")
+	}
+
+	children, err := s.ListDirectChildren(ctx, BucketName, "logs/job_0/")
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	want := []string{"logs/job_0/1", "logs/job_0/2", "logs/job_0/3", "logs/job_0/latest-build.txt", "logs/job_0/not-a-build"}
+	if !reflect.DeepEqual(children, want) {
+		t.Fatalf("Expected %v, actual %v", want, children)
+	}
+
+	files, err := s.ListChildrenFiles(ctx, "other-bucket", "logs/job_0/7/artifacts")
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	want = []string{"logs/job_0/7/artifacts/build-log.txt", "logs/job_0/7/artifacts/nested/file.json"}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("Expected %v, actual %v", want, files)
+	}
+
+	generations, err := s.ListGenerations(ctx, "other-bucket", "logs/job_0/7/artifacts")
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	if _, ok := generations["logs/job_0/7/artifacts/build-log.txt"]; !ok || len(generations) != 1 {
+		t.Fatalf("Expected the generation of the direct child build-log.txt only, actual %v", generations)
+	}
+
+	if files, err := s.ListChildrenFiles(ctx, BucketName, "missing"); err != nil || len(files) != 0 {
+		t.Fatalf("Expected no file and no error listing a missing dir, actual %v, '%v'", files, err)
+	}
+	if _, err := s.ReadObject(ctx, BucketName, "missing"); err == nil {
+		t.Fatal("Expected an error reading a missing file, actual nil")
+	}
+}
+
+func TestClientWithLocalStorage(t *testing.T) {
+	s, cleanup := newTestLocalStorage(t)
+	defer cleanup()
+
+	job := NewClient(s, "").NewJob(testJobName, PeriodicJob, "", "", 0)
+	if job.Bucket != BucketName {
+		t.Fatalf("Expected bucket %q, actual %q", BucketName, job.Bucket)
+	}
+	if !job.PathExists() {
+		t.Fatal("Expected job path to exist")
+	}
+	if id, err := job.GetLatestBuildNumber(); err != nil || id != 3 {
+		t.Fatalf("Expected latest build 3, actual %d, '%v'", id, err)
+	}
+	if ids := job.GetBuildIDs(); !reflect.DeepEqual(ids, []int{1, 2, 3}) {
+		t.Fatalf("Expected build IDs [1 2 3], actual %v", ids)
+	}
+
+	builds := job.GetLatestBuilds(5)
+	var ids []int
+	for _, b := range builds {
+		ids = append(ids, b.BuildID)
+	}
+	if !reflect.DeepEqual(ids, []int{2, 1}) {
+		t.Fatalf("Expected finished builds [2 1], actual %v", ids)
+	}
+	if *builds[0].StartTime != 300 || *builds[0].FinishTime != 400 {
+		t.Fatalf("Expected build 2 to start at 300 and finish at 400, actual %d and %d",
+			*builds[0].StartTime, *builds[0].FinishTime)
+	}
+	if artifacts := builds[1].GetArtifacts(); !reflect.DeepEqual(artifacts, []string{"logs/job_0/1/artifacts/junit_01.xml"}) {
+		t.Fatalf("Expected the junit artifact of build 1, actual %v", artifacts)
+	}
+
+	// Jobs of a client for another bucket must read from that bucket.
+	other := NewClient(s, "other-bucket").NewJob(testJobName, PeriodicJob, "", "", 0)
+	if ids := other.GetBuildIDs(); !reflect.DeepEqual(ids, []int{7}) {
+		t.Fatalf("Expected build IDs [7] in other-bucket, actual %v", ids)
+	}
+	build := other.NewBuild(7)
+	if build.Bucket != "other-bucket" || !build.IsFinished() {
+		t.Fatalf("Expected build 7 of other-bucket to be finished, actual %+v", build)
+	}
+	logs, err := build.ReadFile("artifacts/build-log.txt")
+	if err != nil || string(logs) != "hello" {
+		t.Fatalf("Expected 'hello', actual %q, '%v'", string(logs), err)
+	}
+}
+
+func TestNewClientFromURL(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewClientFromURL(ctx, "file:///tmp/prow/my-bucket", "")
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	if ls, ok := c.storage.(*LocalStorage); !ok || ls.Root != filepath.FromSlash("/tmp/prow") || c.Bucket() != "my-bucket" {
+		t.Fatalf("Expected local storage of my-bucket under /tmp/prow, actual %+v", c)
+	}
+
+	c, err = NewClientFromURL(ctx, "s3://my-bucket?endpoint=localhost:9000&insecure=true", "")
+	if err != nil {
+		t.Fatalf("Expected '', actual '%v'", err)
+	}
+	if s3, ok := c.storage.(*S3Storage); !ok || s3.opts.Endpoint != "localhost:9000" || !s3.opts.Insecure || c.Bucket() != "my-bucket" {
+		t.Fatalf("Expected insecure s3 storage of my-bucket at localhost:9000, actual %+v", c)
+	}
+
+	if _, err := NewClientFromURL(ctx, "ftp://my-bucket", ""); err == nil {
+		t.Fatal("Expected an error for an unsupported scheme, actual nil")
+	}
+}
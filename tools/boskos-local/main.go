@@ -0,0 +1,81 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// The boskos-local tool runs a Boskos-compatible server with the resources of
+// a Boskos config file, so that the tools acquiring projects from Boskos can
+// be run outside of the Prow cluster.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	boskoscommon "sigs.k8s.io/boskos/common"
+
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/boskos/server"
+)
+
+func main() {
+	configPath := flag.String("config", "config/prod/build-cluster/boskos/boskos_resources.yaml", "Boskos config file with the resources to serve")
+	port := flag.Int("port", 8080, "port to listen on")
+	expire := flag.Duration("expire", 15*time.Minute, "busy resources not updated for this long are reset to dirty, like the Boskos reaper does, never if 0")
+	freeDirty := flag.Bool("free-dirty", false, "reset the dirty resources to free without cleaning them up, in place of the Boskos janitor")
+	resetInterval := flag.Duration("reset-interval", time.Minute, "interval between the resets of the expired and dirty resources")
+	flag.Parse()
+
+	config, err := server.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s, err := server.NewServer(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Serving %d resources of types %v", len(s.Resources()), s.Types())
+
+	go resetLoop(context.Background(), s, *resetInterval, *expire, *freeDirty)
+
+	log.Printf("Boskos server listening on port %d, use it with BOSKOS_URL=http://localhost:%d", *port, *port)
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", *port), s))
+}
+
+// resetLoop resets the expired and the dirty resources until ctx is done
+func resetLoop(ctx context.Context, s *server.Server, interval, expire time.Duration, freeDirty bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if expire > 0 {
+			for name, owner := range s.Reset("", boskoscommon.Busy, expire, boskoscommon.Dirty) {
+				log.Printf("Reset %q to %s, its lease by %q expired", name, boskoscommon.Dirty, owner)
+			}
+		}
+		if freeDirty {
+			for name := range s.Reset("", boskoscommon.Dirty, 0, boskoscommon.Free) {
+				log.Printf("Reset %q to %s", name, boskoscommon.Free)
+			}
+		}
+	}
+}
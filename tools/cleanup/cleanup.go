@@ -20,6 +20,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -42,6 +43,7 @@ import (
 	"knative.dev/test-infra/pkg/cmd"
 	"knative.dev/test-infra/pkg/gke"
 	"knative.dev/test-infra/pkg/helpers"
+	"knative.dev/test-infra/pkg/protection"
 )
 
 var (
@@ -65,6 +67,9 @@ type BaseResourceDeleter struct {
 	ResourceDeleter
 	projects           []string
 	deleteResourceFunc func(string, int, bool) (int, error)
+	// policy is the protection policy the deletions are checked against, the
+	// default protection policy if nil
+	policy *protection.Policy
 }
 
 // ImageDeleter deletes old images in a given registry.
@@ -77,6 +82,9 @@ type ImageDeleter struct {
 type GkeClusterDeleter struct {
 	BaseResourceDeleter
 	gkeClient gke.SDKOperations
+	// reaper also deletes the clusters left behind by the tests, whatever
+	// their age, if it's not nil
+	reaper *Reaper
 }
 
 // NewBaseResourceDeleter returns a brand new BaseResourceDeleter.
@@ -114,7 +122,7 @@ func NewGkeClusterDeleter(projects []string, serviceAccount string) (*GkeCluster
 	if err != nil {
 		err = errors.Wrapf(err, "cannot create GKE SDK client")
 	}
-	deleter := GkeClusterDeleter{*NewBaseResourceDeleter(projects), gkeClient}
+	deleter := GkeClusterDeleter{BaseResourceDeleter: *NewBaseResourceDeleter(projects), gkeClient: gkeClient}
 	deleter.deleteResourceFunc = deleter.DeleteResources
 	return &deleter, err
 }
@@ -182,15 +190,16 @@ func (d *ImageDeleter) deleteImage(ref string) error {
 	return nil
 }
 
-// DeleteResources deletes old clusters from a given project.
+// DeleteResources deletes old clusters from a given project, and the clusters
+// left behind by the tests if the reaper is set. The clusters are not deleted
+// for their age if hoursToKeepResource is negative.
 func (d *GkeClusterDeleter) DeleteResources(project string, hoursToKeepResource int, dryRun bool) (int, error) {
 	before := time.Now().Add(-time.Hour * time.Duration(hoursToKeepResource))
-	// TODO(adrcunha): Consider exposing https://github.com/knative/pkg/blob/6d806b998379948bd0107d77bcd831e2bdb4f3cb/testutils/clustermanager/e2e-tests/gke.go#L281
-	if project == "knative-tests" {
-		return 0, fmt.Errorf("cleaning up %q is forbidden", project)
+	if err := d.policy.Check(protection.ActionDelete, protection.Project(project)); err != nil {
+		return 0, err
 	}
 	// List clusters, delete those created before the given timestamp.
-	clusters, err := d.gkeClient.ListClustersInProject(project)
+	clusters, err := d.gkeClient.ListClustersInProject(context.Background(), project)
 	if err != nil {
 		return 0, errors.Wrapf(err, "error listing clusters in %q, maybe try 'gcloud auth application-default login'", project)
 	}
@@ -203,29 +212,45 @@ func (d *GkeClusterDeleter) DeleteResources(project string, hoursToKeepResource
 		age := int(time.Since(creation).Hours())
 		fullClusterName := project + "/" + cluster.Name
 		log.Printf("%s is %d hours old", fullClusterName, age)
-		if creation.Before(before) {
-			if err := helpers.Run(fmt.Sprintf("Deleting %q", fullClusterName), func() error {
-				region, zone := gke.RegionZoneFromLoc(cluster.Location)
-				if err := d.gkeClient.DeleteCluster(project, region, zone, cluster.Name); err != nil {
-					return errors.Wrapf(err, "error deleting cluster %q in project %q", cluster.Name, project)
-				}
-				count++
-				return nil
-			}, dryRun); err != nil {
-				return count, err
+		var reason string
+		if hoursToKeepResource >= 0 && creation.Before(before) {
+			reason = fmt.Sprintf("older than %d hours", hoursToKeepResource)
+		} else if d.reaper != nil {
+			reason = d.reaper.Reason(cluster)
+		}
+		if reason == "" {
+			continue
+		}
+		// Skip the protected clusters, the refusal is logged by the policy.
+		if err := d.policy.Check(protection.ActionDelete, protection.Cluster(cluster.Name, cluster.ResourceLabels)); err != nil {
+			continue
+		}
+		if err := helpers.Run(fmt.Sprintf("Deleting %q, %s", fullClusterName, reason), func() error {
+			region, zone := gke.RegionZoneFromLoc(cluster.Location)
+			if err := d.gkeClient.DeleteCluster(context.Background(), project, region, zone, cluster.Name); err != nil {
+				return errors.Wrapf(err, "error deleting cluster %q in project %q", cluster.Name, project)
 			}
+			count++
+			return nil
+		}, dryRun); err != nil {
+			return count, err
 		}
 	}
 	return count, nil
 }
 
+// SetReaper sets the reaper deciding which clusters are left behind by the
+// tests.
+func (d *GkeClusterDeleter) SetReaper(reaper *Reaper) {
+	d.reaper = reaper
+}
+
 // DeleteResources deletes old docker images from a given project.
 func (d *ImageDeleter) DeleteResources(project string, hoursToKeepResource int, dryRun bool) (int, error) {
 	before := time.Now().Add(-time.Hour * time.Duration(hoursToKeepResource))
 	repoRoot := d.registry + "/" + project
-	// TODO(adrcunha): This should be a helper function, like https://github.com/knative/pkg/blob/6d806b998379948bd0107d77bcd831e2bdb4f3cb/testutils/clustermanager/e2e-tests/gke.go#L281
-	if repoRoot == "gcr.io/knative-releases" || repoRoot == "gcr.io/knative-nightly" {
-		return 0, fmt.Errorf("cleaning up %q is forbidden", repoRoot)
+	if err := d.policy.Check(protection.ActionDelete, protection.Registry(repoRoot)); err != nil {
+		return 0, err
 	}
 	gcrrepo, err := name.NewRepository(repoRoot)
 	if err != nil {
@@ -267,6 +292,11 @@ func (d *ImageDeleter) DeleteResources(project string, hoursToKeepResource int,
 	}, google.WithAuthFromKeychain(defaultKeychain))
 }
 
+// SetPolicy sets the protection policy the deletions are checked against.
+func (d *BaseResourceDeleter) SetPolicy(policy *protection.Policy) {
+	d.policy = policy
+}
+
 // Projects returns the projects that should be cleaned up by a ResourceDeleter.
 func (d *BaseResourceDeleter) Projects() []string {
 	return d.projects
@@ -356,24 +386,38 @@ func cleanup(o options.Options) error {
 		return err
 	}
 
+	policy, err := protection.Load(o.ProtectionPolicy)
+	if err != nil {
+		return err
+	}
+
 	start := time.Now()
 
-	var deleter ResourceDeleter
 	if o.DaysToKeepImages >= 0 {
-		if deleter, err = NewImageDeleter(projects, o.Registry, o.ServiceAccount); err != nil {
+		deleter, err := NewImageDeleter(projects, o.Registry, o.ServiceAccount)
+		if err != nil {
 			return err
 		}
+		deleter.SetPolicy(policy)
 		log.Println("Removing images that are:")
 		log.Printf("- older than %d days", o.DaysToKeepImages)
 		deleter.ShowStats(deleter.Delete(o.DaysToKeepImages*24, o.ConcurrentOperations, o.DryRun))
 	}
 
-	if o.HoursToKeepClusters >= 0 {
-		if deleter, err = NewGkeClusterDeleter(projects, o.ServiceAccount); err != nil {
+	if o.HoursToKeepClusters >= 0 || o.ReapClusters {
+		deleter, err := NewGkeClusterDeleter(projects, o.ServiceAccount)
+		if err != nil {
 			return err
 		}
+		deleter.SetPolicy(policy)
 		log.Println("Removing clusters that are:")
-		log.Printf("- older than %d hours", o.HoursToKeepClusters)
+		if o.HoursToKeepClusters >= 0 {
+			log.Printf("- older than %d hours", o.HoursToKeepClusters)
+		}
+		if o.ReapClusters {
+			deleter.SetReaper(NewReaper(o.ProwURL))
+			log.Println("- past their TTL, or created by a finished Prow job")
+		}
 		deleter.ShowStats(deleter.Delete(o.HoursToKeepClusters, o.ConcurrentOperations, o.DryRun))
 	}
 
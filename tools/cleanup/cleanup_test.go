@@ -17,13 +17,23 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	goerrors "errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
+	container "google.golang.org/api/container/v1beta1"
+
+	"knative.dev/test-infra/pkg/clustermanager/ownership"
+	"knative.dev/test-infra/pkg/gke"
+	"knative.dev/test-infra/pkg/protection"
 )
 
 // errorMismatch compares two errors by their error string
@@ -309,6 +319,115 @@ func TestNewGkeClusterDeleter(t *testing.T) {
 	}
 }
 
+// fakeGKEClient lists the clusters and records the deleted ones
+type fakeGKEClient struct {
+	gke.SDKOperations
+	clusters []*container.Cluster
+	deleted  []string
+}
+
+func (c *fakeGKEClient) ListClustersInProject(ctx context.Context, project string) ([]*container.Cluster, error) {
+	return c.clusters, nil
+}
+
+func (c *fakeGKEClient) DeleteCluster(ctx context.Context, project, region, zone, clusterName string, opts ...gke.WaitOption) error {
+	c.deleted = append(c.deleted, clusterName)
+	return nil
+}
+
+func TestProtection(t *testing.T) {
+	policy, err := protection.Parse([]byte(`
+rules:
+- kind: project
+  names: [prod-project]
+  deny: [delete]
+- kind: cluster
+  selector: env=prod
+  deny: [delete]
+- kind: registry
+  names: [gcr.io/prod-project]
+  deny: [delete]
+`))
+	if err != nil {
+		t.Fatalf("Parse() = '%v'", err)
+	}
+	old := time.Now().Add(-48 * time.Hour).Format(time.RFC3339)
+	client := &fakeGKEClient{clusters: []*container.Cluster{
+		{Name: "e2e-1", Location: "us-central1", CreateTime: old},
+		{Name: "prod", Location: "us-central1", CreateTime: old, ResourceLabels: map[string]string{"env": "prod"}},
+		{Name: "e2e-2", Location: "us-central1", CreateTime: old, ResourceLabels: map[string]string{"env": "test"}},
+	}}
+	d := GkeClusterDeleter{BaseResourceDeleter: *NewBaseResourceDeleter([]string{"test-project"}), gkeClient: client}
+	d.SetPolicy(policy)
+
+	if _, err := d.DeleteResources("prod-project", 24, false); !goerrors.Is(err, protection.ErrProtected) {
+		t.Errorf("DeleteResources(prod-project) = '%v', want '%v'", err, protection.ErrProtected)
+	}
+	count, err := d.DeleteResources("test-project", 24, false)
+	if err != nil {
+		t.Fatalf("DeleteResources(test-project) = '%v'", err)
+	}
+	if dif := cmp.Diff([]string{"e2e-1", "e2e-2"}, client.deleted); count != 2 || dif != "" {
+		t.Errorf("deleted %d clusters, got(+) is different from wanted(-)\n%v", count, dif)
+	}
+
+	id := ImageDeleter{*NewBaseResourceDeleter([]string{"prod-project"}), "gcr.io"}
+	id.SetPolicy(policy)
+	if _, err := id.DeleteResources("prod-project", 24, false); !goerrors.Is(err, protection.ErrProtected) {
+		t.Errorf("DeleteResources(gcr.io/prod-project) = '%v', want '%v'", err, protection.ErrProtected)
+	}
+}
+
+func TestReaper(t *testing.T) {
+	jobs := map[string]string{
+		"finished": "status:\n  state: success\n  completionTime: \"2020-01-01T01:00:00Z\"\n",
+		"running":  "status:\n  state: pending\n",
+	}
+	prow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		job, ok := jobs[r.URL.Query().Get("prowjob")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, job)
+	}))
+	defer prow.Close()
+
+	now := time.Now()
+	recent := now.Add(-time.Hour).Format(time.RFC3339)
+	expiresAt := func(d time.Duration) string {
+		return strconv.FormatInt(now.Add(d).Unix(), 10)
+	}
+	clusters := []*container.Cluster{
+		{Name: "unlabeled", Location: "us-central1", CreateTime: recent},
+		{Name: "expired", Location: "us-central1", CreateTime: recent,
+			ResourceLabels: map[string]string{ownership.CreatorLabel: "jane", ownership.ExpiresAtLabel: expiresAt(-time.Minute)}},
+		{Name: "finished-job", Location: "us-central1", CreateTime: recent,
+			ResourceLabels: map[string]string{ownership.ProwJobIDLabel: "finished", ownership.ExpiresAtLabel: expiresAt(time.Hour)}},
+		{Name: "running-job", Location: "us-central1", CreateTime: recent,
+			ResourceLabels: map[string]string{ownership.ProwJobIDLabel: "running", ownership.ExpiresAtLabel: expiresAt(time.Hour)}},
+		{Name: "unknown-job", Location: "us-central1", CreateTime: recent,
+			ResourceLabels: map[string]string{ownership.ProwJobIDLabel: "unknown", ownership.ExpiresAtLabel: expiresAt(time.Hour)}},
+	}
+
+	for _, dryRun := range []bool{true, false} {
+		client := &fakeGKEClient{clusters: clusters}
+		d := GkeClusterDeleter{BaseResourceDeleter: *NewBaseResourceDeleter([]string{"test-project"}), gkeClient: client}
+		d.SetReaper(NewReaper(prow.URL))
+		count, err := d.DeleteResources("test-project", -1, dryRun)
+		if err != nil {
+			t.Fatalf("DeleteResources(dryRun=%v) = '%v'", dryRun, err)
+		}
+		var want []string
+		if !dryRun {
+			want = []string{"expired", "finished-job"}
+		}
+		if dif := cmp.Diff(want, client.deleted); count != len(want) || dif != "" {
+			t.Errorf("dryRun=%v: deleted %d clusters, got(+) is different from wanted(-)\n%v", dryRun, count, dif)
+		}
+	}
+}
+
 /*
   TODO: Increase test coverage.
 
@@ -318,7 +437,6 @@ func TestNewGkeClusterDeleter(t *testing.T) {
   - delete image
 
   GkeClusterDeleter.DeleteResources (requires mocking gkeClient)
-  - bad project
   - error listing clusters
   - bad timestamp
   - delete cluster (dry run)
@@ -327,7 +445,6 @@ func TestNewGkeClusterDeleter(t *testing.T) {
   - dry run
 
   ImageDeleter.DeleteResources (requires mocking name, google)
-  - bad project
   - bad registry
   - error walking down registry
   - no images to delete
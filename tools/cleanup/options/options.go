@@ -15,6 +15,9 @@ type Options struct {
 	ServiceAccount       string
 	ConcurrentOperations int
 	DryRun               bool
+	ProtectionPolicy     string
+	ReapClusters         bool
+	ProwURL              string
 }
 
 type strSliceArg []string
@@ -38,4 +41,7 @@ func (o *Options) AddOptions() {
 	flag.StringVar(&o.ServiceAccount, "service-account", "", "Specify the key file of the service account to use.")
 	flag.IntVar(&o.ConcurrentOperations, "concurrent-operations", 10, "How many deletion operations to run concurrently (defaults to 10).")
 	flag.BoolVar(&o.DryRun, "dry-run", false, "Performs a dry run for all deletion functions.")
+	flag.StringVar(&o.ProtectionPolicy, "protection-policy", "", "Protection policy file the deletions are checked against (defaults to the default protection policy).")
+	flag.BoolVar(&o.ReapClusters, "reap-clusters", false, "Also delete the clusters past their TTL or created by a finished Prow job, from their ownership labels.")
+	flag.StringVar(&o.ProwURL, "prow-url", "https://prow.knative.dev", "The Prow the jobs of the reaped clusters are looked up in (empty means the jobs are not looked up).")
 }
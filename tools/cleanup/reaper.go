@@ -0,0 +1,118 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// reaper.go finds the test clusters left behind, from the ownership labels
+// stamped on them when they are created
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	container "google.golang.org/api/container/v1beta1"
+	yaml "gopkg.in/yaml.v2"
+
+	"knative.dev/test-infra/pkg/clustermanager/ownership"
+)
+
+// The states of the finished Prow jobs, see
+// https://github.com/kubernetes/test-infra/blob/master/prow/apis/prowjobs/v1/types.go
+var finishedJobStates = map[string]bool{
+	"success": true,
+	"failure": true,
+	"aborted": true,
+	"error":   true,
+}
+
+// Reaper decides which clusters are left behind by the tests. A cluster is
+// left behind if it's past its TTL, or if the Prow job that created it is
+// known to be finished.
+type Reaper struct {
+	// prowURL is the URL of Prow the jobs are looked up in, the jobs are not
+	// looked up if it's empty
+	prowURL string
+	client  *http.Client
+	now     func() time.Time
+}
+
+// NewReaper returns a Reaper looking up the Prow jobs in the Prow at prowURL,
+// e.g. https://prow.knative.dev
+func NewReaper(prowURL string) *Reaper {
+	return &Reaper{
+		prowURL: prowURL,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		now:     time.Now,
+	}
+}
+
+// Reason returns why the cluster should be reaped, empty if it shouldn't.
+// The clusters without ownership labels are never reaped.
+func (r *Reaper) Reason(cluster *container.Cluster) string {
+	owner, ok := ownership.FromLabels(cluster.ResourceLabels)
+	if !ok {
+		return ""
+	}
+	if owner.Expired(r.now()) {
+		return fmt.Sprintf("expired at %s", owner.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	if owner.ProwJobID == "" || r.prowURL == "" {
+		return ""
+	}
+	finished, err := r.jobFinished(owner.ProwJobID)
+	if err != nil {
+		log.Printf("Failed looking up Prow job %s of cluster %q: %v", owner.ProwJobID, cluster.Name, err)
+		return ""
+	}
+	if finished {
+		return fmt.Sprintf("Prow job %s %s finished", owner.ProwJob, owner.ProwJobID)
+	}
+	return ""
+}
+
+// jobFinished checks if the Prow job is known to be finished. The jobs Prow
+// doesn't know anymore are not known to be finished.
+func (r *Reaper) jobFinished(id string) (bool, error) {
+	resp, err := r.client.Get(r.prowURL + "/prowjob?prowjob=" + url.QueryEscape(id))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	var job struct {
+		Status struct {
+			State          string `yaml:"state"`
+			CompletionTime string `yaml:"completionTime"`
+		} `yaml:"status"`
+	}
+	if err := yaml.Unmarshal(body, &job); err != nil {
+		return false, fmt.Errorf("invalid Prow job: %w", err)
+	}
+	return job.Status.CompletionTime != "" || finishedJobStates[job.Status.State], nil
+}
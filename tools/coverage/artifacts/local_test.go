@@ -31,7 +31,7 @@ func TestProfiling(t *testing.T) {
 
 	arts := LocalArtifacts{
 		Artifacts: *New(
-			test.NewArtsDir(t.Name()),
+			t.TempDir(),
 			"cov-profile.txt",
 			"key-cov-profile.txt",
 			"stdout.txt"),
@@ -37,8 +37,7 @@ func NewTestCase(targetName, coverage string, failure bool) junit.TestCase {
 	// we want to add <failure> tag to only failed tests. Testgrid treats both
 	// "<failure> true </failure>" and "<failure> false </failure>" as failure
 	if failure {
-		f := strconv.FormatBool(failure)
-		tc.Failure = &f
+		tc.Failure = &junit.Result{Value: strconv.FormatBool(failure)}
 	}
 
 	tc.AddProperty("coverage", coverage)
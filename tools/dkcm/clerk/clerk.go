@@ -31,11 +31,11 @@ import (
 
 type Operations interface {
 	// check cluster available, if available, return cluster id and access token
-	CheckAvail(cp ClusterParams) (bool, int64)
+	CheckAvail(cp *ClusterParams) (bool, int64)
 	// check number of clusters of a status specific configurations
 	CheckNumStatus(cp *ClusterParams, status string) int64
 	// get with cluster id stored in the Cluster database
-	GetCluster(clusterID int64) (Response, error)
+	GetCluster(clusterID int64) (*Response, error)
 	// delete a cluster entry
 	DeleteCluster(clusterID int64) error
 	// Insert a cluster entry
@@ -45,11 +45,9 @@ type Operations interface {
 	// List clutsers (use for checking after downtime to see stale clusters)
 	ListClusters() ([]Cluster, error)
 	// get with accessToken stored in the Request database
-	GetRequest(accessToken string) (Request, error)
-	// Generate Unique access token for Prow
-	generateToken() string
-	// Insert a request entry
-	InsertRequest(r *Request) error
+	GetRequest(accessToken string) (*Request, error)
+	// Insert a request entry, and return its unique access token for Prow
+	InsertRequest(r *Request) (string, error)
 	// Update a request entry
 	UpdateRequest(requestID int64, opts ...UpdateOption) error
 	// List requests within a time interval (use for checking after downtime to see stale requests)
@@ -70,6 +68,8 @@ type DBClient struct {
 	*sql.DB
 }
 
+var _ Operations = (*DBClient)(nil)
+
 // consumer facing request display
 func (r Request) String() string {
 	return fmt.Sprintf("Request Info: (RequestTime: %v, NodesCount: %v, NodeType: %s, ProwJobID: %s, Zone: %s)",
@@ -173,12 +173,14 @@ func (db *DBClient) UpdateCluster(clusterID int64, opts ...UpdateOption) error {
 // List all clusters
 func (db *DBClient) ListClusters() ([]Cluster, error) {
 	var result []Cluster
+	// the columns are in the order populateCluster scans them
 	rows, err := db.Query(`
-	SELECT ID, Nodes, NodeType, ProjectID, Status, Zone
+	SELECT ID, ProjectID, Status, Zone, Nodes, NodeType
 	FROM Clusters`)
 	if err != nil {
 		return result, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		c, err := populateCluster(rows)
 		if err != nil {
@@ -186,8 +188,7 @@ func (db *DBClient) ListClusters() ([]Cluster, error) {
 		}
 		result = append(result, *c)
 	}
-	return result, nil
-
+	return result, rows.Err()
 }
 
 // DeleteCluster deletes a row from Cluster db
@@ -287,6 +288,7 @@ func (db *DBClient) ListRequests(window time.Duration) ([]Request, error) {
 	if err != nil {
 		return result, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		r, err := populateRequest(rows)
 		if err != nil {
@@ -294,7 +296,7 @@ func (db *DBClient) ListRequests(window time.Duration) ([]Request, error) {
 		}
 		result = append(result, *r)
 	}
-	return result, nil
+	return result, rows.Err()
 }
 
 // rank request priority so that available clusters are always assigned to the requests that come first
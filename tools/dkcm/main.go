@@ -4,6 +4,7 @@ import (
 	"flag"
 	"log"
 	"os"
+	"strings"
 
 	"knative.dev/test-infra/pkg/mysql"
 	"knative.dev/test-infra/tools/dkcm/mainservice"
@@ -18,6 +19,11 @@ func main() {
 	dbHost := flag.String("database-host", "/secrets/cloudsql/dkcmdb/host", "Database host secret file")
 
 	boskosClientHost := flag.String("boskos-client-host", "dkcm", "Boskos client host name")
+	boskosURL := flag.String("boskos-url", "", "Boskos server URL, e.g. of a local Boskos server, BOSKOS_URL or the Boskos of the Prow cluster if empty")
+	boskosTypes := flag.String("boskos-resource-types", "", "Comma separated Boskos resource types to acquire the projects from, in order, gke-project if empty")
+	boskosReleaseState := flag.String("boskos-release-state", "", "State the Boskos projects are released to, dirty if empty")
+
+	protectionPolicy := flag.String("protection-policy", "", "Protection policy file the projects are checked against, the default protection policy if empty")
 
 	gcpServiceAccount := flag.String("gcp-service-account", os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"), "JSON key file for GCP service account")
 
@@ -28,7 +34,12 @@ func main() {
 		log.Fatal(err)
 	}
 
-	if err := mainservice.Start(dbConfig, *boskosClientHost, *gcpServiceAccount); err != nil {
+	var resourceTypes []string
+	if *boskosTypes != "" {
+		resourceTypes = strings.Split(*boskosTypes, ",")
+	}
+	if err := mainservice.Start(dbConfig, *boskosClientHost, *boskosURL, resourceTypes, *boskosReleaseState,
+		*gcpServiceAccount, *protectionPolicy); err != nil {
 		log.Fatalf("Failed to start main service: %v", err)
 	}
 }
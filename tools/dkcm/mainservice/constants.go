@@ -37,6 +37,12 @@ const (
 	Status    = "Status"
 	ClusterID = "ClusterID"
 
-	// time interval to examine timeout requests
+	// ClusterID of the requests that timed out before getting a cluster
+	TimedOutClusterID = -1
+
+	// time interval in minutes to reconcile the clusters and examine timeout requests
 	CheckInterval = 2
+
+	// time in minutes to wait for a free Boskos project of the resource types
+	BoskosAcquireTimeOut = 120
 )
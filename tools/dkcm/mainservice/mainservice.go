@@ -17,6 +17,7 @@ limitations under the License.
 package mainservice
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -26,19 +27,28 @@ import (
 	"sync"
 	"time"
 
+	"google.golang.org/api/option"
+
 	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/boskos"
 	"knative.dev/test-infra/pkg/clustermanager/kubetest2"
+	"knative.dev/test-infra/pkg/gke"
 	"knative.dev/test-infra/pkg/mysql"
+	"knative.dev/test-infra/pkg/protection"
 	"knative.dev/test-infra/tools/dkcm/clerk"
 )
 
 var (
-	// channel serves as a lock for go routine
-	chanLock             = make(chan struct{})
-	boskosClient         *boskos.Client
-	dbClient             *clerk.DBClient
+	boskosClient         boskos.Operation
+	dbClient             clerk.Operations
+	gkeClient            gke.SDKOperations
 	serviceAccount       string
 	DefaultClusterParams = clerk.ClusterParams{Zone: DefaultZone, Nodes: DefaultNodesCount, NodeType: DefaultNodeType}
+	// policy is the protection policy the projects are checked against
+	policy *protection.Policy
+	// boskosResourceTypes are the resource types the projects are acquired from, in order
+	boskosResourceTypes []string
+	// runKubetest2 is defined for easy mocking in unit tests
+	runKubetest2 = kubetest2.Run
 )
 
 // Response to Prow
@@ -48,17 +58,41 @@ type ServiceResponse struct {
 	ClusterInfo *clerk.Response `json:"clusterInfo"`
 }
 
-func Start(dbConfig *mysql.DBConfig, boskosClientHost, gcpServiceAccount string) error {
+func Start(dbConfig *mysql.DBConfig, boskosClientHost, boskosURL string, boskosTypes []string, boskosReleaseState,
+	gcpServiceAccount, protectionPolicy string) error {
 	var err error
-	boskosClient, err = boskos.NewClient(boskosClientHost, "", "")
+	policy, err = protection.Load(protectionPolicy)
+	if err != nil {
+		return fmt.Errorf("failed to load the protection policy: %w", err)
+	}
+	boskosOpts := []boskos.ClientOption{boskos.WithURL(boskosURL)}
+	if boskosReleaseState != "" {
+		boskosOpts = append(boskosOpts, boskos.WithReleaseState(boskosReleaseState))
+	}
+	boskosClient, err = boskos.NewClient(boskosClientHost, "", "", boskosOpts...)
 	if err != nil {
 		return fmt.Errorf("failed to create Boskos client: %w", err)
 	}
+	boskosResourceTypes = boskosTypes
+	if len(boskosResourceTypes) == 0 {
+		boskosResourceTypes = []string{boskos.GKEProjectResource}
+	}
 	dbClient, err = clerk.NewDB(dbConfig)
 	if err != nil {
 		return fmt.Errorf("failed to create Clerk client: %w", err)
 	}
 	serviceAccount = gcpServiceAccount
+	var opts []option.ClientOption
+	if serviceAccount != "" {
+		opts = append(opts, option.WithCredentialsFile(serviceAccount))
+	}
+	gkeClient, err = gke.NewSDKClient(opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create GKE client: %w", err)
+	}
+	// reconcile the clusters left by the previous runs before serving, then periodically
+	reconcile()
+	go reconcileLoop(reconcileInterval)
 	server := http.NewServeMux()
 	server.HandleFunc("/request-cluster", handleNewClusterRequest)
 	server.HandleFunc("/get-cluster", handleGetCluster)
@@ -87,6 +121,10 @@ func handleCleanCluster(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, fmt.Sprintf("there is an error getting the cluster with the token: %v, please try again", err), http.StatusForbidden)
 		return
 	}
+	if err := policy.Check(protection.ActionDelete, protection.Project(c.ProjectID)); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	err = dbClient.DeleteCluster(r.ClusterID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("there is an error deleting the cluster with the token: %v, please try again", err), http.StatusForbidden)
@@ -99,9 +137,16 @@ func handleCleanCluster(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-// check the pool capacity and create clusters if necessary
+// check the pool capacity and create clusters if necessary, the pools of different ClusterParams
+// are checked independently, and a check is skipped if the pool is being checked already
 func checkPoolCap(cp *clerk.ClusterParams) {
-	chanLock <- struct{}{}
+	lock := poolLock(cp)
+	select {
+	case lock <- struct{}{}:
+	default:
+		return
+	}
+	defer func() { <-lock }()
 	numAvail := dbClient.CheckNumStatus(cp, Ready)
 	numWIP := dbClient.CheckNumStatus(cp, WIP)
 	diff := DefaultOverProvision - numAvail - numWIP
@@ -113,26 +158,45 @@ func checkPoolCap(cp *clerk.ClusterParams) {
 		go CreateCluster(cp, &wg)
 	}
 	wg.Wait()
-	<-chanLock
 }
 
-// assign clusters if available upon request
+// acquire a project and create a new cluster in it, wg is done once the cluster entry is inserted
 func CreateCluster(cp *clerk.ClusterParams, wg *sync.WaitGroup) {
-	project, err := boskosClient.AcquireGKEProject(boskos.GKEProjectResource)
+	ctx, cancel := context.WithTimeout(context.Background(), BoskosAcquireTimeOut*time.Minute)
+	project, err := boskosClient.AcquireGKEProjectFromTypes(ctx, boskosResourceTypes)
+	cancel()
 	if err != nil {
+		wg.Done()
 		log.Printf("Failed to acquire a project from boskos: %v", err)
 		return
 	}
 	projectName := project.Name
+	if err := policy.Check(protection.ActionCreate, protection.Project(projectName)); err != nil {
+		wg.Done()
+		log.Printf("Refused to create a cluster in the project: %v", err)
+		if err := boskosClient.ReleaseGKEProject(projectName); err != nil {
+			log.Printf("Failed to release Boskos Project: %v", err)
+		}
+		return
+	}
 	c := clerk.NewCluster(clerk.AddProjectID(projectName))
 	c.ClusterParams = cp
-	clusterID, err := dbClient.InsertCluster(c)
+	clusterID, err := insertProvisioningCluster(c)
 	wg.Done()
 	if err != nil {
 		log.Printf("Failed to insert a new Cluster entry: %v", err)
+		if err := boskosClient.ReleaseGKEProject(projectName); err != nil {
+			log.Printf("Failed to release Boskos Project: %v", err)
+		}
 		return
 	}
-	if err := kubetest2.Run(&kubetest2.Options{}, &kubetest2.GKEClusterConfig{
+	provisionCluster(clusterID, projectName, cp)
+}
+
+// create the cluster of the cluster entry in the project, and update the entry with the result
+func provisionCluster(clusterID int64, projectName string, cp *clerk.ClusterParams) {
+	defer doneProvisioning(clusterID)
+	if err := runKubetest2(&kubetest2.Options{}, &kubetest2.GKEClusterConfig{
 		GCPServiceAccount: serviceAccount,
 		GCPProjectID:      projectName,
 		Name:              DefaultClusterName,
@@ -145,15 +209,8 @@ func CreateCluster(cp *clerk.ClusterParams, wg *sync.WaitGroup) {
 		Version:           "latest",
 		Scopes:            "cloud-platform",
 	}); err != nil {
-		if err := dbClient.UpdateCluster(clusterID, clerk.UpdateStringField(Status, Fail)); err != nil {
-			log.Printf("Failed to insert delete new Cluster entry: %v", err)
-			return
-		}
-		err = boskosClient.ReleaseGKEProject(c.ProjectID)
-		if err != nil {
-			log.Printf("Failed to release Boskos Project: %v", err)
-			return
-		}
+		log.Printf("Failed to create the cluster %d in the project %q: %v", clusterID, projectName, err)
+		failCluster(clusterID, projectName, true)
 		return
 	}
 	if err := dbClient.UpdateCluster(clusterID, clerk.UpdateStringField(Status, Ready)); err != nil {
@@ -169,6 +226,10 @@ func AssignCluster(token string, w http.ResponseWriter) {
 		http.Error(w, fmt.Sprintf("there is an error getting the request with the token: %v, please try again", err), http.StatusForbidden)
 		return
 	}
+	if r.ClusterID == TimedOutClusterID {
+		http.Error(w, "the request timed out, please request a new cluster", http.StatusGone)
+		return
+	}
 	// check if the Prow job has enough priority to get an existing cluster
 	ranking := dbClient.PriorityRanking(r)
 	numAvail := dbClient.CheckNumStatus(r.ClusterParams, Ready)
@@ -0,0 +1,263 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mainservice
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	container "google.golang.org/api/container/v1beta1"
+
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/boskos"
+	"knative.dev/test-infra/tools/dkcm/clerk"
+)
+
+var (
+	// requests not assigned a cluster within the time out are expired
+	requestTimeOut = DefaultTimeOut * time.Minute
+	// interval between the reconciliations of the clusters
+	reconcileInterval = CheckInterval * time.Minute
+
+	// pools hold a channel per ClusterParams, serving as the lock for checking the capacity of its pool
+	pools     = make(map[clerk.ClusterParams]chan struct{})
+	poolsLock sync.Mutex
+
+	// provisioning are the clusters being created by this process, which the reconciliation skips
+	provisioning     = make(map[int64]bool)
+	provisioningLock sync.Mutex
+)
+
+// action the reconciliation takes for a cluster entry
+type action int
+
+const (
+	// keep the cluster entry as is
+	actionKeep action = iota
+	// mark the cluster as ready, its creation succeeded
+	actionReady
+	// create the cluster again, its creation was interrupted before it started
+	actionResume
+	// mark the cluster as failed and release its project
+	actionFail
+)
+
+// get the lock of the pool of the ClusterParams
+func poolLock(cp *clerk.ClusterParams) chan struct{} {
+	// the ID isn't part of the pool parameters
+	key := clerk.ClusterParams{Zone: cp.Zone, Nodes: cp.Nodes, NodeType: cp.NodeType}
+	poolsLock.Lock()
+	defer poolsLock.Unlock()
+	lock, ok := pools[key]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		pools[key] = lock
+	}
+	return lock
+}
+
+// insert the cluster entry and mark it as being provisioned at once, so that the reconciliation never
+// lists it before it's marked
+func insertProvisioningCluster(c *clerk.Cluster) (int64, error) {
+	provisioningLock.Lock()
+	defer provisioningLock.Unlock()
+	clusterID, err := dbClient.InsertCluster(c)
+	if err == nil {
+		provisioning[clusterID] = true
+	}
+	return clusterID, err
+}
+
+// unmark the cluster as being provisioned
+func doneProvisioning(clusterID int64) {
+	provisioningLock.Lock()
+	defer provisioningLock.Unlock()
+	delete(provisioning, clusterID)
+}
+
+// reconcile the clusters every interval, after the reconciliation on startup
+func reconcileLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		reconcile()
+	}
+}
+
+// expire the stale requests, check every cluster entry against GKE and Boskos, and refill the warm pools
+func reconcile() {
+	if err := dbClient.ClearTimeOut(requestTimeOut); err != nil {
+		log.Printf("Failed to expire the timed out requests: %v", err)
+	}
+	clusters, err := listClustersToReconcile()
+	if err != nil {
+		log.Printf("Failed to list the clusters to reconcile: %v", err)
+	} else {
+		for i := range clusters {
+			reconcileCluster(&clusters[i])
+		}
+	}
+	for _, cp := range warmPools() {
+		go checkPoolCap(cp)
+	}
+}
+
+// list the cluster entries, except the ones being provisioned by this process
+func listClustersToReconcile() ([]clerk.Cluster, error) {
+	provisioningLock.Lock()
+	defer provisioningLock.Unlock()
+	clusters, err := dbClient.ListClusters()
+	if err != nil {
+		return nil, err
+	}
+	var result []clerk.Cluster
+	for _, c := range clusters {
+		if !provisioning[c.ID] {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+// get the ClusterParams of the pools to keep warm: the default ones, and the ones of the pending requests
+func warmPools() []*clerk.ClusterParams {
+	cps := []*clerk.ClusterParams{&DefaultClusterParams}
+	seen := map[clerk.ClusterParams]bool{DefaultClusterParams: true}
+	requests, err := dbClient.ListRequests(requestTimeOut)
+	if err != nil {
+		log.Printf("Failed to list the pending requests: %v", err)
+		return cps
+	}
+	for _, r := range requests {
+		if r.ClusterID != 0 {
+			continue
+		}
+		cp := clerk.ClusterParams{Zone: r.Zone, Nodes: r.Nodes, NodeType: r.NodeType}
+		if !seen[cp] {
+			seen[cp] = true
+			cps = append(cps, &cp)
+		}
+	}
+	return cps
+}
+
+// check the cluster entry against the GKE cluster and the Boskos project, and resume or fail it if needed
+func reconcileCluster(c *clerk.Cluster) {
+	// the projects of the failed clusters are released already
+	if c.Status == Fail {
+		return
+	}
+	gkeCluster, err := getGKECluster(c)
+	if err != nil {
+		// keep the entry until the next reconciliation, the error can be transient
+		log.Printf("Failed to get the GKE cluster of %v: %v", c, err)
+		return
+	}
+	// the leases of the projects aren't kept alive after a restart, take them over
+	leased := true
+	if err := boskosClient.ResumeGKEProject(c.ProjectID); errors.Is(err, boskos.ErrLeaseLost) {
+		log.Printf("Lost the lease of the project of %v: %v", c, err)
+		leased = false
+	} else if err != nil {
+		// keep the entry and resume the lease in the next reconciliation, Boskos can be unavailable
+		log.Printf("Failed to resume the lease of the project of %v: %v", c, err)
+		return
+	}
+	switch clusterAction(c.Status, gkeCluster, leased) {
+	case actionKeep:
+		if gkeCluster != nil && gkeCluster.Status != "RUNNING" {
+			log.Printf("The GKE cluster of %v is %s, checking it again in the next reconciliation", c, gkeCluster.Status)
+		}
+	case actionReady:
+		log.Printf("Marking %v as ready", c)
+		if err := dbClient.UpdateCluster(c.ID, clerk.UpdateStringField(Status, Ready)); err != nil {
+			log.Printf("Failed to update the Cluster entry: %v", err)
+		}
+	case actionResume:
+		log.Printf("Resuming the creation of %v", c)
+		provisioningLock.Lock()
+		provisioning[c.ID] = true
+		provisioningLock.Unlock()
+		go provisionCluster(c.ID, c.ProjectID, c.ClusterParams)
+	case actionFail:
+		log.Printf("Marking %v as failed", c)
+		failCluster(c.ID, c.ProjectID, leased)
+	}
+}
+
+// decide the action for the cluster entry of the status, given its GKE cluster, nil if it doesn't exist,
+// and whether the lease of its project is still held
+func clusterAction(status string, gkeCluster *container.Cluster, leased bool) action {
+	if !leased {
+		// the project is being cleaned up by the Boskos janitor
+		return actionFail
+	}
+	switch status {
+	case WIP:
+		if gkeCluster == nil {
+			return actionResume
+		}
+		switch gkeCluster.Status {
+		case "RUNNING":
+			return actionReady
+		case "PROVISIONING", "RECONCILING":
+			// GKE is still creating it, check it again in the next reconciliation
+			return actionKeep
+		}
+		return actionFail
+	case Ready, InUse:
+		// only the clusters gone or broken for good are failed, GKE repairs or updates the DEGRADED
+		// and RECONCILING ones, check them again in the next reconciliation
+		if gkeCluster == nil || gkeCluster.Status == "ERROR" {
+			return actionFail
+		}
+		return actionKeep
+	}
+	return actionKeep
+}
+
+// get the GKE cluster of the cluster entry, nil if it doesn't exist
+func getGKECluster(c *clerk.Cluster) (*container.Cluster, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	gkeClusters, err := gkeClient.ListClustersInProject(ctx, c.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	for _, gkeCluster := range gkeClusters {
+		if gkeCluster.Name == DefaultClusterName && gkeCluster.Location == c.Zone {
+			return gkeCluster, nil
+		}
+	}
+	return nil, nil
+}
+
+// mark the cluster as failed, and release its project if its lease is still held
+func failCluster(clusterID int64, projectName string, release bool) {
+	if err := dbClient.UpdateCluster(clusterID, clerk.UpdateStringField(Status, Fail)); err != nil {
+		log.Printf("Failed to update the Cluster entry: %v", err)
+		return
+	}
+	if !release {
+		return
+	}
+	if err := boskosClient.ReleaseGKEProject(projectName); err != nil {
+		log.Printf("Failed to release Boskos Project: %v", err)
+	}
+}
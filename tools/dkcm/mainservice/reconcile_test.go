@@ -0,0 +1,420 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mainservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	container "google.golang.org/api/container/v1beta1"
+	boskoscommon "sigs.k8s.io/boskos/common"
+
+	"knative.dev/test-infra/pkg/clustermanager/e2e-tests/boskos"
+	boskosFake "knative.dev/test-infra/pkg/clustermanager/e2e-tests/boskos/fake"
+	"knative.dev/test-infra/pkg/clustermanager/kubetest2"
+	"knative.dev/test-infra/pkg/gke"
+	gkeFake "knative.dev/test-infra/pkg/gke/fake"
+	"knative.dev/test-infra/tools/dkcm/clerk"
+)
+
+// fakeDB is an in-memory clerk.Operations
+type fakeDB struct {
+	mutex    sync.Mutex
+	clusters []clerk.Cluster
+	requests []clerk.Request
+}
+
+var _ clerk.Operations = (*fakeDB)(nil)
+
+func sameParams(a, b *clerk.ClusterParams) bool {
+	return a.Zone == b.Zone && a.Nodes == b.Nodes && a.NodeType == b.NodeType
+}
+
+func (db *fakeDB) CheckAvail(cp *clerk.ClusterParams) (bool, int64) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	for _, c := range db.clusters {
+		if c.Status == Ready && sameParams(c.ClusterParams, cp) {
+			return true, c.ID
+		}
+	}
+	return false, 0
+}
+
+func (db *fakeDB) CheckNumStatus(cp *clerk.ClusterParams, status string) int64 {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	var num int64
+	for _, c := range db.clusters {
+		if c.Status == status && sameParams(c.ClusterParams, cp) {
+			num++
+		}
+	}
+	return num
+}
+
+func (db *fakeDB) GetCluster(clusterID int64) (*clerk.Response, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	for _, c := range db.clusters {
+		if c.ID == clusterID {
+			return &clerk.Response{ProjectID: c.ProjectID, Zone: c.Zone}, nil
+		}
+	}
+	return nil, fmt.Errorf("cluster %d not found", clusterID)
+}
+
+func (db *fakeDB) DeleteCluster(clusterID int64) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	for i, c := range db.clusters {
+		if c.ID == clusterID {
+			db.clusters = append(db.clusters[:i], db.clusters[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("cluster %d not found", clusterID)
+}
+
+func (db *fakeDB) InsertCluster(c *clerk.Cluster) (int64, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	cp := *c.ClusterParams
+	cp.ID = int64(len(db.clusters) + 1)
+	db.clusters = append(db.clusters, clerk.Cluster{ClusterParams: &cp, ProjectID: c.ProjectID, Status: c.Status})
+	return cp.ID, nil
+}
+
+// UpdateCluster only supports updating the status
+func (db *fakeDB) UpdateCluster(clusterID int64, opts ...clerk.UpdateOption) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	for i := range db.clusters {
+		if db.clusters[i].ID != clusterID {
+			continue
+		}
+		for _, opt := range opts {
+			prefix := Status + " = "
+			if update := opt(); strings.HasPrefix(update, prefix) {
+				db.clusters[i].Status = strings.Trim(strings.TrimPrefix(update, prefix), "'")
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("cluster %d not found", clusterID)
+}
+
+func (db *fakeDB) ListClusters() ([]clerk.Cluster, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return append([]clerk.Cluster{}, db.clusters...), nil
+}
+
+func (db *fakeDB) GetRequest(accessToken string) (*clerk.Request, error) {
+	return nil, errors.New("requests aren't looked up by token")
+}
+
+func (db *fakeDB) InsertRequest(r *clerk.Request) (string, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.requests = append(db.requests, *r)
+	return fmt.Sprintf("token-%d", len(db.requests)), nil
+}
+
+func (db *fakeDB) UpdateRequest(requestID int64, opts ...clerk.UpdateOption) error {
+	return nil
+}
+
+func (db *fakeDB) ListRequests(window time.Duration) ([]clerk.Request, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return append([]clerk.Request{}, db.requests...), nil
+}
+
+func (db *fakeDB) PriorityRanking(r *clerk.Request) int64 {
+	return 1
+}
+
+func (db *fakeDB) ClearTimeOut(timeOut time.Duration) error {
+	return nil
+}
+
+// status returns the status of the cluster entry
+func (db *fakeDB) status(clusterID int64) string {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	for _, c := range db.clusters {
+		if c.ID == clusterID {
+			return c.Status
+		}
+	}
+	return ""
+}
+
+// unavailableBoskos fails to resume the leases as if Boskos was unavailable
+type unavailableBoskos struct {
+	*boskosFake.FakeBoskosClient
+}
+
+func (c *unavailableBoskos) ResumeGKEProject(name string) error {
+	return errors.New("status 503 Service Unavailable, status code 503 updating " + name)
+}
+
+// fakeKubetest2 creates the clusters with the fake GKE client, and records the projects they are created in
+type fakeKubetest2 struct {
+	fgsc     *gkeFake.GKESDKClient
+	mutex    sync.Mutex
+	projects []string
+}
+
+func (k *fakeKubetest2) run(opts *kubetest2.Options, cc *kubetest2.GKEClusterConfig) error {
+	k.mutex.Lock()
+	k.projects = append(k.projects, cc.GCPProjectID)
+	k.mutex.Unlock()
+	rb, err := gke.NewCreateClusterRequest(&gke.Request{
+		ClusterName: cc.Name, MinNodes: int64(cc.MinNodes), MaxNodes: int64(cc.MaxNodes), NodeType: cc.Machine,
+	})
+	if err != nil {
+		return err
+	}
+	return k.fgsc.CreateCluster(context.Background(), cc.GCPProjectID, cc.Region, "", rb)
+}
+
+func (k *fakeKubetest2) getProjects() []string {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return append([]string{}, k.projects...)
+}
+
+// setupFakes replaces the clients with fakes until the test is done
+func setupFakes(t *testing.T) (*fakeDB, *boskosFake.FakeBoskosClient, *gkeFake.GKESDKClient, *fakeKubetest2) {
+	oldDB, oldBoskos, oldGKE, oldRun, oldTypes := dbClient, boskosClient, gkeClient, runKubetest2, boskosResourceTypes
+	t.Cleanup(func() {
+		dbClient, boskosClient, gkeClient, runKubetest2, boskosResourceTypes = oldDB, oldBoskos, oldGKE, oldRun, oldTypes
+	})
+	db := &fakeDB{}
+	fbc := &boskosFake.FakeBoskosClient{}
+	fgsc := gkeFake.NewGKESDKClient()
+	k := &fakeKubetest2{fgsc: fgsc}
+	dbClient, boskosClient, gkeClient, runKubetest2 = db, fbc, fgsc, k.run
+	boskosResourceTypes = []string{boskos.GKEProjectResource}
+	return db, fbc, fgsc, k
+}
+
+// createGKECluster creates the GKE cluster of a cluster entry in the project with the status
+func createGKECluster(t *testing.T, k *fakeKubetest2, project, status string) {
+	cc := &kubetest2.GKEClusterConfig{
+		GCPProjectID: project, Name: DefaultClusterName, Region: DefaultZone,
+		MinNodes: DefaultNodesCount, MaxNodes: DefaultNodesCount, Machine: DefaultNodeType,
+	}
+	if err := k.run(&kubetest2.Options{}, cc); err != nil {
+		t.Fatalf("Failed creating the GKE cluster: %v", err)
+	}
+	fgsc := k.fgsc
+	cluster, err := fgsc.GetCluster(context.Background(), project, DefaultZone, "", DefaultClusterName)
+	if err != nil {
+		t.Fatalf("Failed getting the GKE cluster: %v", err)
+	}
+	cluster.Status = status
+}
+
+// waitFor waits until the condition is met, or fails the test
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClusterAction(t *testing.T) {
+	gkeCluster := func(status string) *container.Cluster {
+		return &container.Cluster{Name: DefaultClusterName, Status: status}
+	}
+	cases := []struct {
+		name       string
+		status     string
+		gkeCluster *container.Cluster
+		leased     bool
+		want       action
+	}{
+		{"creation interrupted before the cluster exists", WIP, nil, true, actionResume},
+		{"creation finished after the interruption", WIP, gkeCluster("RUNNING"), true, actionReady},
+		{"creation still in progress", WIP, gkeCluster("PROVISIONING"), true, actionKeep},
+		{"creation failed", WIP, gkeCluster("ERROR"), true, actionFail},
+		{"lease of the project lost during creation", WIP, nil, false, actionFail},
+		{"ready cluster running", Ready, gkeCluster("RUNNING"), true, actionKeep},
+		{"ready cluster gone", Ready, nil, true, actionFail},
+		{"ready cluster degraded", Ready, gkeCluster("DEGRADED"), true, actionKeep},
+		{"ready cluster errored", Ready, gkeCluster("ERROR"), true, actionFail},
+		{"lease of the project of the ready cluster lost", Ready, gkeCluster("RUNNING"), false, actionFail},
+		{"cluster in use being updated", InUse, gkeCluster("RECONCILING"), true, actionKeep},
+		{"cluster in use gone", InUse, nil, true, actionFail},
+		{"cluster in use degraded", InUse, gkeCluster("DEGRADED"), true, actionKeep},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clusterAction(tt.status, tt.gkeCluster, tt.leased); got != tt.want {
+				t.Errorf("Expected action %d, but got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPoolLock(t *testing.T) {
+	cp := clerk.NewClusterParams(clerk.AddZone(DefaultZone), clerk.AddNodes(DefaultNodesCount), clerk.AddNodeType(DefaultNodeType))
+	cp.ID = 1
+	lock := poolLock(cp)
+	if got := poolLock(&DefaultClusterParams); got != lock {
+		t.Error("Expected the same lock for the same ClusterParams of different IDs, but got a different one")
+	}
+	// the pool of other ClusterParams can be checked while this pool is being checked
+	lock <- struct{}{}
+	defer func() { <-lock }()
+	other := poolLock(clerk.NewClusterParams(clerk.AddZone(DefaultZone), clerk.AddNodes(1), clerk.AddNodeType(DefaultNodeType)))
+	select {
+	case other <- struct{}{}:
+		<-other
+	default:
+		t.Error("Expected the pool of other ClusterParams not to be locked, but it was")
+	}
+}
+
+func TestReconcileResumesCreation(t *testing.T) {
+	db, fbc, _, k := setupFakes(t)
+	fbc.NewGKEProject("project-0")
+	if _, err := fbc.AcquireGKEProject(boskos.GKEProjectResource); err != nil {
+		t.Fatalf("Failed acquiring the project: %v", err)
+	}
+	cp := DefaultClusterParams
+	clusterID, _ := db.InsertCluster(&clerk.Cluster{ClusterParams: &cp, ProjectID: "project-0", Status: WIP})
+	clusters, _ := db.ListClusters()
+
+	// the creation was interrupted before the GKE cluster was created
+	reconcileCluster(&clusters[0])
+	waitFor(t, "the cluster to be ready", func() bool { return db.status(clusterID) == Ready })
+	if got := k.getProjects(); len(got) != 1 || got[0] != "project-0" {
+		t.Errorf("Expected the cluster to be created in project-0, but got %v", got)
+	}
+	if !fbc.Heartbeating("project-0") {
+		t.Error("Expected the lease of the project to be resumed, but it wasn't")
+	}
+}
+
+func TestReconcileFailsClusters(t *testing.T) {
+	cases := []struct {
+		name string
+		// status is the status of the cluster entry
+		status string
+		// gkeStatus is the status of the GKE cluster, which doesn't exist if it's empty
+		gkeStatus string
+		// lost is whether the lease of the project is lost, i.e. the project was reclaimed to be cleaned up
+		lost bool
+		// unavailable is whether Boskos is unavailable
+		unavailable bool
+		wantStatus  string
+		// wantState is the state of the project, it's released to "free" by the fake Boskos client
+		wantState string
+	}{
+		{name: "ready cluster gone", status: Ready, wantStatus: Fail, wantState: boskoscommon.Free},
+		{name: "ready cluster errored", status: Ready, gkeStatus: "ERROR", wantStatus: Fail, wantState: boskoscommon.Free},
+		{name: "ready cluster degraded", status: Ready, gkeStatus: "DEGRADED", wantStatus: Ready, wantState: boskoscommon.Busy},
+		{name: "cluster in use reconciling", status: InUse, gkeStatus: "RECONCILING", wantStatus: InUse, wantState: boskoscommon.Busy},
+		{name: "lease of the project lost", status: Ready, gkeStatus: "RUNNING", lost: true, wantStatus: Fail, wantState: boskoscommon.Dirty},
+		{name: "boskos unavailable", status: InUse, unavailable: true, wantStatus: InUse, wantState: boskoscommon.Busy},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fbc, _, k := setupFakes(t)
+			fbc.NewGKEProject("project-0")
+			if _, err := fbc.AcquireGKEProject(boskos.GKEProjectResource); err != nil {
+				t.Fatalf("Failed acquiring the project: %v", err)
+			}
+			if tt.lost {
+				if err := fbc.ReleaseGKEProjectToState("project-0", boskoscommon.Dirty); err != nil {
+					t.Fatalf("Failed releasing the project: %v", err)
+				}
+			}
+			if tt.unavailable {
+				boskosClient = &unavailableBoskos{fbc}
+			}
+			if tt.gkeStatus != "" {
+				createGKECluster(t, k, "project-0", tt.gkeStatus)
+			}
+			cp := DefaultClusterParams
+			clusterID, _ := db.InsertCluster(&clerk.Cluster{ClusterParams: &cp, ProjectID: "project-0", Status: tt.status})
+			clusters, _ := db.ListClusters()
+
+			reconcileCluster(&clusters[0])
+			if got := db.status(clusterID); got != tt.wantStatus {
+				t.Errorf("Expected the cluster to be %q, but got %q", tt.wantStatus, got)
+			}
+			if got := fbc.GetResources()[0].State; got != tt.wantState {
+				t.Errorf("Expected the project to be %q, but got %q", tt.wantState, got)
+			}
+		})
+	}
+}
+
+func TestReconcileRefillsWarmPools(t *testing.T) {
+	db, fbc, _, k := setupFakes(t)
+	for i := 0; i < 2*DefaultOverProvision; i++ {
+		fbc.NewGKEProject(fmt.Sprintf("project-%d", i))
+	}
+	// the pool of the pending request is kept warm too
+	other := clerk.NewClusterParams(clerk.AddZone(DefaultZone), clerk.AddNodes(1), clerk.AddNodeType(DefaultNodeType))
+	r := clerk.NewRequest(clerk.AddProwJobID("job"), clerk.AddRequestTime(time.Now()))
+	r.ClusterParams = other
+	db.InsertRequest(r)
+
+	reconcile()
+	waitFor(t, "the warm pools to be refilled", func() bool {
+		return db.CheckNumStatus(&DefaultClusterParams, Ready) == DefaultOverProvision &&
+			db.CheckNumStatus(other, Ready) == DefaultOverProvision
+	})
+	if got := len(k.getProjects()); got != 2*DefaultOverProvision {
+		t.Errorf("Expected %d clusters to be created, but got %d", 2*DefaultOverProvision, got)
+	}
+	for _, res := range fbc.GetResources() {
+		if res.State != boskoscommon.Busy {
+			t.Errorf("Expected the project %q to be acquired, but it's %q", res.Name, res.State)
+		}
+	}
+	// the pools are full, nothing is created anymore
+	waitFor(t, "the provisioning to be done", func() bool {
+		provisioningLock.Lock()
+		defer provisioningLock.Unlock()
+		return len(provisioning) == 0
+	})
+	for _, cp := range warmPools() {
+		// wait for the check of the pool to be done, then check it again
+		lock := poolLock(cp)
+		lock <- struct{}{}
+		<-lock
+		checkPoolCap(cp)
+	}
+	if got := len(k.getProjects()); got != 2*DefaultOverProvision {
+		t.Errorf("Expected no more clusters to be created, but got %d", got-2*DefaultOverProvision)
+	}
+}
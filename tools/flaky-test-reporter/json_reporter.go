@@ -43,7 +43,7 @@ func getFlakyTestSet(repoDataAll []RepoData) map[string]map[string]bool {
 }
 
 func writeFlakyTestsToJSON(repoDataAll []RepoData, dryrun bool) error {
-	client := &jsonreport.JSONClient{}
+	client := jsonreport.NewJSONClient(nil)
 	var allErrs []error
 	flakyTestSets := getFlakyTestSet(repoDataAll)
 	ch := make(chan bool, len(flakyTestSets))
@@ -17,6 +17,7 @@ limitations under the License.
 package jsonreport
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -49,14 +50,26 @@ type Client interface {
 	GetFlakyTestReport(jobName, repo string, buildID int) ([]Report, error)
 }
 
-// Client is simply a way to call methods, it does not contain any data itself
-type JSONClient struct{}
+// JSONClient reads the reports from the builds of a prow client
+type JSONClient struct {
+	prow *prow.Client
+}
 
 var _ Client = (*JSONClient)(nil)
 
-// Initialize wraps prow's init, which must be called before any other prow functions are used.
+// Initialize creates a Client reading the reports from the knative-prow GCS bucket.
 func Initialize(serviceAccount string) (Client, error) {
-	return &JSONClient{}, prow.Initialize(serviceAccount)
+	prowClient, err := prow.NewGCSClient(context.Background(), serviceAccount)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONClient(prowClient), nil
+}
+
+// NewJSONClient creates a JSONClient reading the reports with the given prow client,
+// which can be nil if only CreateReport is used.
+func NewJSONClient(prowClient *prow.Client) *JSONClient {
+	return &JSONClient{prow: prowClient}
 }
 
 // CreateReport generates a flaky report for a given repository, and optionally
@@ -118,7 +131,10 @@ func (c *JSONClient) GetFlakyTestReport(jobName, repo string, buildID int) ([]Re
 	if jobName == "" {
 		jobName = defaultJobName
 	}
-	job := prow.NewJob(jobName, prow.PeriodicJob, "", "", 0)
+	if c.prow == nil {
+		return nil, fmt.Errorf("no prow client configured for reading reports of job '%s'", jobName)
+	}
+	job := c.prow.NewJob(jobName, prow.PeriodicJob, "", "", 0)
 	var err error
 	if buildID == -1 {
 		buildID, err = c.getLatestValidBuild(job, repo)
@@ -21,6 +21,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -43,9 +44,12 @@ var (
 
 func main() {
 	serviceAccount := flag.String("service-account", os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"), "JSON key file for GCS service account")
+	storageURL := flag.String("storage", "gs://"+prow.BucketName, "where to read prow artifacts from, can be gs://<bucket>, file:///<dir>/<bucket> or s3://<bucket>?endpoint=<host:port>")
 	githubAccount := flag.String("github-account", "", "Token file for Github authentication")
 	slackAccount := flag.String("slack-account", "", "slack secret file for authenticating with Slack")
 	buildsCountOverride := flag.Int("build-count", 10, "count of builds to scan")
+	parallelism := flag.Int("parallelism", 16, "count of builds to read at the same time")
+	cacheDir := flag.String("cache-dir", "", "directory for caching build metadata across runs, no cache if empty")
 	skipReport := flag.Bool("skip-report", false, "skip Github and Slack report")
 	dryrun := flag.Bool("dry-run", false, "dry run switch")
 	flag.Parse()
@@ -57,20 +61,29 @@ func main() {
 		log.Printf("running in [dry run mode]")
 	}
 
-	if err := prow.Initialize(*serviceAccount); err != nil { // Explicit authenticate with gcs Client
-		log.Fatalf("Failed authenticating GCS: '%v'", err)
+	opts := []prow.ClientOption{prow.WithParallelism(*parallelism)}
+	if *cacheDir != "" {
+		cache, err := prow.NewBuildCache(*cacheDir)
+		if err != nil {
+			log.Fatalf("Failed creating cache directory '%s': '%v'", *cacheDir, err)
+		}
+		opts = append(opts, prow.WithCache(cache))
+	}
+	prowClient, err := prow.NewClientFromURL(context.Background(), *storageURL, *serviceAccount, opts...)
+	if err != nil {
+		log.Fatalf("Failed creating storage client for '%s': '%v'", *storageURL, err)
 	}
 
 	var repoDataAll []RepoData
 	// Clean up local artifacts directory, this will be used later for artifacts uploads
-	err := os.RemoveAll(prow.GetLocalArtifactsDir()) // this function returns nil if path not found
+	err = os.RemoveAll(prow.GetLocalArtifactsDir()) // this function returns nil if path not found
 	if err != nil {
 		log.Fatalf("Failed removing local artifacts directory: %v", err)
 	}
 	var jobErrs []error
 	for _, jc := range config.JobConfigs {
 		log.Printf("collecting results for job '%s' in repo '%s'\n", jc.Name, jc.Repo)
-		rd, err := collectTestResultsForRepo(jc)
+		rd, err := collectTestResultsForRepo(prowClient, jc)
 		if err != nil {
 			err = fmt.Errorf("WARNING: error collecting results for job '%s' in repo '%s': %v", jc.Name, jc.Repo, err)
 			log.Printf("%v", err)
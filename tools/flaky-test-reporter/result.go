@@ -25,7 +25,6 @@ import (
 	"log"
 	"path"
 	"path/filepath"
-	"sort"
 	"strings"
 
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -153,7 +152,7 @@ func addSuiteToRepoData(suite *junit.TestSuite, buildID int, rd *RepoData) {
 			rd.TestStats[testFullName].Passed = append(rd.TestStats[testFullName].Passed, buildID)
 		case junit.Skipped:
 			rd.TestStats[testFullName].Skipped = append(rd.TestStats[testFullName].Skipped, buildID)
-		case junit.Failed:
+		case junit.Failed, junit.Errored:
 			rd.TestStats[testFullName].Failed = append(rd.TestStats[testFullName].Failed, buildID)
 		}
 	}
@@ -214,9 +213,9 @@ func getCombinedResultsForBuild(build *prow.Build) ([]*junit.TestSuites, error)
 
 // collectTestResultsForRepo collects test results, build IDs from all builds,
 // as well as LastBuildStartTime, and stores them in RepoData
-func collectTestResultsForRepo(jc config.JobConfig) (*RepoData, error) {
+func collectTestResultsForRepo(prowClient *prow.Client, jc config.JobConfig) (*RepoData, error) {
 	rd := &RepoData{Config: jc}
-	job := prow.NewJob(jc.Name, jc.Type, jc.Org, jc.Repo, 0)
+	job := prowClient.NewJob(jc.Name, jc.Type, jc.Org, jc.Repo, 0)
 	if !job.PathExists() {
 		return rd, fmt.Errorf("job path not exist '%s'", jc.Name)
 	}
@@ -268,22 +267,13 @@ func intSliceContains(its []int, target int) bool {
 }
 
 // getLatestFinishedBuilds is an inexpensive way of listing latest finished builds, in comparing to
-// the GetLatestBuilds function from prow package, as it doesn't precompute start/finish time before sorting.
+// the GetLatestBuilds function from prow package, as it doesn't precompute start/finish time of all builds.
 // This function takes the assumption that build IDs are always incremental integers, it would fail if it doesn't
 func getLatestFinishedBuilds(job *prow.Job, count int) []prow.Build {
-	var builds []prow.Build
-	buildIDs := job.GetBuildIDs()
-	sort.Sort(sort.Reverse(sort.IntSlice(buildIDs)))
-	for _, buildID := range buildIDs {
-		if len(builds) >= count {
-			break
-		}
-		build := job.NewBuild(buildID)
-		if build.FinishTime != nil {
-			if build.StartTime == nil {
-				log.Fatalf("Failed parsing start time for finished build '%s'", build.StoragePath)
-			}
-			builds = append(builds, *build)
+	builds := job.GetLatestFinishedBuilds(count)
+	for _, build := range builds {
+		if build.StartTime == nil {
+			log.Fatalf("Failed parsing start time for finished build '%s'", build.StoragePath)
 		}
 	}
 	return builds
@@ -45,9 +45,9 @@ type HandlerClient struct {
 
 // NewHandlerClient gives us a handler where we can listen for Pubsub messages and
 // post comments on GitHub.
-func NewHandlerClient(serviceAccount, githubAccount string, dryrun bool) (*HandlerClient, error) {
+func NewHandlerClient(storageURL, serviceAccount, githubAccount string, dryrun bool) (*HandlerClient, error) {
 	ctx := context.Background()
-	if err := InitLogParser(serviceAccount); err != nil {
+	if err := InitLogParser(storageURL, serviceAccount); err != nil {
 		log.Fatalf("Failed authenticating GCS: '%v'", err)
 	}
 	githubClient, err := NewGithubClient(githubAccount, dryrun)
@@ -20,6 +20,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"path/filepath"
@@ -35,13 +36,21 @@ import (
 	"knative.dev/test-infra/tools/flaky-test-retryer/prowapi"
 )
 
-var client jsonreport.Client
+var (
+	client     jsonreport.Client
+	prowClient *prow.Client
+)
 
-// InitLogParser configures jsonreport's dependencies.
-func InitLogParser(serviceAccount string) error {
+// InitLogParser configures jsonreport's dependencies, reading prow artifacts
+// from the given storage URL.
+func InitLogParser(storageURL, serviceAccount string) error {
 	var err error
-	client, err = jsonreport.Initialize(serviceAccount)
-	return err
+	prowClient, err = prow.NewClientFromURL(context.Background(), storageURL, serviceAccount)
+	if err != nil {
+		return err
+	}
+	client = jsonreport.NewJSONClient(prowClient)
+	return nil
 }
 
 // JobData contains the message describing a job, a local cache of its failed tests,
@@ -101,7 +110,7 @@ func (jd *JobData) getFailedTests() ([]string, error) {
 	if len(jd.failedTests) > 0 {
 		return jd.failedTests, nil
 	}
-	job := prow.NewJob(jd.JobName, string(jd.JobType), jd.Refs[0].Org, jd.Refs[0].Repo, jd.Refs[0].Pulls[0].Number)
+	job := prowClient.NewJob(jd.JobName, string(jd.JobType), jd.Refs[0].Org, jd.Refs[0].Repo, jd.Refs[0].Pulls[0].Number)
 	// Check latest build instead of using jd.RunID, as there are times where
 	// devs initiated retry manually before retryer gets to it, and in this case
 	// scaning latest build can help retryer avoid initiating another retry
@@ -119,7 +128,7 @@ func (jd *JobData) getFailedTests() ([]string, error) {
 	for _, suites := range results {
 		for _, suite := range suites.Suites {
 			for _, test := range suite.TestCases {
-				if test.GetTestStatus() == junit.Failed {
+				if status := test.GetTestStatus(); status == junit.Failed || status == junit.Errored {
 					tests = append(tests, fmt.Sprintf("%s.%s", suite.Name, test.Name))
 				}
 			}
@@ -17,10 +17,15 @@ limitations under the License.
 package main
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
 
+	"knative.dev/test-infra/pkg/prow"
+	"knative.dev/test-infra/tools/flaky-test-reporter/jsonreport"
 	"knative.dev/test-infra/tools/flaky-test-reporter/jsonreport/fakejsonreport"
 	"knative.dev/test-infra/tools/flaky-test-retryer/prowapi"
 )
@@ -155,3 +160,33 @@ func testGetNonFlakyTests(t *testing.T) {
 		}
 	}
 }
+
+func TestInitLogParserWithLocalStorage(t *testing.T) {
+	root, err := ioutil.TempDir("", "retryer")
+	if err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+	defer os.RemoveAll(root)
+	jobDir := filepath.Join(root, "knative-prow", "logs", flakesRecorderJobName)
+	reportDir := filepath.Join(jobDir, "7", "artifacts", fakeRepo)
+	if err := os.MkdirAll(reportDir, 0755); err != nil {
+		t.Fatalf("cannot create directory: %v", err)
+	}
+	for p, content := range map[string]string{
+		filepath.Join(jobDir, "latest-build.txt"):    "7",
+		filepath.Join(reportDir, "flaky-tests.json"): `{"repo": "fakerepo", "flaky": ["test0", "test1"]}`,
+	} {
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("cannot write file: %v", err)
+		}
+	}
+
+	defer func(c jsonreport.Client, pc *prow.Client) { client, prowClient = c, pc }(client, prowClient)
+	if err := InitLogParser("file://"+filepath.ToSlash(filepath.Join(root, "knative-prow")), ""); err != nil {
+		t.Fatalf("Init log parser: got err %v, want nil", err)
+	}
+	got, err := (&JobData{fakeValidMessage, time.Now(), nil, nil}).getFlakyTests()
+	if want := []string{"test0", "test1"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("Get Flaky Tests: got %v, err %v, want %v", got, err, want)
+	}
+}
@@ -24,6 +24,8 @@ import (
 	"flag"
 	"log"
 	"os"
+
+	"knative.dev/test-infra/pkg/prow"
 )
 
 const (
@@ -31,6 +33,7 @@ const (
 )
 
 type EnvFlags struct {
+	Storage        string // URL of the storage to read prow artifacts from
 	ServiceAccount string // GCP service account file path
 	GithubAccount  string // github account file path
 	Dryrun         bool   // dry run toggle
@@ -39,6 +42,7 @@ type EnvFlags struct {
 func initFlags() *EnvFlags {
 	var f EnvFlags
 	defaultServiceAccount := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	flag.StringVar(&f.Storage, "storage", "gs://"+prow.BucketName, "where to read prow artifacts from, can be gs://<bucket>, file:///<dir>/<bucket> or s3://<bucket>?endpoint=<host:port>")
 	flag.StringVar(&f.ServiceAccount, "service-account", defaultServiceAccount, "JSON key file for GCS service account")
 	flag.StringVar(&f.GithubAccount, "github-account", "", "Token file for Github authentication")
 	flag.BoolVar(&f.Dryrun, "dry-run", false, "dry run switch")
@@ -49,7 +53,7 @@ func initFlags() *EnvFlags {
 func main() {
 	flags := initFlags()
 
-	handler, err := NewHandlerClient(flags.ServiceAccount, flags.GithubAccount, flags.Dryrun)
+	handler, err := NewHandlerClient(flags.Storage, flags.ServiceAccount, flags.GithubAccount, flags.Dryrun)
 	if err != nil {
 		log.Fatalf("Coud not create handler: '%v'", err)
 	}